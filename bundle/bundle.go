@@ -0,0 +1,468 @@
+// Package bundle combines a program and the modules it imports into one
+// GoKid file that runs without them, as gokid bundle does. Functions of
+// the modules that nothing in the program can reach are left out.
+package bundle
+
+import (
+	"fmt"
+	"gokid/diagnostics"
+	"gokid/evaluator"
+	"gokid/lexer"
+	"gokid/parser"
+	"gokid/project"
+	"gokid/tokens"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Result is a bundled program
+type Result struct {
+	Source  string
+	Modules []string // the paths of the modules inlined, each before those importing it
+	Removed []string // the functions left out, as module.name
+}
+
+// module is a source file of the bundle
+type module struct {
+	path     string
+	source   string
+	program  *parser.Program
+	resolved map[*parser.Identifier]*parser.Binding
+	imports  []*imported
+	variable string // the bundle's variable holding the module
+
+	used map[string]bool // exports something in the bundle reads
+	all  bool            // whether the module is used other than as module.name, so any export may be read
+	keep map[parser.Statement]bool
+}
+
+// imported is an import statement of a module
+type imported struct {
+	stmt   *parser.ImportStatement
+	name   string  // the variable it binds
+	target *module // nil for a standard module, whose import is kept
+}
+
+// bundler loads the modules of one bundle
+type bundler struct {
+	modules map[string]*module
+	loading map[string]bool
+	order   []*module // each after the modules it imports
+	dialect string    // the #dialect of the program, which its modules must share
+	words   tokens.Dialect
+	lang    parser.LanguageVersion // the newest grammar of the modules, which the bundle is read with
+}
+
+// Bundle bundles the program in the file entry
+func Bundle(entry string) (*Result, error) {
+	path, err := filepath.Abs(entry)
+	if err != nil {
+		return nil, err
+	}
+	b := &bundler{modules: map[string]*module{}, loading: map[string]bool{}}
+	main, err := b.load(path)
+	if err != nil {
+		return nil, err
+	}
+	b.words = lexer.NewLexer(main.source).Dialect()
+	b.name()
+	removed := b.shake(main)
+
+	var out strings.Builder
+	for _, stmt := range main.program.Statements {
+		if pragma, ok := stmt.(*parser.PragmaStatement); ok && pragma.Name != "lang" {
+			if pragma.Value != "" {
+				fmt.Fprintf(&out, "#%s %s\n", pragma.Name, pragma.Value)
+			} else {
+				fmt.Fprintf(&out, "#%s\n", pragma.Name)
+			}
+		}
+	}
+	if b.lang != parser.DefaultLanguage {
+		fmt.Fprintf(&out, "#lang gokid %s\n", b.lang)
+	}
+	result := &Result{Removed: removed}
+	for _, m := range b.order {
+		if m == main {
+			continue
+		}
+		result.Modules = append(result.Modules, m.path)
+		fmt.Fprintf(&out, "// %s\n%s %s = %s() {\n%s\n", filepath.Base(m.path), b.keyword(tokens.LET), m.variable,
+			b.keyword(tokens.FUNCTION), strings.TrimRight(m.text(b), "\n"))
+		var members []string
+		for _, stmt := range m.program.Statements {
+			if export, ok := stmt.(*parser.ExportStatement); ok && m.keep[stmt] && declared(export.Value) != nil {
+				name := declared(export.Value).Value
+				members = append(members, name+": "+name)
+			}
+		}
+		fmt.Fprintf(&out, "%s {%s};\n}();\n\n", b.keyword(tokens.RETURN), strings.Join(members, ", "))
+	}
+	out.WriteString(strings.TrimLeft(main.text(b), "\n"))
+	result.Source = out.String()
+
+	p := parser.New(lexer.NewLexer(result.Source))
+	p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, fmt.Errorf("the bundle does not parse: %s", p.Errors()[0])
+	}
+	return result, nil
+}
+
+// keyword returns the word the program's dialect writes a keyword with
+func (b *bundler) keyword(t tokens.TokenType) string {
+	if word, ok := b.words.Word(t); ok {
+		return word
+	}
+	word, _ := tokens.English.Word(t)
+	return word
+}
+
+// dialectOf returns the dialect a program's #dialect pragma names, or ""
+// for the default
+func dialectOf(program *parser.Program) string {
+	for _, stmt := range program.Statements {
+		if pragma, ok := stmt.(*parser.PragmaStatement); ok && pragma.Name == "dialect" {
+			if pragma.Value == "en" && lexer.DefaultDialect == nil {
+				return ""
+			}
+			return pragma.Value
+		}
+	}
+	return ""
+}
+
+// load parses the module at path and, before it, the modules it imports
+func (b *bundler) load(path string) (*module, error) {
+	if m, ok := b.modules[path]; ok {
+		return m, nil
+	}
+	if b.loading[path] {
+		return nil, fmt.Errorf("cannot bundle %s: it is part of an import cycle", path)
+	}
+	b.loading[path] = true
+	defer delete(b.loading, path)
+
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot bundle %s: %s", path, err)
+	}
+	p := parser.New(lexer.NewLexer(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, fmt.Errorf("parse errors in %s: %s", path, strings.Join(p.Errors(), "; "))
+	}
+	if _, ok := lexer.Data(string(source)); ok && len(b.loading) > 1 {
+		return nil, fmt.Errorf("cannot bundle %s: its %s section would end the code of the bundle", path, lexer.DataMarker)
+	}
+	// The bundle is one file, so it has one set of keywords
+	if len(b.loading) == 1 {
+		b.dialect = dialectOf(program)
+	} else if dialect := dialectOf(program); dialect != b.dialect {
+		return nil, fmt.Errorf("cannot bundle %s: its keywords are in a different dialect from the program's", path)
+	}
+	// Newer grammar reads older code, so the bundle takes the newest
+	if b.lang.Before(p.Language()) {
+		b.lang = p.Language()
+	}
+	m := &module{path: path, source: string(source), program: program, resolved: parser.Resolve(program),
+		used: map[string]bool{}, keep: map[parser.Statement]bool{}}
+
+	var failed error
+	parser.Walk(program, func(node parser.Node) bool {
+		if failed != nil {
+			return false
+		}
+		switch n := node.(type) {
+		case *parser.ImportStatement:
+			imp := &imported{stmt: n}
+			if failed = m.addImport(b, imp); failed == nil {
+				m.imports = append(m.imports, imp)
+			}
+		case *parser.GlobalStatement:
+			if len(b.loading) > 1 {
+				failed = fmt.Errorf("cannot bundle %s: its global statement would reach the variables of the program importing it", path)
+			}
+		}
+		return true
+	})
+	if failed != nil {
+		return nil, failed
+	}
+	b.modules[path] = m
+	b.order = append(b.order, m)
+	return m, nil
+}
+
+// addImport resolves the module imp imports from m, loading it
+func (m *module) addImport(b *bundler, imp *imported) error {
+	target := imp.stmt.Path.Value
+	if name, ok := strings.CutPrefix(target, "std/"); ok {
+		imp.name = name
+	} else {
+		path := evaluator.ResolveImport(target, m.path)
+		if project.IsURL(target) {
+			var err error
+			if path, err = project.FetchURL(target, project.LockPath(filepath.Dir(m.path))); err != nil {
+				return fmt.Errorf("cannot bundle %s: %s", target, err)
+			}
+		}
+		if evaluator.IsDataFile(path) {
+			return fmt.Errorf("cannot bundle %s: it is a data file, which only a module can be bundled in place of", target)
+		}
+		var err error
+		if imp.target, err = b.load(path); err != nil {
+			return err
+		}
+		imp.name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if imp.stmt.Alias != nil {
+		imp.name = imp.stmt.Alias.Value
+	}
+	return nil
+}
+
+// name picks a variable for each module that no program in the bundle
+// uses
+func (b *bundler) name() {
+	taken := map[string]bool{}
+	for _, m := range b.order {
+		parser.Walk(m.program, func(node parser.Node) bool {
+			if ident, ok := node.(*parser.Identifier); ok {
+				taken[ident.Value] = true
+			}
+			return true
+		})
+	}
+	for _, m := range b.order {
+		base := strings.Map(func(r rune) rune {
+			if r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' {
+				return r
+			}
+			return -1
+		}, strings.TrimSuffix(filepath.Base(m.path), filepath.Ext(m.path)))
+		m.variable = "bundled_" + base
+		for taken[m.variable] {
+			m.variable += "_"
+		}
+		taken[m.variable] = true
+	}
+}
+
+// shake works out which statements of each module to keep, starting from
+// the program and following what each kept statement uses into the
+// modules it imports, and returns the functions left out. A program that
+// calls eval may use anything, so nothing is left out of it.
+func (b *bundler) shake(main *module) []string {
+	usesEval := false
+	for _, m := range b.order {
+		parser.Walk(m.program, func(node parser.Node) bool {
+			if ident, ok := node.(*parser.Identifier); ok && m.resolved[ident] == nil {
+				usesEval = usesEval || ident.Value == "eval" || ident.Value == "evalIn"
+			}
+			return true
+		})
+	}
+	for _, m := range b.order {
+		m.all = usesEval
+	}
+
+	var removed []string
+	for i := len(b.order) - 1; i >= 0; i-- {
+		m := b.order[i]
+		candidates := map[*parser.Identifier]parser.Statement{}
+		var work []parser.Statement
+		for _, stmt := range m.program.Statements {
+			name := function(stmt)
+			exported := false
+			if export, ok := stmt.(*parser.ExportStatement); ok && declared(export.Value) != nil {
+				exported = m.exported(declared(export.Value).Value)
+			}
+			if m == main || m.all || name == nil || exported {
+				m.keep[stmt] = true
+				work = append(work, stmt)
+			} else {
+				candidates[name] = stmt
+			}
+		}
+		for len(work) > 0 {
+			stmt := work[len(work)-1]
+			work = work[:len(work)-1]
+			parser.Walk(stmt, func(node parser.Node) bool {
+				ident, ok := node.(*parser.Identifier)
+				if !ok || m.resolved[ident] == nil {
+					return true
+				}
+				if next, ok := candidates[m.resolved[ident].Decl]; ok && !m.keep[next] {
+					m.keep[next] = true
+					work = append(work, next)
+				}
+				return true
+			})
+		}
+		for name, stmt := range candidates {
+			if !m.keep[stmt] {
+				removed = append(removed, strings.TrimSuffix(filepath.Base(m.path), filepath.Ext(m.path))+"."+name.Value)
+			}
+		}
+		m.markUses()
+	}
+	sort.Strings(removed)
+	return removed
+}
+
+// markUses records the exports of imported modules the kept statements of
+// m read: those named as module.name, or all of them when the module is
+// used some other way
+func (m *module) markUses() {
+	byName := map[string]*imported{}
+	for _, imp := range m.imports {
+		if imp.target != nil {
+			byName[imp.name] = imp
+		}
+	}
+	target := func(expr parser.Expression) *module {
+		ident, ok := expr.(*parser.Identifier)
+		if !ok || byName[ident.Value] == nil {
+			return nil
+		}
+		imp := byName[ident.Value]
+		if b := m.resolved[ident]; b != nil && b.Decl != imp.stmt.Alias {
+			return nil
+		}
+		return imp.target
+	}
+	for _, stmt := range m.program.Statements {
+		if !m.keep[stmt] {
+			continue
+		}
+		parser.Walk(stmt, func(node parser.Node) bool {
+			switch n := node.(type) {
+			case *parser.ImportStatement:
+				return false
+			case *parser.DotExpression:
+				if t := target(n.Left); t != nil {
+					t.used[n.Property.Value] = true
+					return false
+				}
+			case *parser.Identifier:
+				if t := target(n); t != nil {
+					t.all = true
+				}
+			}
+			return true
+		})
+	}
+}
+
+// exported reports whether the bundle keeps m's export name
+func (m *module) exported(name string) bool {
+	return m.all || m.used[name]
+}
+
+// text returns m's source as the bundle holds it: without the statements
+// left out, pragmas or export keywords, and with each import of a bundled
+// module reading the variable holding it
+func (m *module) text(b *bundler) string {
+	var edits []diagnostics.Edit
+	for _, stmt := range m.program.Statements {
+		_, pragma := stmt.(*parser.PragmaStatement)
+		if !m.keep[stmt] || pragma {
+			edits = append(edits, removal(m.source, stmt.Range()))
+		}
+	}
+	for _, stmt := range m.program.Statements {
+		if !m.keep[stmt] {
+			continue
+		}
+		parser.Walk(stmt, func(node parser.Node) bool {
+			if export, ok := node.(*parser.ExportStatement); ok && export.Value.Range().Start > export.Range().Start {
+				span := export.Range()
+				edits = append(edits, diagnostics.Edit{Offset: span.Start, Length: export.Value.Range().Start - span.Start})
+			}
+			return true
+		})
+	}
+	for _, imp := range m.imports {
+		span := imp.stmt.Range()
+		if imp.target != nil && m.keep[topLevel(m.program, span.Start)] {
+			text := fmt.Sprintf("%s %s = %s", b.keyword(tokens.LET), imp.name, imp.target.variable)
+			if strings.HasSuffix(m.source[span.Start:span.End], ";") {
+				text += ";"
+			}
+			edits = append(edits, diagnostics.Edit{Offset: span.Start, Length: span.End - span.Start, Text: text})
+		}
+	}
+	return diagnostics.ApplyEdits(m.source, edits)
+}
+
+// removal returns the edit that deletes span, along with its line when
+// nothing else is on it and the blank line after it when one comes before
+func removal(source string, span parser.Span) diagnostics.Edit {
+	start, end := span.Start, span.End
+	lineStart := strings.LastIndexByte(source[:start], '\n') + 1
+	lineEnd := nextLine(source, end)
+	if strings.TrimSpace(source[lineStart:start]) == "" && strings.TrimSpace(source[end:lineEnd]) == "" {
+		start, end = lineStart, lineEnd
+		blankBefore := start == 0 || strings.TrimSpace(source[strings.LastIndexByte(source[:start-1], '\n')+1:start]) == ""
+		if after := nextLine(source, end); blankBefore && strings.TrimSpace(source[end:after]) == "" {
+			end = after
+		}
+	}
+	return diagnostics.Edit{Offset: start, Length: end - start}
+}
+
+// nextLine returns the offset of the line after the one offset is on, or
+// the end of source
+func nextLine(source string, offset int) int {
+	if i := strings.IndexByte(source[offset:], '\n'); i >= 0 {
+		return offset + i + 1
+	}
+	return len(source)
+}
+
+// topLevel returns the statement of program that offset is in
+func topLevel(program *parser.Program, offset int) parser.Statement {
+	for _, stmt := range program.Statements {
+		if span := stmt.Range(); span.Start <= offset && offset < span.End {
+			return stmt
+		}
+	}
+	return nil
+}
+
+// declared returns the variable a let, const or var statement declares
+func declared(stmt parser.Statement) *parser.Identifier {
+	switch s := stmt.(type) {
+	case *parser.LetStatement:
+		return s.Name
+	case *parser.ConstStatement:
+		return s.Name
+	case *parser.VarStatement:
+		return s.Name
+	}
+	return nil
+}
+
+// function returns the variable stmt declares when it declares one
+// holding a function, which can be left out if nothing calls it
+func function(stmt parser.Statement) *parser.Identifier {
+	if export, ok := stmt.(*parser.ExportStatement); ok {
+		stmt = export.Value
+	}
+	var value parser.Expression
+	switch s := stmt.(type) {
+	case *parser.LetStatement:
+		value = s.Value
+	case *parser.ConstStatement:
+		value = s.Value
+	case *parser.VarStatement:
+		value = s.Value
+	}
+	if _, ok := value.(*parser.FunctionLiteral); !ok {
+		return nil
+	}
+	return declared(stmt)
+}
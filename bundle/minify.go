@@ -0,0 +1,175 @@
+package bundle
+
+import (
+	"fmt"
+	"gokid/lexer"
+	"gokid/parser"
+	"gokid/tokenizer"
+	"gokid/tokens"
+	"strings"
+)
+
+// reflective are the builtins that look variables up by name, which a
+// program using can't have its variables renamed
+var reflective = []string{"eval", "evalIn", "locals", "defined"}
+
+// Minify returns source as small as it can be written: without comments
+// or the white space between tokens that can go, and with the variables of
+// functions, loops and catch blocks given the shortest names free. Top-level
+// variables keep their names, as do all variables of a program that looks
+// them up by name. known says whether a name is defined outside the
+// program, such as a builtin, which no variable may take.
+func Minify(source string, known func(string) bool) (string, error) {
+	program, err := parseSource(source)
+	if err != nil {
+		return "", err
+	}
+	renamed := shortNames(program, known)
+
+	var out strings.Builder
+	pieces := tokenizer.NewTokenizer(source).GetPieces()
+	var last, data string
+	for i, piece := range pieces {
+		if piece.Token.Type == tokens.EOF {
+			data = piece.Text
+			break
+		}
+		text := piece.Text
+		if name, ok := renamed[piece.Token.Offset]; ok {
+			text = name
+		}
+		if i > 0 {
+			out.WriteString(separator(last, text, piece.Token.Type, strings.Contains(piece.Trivia, "\n")))
+		}
+		out.WriteString(text)
+		last = text
+	}
+	out.WriteString("\n")
+	out.WriteString(data)
+
+	if _, err := parseSource(out.String()); err != nil {
+		return "", fmt.Errorf("the minified program does not parse: %s", err)
+	}
+	return out.String(), nil
+}
+
+// parseSource parses source, which must be free of syntax errors
+func parseSource(source string) (*parser.Program, error) {
+	p := parser.New(lexer.NewLexer(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, fmt.Errorf("%s", p.Errors()[0])
+	}
+	return program, nil
+}
+
+// shortNames picks a short name for each variable of program that isn't a
+// top-level one, returning the text to put at the offset of each
+// identifier naming one
+func shortNames(program *parser.Program, known func(string) bool) map[int]string {
+	resolved := parser.Resolve(program)
+	taken := map[string]bool{}
+	lookups := false
+	parser.Walk(program, func(node parser.Node) bool {
+		switch n := node.(type) {
+		case *parser.Identifier:
+			taken[n.Value] = true
+			for _, name := range reflective {
+				lookups = lookups || resolved[n] == nil && n.Value == name
+			}
+		case *parser.ImportStatement:
+			lookups = lookups || n.Path != nil && n.Path.Value == "std/reflect"
+		}
+		return true
+	})
+	if lookups {
+		return nil
+	}
+
+	// In {x} the identifier is also the key, which must stay "x"
+	shorthand := map[*parser.Identifier]bool{}
+	parser.Walk(program, func(node parser.Node) bool {
+		if object, ok := node.(*parser.ObjectLiteral); ok {
+			for _, pair := range object.Pairs {
+				k, isString := pair.Key.(*parser.StringLiteral)
+				v, isIdent := pair.Value.(*parser.Identifier)
+				if isString && isIdent && k.Token.Offset == v.Token.Offset {
+					shorthand[v] = true
+				}
+			}
+		}
+		return true
+	})
+
+	// A record type is named after its variable, and its values show the
+	// name, so the variable keeps it
+	records := map[*parser.Binding]bool{}
+	parser.Walk(program, func(node parser.Node) bool {
+		if let, ok := node.(*parser.LetStatement); ok {
+			if _, ok := let.Value.(*parser.RecordLiteral); ok && let.Name != nil {
+				records[resolved[let.Name]] = true
+			}
+		}
+		return true
+	})
+
+	names := map[*parser.Binding]string{}
+	next := 0
+	renamed := map[int]string{}
+	parser.Walk(program, func(node parser.Node) bool {
+		ident, ok := node.(*parser.Identifier)
+		b := resolved[ident]
+		if !ok || b == nil || b.Scope == program || records[b] {
+			return true
+		}
+		name, ok := names[b]
+		for !ok {
+			name = shortName(next)
+			next++
+			ok = !taken[name] && !tokens.Reserved(name) && (known == nil || !known(name))
+			names[b] = name
+		}
+		if shorthand[ident] {
+			name = ident.Value + ":" + name
+		}
+		renamed[ident.Token.Offset] = name
+		return true
+	})
+	return renamed
+}
+
+// shortName returns the n-th name of a, b, ..., Z, aa, ab, ...
+func shortName(n int) string {
+	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	name := ""
+	for {
+		name = string(letters[n%len(letters)]) + name
+		n = n/len(letters) - 1
+		if n < 0 {
+			return name
+		}
+	}
+}
+
+// separator returns what must come between two tokens for them to lex the
+// same: a line break where there was one and a statement could end there,
+// a space between tokens that would otherwise run together, or nothing.
+// A symbol right after a name, number, string or bracket would be a colon.
+func separator(before, after string, kind tokens.TokenType, newline bool) string {
+	last, first := before[len(before)-1], after[0]
+	switch {
+	case newline && !strings.ContainsRune(";{,(", rune(last)) && !strings.ContainsRune("});,]", rune(first)):
+		return "\n"
+	case word(last) && word(first),
+		'0' <= last && last <= '9' && first == '.',
+		kind == tokens.SYMBOL && (word(last) || strings.ContainsRune(`")]}`, rune(last))),
+		strings.ContainsRune("+-*/<>=!&|:.", rune(last)) && strings.ContainsRune("+-*/<>=!&|:.", rune(first)):
+		return " "
+	}
+	return ""
+}
+
+// word reports whether c can be part of a name or number
+func word(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c >= 0x80
+}
@@ -0,0 +1,179 @@
+// Package conformance runs the conformance suite: GoKid programs whose
+// output and errors are checked against golden files. Each case is a
+// name.gk program with a name.out file holding what it prints and, when
+// it must fail, a name.err file holding the error's message. Modules the
+// cases import are kept in the suite's modules directory. The suite
+// says what the language does independently of how it is run, so every
+// engine that runs GoKid, such as the tree-walking evaluator, must pass
+// it with identical results.
+package conformance
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// suite holds the cases built into gokid
+//
+//go:embed suite
+var suite embed.FS
+
+// Suite returns the cases built into gokid
+func Suite() fs.FS {
+	sub, _ := fs.Sub(suite, "suite")
+	return sub
+}
+
+// Engine runs a program, writing what it prints to out. It returns the
+// error the program failed with, if any.
+type Engine func(name, source string, out io.Writer) error
+
+// Case is one program of the suite and the results it must give
+type Case struct {
+	Name    string // file name of the program, such as strings.gk
+	Source  string
+	WantOut string
+	WantErr string // message of the error the program fails with, or ""
+}
+
+// Result is what running a case with an engine gave
+type Result struct {
+	Case   *Case
+	Out    string
+	Err    string
+	Passed bool
+}
+
+// Load reads the cases in the top directory of fsys, in name order. A
+// program without a .out file is an error, so a case can't pass by
+// having nothing to compare.
+func Load(fsys fs.FS) ([]*Case, error) {
+	return load(fsys, true)
+}
+
+// load reads the cases in fsys; without needOut, a missing .out file is
+// taken as empty
+func load(fsys fs.FS, needOut bool) ([]*Case, error) {
+	names, err := fs.Glob(fsys, "*.gk")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	cases := make([]*Case, 0, len(names))
+	for _, name := range names {
+		source, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		base := strings.TrimSuffix(name, path.Ext(name))
+		out, err := fs.ReadFile(fsys, base+".out")
+		if errors.Is(err, fs.ErrNotExist) && needOut {
+			return nil, fmt.Errorf("%s has no %s.out file with its expected output", name, base)
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		wantErr, err := fs.ReadFile(fsys, base+".err")
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		cases = append(cases, &Case{
+			Name:    name,
+			Source:  string(source),
+			WantOut: string(out),
+			WantErr: strings.TrimSpace(string(wantErr)),
+		})
+	}
+	return cases, nil
+}
+
+// Run runs c with engine and compares what it gives with the golden files
+func (c *Case) Run(engine Engine) *Result {
+	var out strings.Builder
+	r := &Result{Case: c}
+	if err := engine(c.Name, c.Source, &out); err != nil {
+		r.Err = err.Error()
+	}
+	r.Out = out.String()
+	r.Passed = r.Out == c.WantOut && r.Err == c.WantErr
+	return r
+}
+
+// Report writes how a failed result differs from its golden files
+func (r *Result) Report(w io.Writer) {
+	if r.Err != r.Case.WantErr {
+		fmt.Fprintf(w, "  error: got %s, want %s\n", describe(r.Err), describe(r.Case.WantErr))
+	}
+	if r.Out == r.Case.WantOut {
+		return
+	}
+	got := strings.Split(r.Out, "\n")
+	want := strings.Split(r.Case.WantOut, "\n")
+	for i := 0; ; i++ {
+		if i < len(got) && i < len(want) && got[i] == want[i] {
+			continue
+		}
+		fmt.Fprintf(w, "  output line %d: got %s, want %s\n", i+1, line(got, i), line(want, i))
+		return
+	}
+}
+
+// line describes line i of lines, which may be past the end
+func line(lines []string, i int) string {
+	if i >= len(lines) {
+		return "end of output"
+	}
+	return fmt.Sprintf("%q", lines[i])
+}
+
+// describe quotes an error message for a report
+func describe(message string) string {
+	if message == "" {
+		return "no error"
+	}
+	return fmt.Sprintf("%q", message)
+}
+
+// Update rewrites the golden files of the cases in dir with what engine
+// gives, for a change that alters results on purpose. It returns the
+// names of the cases whose files changed.
+func Update(dir string, engine Engine) ([]string, error) {
+	cases, err := load(os.DirFS(dir), false)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	for _, c := range cases {
+		r := c.Run(engine)
+		base := filepath.Join(dir, strings.TrimSuffix(c.Name, path.Ext(c.Name)))
+		if _, err := os.Stat(base + ".out"); r.Passed && err == nil {
+			continue
+		}
+		if err := os.WriteFile(base+".out", []byte(r.Out), 0o644); err != nil {
+			return changed, err
+		}
+		if r.Err == "" {
+			err = os.Remove(base + ".err")
+			if errors.Is(err, fs.ErrNotExist) {
+				err = nil
+			}
+		} else {
+			err = os.WriteFile(base+".err", []byte(r.Err+"\n"), 0o644)
+		}
+		if err != nil {
+			return changed, err
+		}
+		changed = append(changed, c.Name)
+	}
+	return changed, nil
+}
@@ -0,0 +1,114 @@
+// Package cover reports which statements of a GoKid file ran, from the
+// counts an interpreter collects in an evaluator.Coverage, as a summary
+// and as the file's source annotated with how often each line ran.
+package cover
+
+import (
+	"fmt"
+	"gokid/diagnostics"
+	"gokid/lexer"
+	"gokid/parser"
+	"io"
+	"strings"
+)
+
+// File is the coverage of one source file
+type File struct {
+	Path  string
+	Lines []Line
+
+	Statements int // statements in the file
+	Covered    int // statements that ran at least once
+}
+
+// Line is a line of source and the statements that start on it
+type Line struct {
+	Text       string
+	Statements int // statements starting on the line
+	Hits       int // runs of the line's first statement
+	Missed     bool
+}
+
+// Profile matches hits, the runs of each statement by source offset, to
+// the statements of source. Every statement run on its own counts,
+// including those in function bodies and blocks, but not the blocks
+// themselves.
+func Profile(path, source string, hits map[int]int) (*File, error) {
+	p := parser.New(lexer.NewLexer(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, fmt.Errorf("%s: %s", path, p.Errors()[0])
+	}
+
+	f := &File{Path: path}
+	src := diagnostics.NewSource(path, source)
+	lines := strings.Count(strings.TrimSuffix(source, "\n"), "\n") + 1
+	for number := 1; number <= lines; number++ {
+		f.Lines = append(f.Lines, Line{Text: src.Line(number)})
+	}
+
+	count := func(stmts []parser.Statement) {
+		for _, stmt := range stmts {
+			offset := parser.StatementToken(stmt).Offset
+			if offset < 0 {
+				continue
+			}
+			n := hits[offset]
+			number, _ := src.Position(offset)
+			line := &f.Lines[number-1]
+			if line.Statements == 0 {
+				line.Hits = n
+			}
+			line.Statements++
+			line.Missed = line.Missed || n == 0
+
+			f.Statements++
+			if n > 0 {
+				f.Covered++
+			}
+		}
+	}
+	parser.Walk(program, func(node parser.Node) bool {
+		switch n := node.(type) {
+		case *parser.Program:
+			count(n.Statements)
+		case *parser.BlockStatement:
+			count(n.Statements)
+		}
+		return true
+	})
+	return f, nil
+}
+
+// Percent returns the share of statements that ran, 100 for a file
+// without any
+func (f *File) Percent() float64 {
+	if f.Statements == 0 {
+		return 100
+	}
+	return 100 * float64(f.Covered) / float64(f.Statements)
+}
+
+// Summary describes the coverage of f in a line, such as
+// "calc.gokid: 85.7% of statements (12 of 14)"
+func (f *File) Summary() string {
+	return fmt.Sprintf("%s: %.1f%% of statements (%d of %d)", f.Path, f.Percent(), f.Covered, f.Statements)
+}
+
+// Annotate writes the source of f with how often each line that starts a
+// statement ran. Lines with a statement that never ran are marked with >.
+//
+//	3 | let total = add(1, 2);
+//	0 > print("unreachable");
+func (f *File) Annotate(w io.Writer) {
+	for _, line := range f.Lines {
+		switch {
+		case line.Missed:
+			fmt.Fprintf(w, "%5d > %s\n", line.Hits, line.Text)
+		case line.Statements > 0:
+			fmt.Fprintf(w, "%5d | %s\n", line.Hits, line.Text)
+		default:
+			fmt.Fprintf(w, "      | %s\n", line.Text)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+// Package crash reports failures of the interpreter itself: Go panics,
+// which are bugs in gokid rather than in the programs it runs. A report
+// holds the program, where it was and the Go stack, and Minimize shrinks
+// the program to a small one that fails the same way, for filing the bug.
+package crash
+
+import (
+	"fmt"
+	"gokid/diagnostics"
+	"gokid/evaluator"
+	"gokid/project"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IssuesURL is where gokid's bugs are filed
+const IssuesURL = "https://github.com/xspoilt-dev/gokid/issues"
+
+// Minimizing makes Recover shrink the program before saving the report,
+// which runs it many times, for up to MinimizeTime
+var Minimizing bool
+
+// MinimizeTime is how long Recover spends shrinking a program
+var MinimizeTime = 30 * time.Second
+
+// Report describes a panic of the interpreter
+type Report struct {
+	Time    time.Time
+	Version string
+	Args    []string // the command line
+	Panic   string   // the value panicked with
+	Origin  string   // the Go function that panicked
+
+	Path   string // the program's file, or <repl> for a REPL line
+	Source string
+	// Where the statement running when it panicked starts, in File; a
+	// zero Line when none had run yet, as for a panic in the parser
+	File         string
+	Line, Column int
+
+	Stack string // the Go stack of the panic
+	Repro string // the minimized program, "" when it wasn't minimized
+}
+
+// watched is the program the interpreter is running, for the report
+var watched struct {
+	sync.Mutex
+	path, source string
+	env          *evaluator.Environment
+}
+
+// Watch records the program about to run, and the interpreter running it
+// once there is one, so a report of a panic can include them
+func Watch(path, source string, env *evaluator.Environment) {
+	watched.Lock()
+	defer watched.Unlock()
+	watched.path, watched.source, watched.env = path, source, env
+}
+
+// Recover, deferred by main, turns a panic of the goroutine it returns to
+// into a crash report instead of a Go stack trace. It saves the report,
+// tells the user where, and exits with evaluator.ExitUncaught. Panics of
+// other goroutines, such as HTTP handlers, still end the process as Go
+// does.
+func Recover() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	report := newReport(r, origin())
+	fmt.Fprintf(os.Stderr, "gokid crashed: %s\n", report.Panic)
+	fmt.Fprintln(os.Stderr, "This is a bug in gokid, not in your program.")
+	if Minimizing && report.Source != "" {
+		fmt.Fprintf(os.Stderr, "Minimizing the program, for up to %s...\n", MinimizeTime)
+		if repro, ok := Minimize(report.Path, report.Source, MinimizeTime); ok {
+			report.Repro = repro
+		}
+	}
+	path, err := report.Save(Dir())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "The crash report could not be saved: %v\n\n%s", err, report)
+	} else {
+		fmt.Fprintf(os.Stderr, "The crash report is in %s.\nPlease attach it to an issue at %s\n", path, IssuesURL)
+	}
+	os.Exit(evaluator.ExitUncaught)
+}
+
+// newReport describes the panic with value r, raised by the function
+// origin, and the program Watch recorded. Called while the panic unwinds,
+// it takes the stack of the panic.
+func newReport(r any, origin string) *Report {
+	report := &Report{
+		Time:    time.Now(),
+		Version: evaluator.Version,
+		Args:    os.Args,
+		Panic:   fmt.Sprint(r),
+		Origin:  origin,
+		Stack:   string(debug.Stack()),
+	}
+	if info := evaluator.Build(); info.Commit != "" {
+		report.Version += " (" + info.Commit + ")"
+	}
+
+	watched.Lock()
+	report.Path, report.Source = watched.path, watched.source
+	env := watched.env
+	watched.Unlock()
+	if env == nil {
+		return report
+	}
+	pos, ok := env.Running()
+	if !ok {
+		return report
+	}
+	// The statement may be in a module the program imports
+	report.File, report.Line = report.Path, pos.Line
+	source := report.Source
+	if pos.Path != "" && pos.Path != report.Path {
+		report.File = pos.Path
+		data, _ := os.ReadFile(pos.Path)
+		source = string(data)
+	}
+	if pos.Offset <= len(source) {
+		report.Line, report.Column = diagnostics.NewSource(report.File, source).Position(pos.Offset)
+	}
+	return report
+}
+
+// String writes the report as the text of a crash report file
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "gokid crash report\n\n")
+	fmt.Fprintf(&b, "time:    %s\n", r.Time.Format(time.RFC3339))
+	fmt.Fprintf(&b, "version: %s\n", r.Version)
+	fmt.Fprintf(&b, "go:      %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&b, "command: %s\n", strings.Join(r.Args, " "))
+	fmt.Fprintf(&b, "panic:   %s\n", r.Panic)
+	if r.Origin != "" {
+		fmt.Fprintf(&b, "in:      %s\n", r.Origin)
+	}
+	switch {
+	case r.Line > 0:
+		fmt.Fprintf(&b, "running: the statement at %s:%d:%d\n", r.File, r.Line, r.Column)
+	case r.Source != "":
+		fmt.Fprintf(&b, "running: nothing yet; the program had not started\n")
+	}
+	if r.Repro != "" {
+		fmt.Fprintf(&b, "\n--- minimized program, which fails the same way ---\n%s", withNewline(r.Repro))
+	}
+	if r.Source != "" {
+		fmt.Fprintf(&b, "\n--- program %s ---\n%s", r.Path, withNewline(r.Source))
+	}
+	fmt.Fprintf(&b, "\n--- Go stack ---\n%s", withNewline(r.Stack))
+	return b.String()
+}
+
+func withNewline(s string) string {
+	if strings.HasSuffix(s, "\n") {
+		return s
+	}
+	return s + "\n"
+}
+
+// Save writes the report to a new file in dir and returns its path
+func (r *Report) Save(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(dir, "crash-"+r.Time.Format("20060102-150405")+"-*.txt")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(r.String()); err != nil {
+		f.Close()
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+// Dir returns the directory crash reports are saved in:
+// $GOKID_CRASH_DIR, or crashes in gokid's cache directory
+func Dir() string {
+	if dir := os.Getenv("GOKID_CRASH_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(project.CacheDir(), "crashes")
+}
+
+// origin returns the Go function that panicked. Called by a deferred
+// function while the panic unwinds, it finds it on the stack below the
+// runtime's frames and this package's.
+func origin() string {
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(1, pcs)])
+	for {
+		frame, more := frames.Next()
+		if frame.Function != "" && !strings.HasPrefix(frame.Function, "runtime.") && !strings.HasPrefix(frame.Function, "gokid/crash.") {
+			return frame.Function
+		}
+		if !more {
+			return ""
+		}
+	}
+}
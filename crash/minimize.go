@@ -0,0 +1,118 @@
+package crash
+
+import (
+	"fmt"
+	"gokid/evaluator"
+	"gokid/lexer"
+	"gokid/tokens"
+	"io"
+	"strings"
+	"time"
+)
+
+// attemptTime is how long one run of a smaller program may take before
+// it counts as not failing, since taking code out can make a loop endless
+const attemptTime = 2 * time.Second
+
+// Minimize shrinks source, the program in the file path, to a smaller
+// program that makes the interpreter panic in the same Go function. It
+// takes out lines, then tokens, while the program still fails that way,
+// for up to budget. It reports false when source doesn't make the
+// interpreter panic.
+//
+// The programs are run in this process, with no output or input and with
+// loops limited, so taking out code can't make them hang the minimizer.
+// A program left running after attemptTime keeps running in the
+// background.
+func Minimize(path, source string, budget time.Duration) (string, bool) {
+	m := &minimizer{path: path, until: time.Now().Add(budget)}
+	if m.want = m.panics(source); m.want == "" {
+		return source, false
+	}
+	// Taking out tokens can let lines go that couldn't before, such as
+	// the two ends of a block
+	for {
+		shrunk := strings.Join(m.shrink(strings.SplitAfter(source, "\n")), "")
+		shrunk = strings.Join(m.shrink(tokenPieces(shrunk)), "")
+		if len(shrunk) == len(source) || time.Now().After(m.until) {
+			return shrunk, true
+		}
+		source = shrunk
+	}
+}
+
+// minimizer shrinks a program that panics the interpreter
+type minimizer struct {
+	path  string
+	want  string // how the program panics, as panics describes it
+	until time.Time
+}
+
+// shrink takes out runs of pieces, halving their length down to single
+// pieces, as long as the program they make still panics the same way
+func (m *minimizer) shrink(pieces []string) []string {
+	for size := len(pieces) / 2; size >= 1 && time.Now().Before(m.until); {
+		removed := false
+		for i := 0; i+size <= len(pieces) && time.Now().Before(m.until); {
+			candidate := append(append([]string{}, pieces[:i]...), pieces[i+size:]...)
+			if m.panics(strings.Join(candidate, "")) == m.want {
+				pieces, removed = candidate, true
+			} else {
+				i += size
+			}
+		}
+		if !removed {
+			size /= 2
+		}
+	}
+	return pieces
+}
+
+// panics runs source and describes how it panics the interpreter, as the
+// Go function that panicked and the type of the value, or returns "" when
+// it doesn't
+func (m *minimizer) panics(source string) string {
+	done := make(chan string, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Sprintf("%s %T", origin(), r)
+			}
+		}()
+		env := evaluator.NewEnvironment()
+		env.SetPath(m.path)
+		env.SetOutput(io.Discard, io.Discard)
+		env.SetInput(strings.NewReader(""))
+		env.SetLoopGuard(100000, attemptTime)
+		evaluator.Run(env, source)
+		done <- ""
+	}()
+	select {
+	case description := <-done:
+		return description
+	case <-time.After(attemptTime):
+		return ""
+	}
+}
+
+// tokenPieces splits source into its tokens, each with the space and
+// comments after it
+func tokenPieces(source string) []string {
+	l := lexer.NewLexer(source)
+	var starts []int
+	for tok := l.NextToken(); tok.Type != tokens.EOF; tok = l.NextToken() {
+		starts = append(starts, tok.Offset)
+	}
+	if len(starts) == 0 {
+		return []string{source}
+	}
+	pieces := []string{source[:starts[0]]}
+	for i, start := range starts {
+		end := len(source)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		pieces = append(pieces, source[start:end])
+	}
+	return pieces
+}
@@ -0,0 +1,299 @@
+package diagnostics
+
+import (
+	"encoding/json"
+	"fmt"
+	"gokid/messages"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Severity of a diagnostic
+type Severity string
+
+const (
+	Error   Severity = "error"
+	Warning Severity = "warning"
+	Note    Severity = "note"
+)
+
+// Diagnostic is a message about a location in a source file
+type Diagnostic struct {
+	Severity Severity
+	Message  string
+	Offset   int    // byte offset in the source, -1 if unknown
+	Length   int    // bytes to underline
+	Code     string // error code such as E_DIV_ZERO, if any
+	Fix      *Fix   // change that resolves the diagnostic, if there is a safe one
+}
+
+// List collects diagnostics emitted by the parser, evaluator and tools
+type List struct {
+	items []Diagnostic
+}
+
+// Add records a diagnostic
+func (l *List) Add(d Diagnostic) {
+	l.items = append(l.items, d)
+}
+
+// Errorf records an error at offset
+func (l *List) Errorf(offset, length int, format string, args ...interface{}) {
+	l.Add(Diagnostic{Severity: Error, Message: fmt.Sprintf(format, args...), Offset: offset, Length: length})
+}
+
+// Warnf records a warning at offset
+func (l *List) Warnf(offset, length int, format string, args ...interface{}) {
+	l.Add(Diagnostic{Severity: Warning, Message: fmt.Sprintf(format, args...), Offset: offset, Length: length})
+}
+
+// Items returns the diagnostics in the order they were recorded
+func (l *List) Items() []Diagnostic {
+	return l.items
+}
+
+// Sort orders the diagnostics by source position
+func (l *List) Sort() {
+	sort.SliceStable(l.items, func(i, j int) bool { return l.items[i].Offset < l.items[j].Offset })
+}
+
+// HasErrors reports whether any diagnostic is an error
+func (l *List) HasErrors() bool {
+	for _, d := range l.items {
+		if d.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+// Source is a named source text that resolves offsets to lines and columns
+type Source struct {
+	Name  string
+	Text  string
+	lines []int // offset of the start of each line
+}
+
+// NewSource indexes text for position lookups
+func NewSource(name, text string) *Source {
+	lines := []int{0}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
+	return &Source{Name: name, Text: text, lines: lines}
+}
+
+// Position returns the 1-based line and column (in characters) of offset
+func (s *Source) Position(offset int) (int, int) {
+	if offset > len(s.Text) {
+		offset = len(s.Text)
+	}
+	line := sort.Search(len(s.lines), func(i int) bool { return s.lines[i] > offset }) - 1
+	column := utf8.RuneCountInString(s.Text[s.lines[line]:offset]) + 1
+	return line + 1, column
+}
+
+// Offset returns the offset of a 1-based line and column, the reverse of
+// Position. It returns -1 when the source has no such line.
+func (s *Source) Offset(line, column int) int {
+	if line < 1 || line > len(s.lines) {
+		return -1
+	}
+	offset := s.lines[line-1]
+	for ; column > 1 && offset < len(s.Text) && s.Text[offset] != '\n'; column-- {
+		_, size := utf8.DecodeRuneInString(s.Text[offset:])
+		offset += size
+	}
+	return offset
+}
+
+// Line returns the text of a 1-based line without its newline
+func (s *Source) Line(n int) string {
+	start := s.lines[n-1]
+	end := len(s.Text)
+	if n < len(s.lines) {
+		end = s.lines[n] - 1
+	}
+	return strings.TrimSuffix(s.Text[start:end], "\r")
+}
+
+const (
+	colorReset = "\033[0m"
+	colorBold  = "\033[1m"
+	colorBlue  = "\033[1;34m"
+)
+
+var severityColors = map[Severity]string{
+	Error:   "\033[1;31m",
+	Warning: "\033[1;33m",
+	Note:    "\033[1;36m",
+}
+
+// Plain makes Render write diagnostics as sentences, without color,
+// arrows or carets, for screen readers. It is set by gokid --plain.
+var Plain bool
+
+// Render writes each diagnostic as a message followed by the source line
+// it points at, with the location underlined:
+//
+//	error: expected next token to be ), got ; instead
+//	 --> hello.gokid:3:15
+//	  |
+//	3 | let x = (1 + 2;
+//	  |               ^
+//
+// When Plain is set the location is said in words instead:
+//
+//	error: expected next token to be ), got ; instead
+//	  at hello.gokid line 3, column 15: let x = (1 + 2;
+func Render(w io.Writer, src *Source, diags []Diagnostic, color bool) {
+	if Plain {
+		renderPlain(w, src, diags)
+		return
+	}
+	paint := func(code, text string) string {
+		if !color {
+			return text
+		}
+		return code + text + colorReset
+	}
+
+	for _, d := range diags {
+		fmt.Fprintf(w, "%s%s\n", paint(severityColors[d.Severity], messages.Translate(string(d.Severity))+":"), paint(colorBold, " "+d.Message))
+		if d.Offset < 0 || src == nil {
+			if src != nil {
+				fmt.Fprintf(w, " %s %s\n", paint(colorBlue, "-->"), src.Name)
+			}
+			continue
+		}
+
+		line, column := src.Position(d.Offset)
+		text := src.Line(line)
+		gutter := strings.Repeat(" ", len(fmt.Sprint(line)))
+
+		fmt.Fprintf(w, "%s%s %s:%d:%d\n", gutter, paint(colorBlue, "-->"), src.Name, line, column)
+		fmt.Fprintf(w, "%s %s\n", gutter, paint(colorBlue, "|"))
+		fmt.Fprintf(w, "%s %s\n", paint(colorBlue, fmt.Sprint(line)+" |"), text)
+
+		// Keep tabs so the carets line up under the source
+		var pad strings.Builder
+		for _, r := range []rune(text)[:column-1] {
+			if r == '\t' {
+				pad.WriteRune('\t')
+			} else {
+				pad.WriteRune(' ')
+			}
+		}
+		width := caretWidth(src.Text, d.Offset, d.Length)
+		fmt.Fprintf(w, "%s %s %s%s\n", gutter, paint(colorBlue, "|"), pad.String(),
+			paint(severityColors[d.Severity], strings.Repeat("^", width)))
+	}
+}
+
+// renderPlain writes diagnostics as Render does when Plain is set
+func renderPlain(w io.Writer, src *Source, diags []Diagnostic) {
+	for _, d := range diags {
+		fmt.Fprintf(w, "%s: %s\n", messages.Translate(string(d.Severity)), d.Message)
+		switch {
+		case src == nil:
+		case d.Offset < 0:
+			fmt.Fprintf(w, "  %s\n", messages.Sprintf("in %s", src.Name))
+		default:
+			line, column := src.Position(d.Offset)
+			fmt.Fprintf(w, "  %s\n", messages.Sprintf("at %s line %d, column %d: %s", src.Name, line, column, strings.TrimSpace(src.Line(line))))
+		}
+	}
+}
+
+// caretWidth counts the characters underlined, stopping at the end of the line
+func caretWidth(text string, offset, length int) int {
+	end := offset + length
+	if end > len(text) {
+		end = len(text)
+	}
+	if nl := strings.IndexByte(text[offset:end], '\n'); nl >= 0 {
+		end = offset + nl
+	}
+	if width := utf8.RuneCountInString(text[offset:end]); width > 0 {
+		return width
+	}
+	return 1
+}
+
+// jsonDiagnostic is the editor-facing form of a diagnostic
+type jsonDiagnostic struct {
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	File     string   `json:"file"`
+	Line     int      `json:"line,omitempty"`
+	Column   int      `json:"column,omitempty"`
+	Offset   int      `json:"offset"`
+	Length   int      `json:"length"`
+	Code     string   `json:"code,omitempty"`
+	Fix      *jsonFix `json:"fix,omitempty"`
+}
+
+// jsonFix is the editor-facing form of a fix. Edits give both offsets and
+// the line and column they start and end at.
+type jsonFix struct {
+	Message string     `json:"message"`
+	Edits   []jsonEdit `json:"edits"`
+}
+
+type jsonEdit struct {
+	Offset    int    `json:"offset"`
+	Length    int    `json:"length"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	EndLine   int    `json:"endLine"`
+	EndColumn int    `json:"endColumn"`
+	Text      string `json:"text"`
+}
+
+// WriteJSON writes the diagnostics as a JSON array with file, line and
+// column for each
+func WriteJSON(w io.Writer, src *Source, diags []Diagnostic) error {
+	out := make([]jsonDiagnostic, 0, len(diags))
+	for _, d := range diags {
+		jd := jsonDiagnostic{Severity: d.Severity, Message: d.Message, Offset: d.Offset, Length: d.Length, Code: d.Code}
+		if src != nil {
+			jd.File = src.Name
+			if d.Offset >= 0 {
+				jd.Line, jd.Column = src.Position(d.Offset)
+			}
+		}
+		if d.Fix != nil {
+			jd.Fix = &jsonFix{Message: d.Fix.Message, Edits: jsonEdits(src, d.Fix.Edits)}
+		}
+		out = append(out, jd)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
+
+// WriteEditsJSON writes a change to src as an editor's code action carries
+// it: a title, such as "rename x to y", and its edits
+func WriteEditsJSON(w io.Writer, src *Source, title string, edits []Edit) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(jsonFix{Message: title, Edits: jsonEdits(src, edits)})
+}
+
+func jsonEdits(src *Source, edits []Edit) []jsonEdit {
+	out := make([]jsonEdit, len(edits))
+	for i, edit := range edits {
+		je := jsonEdit{Offset: edit.Offset, Length: edit.Length, Text: edit.Text}
+		if src != nil {
+			je.Line, je.Column = src.Position(edit.Offset)
+			je.EndLine, je.EndColumn = src.Position(edit.Offset + edit.Length)
+		}
+		out[i] = je
+	}
+	return out
+}
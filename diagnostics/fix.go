@@ -0,0 +1,82 @@
+package diagnostics
+
+import (
+	"sort"
+	"strings"
+)
+
+// Edit replaces Length bytes of the source at Offset with Text
+type Edit struct {
+	Offset int
+	Length int
+	Text   string
+}
+
+// Fix is a change to the source that resolves a diagnostic, safe to apply
+// without review, as gokid check --fix does and editors offer as a quick
+// fix
+type Fix struct {
+	Message string // what the fix does, such as "remove x"
+	Edits   []Edit
+}
+
+// Shift returns d moved delta bytes through its source, fix included
+func (d Diagnostic) Shift(delta int) Diagnostic {
+	if d.Offset >= 0 {
+		d.Offset += delta
+	}
+	if d.Fix != nil {
+		fix := &Fix{Message: d.Fix.Message, Edits: make([]Edit, len(d.Fix.Edits))}
+		for i, edit := range d.Fix.Edits {
+			edit.Offset += delta
+			fix.Edits[i] = edit
+		}
+		d.Fix = fix
+	}
+	return d
+}
+
+// ApplyFixes applies the fixes of diags to text and returns the result and
+// how many fixes were applied. A fix with an edit that overlaps one
+// already applied is left out; fixing the result again applies it.
+func ApplyFixes(text string, diags []Diagnostic) (string, int) {
+	var edits []Edit
+	applied := 0
+	for _, d := range diags {
+		if d.Fix == nil || overlaps(d.Fix.Edits, edits) {
+			continue
+		}
+		edits = append(edits, d.Fix.Edits...)
+		applied++
+	}
+	return ApplyEdits(text, edits), applied
+}
+
+// ApplyEdits makes edits, which must not overlap, to text
+func ApplyEdits(text string, edits []Edit) string {
+	edits = append([]Edit(nil), edits...)
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].Offset < edits[j].Offset })
+	var b strings.Builder
+	at := 0
+	for _, edit := range edits {
+		b.WriteString(text[at:edit.Offset])
+		b.WriteString(edit.Text)
+		at = edit.Offset + edit.Length
+	}
+	b.WriteString(text[at:])
+	return b.String()
+}
+
+// overlaps reports whether any of edits touches the bytes one of taken
+// changes. Two insertions at the same offset overlap, since their order
+// would be arbitrary.
+func overlaps(edits, taken []Edit) bool {
+	for _, a := range edits {
+		for _, b := range taken {
+			if a.Offset < b.Offset+b.Length && b.Offset < a.Offset+a.Length || a.Offset == b.Offset {
+				return true
+			}
+		}
+	}
+	return false
+}
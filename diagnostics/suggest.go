@@ -0,0 +1,64 @@
+package diagnostics
+
+// Suggest returns the candidate closest to name by edit distance, for a
+// "did you mean" hint, or "" when none is close enough to be a likely
+// typo. Names of two letters or fewer get no hint: one edit turns them
+// into too many other words, such as of into if. Candidates equal to name
+// are skipped, and of two equally close candidates the earlier one wins.
+func Suggest(name string, candidates []string) string {
+	length := len([]rune(name))
+	if length <= 2 {
+		return ""
+	}
+	// A typo changes about one letter in three; anything further off is
+	// more likely a different name altogether
+	limit := length / 3
+	best, bestDistance := "", limit+1
+	for _, candidate := range candidates {
+		if candidate == name {
+			continue
+		}
+		if d := editDistance(name, candidate, bestDistance); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b, counting
+// a swap of two neighbouring letters as one edit. It gives up and returns
+// limit once the distance is known to be at least limit.
+func editDistance(a, b string, limit int) int {
+	s, t := []rune(a), []rune(b)
+	if d := len(s) - len(t); d >= limit || -d >= limit {
+		return limit
+	}
+
+	// Three rows of the distance table: two back, the last and this one
+	prev2 := make([]int, len(t)+1)
+	prev := make([]int, len(t)+1)
+	row := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		row[0] = i
+		smallest := i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			row[j] = min(prev[j]+1, row[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				row[j] = min(row[j], prev2[j-2]+1)
+			}
+			smallest = min(smallest, row[j])
+		}
+		if smallest >= limit {
+			return limit
+		}
+		prev2, prev, row = prev, row, prev2
+	}
+	return min(prev[len(t)], limit)
+}
@@ -0,0 +1,144 @@
+package evaluator
+
+import (
+	"os"
+	"path/filepath"
+	"runtime/metrics"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// moduleAccount is what the code of one file has used since the first
+// import of the process
+type moduleAccount struct {
+	steps int
+	bytes uint64
+	time  time.Duration
+}
+
+// Accounting starts with the first import of a file module, so programs
+// without one don't pay for it. The account of each file, keyed by path
+// and "" for code not from a file, is kept for the whole process, since
+// modules are shared by every interpreter that imports them.
+var (
+	accounting atomic.Bool
+	accountsMu sync.Mutex
+	accounts   = map[string]*moduleAccount{}
+)
+
+// running is the stretch of a session's run spent in one file's code.
+// Its counts are added to the file's account when another file's code
+// starts running, so the accounts are only locked on those switches.
+type running struct {
+	root      *Environment // top-level scope of the code running
+	steps     int
+	since     time.Time
+	allocated uint64 // heap bytes allocated by the process when it began
+}
+
+// startAccounting begins accounting, if it hasn't begun, with env's code
+// as the code running
+func startAccounting(env *Environment) {
+	if accounting.Swap(true) {
+		return
+	}
+	env.session.account(env.root())
+}
+
+// account counts a statement of the code whose top-level scope is root
+func (s *session) account(root *Environment) {
+	if s.running.root == root {
+		s.running.steps++
+		return
+	}
+	s.settle()
+	s.running = running{root: root, steps: 1, since: time.Now(), allocated: allocatedBytes()}
+}
+
+// settle adds what the code running has used so far to its file's account
+func (s *session) settle() {
+	r := &s.running
+	if r.root == nil {
+		return
+	}
+	now, allocated := time.Now(), allocatedBytes()
+	accountsMu.Lock()
+	a := accounts[r.root.path]
+	if a == nil {
+		a = &moduleAccount{}
+		accounts[r.root.path] = a
+	}
+	a.steps += r.steps
+	a.bytes += allocated - r.allocated
+	a.time += now.Sub(r.since)
+	accountsMu.Unlock()
+	r.steps, r.since, r.allocated = 0, now, allocated
+}
+
+// moduleStats returns the account of each file, the one that ran the most
+// statements first
+func moduleStats(env *Environment) Object {
+	s := env.session
+	if s.concurrent {
+		s.mu.Lock()
+		s.settle()
+		s.mu.Unlock()
+	} else {
+		s.settle()
+	}
+
+	accountsMu.Lock()
+	defer accountsMu.Unlock()
+	paths := make([]string, 0, len(accounts))
+	for path := range accounts {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		if accounts[paths[i]].steps != accounts[paths[j]].steps {
+			return accounts[paths[i]].steps > accounts[paths[j]].steps
+		}
+		return paths[i] < paths[j]
+	})
+
+	stats := make([]Object, len(paths))
+	for i, path := range paths {
+		a := accounts[path]
+		name := displayPath(path)
+		if name == "" {
+			name = "<main>"
+		}
+		stats[i] = newHash(map[string]Object{
+			"module": &String{Value: name},
+			"steps":  &Integer{Value: int64(a.steps)},
+			"bytes":  &Integer{Value: int64(a.bytes)},
+			"ms":     &Float{Value: float64(a.time.Microseconds()) / 1000},
+		})
+	}
+	return &Array{Elements: stats}
+}
+
+// displayPath returns path relative to the working directory when it is
+// inside it, as the files a program names are usually given
+func displayPath(path string) string {
+	if !filepath.IsAbs(path) {
+		return path
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(dir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
+
+// allocatedBytes returns the heap bytes the process has allocated in all
+func allocatedBytes() uint64 {
+	sample := []metrics.Sample{{Name: "/gc/heap/allocs:bytes"}}
+	metrics.Read(sample)
+	return sample[0].Value.Uint64()
+}
@@ -0,0 +1,107 @@
+package evaluator
+
+func init() {
+	aggregates := []struct {
+		name string
+		doc  string
+		fn   func(numbers []Object) Object
+	}{
+		{"sum", "Returns the sum of the numbers in an array, 0 when there are none.", sumNumbers},
+		{"avg", "Returns the mean of the numbers in an array, null when there are none.", func(numbers []Object) Object {
+			if len(numbers) == 0 {
+				return NULL
+			}
+			total := sumNumbers(numbers)
+			if i, ok := total.(*Integer); ok {
+				return &Float{Value: float64(i.Value) / float64(len(numbers))}
+			}
+			return evalInfixExpression("/", total, &Integer{Value: int64(len(numbers))})
+		}},
+		{"min", "Returns the smallest number in an array, null when there are none.", func(numbers []Object) Object {
+			return extremeNumber(numbers, -1)
+		}},
+		{"max", "Returns the largest number in an array, null when there are none.", func(numbers []Object) Object {
+			return extremeNumber(numbers, 1)
+		}},
+		{"count", "Returns how many numbers an array holds.", func(numbers []Object) Object {
+			return &Integer{Value: int64(len(numbers))}
+		}},
+	}
+
+	for _, aggregate := range aggregates {
+		aggregate := aggregate
+		registerBuiltin(&Builtin{
+			Name:   aggregate.name,
+			Params: []Param{{Name: "array", Types: []ObjectType{ARRAY_OBJ}}, {Name: "options", Types: []ObjectType{HASH_OBJ}, Optional: true}},
+			Doc:    aggregate.doc + ` Other values are an error, or skipped with {"nonNumeric": "skip"}.`,
+			Fn: func(args ...Object) Object {
+				numbers, err := numericElements(aggregate.name, args)
+				if err != nil {
+					return err
+				}
+				return aggregate.fn(numbers)
+			},
+		})
+	}
+}
+
+// numericElements returns the numbers in the array given to an aggregate
+// builtin, applying its nonNumeric option to the other elements
+func numericElements(name string, args []Object) ([]Object, *Error) {
+	skip := false
+	if len(args) == 2 {
+		for _, pair := range sortedPairs(args[1].(*Hash)) {
+			if pair.Key.Inspect() != "nonNumeric" {
+				return nil, newCodedError(E_VALUE, "unknown option %s to `%s`", pair.Key.Inspect(), name)
+			}
+			switch pair.Value.Inspect() {
+			case "skip":
+				skip = true
+			case "error":
+				skip = false
+			default:
+				return nil, newCodedError(E_VALUE, "option nonNumeric must be \"skip\" or \"error\", got %s", pair.Value.Inspect())
+			}
+		}
+	}
+
+	numbers := []Object{}
+	for i, element := range args[0].(*Array).Elements {
+		if hasType(numericTypes, element.Type()) {
+			numbers = append(numbers, element)
+		} else if !skip {
+			return nil, newCodedError(E_TYPE_MISMATCH, "element %d of array given to `%s` is %s, not a number", i, name, element.Type())
+		}
+	}
+	return numbers, nil
+}
+
+func sumNumbers(numbers []Object) Object {
+	var total Object = &Integer{Value: 0}
+	for _, n := range numbers {
+		total = evalInfixExpression("+", total, n)
+		if isError(total) {
+			return total
+		}
+	}
+	return total
+}
+
+// extremeNumber returns the number that sorts before every other when
+// sign is -1, or after every other when it is 1
+func extremeNumber(numbers []Object, sign int) Object {
+	if len(numbers) == 0 {
+		return NULL
+	}
+	best := numbers[0]
+	for _, n := range numbers[1:] {
+		cmp, err := compareObjects(n, best)
+		if err != nil {
+			return err
+		}
+		if cmp == sign {
+			best = n
+		}
+	}
+	return best
+}
@@ -0,0 +1,229 @@
+package evaluator
+
+import "slices"
+
+// maxArrayLength bounds the arrays newArray makes, so a mistyped length
+// fails instead of exhausting memory
+const maxArrayLength = 1 << 26
+
+func init() {
+	registerBuiltin(&Builtin{
+		Name:   "zip",
+		Params: []Param{{Name: "array", Types: []ObjectType{ARRAY_OBJ}}, {Name: "arrays", Types: []ObjectType{ARRAY_OBJ}, Variadic: true}},
+		Doc:    "Pairs up the elements of arrays by index, stopping at the end of the shortest.",
+		Fn: func(args ...Object) Object {
+			length := len(args[0].(*Array).Elements)
+			for _, arg := range args[1:] {
+				if n := len(arg.(*Array).Elements); n < length {
+					length = n
+				}
+			}
+
+			tuples := make([]Object, length)
+			for i := range tuples {
+				tuple := make([]Object, len(args))
+				for j, arg := range args {
+					tuple[j] = arg.(*Array).Elements[i]
+				}
+				tuples[i] = &Array{Elements: tuple}
+			}
+			return &Array{Elements: tuples}
+		},
+	})
+
+	registerBuiltin(&Builtin{
+		Name:   "enumerate",
+		Params: []Param{{Name: "array", Types: []ObjectType{ARRAY_OBJ}}},
+		Doc:    "Returns [index, element] pairs for the elements of an array.",
+		Fn: func(args ...Object) Object {
+			elements := args[0].(*Array).Elements
+			pairs := make([]Object, len(elements))
+			for i, element := range elements {
+				pairs[i] = &Array{Elements: []Object{&Integer{Value: int64(i)}, element}}
+			}
+			return &Array{Elements: pairs}
+		},
+	})
+
+	registerBuiltin(&Builtin{
+		Name:   "flatten",
+		Params: []Param{{Name: "array", Types: []ObjectType{ARRAY_OBJ}}, {Name: "depth", Types: []ObjectType{INTEGER_OBJ}, Optional: true}},
+		Doc:    "Returns a new array with nested arrays spliced in, depth levels deep (1 by default).",
+		Fn: func(args ...Object) Object {
+			depth := int64(1)
+			if len(args) == 2 {
+				depth = args[1].(*Integer).Value
+				if depth < 0 {
+					return newCodedError(E_VALUE, "depth given to `flatten` must not be negative, got %d", depth)
+				}
+			}
+			return &Array{Elements: flattenElements(args[0].(*Array).Elements, depth, nil)}
+		},
+	})
+
+	registerBuiltin(&Builtin{
+		Name:   "groupBy",
+		Params: []Param{{Name: "array", Types: []ObjectType{ARRAY_OBJ}}, {Name: "key", Types: callableTypes}},
+		Doc:    "Returns a hash from each key(element) to the array of elements with that key, in their original order.",
+		Fn: func(args ...Object) Object {
+			groups := &Hash{Pairs: make(map[HashKey]HashPair)}
+			// key may change the array; the groups are of the elements
+			// as they were when groupBy was called
+			for _, element := range slices.Clone(args[0].(*Array).Elements) {
+				key := applyFunction(args[1], []Object{element})
+				if isError(key) {
+					return key
+				}
+				hashKey, err := hashKeyOf(key)
+				if err != nil {
+					return err
+				}
+
+				pair, ok := groups.Pairs[hashKey]
+				if !ok {
+					pair = HashPair{Key: key, Value: &Array{Elements: []Object{}}}
+				}
+				group := pair.Value.(*Array)
+				group.Elements = append(group.Elements, element)
+				groups.Pairs[hashKey] = pair
+			}
+			return groups
+		},
+	})
+
+	registerBuiltin(&Builtin{
+		Name:   "unique",
+		Params: []Param{{Name: "array", Types: []ObjectType{ARRAY_OBJ}}},
+		Doc:    "Returns the elements of an array without repeats, keeping the first of each.",
+		Fn: func(args ...Object) Object {
+			seen := make(map[HashKey]bool)
+			var unhashable []Object
+			result := []Object{}
+
+		elements:
+			for _, element := range args[0].(*Array).Elements {
+				if key, err := hashKeyOf(element); err == nil {
+					if seen[key] {
+						continue
+					}
+					seen[key] = true
+					result = append(result, element)
+					continue
+				}
+
+				// Values that can't be hash keys, such as arrays and
+				// NaN, are compared with ==
+				for _, kept := range unhashable {
+					if evalInfixExpression("==", element, kept) == TRUE {
+						continue elements
+					}
+				}
+				unhashable = append(unhashable, element)
+				result = append(result, element)
+			}
+			return &Array{Elements: result}
+		},
+	})
+
+	registerBuiltin(&Builtin{
+		Name:   "newArray",
+		Params: []Param{{Name: "length", Types: []ObjectType{INTEGER_OBJ}}, {Name: "value", Optional: true}},
+		Doc:    "Returns an array of length elements, each value (null by default); an array or object given is shared by every element.",
+		Fn: func(args ...Object) Object {
+			length := args[0].(*Integer).Value
+			if length < 0 || length > maxArrayLength {
+				return newCodedError(E_VALUE, "length given to `newArray` must be between 0 and %d, got %d", maxArrayLength, length)
+			}
+			var value Object = NULL
+			if len(args) == 2 {
+				value = args[1]
+			}
+			elements := make([]Object, length)
+			for i := range elements {
+				elements[i] = value
+			}
+			return &Array{Elements: elements}
+		},
+	})
+
+	registerBuiltin(&Builtin{
+		Name: "fill",
+		Params: []Param{
+			{Name: "array", Types: []ObjectType{ARRAY_OBJ}},
+			{Name: "value"},
+			{Name: "from", Types: []ObjectType{INTEGER_OBJ}, Optional: true},
+			{Name: "to", Types: []ObjectType{INTEGER_OBJ}, Optional: true},
+		},
+		Doc: "Sets the elements of an array from index from up to but not including to (the whole array by default) to value, and returns the array.",
+		Fn: func(args ...Object) Object {
+			array := args[0].(*Array)
+			if err := checkMutable(array); err != nil {
+				return err
+			}
+			from, to := int64(0), int64(len(array.Elements))
+			if len(args) > 2 {
+				from = args[2].(*Integer).Value
+			}
+			if len(args) > 3 {
+				to = args[3].(*Integer).Value
+			}
+			if from < 0 || from > to || to > int64(len(array.Elements)) {
+				return newCodedError(E_INDEX, "`fill` range %d to %d is not within the array (length %d)", from, to, len(array.Elements))
+			}
+			for i := from; i < to; i++ {
+				array.Elements[i] = args[1]
+			}
+			return array
+		},
+	})
+
+	registerBuiltin(&Builtin{
+		Name: "splice",
+		Params: []Param{
+			{Name: "array", Types: []ObjectType{ARRAY_OBJ}},
+			{Name: "start", Types: []ObjectType{INTEGER_OBJ}},
+			{Name: "deleteCount", Types: []ObjectType{INTEGER_OBJ}, Optional: true},
+			{Name: "items", Variadic: true},
+		},
+		Doc: "Removes deleteCount elements of an array from index start (all of them by default), puts items in their place, and returns the removed elements.",
+		Fn: func(args ...Object) Object {
+			array := args[0].(*Array)
+			if err := checkMutable(array); err != nil {
+				return err
+			}
+			length := int64(len(array.Elements))
+			start := args[1].(*Integer).Value
+			if start < 0 || start > length {
+				return newCodedError(E_INDEX, "`splice` start %d is not within the array (length %d)", start, length)
+			}
+			end := length
+			if len(args) > 2 {
+				count := args[2].(*Integer).Value
+				if count < 0 {
+					return newCodedError(E_VALUE, "`splice` cannot remove %d elements", count)
+				}
+				// Removing past the end removes the rest
+				end = start + min(count, length-start)
+			}
+			removed := slices.Clone(array.Elements[start:end])
+			array.Elements = slices.Replace(array.Elements, int(start), int(end), args[min(len(args), 3):]...)
+			return &Array{Elements: removed}
+		},
+	})
+}
+
+// flattenElements appends elements to out, splicing in the elements of
+// nested arrays up to depth levels deep
+func flattenElements(elements []Object, depth int64, out []Object) []Object {
+	if out == nil {
+		out = []Object{}
+	}
+	for _, element := range elements {
+		if nested, ok := element.(*Array); ok && depth > 0 {
+			out = flattenElements(nested.Elements, depth-1, out)
+		} else {
+			out = append(out, element)
+		}
+	}
+	return out
+}
@@ -1,65 +1,438 @@
 package evaluator
 
-import "fmt"
+import (
+	"gokid/messages"
+	"gokid/tokens"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
 
 // BuiltinFunction represents a built-in function
 type BuiltinFunction func(args ...Object) Object
 
-// Builtin object for built-in functions
+// Builtin object for built-in functions. Registered builtins declare their
+// parameters, and their arguments are checked against them before Fn runs.
 type Builtin struct {
-	Fn BuiltinFunction
+	Name   string
+	Params []Param
+	Doc    string
+	Fn     BuiltinFunction
+
+	// Pure builtins, such as len and math.abs, give equal results for
+	// equal arguments and do nothing else, so a call of one whose
+	// arguments are constants is worked out once and its result reused
+	Pure bool
+
+	// EnvFn is used instead of Fn by builtins that need the scope they
+	// are called from
+	EnvFn func(env *Environment, args ...Object) Object
+
+	// OutFn is used instead of Fn by builtins that write output, such as
+	// print; out is the standard output of the interpreter calling it
+	OutFn func(out io.Writer, args ...Object) Object
+
+	// sessionFn is used instead of Fn by builtins that need the
+	// interpreter calling them rather than a scope, such as ones that
+	// block and must return once the host's context is done
+	sessionFn func(s *session, args ...Object) Object
+
+	// capability, such as HTTP, makes each call count against the quota
+	// the host set for it; unmetered is Fn before it was wrapped to count
+	capability string
+	unmetered  BuiltinFunction
+
+	// captured are the values a builtin made by another one works with,
+	// such as the function and arguments of the one partial returns, and
+	// build makes its Fn from them, so a copy of the interpreter can build
+	// one that works with copies of them
+	captured []Object
+	build    func(captured []Object) BuiltinFunction
+}
+
+// closure returns a builtin whose Fn build makes from captured, for the
+// functions builtins such as partial and memoize return
+func closure(captured []Object, build func(captured []Object) BuiltinFunction) *Builtin {
+	return &Builtin{Fn: build(captured), captured: captured, build: build}
+}
+
+// Param describes one parameter of a builtin
+type Param struct {
+	Name     string
+	Types    []ObjectType // accepted types; empty accepts any value
+	Optional bool         // may be left out, along with the parameters after it
+	Variadic bool         // takes all remaining arguments, which may be none
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
 func (b *Builtin) Inspect() string  { return "builtin function" }
 
-// Built-in functions map
-var builtins = map[string]*Builtin{
-	"len": {
-		Fn: func(args ...Object) Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
+// Arity returns the least and most arguments b accepts. The most is -1
+// for variadic builtins.
+func (b *Builtin) Arity() (int, int) {
+	min := 0
+	for _, param := range b.Params {
+		if param.Variadic {
+			return min, -1
+		}
+		if !param.Optional {
+			min++
+		}
+	}
+	return min, len(b.Params)
+}
+
+// Signature describes how to call b, such as "http.get(url, options?)"
+func (b *Builtin) Signature() string {
+	params := make([]string, len(b.Params))
+	for i, param := range b.Params {
+		params[i] = param.Name
+		if param.Variadic {
+			params[i] += "..."
+		} else if param.Optional {
+			params[i] += "?"
+		}
+	}
+	return b.Name + "(" + strings.Join(params, ", ") + ")"
+}
+
+// checkArgs validates args against the declared parameters. Builtins
+// without a name, such as methods bound to a collection, check their own
+// arguments.
+func (b *Builtin) checkArgs(args []Object) *Error {
+	if b.Name == "" {
+		return nil
+	}
+
+	min, max := b.Arity()
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		var want string
+		switch {
+		case max < 0:
+			want = messages.Sprintf(" at least %d", min)
+		case max == min:
+			want = messages.Sprintf("=%d", min)
+		case max == min+1:
+			want = messages.Sprintf("=%d or %d", min, max)
+		default:
+			want = messages.Sprintf("=%d to %d", min, max)
+		}
+		return newCodedError(E_ARITY, "wrong number of arguments to `%s`. got=%d, want%s", b.Name, len(args), want)
+	}
+
+	for i, arg := range args {
+		param := b.Params[len(b.Params)-1]
+		if i < len(b.Params) {
+			param = b.Params[i]
+		}
+		if len(param.Types) == 0 || hasType(param.Types, arg.Type()) {
+			continue
+		}
+		if len(b.Params) == 1 {
+			return newCodedError(E_TYPE_MISMATCH, "argument to `%s` must be %s, got %s", b.Name, joinTypes(param.Types), arg.Type())
+		}
+		return newCodedError(E_TYPE_MISMATCH, "argument `%s` to `%s` must be %s, got %s", param.Name, b.Name, joinTypes(param.Types), arg.Type())
+	}
+
+	return nil
+}
+
+func hasType(types []ObjectType, t ObjectType) bool {
+	for _, candidate := range types {
+		if candidate == t {
+			return true
+		}
+	}
+	return false
+}
+
+// joinTypes lists types as "A, B or C"
+func joinTypes(types []ObjectType) string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = string(t)
+	}
+	if len(names) == 1 {
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
+
+// callableTypes are accepted wherever a builtin takes a callback
+var callableTypes = []ObjectType{FUNCTION_OBJ, BUILTIN_OBJ}
+
+// Built-in functions, registered by name. Each interpreter starts with a
+// copy of these.
+var builtins = map[string]*Builtin{}
+
+func registerBuiltin(b *Builtin) {
+	builtins[b.Name] = b
+}
+
+// Built-in modules, resolved by name when no variable shadows them. Each
+// interpreter starts with a copy of these.
+var modules = map[string]*Module{}
+
+// registerModule adds a builtin module. Its builtin members are named
+// after the module, as in "http.get".
+func registerModule(name string, members map[string]Object) {
+	for member, value := range members {
+		if b, ok := value.(*Builtin); ok {
+			b.Name = name + "." + member
+		}
+	}
+	modules[name] = &Module{Name: name, Members: members}
+}
+
+// writeValues writes values separated by spaces, then end, in one write
+func writeValues(out io.Writer, values []Object, end string) {
+	var line strings.Builder
+	for i, value := range values {
+		if i > 0 {
+			line.WriteByte(' ')
+		}
+		line.WriteString(value.Inspect())
+	}
+	line.WriteString(end)
+	io.WriteString(out, line.String())
+}
+
+// flushOutput writes out what a buffered output writer holds
+func flushOutput(out io.Writer) {
+	if f, ok := out.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+}
+
+// DefineBuiltin makes b available to the interpreter env belongs to,
+// replacing any builtin function of the same name
+func (e *Environment) DefineBuiltin(b *Builtin) {
+	s := e.session
+	s.builtins[b.Name] = s.bind(b)
+	s.resolve(b.Name)
+}
+
+// DefineModule makes a builtin module available to the interpreter env
+// belongs to, replacing any module of the same name
+func (e *Environment) DefineModule(name string, members map[string]Object) {
+	for member, value := range members {
+		if b, ok := value.(*Builtin); ok && b.Name == "" {
+			b.Name = name + "." + member
+		}
+	}
+	s := e.session
+	s.modules[name] = s.bindModule(&Module{Name: name, Members: members})
+	delete(s.hidden, name)
+	s.resolve(name)
+}
+
+// PreloadModules makes the standard modules, such as math and http, global
+// names in the interpreter env belongs to, as they were before they had to
+// be imported with import "std/<name>". Call it before running code.
+func (e *Environment) PreloadModules() {
+	s := e.session
+	for name := range s.hidden {
+		if s.resolved != nil {
+			s.resolved[tokens.Intern(name)] = s.modules[name]
+		}
+	}
+	s.hidden = nil
+}
+
+// RemoveBuiltin removes the builtin function or module called name from
+// the interpreter env belongs to
+func (e *Environment) RemoveBuiltin(name string) {
+	delete(e.session.builtins, name)
+	delete(e.session.modules, name)
+	e.session.resolve(name)
+}
+
+// globalModule returns the module a global name refers to, or nil. Standard
+// modules that haven't been imported or preloaded aren't global.
+func (s *session) globalModule(name string) *Module {
+	if s.hidden[name] {
+		return nil
+	}
+	return s.modules[name]
+}
+
+// resolve updates the resolved entry for a builtin or module name that
+// changed. A name that isn't resolved may have a variable bound to it
+// somewhere, so only names that are already resolved stay resolved.
+func (s *session) resolve(name string) {
+	id := tokens.Intern(name)
+	if _, ok := s.resolved[id]; !ok {
+		return
+	}
+	if b, ok := s.builtins[name]; ok {
+		s.resolved[id] = b
+	} else if m := s.globalModule(name); m != nil {
+		s.resolved[id] = m
+	} else {
+		delete(s.resolved, id)
+	}
+}
+
+// Builtins returns the builtin functions available to env, including the
+// functions of builtin modules, sorted by name
+func (e *Environment) Builtins() []*Builtin {
+	var all []*Builtin
+	for _, b := range e.session.builtins {
+		all = append(all, b)
+	}
+	for _, module := range e.session.modules {
+		for _, member := range module.Members {
+			if b, ok := member.(*Builtin); ok {
+				all = append(all, b)
 			}
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return all
+}
+
+// Defines reports whether name is a variable in env or a scope around it,
+// a builtin or a module, so that reading it wouldn't fail
+func (e *Environment) Defines(name string) bool {
+	if _, ok := e.Get(name); ok {
+		return true
+	}
+	_, builtin := e.session.builtins[name]
+	return builtin || e.session.globalModule(name) != nil
+}
+
+// LookupBuiltin finds a builtin available to env by name, such as "len"
+// or "http.get"
+func (e *Environment) LookupBuiltin(name string) (*Builtin, bool) {
+	if b, ok := e.session.builtins[name]; ok {
+		return b, true
+	}
+	if dot := strings.Index(name, "."); dot >= 0 {
+		if module, ok := e.session.modules[name[:dot]]; ok {
+			b, ok := module.Members[name[dot+1:]].(*Builtin)
+			return b, ok
+		}
+	}
+	return nil, false
+}
 
+func init() {
+	registerBuiltin(&Builtin{
+		Name: "len",
+		Params: []Param{{Name: "value", Types: []ObjectType{
+			ARRAY_OBJ, STRING_OBJ, HASH_OBJ, STACK_OBJ, QUEUE_OBJ, DEQUE_OBJ, HEAP_OBJ, SORTED_MAP_OBJ,
+		}}},
+		Doc:  "Returns the number of elements in a collection, of bytes in a string, or of keys in an object; an object with a __len__ method returns what it says.",
+		Pure: true,
+		Fn: func(args ...Object) Object {
 			switch arg := args[0].(type) {
 			case *Array:
 				return &Integer{Value: int64(len(arg.Elements))}
+			case *Hash:
+				if hook := protocolHook(arg, "__len__"); hook != nil {
+					n := applyMethod(hook, arg, nil)
+					if length, ok := n.(*Integer); (ok && length.Value >= 0) || isError(n) {
+						return n
+					}
+					if length, ok := n.(*Integer); ok {
+						return newCodedError(E_VALUE, "__len__ must return an integer of at least 0, got %d", length.Value)
+					}
+					return newCodedError(E_TYPE_MISMATCH, "__len__ must return an integer, got %s", n.Type())
+				}
+				return &Integer{Value: int64(len(arg.Pairs))}
 			case *String:
 				return &Integer{Value: int64(len(arg.Value))}
+			case *Stack:
+				return &Integer{Value: int64(len(arg.Elements))}
+			case *Queue:
+				return &Integer{Value: int64(len(arg.Elements))}
+			case *Deque:
+				return &Integer{Value: int64(len(arg.Elements))}
+			case *Heap:
+				return &Integer{Value: int64(len(arg.Entries))}
+			case *SortedMap:
+				return &Integer{Value: int64(len(arg.Entries))}
 			default:
-				return newError("argument to `len` not supported, got %T", args[0])
+				return newCodedError(E_TYPE_MISMATCH, "argument to `len` not supported, got %T", args[0])
 			}
 		},
-	},
-	"print": {
+	})
+
+	registerBuiltin(&Builtin{
+		Name:   "keys",
+		Params: []Param{{Name: "object", Types: []ObjectType{HASH_OBJ}}},
+		Doc:    "Returns the keys of an object, in the order they are shown; an object with a __keys__ method returns the array it gives.",
 		Fn: func(args ...Object) Object {
-			for i, arg := range args {
-				if i > 0 {
-					fmt.Print(" ")
-				}
-				fmt.Print(arg.Inspect())
-			}
-			fmt.Println()
+			return hashKeys(args[0].(*Hash))
+		},
+	})
+
+	registerBuiltin(&Builtin{
+		Name:   "print",
+		Params: []Param{{Name: "values", Variadic: true}},
+		Doc:    "Prints its arguments separated by spaces, followed by a newline.",
+		OutFn: func(out io.Writer, args ...Object) Object {
+			writeValues(out, args, "\n")
+			return NULL
+		},
+	})
+
+	registerBuiltin(&Builtin{
+		Name:   "write",
+		Params: []Param{{Name: "values", Variadic: true}},
+		Doc:    "Prints its arguments separated by spaces, without a newline.",
+		OutFn: func(out io.Writer, args ...Object) Object {
+			writeValues(out, args, "")
 			return NULL
 		},
-	},
-	"type": {
+	})
+
+	registerBuiltin(&Builtin{
+		Name: "flush",
+		Doc:  "Writes out any output held back by output buffering.",
+		OutFn: func(out io.Writer, args ...Object) Object {
+			flushOutput(out)
+			return NULL
+		},
+	})
+
+	registerBuiltin(&Builtin{
+		Name:   "type",
+		Params: []Param{{Name: "value"}},
+		Doc:    "Returns the type of a value as a string, such as \"INTEGER\" or \"ARRAY\".",
+		Pure:   true,
 		Fn: func(args ...Object) Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
 			return &String{Value: string(args[0].Type())}
 		},
-	},
-	"first": {
+	})
+
+	registerBuiltin(&Builtin{
+		Name:   "num",
+		Params: []Param{{Name: "value", Types: []ObjectType{INTEGER_OBJ, FLOAT_OBJ, STRING_OBJ, BOOLEAN_OBJ}}},
+		Doc:    "Converts a string or boolean to a number; numbers are returned unchanged.",
+		Pure:   true,
 		Fn: func(args ...Object) Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
-			if args[0].Type() != ARRAY_OBJ {
-				return newError("argument to `first` must be ARRAY, got %T", args[0])
+			switch arg := args[0].(type) {
+			case *String:
+				return parseNumber(arg.Value)
+			case *Boolean:
+				if arg.Value {
+					return &Integer{Value: 1}
+				}
+				return &Integer{Value: 0}
+			default:
+				return arg
 			}
+		},
+	})
 
+	registerBuiltin(&Builtin{
+		Name:   "first",
+		Params: []Param{{Name: "array", Types: []ObjectType{ARRAY_OBJ}}},
+		Doc:    "Returns the first element of an array, or null if it is empty.",
+		Fn: func(args ...Object) Object {
 			arr := args[0].(*Array)
 			if len(arr.Elements) > 0 {
 				return arr.Elements[0]
@@ -67,16 +440,13 @@ var builtins = map[string]*Builtin{
 
 			return NULL
 		},
-	},
-	"last": {
-		Fn: func(args ...Object) Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
-			if args[0].Type() != ARRAY_OBJ {
-				return newError("argument to `last` must be ARRAY, got %T", args[0])
-			}
+	})
 
+	registerBuiltin(&Builtin{
+		Name:   "last",
+		Params: []Param{{Name: "array", Types: []ObjectType{ARRAY_OBJ}}},
+		Doc:    "Returns the last element of an array, or null if it is empty.",
+		Fn: func(args ...Object) Object {
 			arr := args[0].(*Array)
 			length := len(arr.Elements)
 			if length > 0 {
@@ -85,16 +455,13 @@ var builtins = map[string]*Builtin{
 
 			return NULL
 		},
-	},
-	"rest": {
-		Fn: func(args ...Object) Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
-			if args[0].Type() != ARRAY_OBJ {
-				return newError("argument to `rest` must be ARRAY, got %T", args[0])
-			}
+	})
 
+	registerBuiltin(&Builtin{
+		Name:   "rest",
+		Params: []Param{{Name: "array", Types: []ObjectType{ARRAY_OBJ}}},
+		Doc:    "Returns a new array of every element but the first, or null if the array is empty.",
+		Fn: func(args ...Object) Object {
 			arr := args[0].(*Array)
 			length := len(arr.Elements)
 			if length > 0 {
@@ -105,16 +472,13 @@ var builtins = map[string]*Builtin{
 
 			return NULL
 		},
-	},
-	"push": {
-		Fn: func(args ...Object) Object {
-			if len(args) != 2 {
-				return newError("wrong number of arguments. got=%d, want=2", len(args))
-			}
-			if args[0].Type() != ARRAY_OBJ {
-				return newError("argument to `push` must be ARRAY, got %T", args[0])
-			}
+	})
 
+	registerBuiltin(&Builtin{
+		Name:   "push",
+		Params: []Param{{Name: "array", Types: []ObjectType{ARRAY_OBJ}}, {Name: "value"}},
+		Doc:    "Returns a new array with value added to the end.",
+		Fn: func(args ...Object) Object {
 			arr := args[0].(*Array)
 			length := len(arr.Elements)
 
@@ -124,5 +488,109 @@ var builtins = map[string]*Builtin{
 
 			return &Array{Elements: newElements}
 		},
-	},
+	})
+
+	registerBuiltin(&Builtin{
+		Name:   "freeze",
+		Params: []Param{{Name: "value", Types: []ObjectType{ARRAY_OBJ, HASH_OBJ}}},
+		Doc:    "Makes an array or hash immutable and returns it. Nested values are not frozen.",
+		Fn: func(args ...Object) Object {
+			switch arg := args[0].(type) {
+			case *Array:
+				arg.Frozen = true
+			case *Hash:
+				arg.Frozen = true
+			}
+			return args[0]
+		},
+	})
+
+	registerBuiltin(&Builtin{
+		Name:   "isFrozen",
+		Params: []Param{{Name: "value"}},
+		Doc:    "Reports whether a value is a frozen array or hash.",
+		Fn: func(args ...Object) Object {
+			switch arg := args[0].(type) {
+			case *Array:
+				return nativeBoolToPyMonkeyBool(arg.Frozen)
+			case *Hash:
+				return nativeBoolToPyMonkeyBool(arg.Frozen)
+			}
+			return FALSE
+		},
+	})
+
+	registerBuiltin(&Builtin{
+		Name:   "deepCopy",
+		Params: []Param{{Name: "value"}},
+		Doc:    "Returns a copy of a value in which nested arrays and objects are copied too. The copy is not frozen.",
+		Fn: func(args ...Object) Object {
+			return deepCopy(args[0], map[Object]Object{})
+		},
+	})
+}
+
+// deepCopy clones arrays, hashes and records recursively. copies maps each
+// one already copied to its copy, so shared and cyclic references keep
+// their shape instead of recursing forever.
+func deepCopy(obj Object, copies map[Object]Object) Object {
+	if copied, ok := copies[obj]; ok {
+		return copied
+	}
+
+	switch obj := obj.(type) {
+	case *Array:
+		arr := &Array{Elements: make([]Object, len(obj.Elements))}
+		copies[obj] = arr
+		for i, element := range obj.Elements {
+			arr.Elements[i] = deepCopy(element, copies)
+		}
+		return arr
+	case *Hash:
+		hash := &Hash{Pairs: make(map[HashKey]HashPair, len(obj.Pairs))}
+		copies[obj] = hash
+		for key, pair := range obj.Pairs {
+			hash.Pairs[key] = HashPair{Key: pair.Key, Value: deepCopy(pair.Value, copies)}
+		}
+		return hash
+	case *Record:
+		record := &Record{Def: obj.Def, Values: make([]Object, len(obj.Values))}
+		copies[obj] = record
+		for i, value := range obj.Values {
+			record.Values[i] = deepCopy(value, copies)
+		}
+		return record
+	default:
+		return obj
+	}
+}
+
+// parseNumber reads an integer, or failing that a float, ignoring
+// surrounding whitespace
+func parseNumber(s string) Object {
+	text := strings.TrimSpace(s)
+	if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return &Integer{Value: i}
+	}
+	if f, err := strconv.ParseFloat(text, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+		return &Float{Value: f}
+	}
+	return newCodedError(E_VALUE, "cannot convert %q to a number", s)
+}
+
+// hashKeys returns a new array of the keys of hash: the result of its
+// __keys__ method, or its keys in the order they are shown
+func hashKeys(hash *Hash) Object {
+	if hook := protocolHook(hash, "__keys__"); hook != nil {
+		keys := applyMethod(hook, hash, nil)
+		if keys.Type() == ARRAY_OBJ || isError(keys) {
+			return keys
+		}
+		return newCodedError(E_TYPE_MISMATCH, "__keys__ must return an array, got %s", keys.Type())
+	}
+	keys := make([]Object, 0, len(hash.Pairs))
+	for _, pair := range sortedPairs(hash) {
+		keys = append(keys, pair.Key)
+	}
+	return &Array{Elements: keys}
 }
@@ -0,0 +1,63 @@
+package evaluator
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+func init() {
+	registerBuiltin(&Builtin{
+		Name:   "ord",
+		Params: []Param{{Name: "ch", Types: []ObjectType{STRING_OBJ}}},
+		Doc:    "Returns the Unicode code point of a one-character string, such as 97 for \"a\".",
+		Pure:   true,
+		Fn: func(args ...Object) Object {
+			s := args[0].(*String).Value
+			r, size := utf8.DecodeRuneInString(s)
+			if s == "" || size != len(s) {
+				return newCodedError(E_VALUE, "`ord` needs a string of one character, got %q", s)
+			}
+			return &Integer{Value: int64(r)}
+		},
+	})
+
+	registerBuiltin(&Builtin{
+		Name:   "chr",
+		Params: []Param{{Name: "code", Types: []ObjectType{INTEGER_OBJ}}},
+		Doc:    "Returns the one-character string with a Unicode code point, such as \"a\" for 97.",
+		Pure:   true,
+		Fn: func(args ...Object) Object {
+			code := args[0].(*Integer).Value
+			if code < 0 || code > unicode.MaxRune || !utf8.ValidRune(rune(code)) {
+				return newCodedError(E_VALUE, "%d is not a Unicode code point", code)
+			}
+			return &String{Value: string(rune(code))}
+		},
+	})
+
+	predicates := []struct {
+		name string
+		doc  string
+		is   func(rune) bool
+	}{
+		{"isDigit", "Reports whether a string is made of the digits 0 to 9.", func(r rune) bool { return '0' <= r && r <= '9' }},
+		{"isAlpha", "Reports whether a string is made of letters, in any alphabet.", unicode.IsLetter},
+		{"isSpace", "Reports whether a string is made of spaces, tabs, newlines and other white space.", unicode.IsSpace},
+	}
+	for _, predicate := range predicates {
+		registerBuiltin(&Builtin{
+			Name:   predicate.name,
+			Params: []Param{{Name: "s", Types: []ObjectType{STRING_OBJ}}},
+			Doc:    predicate.doc + " The empty string is not.",
+			Fn: func(args ...Object) Object {
+				s := args[0].(*String).Value
+				for _, r := range s {
+					if !predicate.is(r) {
+						return FALSE
+					}
+				}
+				return nativeBoolToPyMonkeyBool(s != "")
+			},
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package evaluator
+
+import (
+	"gokid/parser"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// evalClauses gives fn, made from node, the values of its patterns and
+// the functions its following clauses make
+func evalClauses(fn *Function, node *parser.FunctionLiteral, env *Environment) Object {
+	if node.Patterns != nil {
+		fn.Patterns = make([]Object, len(node.Patterns))
+		for i, pattern := range node.Patterns {
+			if pattern == nil {
+				continue
+			}
+			value := Eval(pattern, env)
+			if isError(value) {
+				return value
+			}
+			fn.Patterns[i] = value
+		}
+	}
+
+	if len(node.Clauses) == 0 {
+		return fn
+	}
+	fn.Clauses = []*Function{fn}
+	for _, lit := range node.Clauses {
+		clause := Eval(lit, env)
+		if isError(clause) {
+			return clause
+		}
+		fn.Clauses = append(fn.Clauses, clause.(*Function))
+	}
+	return fn
+}
+
+// choose returns the clause of f that args match: the first with as many
+// parameters as there are arguments, each of which equals its parameter's
+// pattern if it has one. Patterns compare with ==, as switch cases do.
+func (f *Function) choose(args []Object) (*Function, *Error) {
+	if f.Patterns == nil && f.Clauses == nil {
+		return f, nil
+	}
+	clauses := f.Clauses
+	if clauses == nil {
+		clauses = []*Function{f}
+	}
+
+	counted := false
+	for _, clause := range clauses {
+		if len(clause.Parameters) != len(args) {
+			continue
+		}
+		counted = true
+		if clause.matches(args) {
+			return clause, nil
+		}
+	}
+
+	name := f.Name
+	if name == "" {
+		name = "function"
+	}
+	if !counted {
+		return nil, newCodedError(E_ARITY, "wrong number of arguments to `%s`. got=%d, want=%s", name, len(args), clauseArities(clauses))
+	}
+	values := make([]string, len(args))
+	for i, arg := range args {
+		values[i] = literal(arg)
+	}
+	return nil, newCodedError(E_VALUE, "no clause of `%s` matches %s(%s)", name, name, strings.Join(values, ", "))
+}
+
+// matches reports whether each argument equals the pattern of its
+// parameter, for the parameters that have one
+func (f *Function) matches(args []Object) bool {
+	for i, pattern := range f.Patterns {
+		if pattern != nil && evalInfixExpression("==", args[i], pattern) != TRUE {
+			return false
+		}
+	}
+	return true
+}
+
+// clauseArities lists the numbers of arguments the clauses take, such as
+// "1 or 2"
+func clauseArities(clauses []*Function) string {
+	var arities []int
+	for _, clause := range clauses {
+		if n := len(clause.Parameters); !slices.Contains(arities, n) {
+			arities = append(arities, n)
+		}
+	}
+	slices.Sort(arities)
+	counts := make([]string, len(arities))
+	for i, n := range arities {
+		counts[i] = strconv.Itoa(n)
+	}
+	if len(counts) == 1 {
+		return counts[0]
+	}
+	return strings.Join(counts[:len(counts)-1], ", ") + " or " + counts[len(counts)-1]
+}
+
+// literal writes a value the way a pattern for it is written, with
+// strings quoted
+func literal(obj Object) string {
+	if s, ok := obj.(*String); ok {
+		return strconv.Quote(s.Value)
+	}
+	return obj.Inspect()
+}
@@ -0,0 +1,547 @@
+package evaluator
+
+import "sort"
+
+const (
+	STACK_OBJ = "STACK"
+	QUEUE_OBJ = "QUEUE"
+	DEQUE_OBJ = "DEQUE"
+	HEAP_OBJ  = "HEAP"
+
+	SORTED_MAP_OBJ = "SORTED_MAP"
+)
+
+func init() {
+	registerModule("collections", map[string]Object{
+		"stack": &Builtin{
+			Params: []Param{{Name: "values", Variadic: true}},
+			Doc:    "Creates a stack holding values, the last one on top.",
+			Fn: func(args ...Object) Object {
+				return &Stack{Elements: append([]Object{}, args...)}
+			},
+		},
+		"queue": &Builtin{
+			Params: []Param{{Name: "values", Variadic: true}},
+			Doc:    "Creates a queue holding values, the first one at the front.",
+			Fn: func(args ...Object) Object {
+				return &Queue{Elements: append([]Object{}, args...)}
+			},
+		},
+		"deque": &Builtin{
+			Params: []Param{{Name: "values", Variadic: true}},
+			Doc:    "Creates a double-ended queue holding values.",
+			Fn: func(args ...Object) Object {
+				return &Deque{Elements: append([]Object{}, args...)}
+			},
+		},
+		"heap": &Builtin{
+			Params: []Param{{Name: "key", Types: callableTypes, Optional: true}},
+			Doc:    "Creates a min-heap, ordered by key(value) when a key function is given.",
+			Fn: func(args ...Object) Object {
+				h := &Heap{}
+				if len(args) == 1 {
+					h.KeyFn = args[0]
+				}
+				return h
+			},
+		},
+		"sortedMap": &Builtin{
+			Doc: "Creates a map that keeps its keys in sorted order.",
+			Fn: func(args ...Object) Object {
+				return &SortedMap{}
+			},
+		},
+	})
+}
+
+// method wraps a Go closure as a builtin bound to a collection
+func method(fn BuiltinFunction) *Builtin {
+	return &Builtin{Fn: fn}
+}
+
+func checkArity(name string, args []Object, want int) *Error {
+	if len(args) != want {
+		return newCodedError(E_ARITY, "wrong number of arguments to `%s`. got=%d, want=%d", name, len(args), want)
+	}
+	return nil
+}
+
+// Stack object (last in, first out)
+type Stack struct {
+	Elements []Object
+}
+
+func (s *Stack) Type() ObjectType { return STACK_OBJ }
+func (s *Stack) Inspect() string  { return Pretty(s, PrettyOptions{}) }
+
+func (s *Stack) Member(name string) (Object, bool) {
+	switch name {
+	case "push":
+		return method(func(args ...Object) Object {
+			s.Elements = append(s.Elements, args...)
+			return s
+		}), true
+	case "pop":
+		return method(func(args ...Object) Object {
+			if err := checkArity("pop", args, 0); err != nil {
+				return err
+			}
+			if len(s.Elements) == 0 {
+				return NULL
+			}
+			top := s.Elements[len(s.Elements)-1]
+			s.Elements = s.Elements[:len(s.Elements)-1]
+			return top
+		}), true
+	case "peek":
+		return method(func(args ...Object) Object {
+			if err := checkArity("peek", args, 0); err != nil {
+				return err
+			}
+			if len(s.Elements) == 0 {
+				return NULL
+			}
+			return s.Elements[len(s.Elements)-1]
+		}), true
+	}
+	return sizeMembers(name, func() []Object { return s.Elements })
+}
+
+// Queue object (first in, first out)
+type Queue struct {
+	Elements []Object
+}
+
+func (q *Queue) Type() ObjectType { return QUEUE_OBJ }
+func (q *Queue) Inspect() string  { return Pretty(q, PrettyOptions{}) }
+
+func (q *Queue) Member(name string) (Object, bool) {
+	switch name {
+	case "push", "enqueue":
+		return method(func(args ...Object) Object {
+			q.Elements = append(q.Elements, args...)
+			return q
+		}), true
+	case "pop", "dequeue":
+		return method(func(args ...Object) Object {
+			if err := checkArity(name, args, 0); err != nil {
+				return err
+			}
+			if len(q.Elements) == 0 {
+				return NULL
+			}
+			front := q.Elements[0]
+			q.Elements = q.Elements[1:]
+			return front
+		}), true
+	case "peek":
+		return method(func(args ...Object) Object {
+			if err := checkArity("peek", args, 0); err != nil {
+				return err
+			}
+			if len(q.Elements) == 0 {
+				return NULL
+			}
+			return q.Elements[0]
+		}), true
+	}
+	return sizeMembers(name, func() []Object { return q.Elements })
+}
+
+// Deque object (double-ended queue)
+type Deque struct {
+	Elements []Object
+}
+
+func (d *Deque) Type() ObjectType { return DEQUE_OBJ }
+func (d *Deque) Inspect() string  { return Pretty(d, PrettyOptions{}) }
+
+func (d *Deque) Member(name string) (Object, bool) {
+	switch name {
+	case "pushBack", "push":
+		return method(func(args ...Object) Object {
+			d.Elements = append(d.Elements, args...)
+			return d
+		}), true
+	case "pushFront":
+		return method(func(args ...Object) Object {
+			for _, arg := range args {
+				d.Elements = append([]Object{arg}, d.Elements...)
+			}
+			return d
+		}), true
+	case "popBack", "pop":
+		return method(func(args ...Object) Object {
+			if err := checkArity(name, args, 0); err != nil {
+				return err
+			}
+			if len(d.Elements) == 0 {
+				return NULL
+			}
+			back := d.Elements[len(d.Elements)-1]
+			d.Elements = d.Elements[:len(d.Elements)-1]
+			return back
+		}), true
+	case "popFront":
+		return method(func(args ...Object) Object {
+			if err := checkArity(name, args, 0); err != nil {
+				return err
+			}
+			if len(d.Elements) == 0 {
+				return NULL
+			}
+			front := d.Elements[0]
+			d.Elements = d.Elements[1:]
+			return front
+		}), true
+	case "peekBack", "peek":
+		return method(func(args ...Object) Object {
+			if err := checkArity(name, args, 0); err != nil {
+				return err
+			}
+			if len(d.Elements) == 0 {
+				return NULL
+			}
+			return d.Elements[len(d.Elements)-1]
+		}), true
+	case "peekFront":
+		return method(func(args ...Object) Object {
+			if err := checkArity(name, args, 0); err != nil {
+				return err
+			}
+			if len(d.Elements) == 0 {
+				return NULL
+			}
+			return d.Elements[0]
+		}), true
+	}
+	return sizeMembers(name, func() []Object { return d.Elements })
+}
+
+// Heap object (binary min-heap ordered by an optional key function)
+type Heap struct {
+	Entries []HeapEntry
+	KeyFn   Object
+}
+
+type HeapEntry struct {
+	Key   Object
+	Value Object
+}
+
+func (h *Heap) Type() ObjectType { return HEAP_OBJ }
+func (h *Heap) Inspect() string  { return Pretty(h, PrettyOptions{}) }
+
+func (h *Heap) values() []Object {
+	values := make([]Object, len(h.Entries))
+	for i, entry := range h.Entries {
+		values[i] = entry.Value
+	}
+	return values
+}
+
+func (h *Heap) Member(name string) (Object, bool) {
+	switch name {
+	case "push":
+		return method(func(args ...Object) Object {
+			for _, arg := range args {
+				if err := h.push(arg); err != nil {
+					return err
+				}
+			}
+			return h
+		}), true
+	case "pop":
+		return method(func(args ...Object) Object {
+			if err := checkArity("pop", args, 0); err != nil {
+				return err
+			}
+			if len(h.Entries) == 0 {
+				return NULL
+			}
+			return h.pop()
+		}), true
+	case "peek":
+		return method(func(args ...Object) Object {
+			if err := checkArity("peek", args, 0); err != nil {
+				return err
+			}
+			if len(h.Entries) == 0 {
+				return NULL
+			}
+			return h.Entries[0].Value
+		}), true
+	}
+	return sizeMembers(name, h.values)
+}
+
+func (h *Heap) push(value Object) *Error {
+	key := value
+	if h.KeyFn != nil {
+		key = applyFunction(h.KeyFn, []Object{value})
+		if err, ok := key.(*Error); ok {
+			return err
+		}
+	}
+
+	if len(h.Entries) > 0 {
+		if _, ok := compareKeys(h.Entries[0].Key, key); !ok {
+			return newCodedError(E_TYPE_MISMATCH, "heap keys must be comparable, got %s and %s",
+				h.Entries[0].Key.Type(), key.Type())
+		}
+	} else if _, ok := compareKeys(key, key); !ok {
+		return newCodedError(E_TYPE_MISMATCH, "heap key must be a number or a string, got %s", key.Type())
+	}
+
+	h.Entries = append(h.Entries, HeapEntry{Key: key, Value: value})
+
+	// Sift up
+	i := len(h.Entries) - 1
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !h.less(i, parent) {
+			break
+		}
+		h.Entries[i], h.Entries[parent] = h.Entries[parent], h.Entries[i]
+		i = parent
+	}
+
+	return nil
+}
+
+func (h *Heap) pop() Object {
+	top := h.Entries[0].Value
+	last := len(h.Entries) - 1
+	h.Entries[0] = h.Entries[last]
+	h.Entries = h.Entries[:last]
+
+	// Sift down
+	i := 0
+	for {
+		smallest := i
+		left, right := 2*i+1, 2*i+2
+		if left < len(h.Entries) && h.less(left, smallest) {
+			smallest = left
+		}
+		if right < len(h.Entries) && h.less(right, smallest) {
+			smallest = right
+		}
+		if smallest == i {
+			break
+		}
+		h.Entries[i], h.Entries[smallest] = h.Entries[smallest], h.Entries[i]
+		i = smallest
+	}
+
+	return top
+}
+
+func (h *Heap) less(i, j int) bool {
+	cmp, _ := compareKeys(h.Entries[i].Key, h.Entries[j].Key)
+	return cmp < 0
+}
+
+// SortedMap object (map with keys kept in ascending order)
+type SortedMap struct {
+	Entries []HashPair
+}
+
+func (sm *SortedMap) Type() ObjectType { return SORTED_MAP_OBJ }
+func (sm *SortedMap) Inspect() string  { return Pretty(sm, PrettyOptions{}) }
+
+// search returns the index of the first entry whose key is >= key
+func (sm *SortedMap) search(key Object) (int, *Error) {
+	if len(sm.Entries) > 0 {
+		if _, ok := compareKeys(sm.Entries[0].Key, key); !ok {
+			return 0, newCodedError(E_TYPE_MISMATCH, "sorted map keys must be comparable, got %s and %s",
+				sm.Entries[0].Key.Type(), key.Type())
+		}
+	} else if _, ok := compareKeys(key, key); !ok {
+		return 0, newCodedError(E_TYPE_MISMATCH, "sorted map key must be a number or a string, got %s", key.Type())
+	}
+
+	idx := sort.Search(len(sm.Entries), func(i int) bool {
+		cmp, _ := compareKeys(sm.Entries[i].Key, key)
+		return cmp >= 0
+	})
+	return idx, nil
+}
+
+func (sm *SortedMap) found(idx int, key Object) bool {
+	if idx >= len(sm.Entries) {
+		return false
+	}
+	cmp, _ := compareKeys(sm.Entries[idx].Key, key)
+	return cmp == 0
+}
+
+func (sm *SortedMap) Member(name string) (Object, bool) {
+	switch name {
+	case "set":
+		return method(func(args ...Object) Object {
+			if err := checkArity("set", args, 2); err != nil {
+				return err
+			}
+			idx, err := sm.search(args[0])
+			if err != nil {
+				return err
+			}
+			if sm.found(idx, args[0]) {
+				sm.Entries[idx].Value = args[1]
+				return sm
+			}
+			sm.Entries = append(sm.Entries, HashPair{})
+			copy(sm.Entries[idx+1:], sm.Entries[idx:])
+			sm.Entries[idx] = HashPair{Key: args[0], Value: args[1]}
+			return sm
+		}), true
+	case "get", "has", "delete":
+		return method(func(args ...Object) Object {
+			if err := checkArity(name, args, 1); err != nil {
+				return err
+			}
+			idx, err := sm.search(args[0])
+			if err != nil {
+				return err
+			}
+			found := sm.found(idx, args[0])
+			switch name {
+			case "has":
+				return nativeBoolToPyMonkeyBool(found)
+			case "delete":
+				if found {
+					sm.Entries = append(sm.Entries[:idx], sm.Entries[idx+1:]...)
+				}
+				return nativeBoolToPyMonkeyBool(found)
+			}
+			if !found {
+				return NULL
+			}
+			return sm.Entries[idx].Value
+		}), true
+	case "firstKey", "lastKey":
+		return method(func(args ...Object) Object {
+			if err := checkArity(name, args, 0); err != nil {
+				return err
+			}
+			if len(sm.Entries) == 0 {
+				return NULL
+			}
+			if name == "firstKey" {
+				return sm.Entries[0].Key
+			}
+			return sm.Entries[len(sm.Entries)-1].Key
+		}), true
+	case "floor":
+		// Greatest key less than or equal to the argument
+		return method(func(args ...Object) Object {
+			if err := checkArity("floor", args, 1); err != nil {
+				return err
+			}
+			idx, err := sm.search(args[0])
+			if err != nil {
+				return err
+			}
+			if sm.found(idx, args[0]) {
+				return sm.Entries[idx].Key
+			}
+			if idx == 0 {
+				return NULL
+			}
+			return sm.Entries[idx-1].Key
+		}), true
+	case "ceiling":
+		// Smallest key greater than or equal to the argument
+		return method(func(args ...Object) Object {
+			if err := checkArity("ceiling", args, 1); err != nil {
+				return err
+			}
+			idx, err := sm.search(args[0])
+			if err != nil {
+				return err
+			}
+			if idx >= len(sm.Entries) {
+				return NULL
+			}
+			return sm.Entries[idx].Key
+		}), true
+	case "range":
+		// Entries with from <= key < to as [key, value] pairs
+		return method(func(args ...Object) Object {
+			if err := checkArity("range", args, 2); err != nil {
+				return err
+			}
+			from, err := sm.search(args[0])
+			if err != nil {
+				return err
+			}
+			to, err := sm.search(args[1])
+			if err != nil {
+				return err
+			}
+			pairs := []Object{}
+			for i := from; i < to; i++ {
+				entry := sm.Entries[i]
+				pairs = append(pairs, &Array{Elements: []Object{entry.Key, entry.Value}})
+			}
+			return &Array{Elements: pairs}
+		}), true
+	case "keys", "values":
+		return method(func(args ...Object) Object {
+			if err := checkArity(name, args, 0); err != nil {
+				return err
+			}
+			elements := make([]Object, len(sm.Entries))
+			for i, entry := range sm.Entries {
+				if name == "keys" {
+					elements[i] = entry.Key
+				} else {
+					elements[i] = entry.Value
+				}
+			}
+			return &Array{Elements: elements}
+		}), true
+	case "size", "isEmpty":
+		return sizeMembers(name, func() []Object { return make([]Object, len(sm.Entries)) })
+	}
+	return nil, false
+}
+
+func isNumber(obj Object) bool {
+	return obj.Type() == INTEGER_OBJ || obj.Type() == FLOAT_OBJ
+}
+
+func toFloat(obj Object) float64 {
+	if f, ok := obj.(*Float); ok {
+		return f.Value
+	}
+	return float64(obj.(*Integer).Value)
+}
+
+// sizeMembers provides the members shared by every collection
+func sizeMembers(name string, elements func() []Object) (Object, bool) {
+	switch name {
+	case "size":
+		return method(func(args ...Object) Object {
+			if err := checkArity("size", args, 0); err != nil {
+				return err
+			}
+			return &Integer{Value: int64(len(elements()))}
+		}), true
+	case "isEmpty":
+		return method(func(args ...Object) Object {
+			if err := checkArity("isEmpty", args, 0); err != nil {
+				return err
+			}
+			return nativeBoolToPyMonkeyBool(len(elements()) == 0)
+		}), true
+	case "toArray":
+		return method(func(args ...Object) Object {
+			if err := checkArity("toArray", args, 0); err != nil {
+				return err
+			}
+			return &Array{Elements: append([]Object{}, elements()...)}
+		}), true
+	}
+	return nil, false
+}
@@ -0,0 +1,461 @@
+package evaluator
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+func init() {
+	registerBuiltin(&Builtin{
+		Name:   "equalsFold",
+		Params: []Param{{Name: "a", Types: []ObjectType{STRING_OBJ}}, {Name: "b", Types: []ObjectType{STRING_OBJ}}},
+		Doc:    "Reports whether two strings are equal ignoring case.",
+		Pure:   true,
+		Fn: func(args ...Object) Object {
+			return nativeBoolToPyMonkeyBool(strings.EqualFold(args[0].(*String).Value, args[1].(*String).Value))
+		},
+	})
+
+	registerBuiltin(&Builtin{
+		Name: "approxEqual",
+		Params: []Param{
+			{Name: "a", Types: approxTypes},
+			{Name: "b", Types: approxTypes},
+			{Name: "epsilon", Types: realTypes, Optional: true},
+		},
+		Doc:  "Reports whether two numbers, or arrays of them, differ by at most epsilon, or without it, agree to about nine significant digits.",
+		Pure: true,
+		Fn: func(args ...Object) Object {
+			epsilon, err := epsilonArg(args[2:])
+			if err != nil {
+				return err
+			}
+			equal, err := approxEqual(args[0], args[1], epsilon)
+			if err != nil {
+				return err
+			}
+			return nativeBoolToPyMonkeyBool(equal)
+		},
+	})
+
+	registerBuiltin(&Builtin{
+		Name: "assertApprox",
+		Params: []Param{
+			{Name: "actual", Types: approxTypes},
+			{Name: "expected", Types: approxTypes},
+			{Name: "epsilon", Types: realTypes, Optional: true},
+			{Name: "message", Types: []ObjectType{STRING_OBJ}, Optional: true},
+		},
+		Doc: "Fails unless approxEqual(actual, expected, epsilon) holds, for tests of code that computes with floats.",
+		Fn: func(args ...Object) Object {
+			epsilon, err := epsilonArg(args[2:])
+			if err != nil {
+				return err
+			}
+			equal, err := approxEqual(args[0], args[1], epsilon)
+			if err != nil {
+				return err
+			}
+			if equal {
+				return NULL
+			}
+			message := fmt.Sprintf("expected about %s, got %s", args[1].Inspect(), args[0].Inspect())
+			if epsilon != -1 {
+				message = fmt.Sprintf("expected %s within %g, got %s", args[1].Inspect(), epsilon, args[0].Inspect())
+			}
+			if len(args) > 3 {
+				message = args[3].(*String).Value + ": " + message
+			}
+			return newError("%s", message)
+		},
+	})
+
+	registerBuiltin(&Builtin{
+		Name: "compare",
+		Params: []Param{
+			{Name: "a", Types: []ObjectType{STRING_OBJ}},
+			{Name: "b", Types: []ObjectType{STRING_OBJ}},
+			{Name: "options", Types: []ObjectType{HASH_OBJ}, Optional: true},
+		},
+		Doc:  "Returns -1, 0 or 1 as a sorts before, with or after b. Options are caseInsensitive and locale.",
+		Pure: true,
+		Fn: func(args ...Object) Object {
+			var options *Hash
+			if len(args) == 3 {
+				options = args[2].(*Hash)
+			}
+			caseInsensitive, locale, err := compareOptions(options)
+			if err != nil {
+				return err
+			}
+			return &Integer{Value: int64(compareStrings(args[0].(*String).Value, args[1].(*String).Value, caseInsensitive, locale))}
+		},
+	})
+
+	registerBuiltin(&Builtin{
+		Name:   "sort",
+		Params: []Param{{Name: "array", Types: []ObjectType{ARRAY_OBJ}}, {Name: "cmp", Types: callableTypes, Optional: true}},
+		Doc:    "Returns a sorted copy of an array. cmp(a, b), such as compare, returns a negative number when a sorts first.",
+		Fn: func(args ...Object) Object {
+			elements := append([]Object{}, args[0].(*Array).Elements...)
+			compare := comparator(args[1:])
+
+			var err *Error
+			sort.SliceStable(elements, func(i, j int) bool {
+				if err != nil {
+					return false
+				}
+				var cmp int
+				cmp, err = compare(elements[i], elements[j])
+				return cmp < 0
+			})
+			if err != nil {
+				return err
+			}
+			return &Array{Elements: elements}
+		},
+	})
+
+	registerBuiltin(&Builtin{
+		Name:   "binarySearch",
+		Params: []Param{{Name: "array", Types: []ObjectType{ARRAY_OBJ}}, {Name: "value"}, {Name: "cmp", Types: callableTypes, Optional: true}},
+		Doc:    "Returns the index of value in a sorted array, or -1 when it is missing.",
+		Fn: func(args ...Object) Object {
+			elements := args[0].(*Array).Elements
+			compare := comparator(args[2:])
+			i, err := searchSorted(elements, args[1], compare)
+			if err != nil {
+				return err
+			}
+			if i == len(elements) {
+				return &Integer{Value: -1}
+			}
+			cmp, err := compare(elements[i], args[1])
+			if err != nil {
+				return err
+			}
+			if cmp != 0 {
+				return &Integer{Value: -1}
+			}
+			return &Integer{Value: int64(i)}
+		},
+	})
+
+	registerBuiltin(&Builtin{
+		Name:   "sortedInsert",
+		Params: []Param{{Name: "array", Types: []ObjectType{ARRAY_OBJ}}, {Name: "value"}, {Name: "cmp", Types: callableTypes, Optional: true}},
+		Doc:    "Inserts value into a sorted array in place, after any equal elements, and returns its index.",
+		Fn: func(args ...Object) Object {
+			arr := args[0].(*Array)
+			if err := checkMutable(arr); err != nil {
+				return err
+			}
+			compare := comparator(args[2:])
+			// Search for the first element greater than value
+			i, err := searchSorted(arr.Elements, args[1], func(a, b Object) (int, *Error) {
+				cmp, err := compare(a, b)
+				if cmp == 0 {
+					cmp = -1
+				}
+				return cmp, err
+			})
+			if err != nil {
+				return err
+			}
+			arr.Elements = append(arr.Elements, nil)
+			copy(arr.Elements[i+1:], arr.Elements[i:])
+			arr.Elements[i] = args[1]
+			return &Integer{Value: int64(i)}
+		},
+	})
+}
+
+// comparator returns the comparison a sorting builtin uses: the function
+// in cmp when one was given, or else compareObjects
+func comparator(cmp []Object) func(a, b Object) (int, *Error) {
+	if len(cmp) == 0 {
+		return compareObjects
+	}
+	return func(a, b Object) (int, *Error) {
+		return comparisonResult("comparison function", applyFunction(cmp[0], []Object{a, b}))
+	}
+}
+
+// Comparable is implemented by values with a natural order. Sorting, min
+// and max, the < and > operators, heaps and sorted maps all order values
+// through it, so they agree on what comes first. Numbers compare with
+// numbers of any kind by value, and strings with strings byte by byte;
+// no other values compare across types.
+type Comparable interface {
+	// Compare returns -1, 0 or 1 as the value sorts before, with or after
+	// other, and false when the two have no order between them
+	Compare(other Object) (int, bool)
+}
+
+func (i *Integer) Compare(other Object) (int, bool) {
+	if o, ok := other.(*Integer); ok {
+		return cmp.Compare(i.Value, o.Value), true
+	}
+	return compareNumbers(i, other)
+}
+
+func (f *Float) Compare(other Object) (int, bool)    { return compareNumbers(f, other) }
+func (f *Fraction) Compare(other Object) (int, bool) { return compareNumbers(f, other) }
+func (d *Decimal) Compare(other Object) (int, bool)  { return compareNumbers(d, other) }
+
+func (s *String) Compare(other Object) (int, bool) {
+	o, ok := other.(*String)
+	if !ok {
+		return 0, false
+	}
+	return strings.Compare(s.Value, o.Value), true
+}
+
+// realTypes are the numbers with an order
+var realTypes = []ObjectType{INTEGER_OBJ, FLOAT_OBJ, FRACTION_OBJ, DECIMAL_OBJ}
+
+// approxTypes are the values approxEqual compares
+var approxTypes = append([]ObjectType{ARRAY_OBJ}, realTypes...)
+
+// defaultEpsilon is the tolerance of approxEqual when none is given
+// relative to the larger of the numbers when it is above 1
+const defaultEpsilon = 1e-9
+
+// epsilonArg returns the epsilon given in args, or -1 for the default
+func epsilonArg(args []Object) (float64, *Error) {
+	if len(args) == 0 {
+		return -1, nil
+	}
+	epsilon := realToFloat(args[0])
+	if !(epsilon >= 0) {
+		return 0, newCodedError(E_VALUE, "epsilon must not be negative, got %s", args[0].Inspect())
+	}
+	return epsilon, nil
+}
+
+// approxEqual reports whether a and b, numbers or arrays of them, are
+// equal within epsilon, or for an epsilon of -1, within defaultEpsilon
+// relative to the larger
+func approxEqual(a, b Object, epsilon float64) (bool, *Error) {
+	x, isArray := a.(*Array)
+	y, bothArrays := b.(*Array)
+	switch {
+	case isArray && bothArrays:
+		if len(x.Elements) != len(y.Elements) {
+			return false, nil
+		}
+		for i := range x.Elements {
+			if equal, err := approxEqual(x.Elements[i], y.Elements[i], epsilon); !equal || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	case isArray || bothArrays:
+		return false, nil
+	case !hasType(realTypes, a.Type()) || !hasType(realTypes, b.Type()):
+		return false, newCodedError(E_TYPE_MISMATCH, "approxEqual compares numbers, got %s and %s", a.Type(), b.Type())
+	}
+	f, g := realToFloat(a), realToFloat(b)
+	if f == g {
+		// Equal infinities, whose difference is NaN
+		return true, nil
+	}
+	if epsilon == -1 {
+		return math.Abs(f-g) <= defaultEpsilon*max(1, math.Abs(f), math.Abs(g)), nil
+	}
+	return math.Abs(f-g) <= epsilon, nil
+}
+
+// compareNumbers orders two real numbers: as floats when either is one,
+// and exactly otherwise. NaN is neither before nor after anything.
+func compareNumbers(a, b Object) (int, bool) {
+	if !hasType(realTypes, a.Type()) || !hasType(realTypes, b.Type()) {
+		return 0, false
+	}
+	if a.Type() == FLOAT_OBJ || b.Type() == FLOAT_OBJ {
+		x, y := realToFloat(a), realToFloat(b)
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+	return realToRat(a).Cmp(realToRat(b)), true
+}
+
+// realToRat converts an integer, fraction or decimal to a big.Rat
+func realToRat(obj Object) *big.Rat {
+	if d, ok := obj.(*Decimal); ok {
+		return new(big.Rat).SetFrac(d.Unscaled, pow10(d.Scale))
+	}
+	return toRat(obj)
+}
+
+func realToFloat(obj Object) float64 {
+	if f, ok := obj.(*Float); ok {
+		return f.Value
+	}
+	f, _ := realToRat(obj).Float64()
+	return f
+}
+
+// compareKeys orders two Comparable values, for heaps and sorted maps,
+// whose keys can't run code
+func compareKeys(a, b Object) (int, bool) {
+	if c, ok := a.(Comparable); ok {
+		return c.Compare(b)
+	}
+	return 0, false
+}
+
+// compareObjects orders two values for sorting, min and max. An object
+// with a __cmp__ function is ordered by calling it with the object and the
+// other value; anything else must be Comparable.
+func compareObjects(a, b Object) (int, *Error) {
+	result, ok, err := order(a, b)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, newCodedError(E_TYPE_MISMATCH, "cannot compare %s and %s", a.Type(), b.Type())
+	}
+	return result, nil
+}
+
+// order compares a and b, reporting false when they have no order
+func order(a, b Object) (int, bool, *Error) {
+	if hook := cmpHook(a); hook != nil {
+		result, err := comparisonResult("__cmp__", applyFunction(hook, []Object{a, b}))
+		return result, true, err
+	}
+	if hook := cmpHook(b); hook != nil {
+		result, err := comparisonResult("__cmp__", applyFunction(hook, []Object{b, a}))
+		return -result, true, err
+	}
+	result, ok := compareKeys(a, b)
+	return result, ok, nil
+}
+
+// cmpHook returns the __cmp__ function of an object, or nil
+func cmpHook(obj Object) Object {
+	return protocolHook(obj, "__cmp__")
+}
+
+// protocolHook returns the function an object holds under a protocol
+// name such as __cmp__ or __len__, or nil
+func protocolHook(obj Object, name string) Object {
+	hash, ok := obj.(*Hash)
+	if !ok {
+		return nil
+	}
+	pair, ok := hash.Pairs[stringHashKey(name)]
+	if !ok || !hasType(callableTypes, pair.Value.Type()) {
+		return nil
+	}
+	return pair.Value
+}
+
+// comparisonResult turns what a comparison function returned into -1, 0
+// or 1
+func comparisonResult(what string, result Object) (int, *Error) {
+	if err, ok := result.(*Error); ok {
+		return 0, err
+	}
+	if !isNumber(result) {
+		return 0, newCodedError(E_TYPE_MISMATCH, "%s must return a number, got %s", what, result.Type())
+	}
+	switch f := toFloat(result); {
+	case f < 0:
+		return -1, nil
+	case f > 0:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// evalComparisonExpression evaluates < and > for everything but two
+// integers, which evalIntegerInfixExpression compares directly as the
+// most common case
+func evalComparisonExpression(operator string, left, right Object) Object {
+	result, ok, err := order(left, right)
+	switch {
+	case err != nil:
+		return err
+	case !ok && left.Type() != right.Type():
+		return newCodedError(E_TYPE_MISMATCH, "type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	case !ok:
+		return newCodedError(E_UNKNOWN_OPERATOR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	case operator == "<":
+		return nativeBoolToPyMonkeyBool(result < 0)
+	default:
+		return nativeBoolToPyMonkeyBool(result > 0)
+	}
+}
+
+// searchSorted returns the index of the first element of a sorted array
+// that is not less than value
+func searchSorted(elements []Object, value Object, compare func(a, b Object) (int, *Error)) (int, *Error) {
+	lo, hi := 0, len(elements)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		cmp, err := compare(elements[mid], value)
+		if err != nil {
+			return 0, err
+		}
+		if cmp < 0 {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
+
+// compareOptions reads the options hash given to compare
+func compareOptions(options *Hash) (bool, string, *Error) {
+	if options == nil {
+		return false, "", nil
+	}
+
+	caseInsensitive, locale := false, ""
+	for _, pair := range sortedPairs(options) {
+		switch pair.Key.Inspect() {
+		case "caseInsensitive":
+			value, ok := pair.Value.(*Boolean)
+			if !ok {
+				return false, "", newCodedError(E_TYPE_MISMATCH, "option caseInsensitive must be BOOLEAN, got %s", pair.Value.Type())
+			}
+			caseInsensitive = value.Value
+		case "locale":
+			value, ok := pair.Value.(*String)
+			if !ok {
+				return false, "", newCodedError(E_TYPE_MISMATCH, "option locale must be STRING, got %s", pair.Value.Type())
+			}
+			locale = value.Value
+		default:
+			return false, "", newCodedError(E_VALUE, "unknown option %s to `compare`", pair.Key.Inspect())
+		}
+	}
+	return caseInsensitive, locale, nil
+}
+
+// compareStrings orders two strings. Without a locale they are compared
+// byte by byte, so "Zoo" sorts before "apple". With any locale (other than
+// "C") they are in dictionary order: letters compare ignoring case, and
+// only strings that differ just in case put lowercase first. Rules
+// specific to a language, such as accents, are not applied.
+func compareStrings(a, b string, caseInsensitive bool, locale string) int {
+	if caseInsensitive || (locale != "" && locale != "C") {
+		if cmp := strings.Compare(strings.ToLower(a), strings.ToLower(b)); cmp != 0 || caseInsensitive {
+			return cmp
+		}
+		return -strings.Compare(a, b)
+	}
+	return strings.Compare(a, b)
+}
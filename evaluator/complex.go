@@ -0,0 +1,73 @@
+package evaluator
+
+import "fmt"
+
+const COMPLEX_OBJ = "COMPLEX"
+
+func init() {
+	registerBuiltin(&Builtin{
+		Name:   "complex",
+		Params: []Param{{Name: "re", Types: []ObjectType{INTEGER_OBJ, FLOAT_OBJ}}, {Name: "im", Types: []ObjectType{INTEGER_OBJ, FLOAT_OBJ}}},
+		Doc:    "Returns the complex number re + im*i.",
+		Fn: func(args ...Object) Object {
+			return &Complex{Value: complex(toFloat(args[0]), toFloat(args[1]))}
+		},
+	})
+}
+
+// Complex object, written as in 3 + 4i
+type Complex struct {
+	Value complex128
+}
+
+func (c *Complex) Type() ObjectType { return COMPLEX_OBJ }
+func (c *Complex) Inspect() string {
+	return fmt.Sprintf("%g%+gi", real(c.Value), imag(c.Value))
+}
+
+// toComplex converts numbers and complex numbers to a complex128
+func toComplex(obj Object) (complex128, bool) {
+	switch obj := obj.(type) {
+	case *Complex:
+		return obj.Value, true
+	case *Integer, *Float:
+		return complex(toFloat(obj), 0), true
+	}
+	return 0, false
+}
+
+// isComplexOperation reports whether an infix operation mixes a complex
+// number with another number or complex number
+func isComplexOperation(left, right Object) bool {
+	if left.Type() != COMPLEX_OBJ && right.Type() != COMPLEX_OBJ {
+		return false
+	}
+	_, leftOK := toComplex(left)
+	_, rightOK := toComplex(right)
+	return leftOK && rightOK
+}
+
+func evalComplexInfixExpression(operator string, left, right Object) Object {
+	leftVal, _ := toComplex(left)
+	rightVal, _ := toComplex(right)
+
+	switch operator {
+	case "+":
+		return &Complex{Value: leftVal + rightVal}
+	case "-":
+		return &Complex{Value: leftVal - rightVal}
+	case "*":
+		return &Complex{Value: leftVal * rightVal}
+	case "/":
+		if rightVal == 0 {
+			return newCodedError(E_DIV_ZERO, "division by zero")
+		}
+		return &Complex{Value: leftVal / rightVal}
+	case "==":
+		return nativeBoolToPyMonkeyBool(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToPyMonkeyBool(leftVal != rightVal)
+	default:
+		return newCodedError(E_UNKNOWN_OPERATOR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
@@ -0,0 +1,130 @@
+package evaluator
+
+import (
+	"fmt"
+	"sync"
+)
+
+const COUNTERS_OBJ = "COUNTERS"
+
+// Counters are an interpreter's named counters, which a script counts
+// what its code does with, such as the comparisons a sort makes, instead
+// of printing as it goes. runtime.counters() returns them, and gokid run
+// --stats prints them when the program ends. They stay in the process:
+// nothing is sent anywhere.
+type Counters struct {
+	mu     sync.Mutex
+	names  []string // in the order they were registered
+	counts map[string]int64
+}
+
+func newCounters() *Counters {
+	return &Counters{counts: map[string]int64{}}
+}
+
+// Counters returns the counters of the interpreter env belongs to
+func (e *Environment) Counters() *Counters {
+	return e.session.counters
+}
+
+// Names returns the names of the counters, in the order they were
+// registered
+func (c *Counters) Names() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string{}, c.names...)
+}
+
+// Get returns the count of the counter called name, 0 if there is none
+func (c *Counters) Get(name string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[name]
+}
+
+// Add adds n to the counter called name, registering it first if needed,
+// and returns its count
+func (c *Counters) Add(name string, n int64) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.counts[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.counts[name] += n
+	return c.counts[name]
+}
+
+func (c *Counters) Type() ObjectType { return COUNTERS_OBJ }
+func (c *Counters) Inspect() string {
+	return fmt.Sprintf("counters(%d)", len(c.Names()))
+}
+
+func (c *Counters) Member(name string) (Object, bool) {
+	switch name {
+	case "register":
+		return method(func(args ...Object) Object {
+			for _, arg := range args {
+				name, ok := arg.(*String)
+				if !ok {
+					return newCodedError(E_TYPE_MISMATCH, "counter names must be strings, got %s", arg.Type())
+				}
+				c.Add(name.Value, 0)
+			}
+			return c
+		}), true
+	case "inc":
+		return method(func(args ...Object) Object {
+			if len(args) < 1 || len(args) > 2 {
+				return newCodedError(E_ARITY, "wrong number of arguments to `inc`. got=%d, want=1 or 2", len(args))
+			}
+			name, ok := args[0].(*String)
+			if !ok {
+				return newCodedError(E_TYPE_MISMATCH, "counter names must be strings, got %s", args[0].Type())
+			}
+			n := int64(1)
+			if len(args) == 2 {
+				by, ok := args[1].(*Integer)
+				if !ok {
+					return newCodedError(E_TYPE_MISMATCH, "a counter goes up by an integer, got %s", args[1].Type())
+				}
+				n = by.Value
+			}
+			return &Integer{Value: c.Add(name.Value, n)}
+		}), true
+	case "get":
+		return method(func(args ...Object) Object {
+			if err := checkArity("get", args, 1); err != nil {
+				return err
+			}
+			name, ok := args[0].(*String)
+			if !ok {
+				return newCodedError(E_TYPE_MISMATCH, "counter names must be strings, got %s", args[0].Type())
+			}
+			return &Integer{Value: c.Get(name.Value)}
+		}), true
+	case "all":
+		return method(func(args ...Object) Object {
+			if err := checkArity("all", args, 0); err != nil {
+				return err
+			}
+			counts := map[string]Object{}
+			for _, name := range c.Names() {
+				counts[name] = &Integer{Value: c.Get(name)}
+			}
+			return newHash(counts)
+		}), true
+	case "reset":
+		return method(func(args ...Object) Object {
+			if err := checkArity("reset", args, 0); err != nil {
+				return err
+			}
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			for name := range c.counts {
+				c.counts[name] = 0
+			}
+			return c
+		}), true
+	}
+	return nil, false
+}
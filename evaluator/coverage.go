@@ -0,0 +1,60 @@
+package evaluator
+
+import (
+	"gokid/parser"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// Coverage counts how many times each statement of each file ran, for
+// finding the code a test suite never reaches. Statements are identified
+// by the source offset they start at.
+type Coverage struct {
+	mu   sync.Mutex
+	hits map[string]map[int]int
+}
+
+// NewCoverage returns an empty set of counts
+func NewCoverage() *Coverage {
+	return &Coverage{hits: map[string]map[int]int{}}
+}
+
+// SetCoverage makes the interpreter count the statements it runs in c.
+// Several interpreters may count in the same c. Passing nil stops the
+// counting.
+func (e *Environment) SetCoverage(c *Coverage) {
+	e.session.coverage = c
+}
+
+// hit counts a run of stmt, from the file at path. Code that isn't in a
+// file, such as a REPL line, isn't counted.
+func (c *Coverage) hit(path string, stmt parser.Statement) {
+	offset := parser.StatementToken(stmt).Offset
+	if path == "" || offset < 0 {
+		return
+	}
+	c.mu.Lock()
+	file, ok := c.hits[path]
+	if !ok {
+		file = map[int]int{}
+		c.hits[path] = file
+	}
+	file[offset]++
+	c.mu.Unlock()
+}
+
+// Files returns the files that had statements run, in order
+func (c *Coverage) Files() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Sorted(maps.Keys(c.hits))
+}
+
+// Hits returns how many times the statement at each offset of the file
+// at path ran. Statements that never ran are missing.
+func (c *Coverage) Hits(path string) map[int]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return maps.Clone(c.hits[path])
+}
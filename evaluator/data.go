@@ -0,0 +1,92 @@
+package evaluator
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gokid/parser"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dataFormats parses the data files import can load, by extension. A data
+// file is bound to the value it holds instead of to a module.
+var dataFormats = map[string]func(source []byte) (Object, error){
+	".json": parseJSONData,
+	".csv":  parseCSVData,
+}
+
+// IsDataFile reports whether import loads the file at path as data, such
+// as a JSON file, instead of running it as a module
+func IsDataFile(path string) bool {
+	_, ok := dataFormats[strings.ToLower(filepath.Ext(path))]
+	return ok
+}
+
+// importData binds the value in the data file at path, parsed as format.
+// The file is read on every import, so importers never share the value.
+func importData(path string, format func([]byte) (Object, error), is *parser.ImportStatement, env *Environment) Object {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return newCodedError(E_IMPORT, "cannot import %s: %s", path, err)
+	}
+	if err := env.session.meter.useRead(len(source)); err != nil {
+		return err
+	}
+	value, err := format(source)
+	if err != nil {
+		return newCodedError(E_IMPORT, "cannot import %s: %s", path, err)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if is.Alias != nil {
+		name = is.Alias.Value
+	}
+	env.Set(name, value)
+	return NULL
+}
+
+func parseJSONData(source []byte) (Object, error) {
+	value, err := decodeJSON(source)
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(source) {
+		return nil, errors.New("unexpected text after the JSON value")
+	}
+	return fromJSONValue(value), nil
+}
+
+// parseCSVData reads a CSV file whose first row names its columns into an
+// array with an object per row. Fields stay strings; num converts them.
+func parseCSVData(source []byte) (Object, error) {
+	reader := csv.NewReader(bytes.NewReader(source))
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return &Array{Elements: []Object{}}, nil
+	}
+
+	header := records[0]
+	seen := make(map[string]bool, len(header))
+	for _, column := range header {
+		if seen[column] {
+			return nil, fmt.Errorf("column %q appears more than once in the header", column)
+		}
+		seen[column] = true
+	}
+	rows := make([]Object, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make(map[string]Object, len(header))
+		for i, column := range header {
+			row[column] = &String{Value: record[i]}
+		}
+		rows = append(rows, newHash(row))
+	}
+	return &Array{Elements: rows}, nil
+}
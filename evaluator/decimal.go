@@ -0,0 +1,214 @@
+package evaluator
+
+import (
+	"math/big"
+	"strings"
+)
+
+const DECIMAL_OBJ = "DECIMAL"
+
+// divisionScale is the number of decimal places division keeps
+const divisionScale = 20
+
+func init() {
+	registerBuiltin(&Builtin{
+		Name:   "decimal",
+		Params: []Param{{Name: "value", Types: []ObjectType{STRING_OBJ, INTEGER_OBJ}}},
+		Doc:    "Returns an exact decimal number, such as decimal(\"19.99\"), for money arithmetic.",
+		Fn: func(args ...Object) Object {
+			if n, ok := args[0].(*Integer); ok {
+				return &Decimal{Unscaled: big.NewInt(n.Value)}
+			}
+			return parseDecimal(args[0].(*String).Value)
+		},
+	})
+}
+
+// Decimal object, an exact fixed-point number equal to Unscaled / 10^Scale.
+// Its value is never changed once created.
+type Decimal struct {
+	Unscaled *big.Int
+	Scale    int
+}
+
+func (d *Decimal) Type() ObjectType { return DECIMAL_OBJ }
+func (d *Decimal) Inspect() string {
+	digits := new(big.Int).Abs(d.Unscaled).String()
+	if d.Scale > 0 {
+		if len(digits) <= d.Scale {
+			digits = strings.Repeat("0", d.Scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-d.Scale] + "." + digits[len(digits)-d.Scale:]
+	}
+	if d.Unscaled.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+func (d *Decimal) Member(name string) (Object, bool) {
+	if name != "round" {
+		return nil, false
+	}
+	return method(func(args ...Object) Object {
+		if len(args) < 1 || len(args) > 2 {
+			return newCodedError(E_ARITY, "wrong number of arguments to `round`. got=%d, want=1 or 2", len(args))
+		}
+		places, ok := args[0].(*Integer)
+		if !ok || places.Value < 0 {
+			return newCodedError(E_VALUE, "argument `places` to `round` must be a non-negative INTEGER, got %s", args[0].Inspect())
+		}
+		mode := "half-even"
+		if len(args) == 2 {
+			s, ok := args[1].(*String)
+			if !ok || !isRoundingMode(s.Value) {
+				return newCodedError(E_VALUE, "argument `mode` to `round` must be one of %s, got %s", strings.Join(roundingModes, ", "), args[1].Inspect())
+			}
+			mode = s.Value
+		}
+		return d.rescale(int(places.Value), mode)
+	}), true
+}
+
+// roundingModes are the modes round accepts, the default first
+var roundingModes = []string{"half-even", "half-up", "half-down", "up", "down", "ceiling", "floor"}
+
+func isRoundingMode(mode string) bool {
+	for _, m := range roundingModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDecimal reads a decimal such as "-12.50"
+func parseDecimal(s string) Object {
+	text := strings.TrimSpace(s)
+	digits := strings.TrimLeft(text, "+-")
+	whole, fraction, _ := strings.Cut(digits, ".")
+	if whole == "" && fraction == "" || strings.Trim(whole+fraction, "0123456789") != "" || len(text)-len(digits) > 1 {
+		return newCodedError(E_VALUE, "cannot convert %q to a decimal", s)
+	}
+
+	unscaled, _ := new(big.Int).SetString(whole+fraction, 10)
+	if strings.HasPrefix(text, "-") {
+		unscaled.Neg(unscaled)
+	}
+	return &Decimal{Unscaled: unscaled, Scale: len(fraction)}
+}
+
+// rescale returns d with the given number of decimal places, rounding
+// with mode when places are dropped
+func (d *Decimal) rescale(scale int, mode string) *Decimal {
+	if scale >= d.Scale {
+		return &Decimal{Unscaled: new(big.Int).Mul(d.Unscaled, pow10(scale-d.Scale)), Scale: scale}
+	}
+	return &Decimal{Unscaled: divRound(d.Unscaled, pow10(d.Scale-scale), mode), Scale: scale}
+}
+
+// trim drops trailing zero decimal places, keeping at least min places
+func (d *Decimal) trim(min int) *Decimal {
+	unscaled, scale := new(big.Int).Set(d.Unscaled), d.Scale
+	ten, rem := big.NewInt(10), new(big.Int)
+	for scale > min {
+		quo, r := new(big.Int).QuoRem(unscaled, ten, rem)
+		if r.Sign() != 0 {
+			break
+		}
+		unscaled, scale = quo, scale-1
+	}
+	return &Decimal{Unscaled: unscaled, Scale: scale}
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// divRound divides num by den, rounding the quotient with mode
+func divRound(num, den *big.Int, mode string) *big.Int {
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Sign() == 0 {
+		return quo
+	}
+
+	sign := int64(num.Sign() * den.Sign())
+	// Compare the remainder with half the divisor
+	half := new(big.Int).Abs(rem)
+	half.Mul(half, big.NewInt(2))
+	cmp := half.Cmp(new(big.Int).Abs(den))
+
+	var away bool
+	switch mode {
+	case "up":
+		away = true
+	case "down":
+		away = false
+	case "ceiling":
+		away = sign > 0
+	case "floor":
+		away = sign < 0
+	case "half-up":
+		away = cmp >= 0
+	case "half-down":
+		away = cmp > 0
+	default: // half-even
+		away = cmp > 0 || (cmp == 0 && quo.Bit(0) == 1)
+	}
+	if away {
+		quo.Add(quo, big.NewInt(sign))
+	}
+	return quo
+}
+
+// isDecimalOperation reports whether an infix operation mixes a decimal
+// with an integer or decimal. Decimals don't mix with floats, whose
+// rounding errors they exist to avoid.
+func isDecimalOperation(left, right Object) bool {
+	if left.Type() != DECIMAL_OBJ && right.Type() != DECIMAL_OBJ {
+		return false
+	}
+	return hasType([]ObjectType{INTEGER_OBJ, DECIMAL_OBJ}, left.Type()) &&
+		hasType([]ObjectType{INTEGER_OBJ, DECIMAL_OBJ}, right.Type())
+}
+
+func toDecimal(obj Object) *Decimal {
+	if d, ok := obj.(*Decimal); ok {
+		return d
+	}
+	return &Decimal{Unscaled: big.NewInt(obj.(*Integer).Value)}
+}
+
+func evalDecimalInfixExpression(operator string, left, right Object) Object {
+	leftVal := toDecimal(left)
+	rightVal := toDecimal(right)
+
+	scale := leftVal.Scale
+	if rightVal.Scale > scale {
+		scale = rightVal.Scale
+	}
+	a := leftVal.rescale(scale, "").Unscaled
+	b := rightVal.rescale(scale, "").Unscaled
+
+	switch operator {
+	case "+":
+		return &Decimal{Unscaled: new(big.Int).Add(a, b), Scale: scale}
+	case "-":
+		return &Decimal{Unscaled: new(big.Int).Sub(a, b), Scale: scale}
+	case "*":
+		return &Decimal{Unscaled: new(big.Int).Mul(leftVal.Unscaled, rightVal.Unscaled), Scale: leftVal.Scale + rightVal.Scale}
+	case "/":
+		if b.Sign() == 0 {
+			return newCodedError(E_DIV_ZERO, "division by zero")
+		}
+		// a and b share a scale, so a/b needs divisionScale more places
+		quotient := &Decimal{Unscaled: divRound(new(big.Int).Mul(a, pow10(divisionScale)), b, "half-even"), Scale: divisionScale}
+		return quotient.trim(scale)
+	case "==":
+		return nativeBoolToPyMonkeyBool(a.Cmp(b) == 0)
+	case "!=":
+		return nativeBoolToPyMonkeyBool(a.Cmp(b) != 0)
+	default:
+		return newCodedError(E_UNKNOWN_OPERATOR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
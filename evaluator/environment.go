@@ -1,35 +1,681 @@
 package evaluator
 
-// Environment holds variable bindings
+import (
+	"bufio"
+	"context"
+	"gokid/logging"
+	"gokid/parser"
+	"gokid/tokens"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Environment holds variable bindings, keyed by interned name
 type Environment struct {
-	store map[string]Object
-	outer *Environment // for scope chaining
+	store   map[tokens.Ident]Object
+	outer   *Environment // for scope chaining
+	session *session     // shared by every scope of one interpreter
+
+	path    string                // source file of a top-level scope
+	lines   []int                 // offsets where each line of the scope's source starts
+	data    *String               // the data section of the scope's source, if it has one
+	dialect tokens.Dialect        // the keywords of the scope's source
+	exports []string              // names exported by a module scope
+	globals map[tokens.Ident]bool // names declared with `global` in this scope
+
+	// block marks the scope of a for loop iteration or a catch block,
+	// which holds only the variables declared in it; other assignments go
+	// to the scope around it
+	block bool
+
+	// captured marks a scope something may still refer to after the code
+	// running in it has finished, such as a closure
+	captured atomic.Bool
+
+	// mu guards store and globals when the interpreter is concurrent
+	mu sync.RWMutex
 }
 
-// NewEnvironment creates a new environment
+// session holds per-interpreter state shared by all nested environments
+type session struct {
+	step      StepFunc
+	stepEvery int
+	steps     int
+
+	// last is the statement run last and lastEnv the scope it ran in, so
+	// a report of the interpreter failing can say where it was. When that
+	// scope is a function call's, recycled once the call returns, lastPos
+	// holds where the statement is instead and lastEnv is nil.
+	last    parser.Statement
+	lastEnv *Environment
+	lastPos Position
+
+	// concurrent, set by SetConcurrent, makes scopes lock their variables
+	// and the session lock its own state with mu
+	concurrent bool
+	mu         sync.Mutex
+
+	// loopLimit and loopTimeout, set by SetLoopGuard, stop a single loop
+	// after that many iterations or that long; zero means no limit
+	loopLimit   int
+	loopTimeout time.Duration
+
+	warnings  []*Warning
+	warned    map[parser.Node]bool
+	onWarning func(*Warning)
+
+	// Builtin functions and modules, copied from the registered defaults
+	// so each interpreter can change its own
+	builtins map[string]*Builtin
+	modules  map[string]*Module
+
+	// hidden holds the standard modules that aren't global names until a
+	// program imports them with import "std/<name>", or the host preloads
+	// them
+	hidden map[string]bool
+
+	// resolved holds the builtins and modules no variable has ever been
+	// bound over. Identifiers naming one of them are looked up here
+	// before walking the environment chain, which would otherwise be
+	// searched in full on every reference to a builtin.
+	resolved map[tokens.Ident]Object
+
+	// meter counts what the programs use against the host's limits
+	meter *meter
+
+	// running is the file whose code is running, once accounting has
+	// started, with what it has used since it started running
+	running running
+
+	// coverage, set by SetCoverage, counts the statements run
+	coverage *Coverage
+
+	// hooks, set by SetHooks, watch the program run
+	hooks Hooks
+
+	// recording, set by SetRecording, keeps the history of the run
+	recording *Recording
+
+	// imports are the modules the interpreter imported from files
+	imports *moduleCache
+
+	// exitHooks are the functions registered with os.atexit, to run when
+	// the program ends
+	exitHooks []Object
+
+	// flags holds the options declared with the flags module
+	flags flagState
+
+	// evalDisabled, set by DisableEval, makes eval and evalIn fail
+	evalDisabled bool
+
+	// importsDisabled, set by DisableImports, makes imports other than
+	// standard modules fail
+	importsDisabled bool
+
+	// deterministic, set by a file's #deterministic pragma, stops the
+	// clock at fixedTime
+	deterministic bool
+
+	// isolated marks a copy of an interpreter, such as an HTTP worker,
+	// which leaves signals and host tasks to the original
+	isolated bool
+
+	// forker, for an isolated copy, is what copied it, which also copies
+	// the modules the copy imports, so it never runs the original's code
+	forker *forker
+
+	// stdout and stderr, set by SetOutput, receive the program's output;
+	// nil means the process's own. buffer, set by SetOutputBuffer, holds
+	// output on its way to stdout.
+	stdout io.Writer
+	stderr io.Writer
+	buffer *bufio.Writer
+
+	// stdin, set by SetInput, is what input reads; nil until input first
+	// reads the process's own. reading is a read input stopped waiting
+	// for when the interpreter's context was done.
+	stdin   *bufio.Reader
+	reading chan lineRead
+
+	// counters are the named counters of runtime.counters(), shared with
+	// the interpreter's copies
+	counters *Counters
+
+	// ctx, set by SetContext, stops the interpreter once it is done.
+	// ticks counts loop iterations and calls between yield points.
+	ctx   context.Context
+	ticks atomic.Uint32
+}
+
+func newSession() *session {
+	s := &session{
+		builtins: make(map[string]*Builtin, len(builtins)),
+		modules:  make(map[string]*Module, len(modules)),
+		resolved: make(map[tokens.Ident]Object, len(builtins)+len(modules)),
+		hidden:   make(map[string]bool, len(modules)),
+		meter:    &meter{},
+		counters: newCounters(),
+		imports:  newModuleCache(),
+	}
+	for name, m := range modules {
+		s.modules[name] = s.bindModule(m)
+		s.hidden[name] = true
+	}
+	for name, b := range builtins {
+		s.builtins[name] = s.bind(b)
+		s.resolved[tokens.Intern(name)] = s.builtins[name]
+	}
+	return s
+}
+
+// SetOutput makes print and other builtins that write output use stdout,
+// and messages such as failed hot reloads use stderr, instead of the
+// process's own. A nil writer restores the default.
+func (e *Environment) SetOutput(stdout, stderr io.Writer) {
+	s := e.session
+	s.flush()
+	s.stdout = stdout
+	s.stderr = stderr
+	if s.buffer != nil {
+		s.buffer.Reset(s.rawOut())
+	}
+}
+
+// SetOutputBuffer collects up to size bytes of the program's output before
+// writing it, saving a write per print for programs that print a lot.
+// Output is written when the buffer fills, when the program calls flush
+// or os.exit, and when the host calls Flush. A size of 0, the default,
+// writes every print straight away.
+func (e *Environment) SetOutputBuffer(size int) {
+	s := e.session
+	s.flush()
+	s.buffer = nil
+	if size > 0 {
+		s.buffer = bufio.NewWriterSize(s.rawOut(), size)
+	}
+}
+
+// Flush writes any output held back by SetOutputBuffer
+func (e *Environment) Flush() error {
+	return e.session.flush()
+}
+
+// Stdout returns the writer the program's output goes to
+func (e *Environment) Stdout() io.Writer {
+	return e.session.out()
+}
+
+// Stderr returns the writer the program's error messages go to
+func (e *Environment) Stderr() io.Writer {
+	return e.session.errOut()
+}
+
+// Output returns the writers set with SetOutput, os.Stdout and os.Stderr
+// if none were, so a host can wrap them and set them back
+func (e *Environment) Output() (stdout, stderr io.Writer) {
+	return e.session.rawOut(), e.session.errOut()
+}
+
+// out is the standard output builtins write to, metered for the write
+// quota
+func (s *session) out() io.Writer {
+	return meteredOutput{s}
+}
+
+// target is where the standard output goes: the buffer or the writer
+func (s *session) target() io.Writer {
+	if s.buffer != nil {
+		return s.buffer
+	}
+	return s.rawOut()
+}
+
+func (s *session) rawOut() io.Writer {
+	if s.stdout == nil {
+		return os.Stdout
+	}
+	return s.stdout
+}
+
+func (s *session) flush() error {
+	if s.buffer == nil {
+		return nil
+	}
+	return s.buffer.Flush()
+}
+
+func (s *session) errOut() io.Writer {
+	if s.stderr == nil {
+		return os.Stderr
+	}
+	return s.stderr
+}
+
+// bind returns b with its output, if it writes any, going to the
+// session's standard output, its sessionFn, if it has one, called with
+// the session, and its calls counted against the session's quota if it
+// uses a capability such as HTTP
+func (s *session) bind(b *Builtin) *Builtin {
+	switch {
+	case b.OutFn != nil:
+		bound := *b
+		bound.Fn = func(args ...Object) Object {
+			result := b.OutFn(s.out(), args...)
+			if err := s.meter.refused.Swap(nil); err != nil {
+				return err
+			}
+			return result
+		}
+		return &bound
+	case b.capability != "" || b.sessionFn != nil:
+		bound := *b
+		fn := b.unmetered
+		if b.sessionFn != nil {
+			fn = func(args ...Object) Object { return b.sessionFn(s, args...) }
+		} else if fn == nil {
+			fn = b.Fn
+		}
+		bound.unmetered, bound.Fn = fn, fn
+		if b.capability != "" {
+			bound.Fn = func(args ...Object) Object {
+				if err := s.meter.use(b.capability); err != nil {
+					return err
+				}
+				return fn(args...)
+			}
+		}
+		return &bound
+	default:
+		return b
+	}
+}
+
+// bindModule returns m with its builtins bound to the session, copying it
+// only if one of them writes output, is metered or needs the session
+func (s *session) bindModule(m *Module) *Module {
+	var members map[string]Object
+	for name, member := range m.Members {
+		if b, ok := member.(*Builtin); ok && (b.OutFn != nil || b.capability != "" || b.sessionFn != nil) {
+			if members == nil {
+				members = make(map[string]Object, len(m.Members))
+				for name, member := range m.Members {
+					members[name] = member
+				}
+			}
+			members[name] = s.bind(b)
+		}
+	}
+	if members == nil {
+		return m
+	}
+	return &Module{Name: m.Name, Members: members}
+}
+
+// StepFunc is called by the evaluator before a statement is evaluated.
+// Returning false stops the program with an error.
+type StepFunc func(step int, stmt parser.Statement, env *Environment) bool
+
+// NewEnvironment creates a new environment for a new interpreter, with
+// the default builtins
 func NewEnvironment() *Environment {
-	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	s := make(map[tokens.Ident]Object)
+	return &Environment{store: s, outer: nil, session: newSession()}
 }
 
 // NewEnclosedEnvironment creates a new environment with an outer scope
 func NewEnclosedEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
+	s := make(map[tokens.Ident]Object)
+	return &Environment{store: s, outer: outer, session: outer.session}
+}
+
+// newBlockEnvironment creates the scope of a for loop iteration or a
+// catch block
+func newBlockEnvironment(outer *Environment) *Environment {
+	env := NewEnclosedEnvironment(outer)
+	env.block = true
+	return env
+}
+
+// functionEnvs recycles the scopes of function calls, so tight recursive
+// calls don't allocate a scope and its map each time
+var functionEnvs = sync.Pool{
+	New: func() any { return &Environment{store: make(map[tokens.Ident]Object)} },
+}
+
+// newFunctionEnvironment creates the scope of a function call, which
+// should be released when the call returns
+func newFunctionEnvironment(outer *Environment) *Environment {
+	env := functionEnvs.Get().(*Environment)
 	env.outer = outer
+	env.session = outer.session
 	return env
 }
 
+// release returns a function call's scope to the pool, unless a closure
+// or a builtin given the scope may still refer to it, or a step hook,
+// which is handed every scope, is set
+func (e *Environment) release() {
+	if e.captured.Load() || e.session.step != nil {
+		if logging.Debugging() {
+			scopeStats.kept.Add(1)
+		}
+		return
+	}
+	if logging.Debugging() {
+		scopeStats.recycled.Add(1)
+	}
+	e.session.leave(e)
+	clear(e.store)
+	e.outer, e.session, e.globals, e.block = nil, nil, nil, false
+	functionEnvs.Put(e)
+}
+
+// scopeStats counts what became of function call scopes, while debug
+// logging is on
+var scopeStats struct {
+	recycled atomic.Int64 // returned to the pool for the next call
+	kept     atomic.Int64 // kept alive by a closure, a builtin or a step hook
+}
+
+// LogStats logs, at debug level, how many function call scopes were
+// recycled and how many kept alive since the last call, along with the Go
+// heap. Hosts call it when a program ends.
+func LogStats() {
+	if !logging.Debugging() {
+		return
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	logging.Debug("scopes", "recycled", scopeStats.recycled.Swap(0), "kept", scopeStats.kept.Swap(0),
+		"heapAlloc", mem.HeapAlloc, "numGC", mem.NumGC)
+}
+
+// capture marks e and the scopes around it as referred to by something
+// that may outlive them, so they are never released
+func (e *Environment) capture() {
+	for env := e; env != nil && !env.captured.Load(); env = env.outer {
+		env.captured.Store(true)
+	}
+}
+
+// SetConcurrent makes the interpreter env belongs to safe to run from
+// several goroutines at once, as when HTTP handlers share the top-level
+// scope with the main program: every scope then locks its variables while
+// they are read or changed. Values themselves, such as arrays changed in
+// place, are not locked. Locking costs some speed, so it is off by
+// default; set it before any goroutine starts running code.
+func (e *Environment) SetConcurrent(on bool) {
+	s := e.session
+	s.concurrent = on
+	if on {
+		// Set would have to lock the session to keep resolved up to date,
+		// so builtins are looked up after the environment chain instead
+		s.resolved = nil
+	}
+}
+
+// Concurrent reports whether SetConcurrent turned locking on
+func (e *Environment) Concurrent() bool {
+	return e.session.concurrent
+}
+
+func (e *Environment) rlock() {
+	if e.session.concurrent {
+		e.mu.RLock()
+	}
+}
+
+func (e *Environment) runlock() {
+	if e.session.concurrent {
+		e.mu.RUnlock()
+	}
+}
+
+func (e *Environment) lock() {
+	if e.session.concurrent {
+		e.mu.Lock()
+	}
+}
+
+func (e *Environment) unlock() {
+	if e.session.concurrent {
+		e.mu.Unlock()
+	}
+}
+
+// lookup returns the value name has in e itself, and whether e declared
+// name global
+func (e *Environment) lookup(name tokens.Ident) (value Object, ok, global bool) {
+	e.rlock()
+	value, ok = e.store[name]
+	global = e.globals[name]
+	e.runlock()
+	return value, ok, global
+}
+
 // Get retrieves a variable from the environment
 func (e *Environment) Get(name string) (Object, bool) {
-	value, ok := e.store[name]
+	return e.get(tokens.Intern(name))
+}
+
+// get is Get for an interned name
+func (e *Environment) get(name tokens.Ident) (Object, bool) {
+	value, ok, global := e.lookup(name)
+	if global && e.outer != nil {
+		return e.root().get(name)
+	}
 	if !ok && e.outer != nil {
-		value, ok = e.outer.Get(name)
+		value, ok = e.outer.get(name)
 	}
 	return value, ok
 }
 
 // Set stores a variable in the environment
 func (e *Environment) Set(name string, val Object) Object {
+	return e.set(tokens.Intern(name), val)
+}
+
+// set is Set for an interned name
+func (e *Environment) set(name tokens.Ident, val Object) Object {
+	e.lock()
 	e.store[name] = val
+	e.unlock()
+	if _, ok := e.session.resolved[name]; ok {
+		delete(e.session.resolved, name)
+	}
 	return val
 }
+
+// assign binds name for an assignment: in the top-level scope when name
+// was declared global in this scope or an enclosing one, and otherwise in
+// this scope, or for a block's scope the scope around it unless name was
+// declared in the block
+func (e *Environment) assign(name tokens.Ident, val Object) Object {
+	for env := e; env.outer != nil; env = env.outer {
+		_, ok, global := env.lookup(name)
+		if global {
+			return env.root().set(name, val)
+		}
+		if ok {
+			break
+		}
+	}
+	if _, ok, _ := e.lookup(name); !ok && e.block {
+		return e.outer.assign(name, val)
+	}
+	return e.set(name, val)
+}
+
+// Bindings returns a copy of the variables bound in env itself, without
+// those of outer scopes
+func (e *Environment) Bindings() map[string]Object {
+	e.rlock()
+	defer e.runlock()
+	bindings := make(map[string]Object, len(e.store))
+	for name, value := range e.store {
+		bindings[name.Name()] = value
+	}
+	return bindings
+}
+
+// declareGlobal makes assignments to name in e and the scopes nested in it
+// target the top-level scope
+func (e *Environment) declareGlobal(name tokens.Ident) {
+	e.lock()
+	if e.globals == nil {
+		e.globals = make(map[tokens.Ident]bool)
+	}
+	e.globals[name] = true
+	e.unlock()
+}
+
+// SetStepHook registers fn to be called before every n-th statement.
+// Passing a nil fn removes the hook.
+func (e *Environment) SetStepHook(n int, fn StepFunc) {
+	if n < 1 {
+		n = 1
+	}
+	e.session.step = fn
+	e.session.stepEvery = n
+}
+
+// SetLoopGuard makes any while or for loop that runs more than
+// maxIterations times, or for longer than timeout, fail with an error.
+// A zero value turns that limit off, which is the default.
+func (e *Environment) SetLoopGuard(maxIterations int, timeout time.Duration) {
+	e.session.loopLimit = max(maxIterations, 0)
+	e.session.loopTimeout = max(timeout, 0)
+}
+
+// LoopGuard returns the limits set by SetLoopGuard
+func (e *Environment) LoopGuard() (maxIterations int, timeout time.Duration) {
+	return e.session.loopLimit, e.session.loopTimeout
+}
+
+// Steps returns the number of statements evaluated so far
+func (e *Environment) Steps() int {
+	s := e.session
+	if s.concurrent {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+	return s.steps
+}
+
+// Running returns where the statement the interpreter is running, or ran
+// last, starts, for a report of the interpreter itself failing. It reports
+// false before the first statement runs.
+func (e *Environment) Running() (Position, bool) {
+	s := e.session
+	if s.concurrent {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+	if parser.IsNil(s.last) {
+		return Position{}, false
+	}
+	if s.lastEnv == nil {
+		return s.lastPos, true
+	}
+	return s.lastEnv.statementPosition(s.last), true
+}
+
+// leave is called when the scope of a function call is about to be
+// recycled. If the last statement ran in it, or in a block inside it, its
+// position is worked out while the scope still knows it.
+func (s *session) leave(e *Environment) {
+	if s.concurrent {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+	env := s.lastEnv
+	for env != nil && env != e && env.block {
+		env = env.outer
+	}
+	if env == e {
+		if !parser.IsNil(s.last) {
+			s.lastPos = s.lastEnv.statementPosition(s.last)
+		}
+		s.lastEnv = nil
+	}
+}
+
+// step counts a statement, stops if the host's context is done, dispatches
+// pending signals and host tasks and consults the step hook, returning an
+// error if evaluation must not continue
+func (e *Environment) step(stmt parser.Statement) *Error {
+	s := e.session
+	if err := s.cancelled(); err != nil {
+		return err
+	}
+	if !s.isolated {
+		if err := dispatchSignals(); err != nil {
+			return err
+		}
+		RunHostTasks()
+	}
+
+	if s.coverage != nil {
+		s.coverage.hit(e.root().path, stmt)
+	}
+	if s.hooks.OnStatement != nil {
+		e.statementHook(stmt)
+	}
+	if s.recording != nil {
+		s.recording.record(stmt, e)
+	}
+
+	if s.concurrent {
+		s.mu.Lock()
+	}
+	s.steps++
+	steps := s.steps
+	s.last, s.lastEnv = stmt, e
+	if accounting.Load() {
+		s.account(e.root())
+	}
+	if s.concurrent {
+		s.mu.Unlock()
+	}
+	if s.step == nil || steps%s.stepEvery != 0 {
+		return nil
+	}
+	if !s.step(steps, stmt, e) {
+		return newCodedError(E_STOPPED, "execution stopped by host")
+	}
+	return nil
+}
+
+// loopGuard counts the iterations of one loop against the session's limits
+type loopGuard struct {
+	session    *session
+	iterations int
+	start      time.Time
+}
+
+func (e *Environment) guardLoop() *loopGuard {
+	g := &loopGuard{session: e.session}
+	if g.session.loopTimeout > 0 {
+		g.start = time.Now()
+	}
+	return g
+}
+
+// next counts an iteration, returning an error once the loop has run too
+// many times or for too long, or stops at a yield point
+func (g *loopGuard) next() *Error {
+	s := g.session
+	g.iterations++
+	if s.loopLimit > 0 && g.iterations > s.loopLimit {
+		return newCodedError(E_LIMIT, "loop stopped after %s iterations", groupDigits(s.loopLimit))
+	}
+	if s.loopTimeout > 0 && time.Since(g.start) > s.loopTimeout {
+		return newCodedError(E_LIMIT, "loop stopped after running for %s", s.loopTimeout)
+	}
+	return s.tick()
+}
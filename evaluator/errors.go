@@ -0,0 +1,91 @@
+package evaluator
+
+import "gokid/messages"
+
+// ErrorCode classifies a runtime error, so that catch blocks and hosts can
+// tell errors apart without matching their messages. Codes are Go errors
+// too: errors.Is(err, evaluator.E_DIV_ZERO) holds for an *Error with that
+// code.
+type ErrorCode string
+
+const (
+	E_RUNTIME          ErrorCode = "E_RUNTIME"          // not classified further
+	E_TYPE_MISMATCH    ErrorCode = "E_TYPE_MISMATCH"    // a value of the wrong type
+	E_UNDEFINED_IDENT  ErrorCode = "E_UNDEFINED_IDENT"  // a name that is not defined
+	E_UNKNOWN_OPERATOR ErrorCode = "E_UNKNOWN_OPERATOR" // an operator the operands don't support
+	E_UNKNOWN_MEMBER   ErrorCode = "E_UNKNOWN_MEMBER"   // a method or property that doesn't exist
+	E_DIV_ZERO         ErrorCode = "E_DIV_ZERO"         // division by zero
+	E_ARITY            ErrorCode = "E_ARITY"            // the wrong number of arguments
+	E_INDEX            ErrorCode = "E_INDEX"            // an index out of range
+	E_NOT_CALLABLE     ErrorCode = "E_NOT_CALLABLE"     // a call of something that isn't a function
+	E_FROZEN           ErrorCode = "E_FROZEN"           // a change to a frozen value
+	E_VALUE            ErrorCode = "E_VALUE"            // an argument of the right type but a bad value
+	E_SYNTAX           ErrorCode = "E_SYNTAX"           // code given to eval that doesn't parse
+	E_IMPORT           ErrorCode = "E_IMPORT"           // a module that can't be loaded
+	E_IO               ErrorCode = "E_IO"               // a failed network request or connection
+	E_DISABLED         ErrorCode = "E_DISABLED"         // a builtin turned off by the host
+	E_LIMIT            ErrorCode = "E_LIMIT"            // a loop that ran past the loop guard
+	E_QUOTA            ErrorCode = "E_QUOTA"            // a builtin that went over a quota the host set
+	E_STOPPED          ErrorCode = "E_STOPPED"          // evaluation stopped by the host; not catchable
+	E_THROWN           ErrorCode = "E_THROWN"           // a value thrown with throw
+	E_EXIT             ErrorCode = "E_EXIT"             // os.exit ending the program; not catchable
+)
+
+func (c ErrorCode) Error() string { return string(c) }
+
+// Error lets hosts treat a GoKid error as a Go error
+func (e *Error) Error() string { return e.Message }
+
+// Unwrap returns the error's code, for errors.Is
+func (e *Error) Unwrap() error { return e.code() }
+
+// code returns the error's code, E_RUNTIME if it has none
+func (e *Error) code() ErrorCode {
+	if e.Code == "" {
+		return E_RUNTIME
+	}
+	return e.Code
+}
+
+// catchable reports whether catch blocks see err. Stopping and exiting
+// end the program whatever it is doing, though finally blocks still run.
+func (e *Error) catchable() bool {
+	return e.Code != E_STOPPED && e.Code != E_EXIT
+}
+
+// maxStack is the most functions an error's stack records
+const maxStack = 64
+
+// addFrame records that result, if it is an error, passed out of a call
+// of fn. The innermost function is also kept as the error's Function.
+func addFrame(result Object, fn *Function) {
+	err, ok := result.(*Error)
+	if !ok || err.Code == E_EXIT {
+		return
+	}
+	if err.Function == "" {
+		err.Function = fn.describe()
+	}
+	if len(err.Stack) < maxStack {
+		err.Stack = append(err.Stack, fn.describe())
+	} else {
+		err.Dropped++
+	}
+}
+
+// newCodedError is newError for errors of a known kind
+func newCodedError(code ErrorCode, format string, a ...interface{}) *Error {
+	return &Error{Message: messages.Sprintf(format, a...), Code: code}
+}
+
+// caughtValue is what a catch block receives for err: the value thrown,
+// or for other errors an object with their code and message
+func caughtValue(err *Error) Object {
+	if err.Thrown != nil {
+		return err.Thrown
+	}
+	return newHash(map[string]Object{
+		"code":    &String{Value: string(err.code())},
+		"message": &String{Value: err.Message},
+	})
+}
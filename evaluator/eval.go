@@ -0,0 +1,80 @@
+package evaluator
+
+import (
+	"gokid/lexer"
+	"gokid/parser"
+	"gokid/tokens"
+	"strings"
+)
+
+func init() {
+	registerBuiltin(&Builtin{
+		Name:   "eval",
+		Params: []Param{{Name: "code", Types: []ObjectType{STRING_OBJ}}},
+		Doc:    "Runs GoKid code in a new scope nested in the current one and returns its last value.",
+		EnvFn: func(env *Environment, args ...Object) Object {
+			if env.session.evalDisabled {
+				return newCodedError(E_DISABLED, "`eval` is disabled in this interpreter")
+			}
+			return evalCode(args[0].(*String).Value, NewEnclosedEnvironment(env))
+		},
+	})
+
+	registerBuiltin(&Builtin{
+		Name:   "evalIn",
+		Params: []Param{{Name: "code", Types: []ObjectType{STRING_OBJ}}, {Name: "scope", Types: []ObjectType{HASH_OBJ}}},
+		Doc:    "Runs GoKid code with only the variables in scope, then stores the variables it set back into scope.",
+		EnvFn: func(env *Environment, args ...Object) Object {
+			if env.session.evalDisabled {
+				return newCodedError(E_DISABLED, "`evalIn` is disabled in this interpreter")
+			}
+			hash := args[1].(*Hash)
+
+			scope := &Environment{store: make(map[tokens.Ident]Object), session: env.session}
+			for _, pair := range hash.Pairs {
+				if name, ok := pair.Key.(*String); ok {
+					scope.Set(name.Value, pair.Value)
+				}
+			}
+
+			result := evalCode(args[0].(*String).Value, scope)
+			if isError(result) {
+				return result
+			}
+
+			for name, value := range scope.Bindings() {
+				if hashGet(hash, name) == value {
+					continue
+				}
+				if err := setIndex(hash, &String{Value: name}, value); err != nil {
+					return err
+				}
+			}
+			return result
+		},
+	})
+}
+
+// DisableEval makes eval and evalIn fail in the interpreter env belongs
+// to, for hosts that run untrusted programs
+func (e *Environment) DisableEval() {
+	e.session.evalDisabled = true
+}
+
+// evalCode parses and evaluates code in env. Errors are returned without
+// a location, so they are reported at the call to eval rather than at an
+// offset into code.
+func evalCode(code string, env *Environment) Object {
+	p := parser.New(lexer.NewLexer(code))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return newCodedError(E_SYNTAX, "cannot parse code: %s", strings.Join(p.Errors(), "; "))
+	}
+
+	env.SetSource(code)
+	result := Eval(program, env)
+	if err, ok := result.(*Error); ok {
+		return &Error{Message: err.Message, Code: err.Code, Thrown: err.Thrown, Status: err.Status}
+	}
+	return result
+}
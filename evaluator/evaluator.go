@@ -1,8 +1,15 @@
 package evaluator
 
 import (
-	"fmt"
+	"gokid/diagnostics"
+	"gokid/messages"
 	"gokid/parser"
+	"gokid/tokens"
+	"math/big"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
 )
 
 var (
@@ -13,6 +20,12 @@ var (
 
 // Eval evaluates AST nodes and returns objects
 func Eval(node parser.Node, env *Environment) Object {
+	// Programs built outside the parser, or left incomplete by a failed
+	// parse, can contain nil nodes
+	if parser.IsNil(node) {
+		return newError("missing expression")
+	}
+
 	switch node := node.(type) {
 
 	// Statements
@@ -23,22 +36,31 @@ func Eval(node parser.Node, env *Environment) Object {
 		return Eval(node.Expression, env)
 
 	case *parser.LetStatement:
+		if node.Name == nil {
+			return newError("let statement is missing a name")
+		}
 		val := Eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		env.set(node.Name.Ident, val)
 		return val
 
 	case *parser.ConstStatement:
+		if node.Name == nil {
+			return newError("const statement is missing a name")
+		}
 		val := Eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		env.set(node.Name.Ident, val)
 		return val
 
 	case *parser.VarStatement:
+		if node.Name == nil {
+			return newError("var statement is missing a name")
+		}
 		var val Object = NULL
 		if node.Value != nil {
 			val = Eval(node.Value, env)
@@ -46,10 +68,13 @@ func Eval(node parser.Node, env *Environment) Object {
 				return val
 			}
 		}
-		env.Set(node.Name.Value, val)
+		env.set(node.Name.Ident, val)
 		return val
 
 	case *parser.ReturnStatement:
+		if node.ReturnValue == nil {
+			return &ReturnValue{Value: NULL}
+		}
 		val := Eval(node.ReturnValue, env)
 		if isError(val) {
 			return val
@@ -63,6 +88,12 @@ func Eval(node parser.Node, env *Environment) Object {
 	case *parser.IntegerLiteral:
 		return &Integer{Value: node.Value}
 
+	case *parser.DecimalLiteral:
+		return parseDecimal(node.Value)
+
+	case *parser.ImaginaryLiteral:
+		return &Complex{Value: complex(0, node.Value)}
+
 	case *parser.FloatLiteral:
 		return &Float{Value: node.Value}
 
@@ -72,6 +103,9 @@ func Eval(node parser.Node, env *Environment) Object {
 	case *parser.StringLiteral:
 		return &String{Value: node.Value}
 
+	case *parser.SymbolLiteral:
+		return Intern(node.Value)
+
 	case *parser.NullLiteral:
 		return NULL
 
@@ -94,6 +128,10 @@ func Eval(node parser.Node, env *Environment) Object {
 		if isError(right) {
 			return right
 		}
+		if (node.Operator == "==" || node.Operator == "!=") && isNumber(left) && isNumber(right) &&
+			(left.Type() == FLOAT_OBJ || right.Type() == FLOAT_OBJ) {
+			env.warn(node, node.Token.Offset, "comparing floats with %s is unreliable; use approxEqual(a, b) instead", node.Operator)
+		}
 		return evalInfixExpression(node.Operator, left, right)
 
 	case *parser.IfExpression:
@@ -111,30 +149,75 @@ func Eval(node parser.Node, env *Environment) Object {
 		if isError(left) {
 			return left
 		}
+		if hash, ok := left.(*Hash); ok && protocolHook(hash, "__index__") == nil {
+			if lit, ok := node.Index.(*parser.StringLiteral); ok {
+				return hashLookup(hash, cachedKey(&node.Cache, lit.Value))
+			}
+		}
 		index := Eval(node.Index, env)
 		if isError(index) {
 			return index
 		}
-		return evalIndexExpression(left, index)
+		result := evalIndexExpression(left, index)
+		if err, ok := result.(*Error); ok && left.Type() == HASH_OBJ {
+			// A key that can't be used points at the key
+			return locateAt(err, node.Index.Range().Start, env)
+		}
+		return result
 
 	case *parser.ObjectLiteral:
 		return evalObjectLiteral(node, env)
 
+	case *parser.RecordLiteral:
+		return evalRecordLiteral(node)
+
+	case *parser.DotExpression:
+		if node.Property == nil {
+			return newError("property access is missing a name")
+		}
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		return evalDotExpression(left, node.Property.Value, &node.Cache)
+
 	case *parser.CallExpression:
 		function := Eval(node.Function, env)
 		if isError(function) {
 			return function
 		}
+		if env.session.hooks.OnCall != nil {
+			env.callHook(node, function)
+		}
+		if result, ok := node.Cache.Load(function); ok {
+			return result.(Object)
+		}
 		args := evalExpressions(node.Arguments, env)
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
-		return applyFunction(function, args)
+		result := evalCall(node, function, args, env)
+		if isConstantCall(node, function, result) {
+			node.Cache.Store(function, result)
+		}
+		return result
 
 	case *parser.FunctionLiteral:
 		params := node.Parameters
+		for i, param := range params {
+			if param == nil && (i >= len(node.Patterns) || node.Patterns[i] == nil) {
+				return newError("function parameter %d is missing a name", i+1)
+			}
+		}
 		body := node.Body
-		return &Function{Parameters: params, Env: env, Body: body}
+		path, line := env.position(node.Token.Offset)
+		env.capture()
+		fn := &Function{Parameters: params, Env: env, Body: body, Source: node.Source, Name: node.Name,
+			Doc: node.Doc, Offset: node.Token.Offset, Path: path, Line: line}
+		if node.Patterns != nil || node.Clauses != nil {
+			return evalClauses(fn, node, env)
+		}
+		return fn
 
 	case *parser.WhileStatement:
 		return evalWhileStatement(node, env)
@@ -142,6 +225,12 @@ func Eval(node parser.Node, env *Environment) Object {
 	case *parser.ForStatement:
 		return evalForStatement(node, env)
 
+	case *parser.ForOfStatement:
+		return evalForOfStatement(node, env)
+
+	case *parser.SwitchStatement:
+		return evalSwitchStatement(node, env)
+
 	case *parser.BreakStatement:
 		return &Break{}
 
@@ -151,6 +240,24 @@ func Eval(node parser.Node, env *Environment) Object {
 	case *parser.AssignmentExpression:
 		return evalAssignmentExpression(node, env)
 
+	case *parser.ImportStatement:
+		return evalImportStatement(node, env)
+
+	case *parser.ExportStatement:
+		return evalExportStatement(node, env)
+
+	case *parser.GlobalStatement:
+		return evalGlobalStatement(node, env)
+
+	case *parser.PragmaStatement:
+		return evalPragmaStatement(node, env)
+
+	case *parser.TryStatement:
+		return evalTryStatement(node, env)
+
+	case *parser.ThrowStatement:
+		return evalThrowStatement(node, env)
+
 	default:
 		return newError("unknown node type: %T", node)
 	}
@@ -161,13 +268,16 @@ func evalProgram(stmts []parser.Statement, env *Environment) Object {
 	var result Object
 
 	for _, statement := range stmts {
+		if err := env.step(statement); err != nil {
+			return err
+		}
 		result = Eval(statement, env)
 
 		switch result := result.(type) {
 		case *ReturnValue:
 			return result.Value
 		case *Error:
-			return result
+			return locateError(result, statement, env)
 		}
 	}
 
@@ -175,14 +285,20 @@ func evalProgram(stmts []parser.Statement, env *Environment) Object {
 }
 
 func evalBlockStatement(block *parser.BlockStatement, env *Environment) Object {
-	var result Object
+	var result Object = NULL
 
 	for _, statement := range block.Statements {
+		if err := env.step(statement); err != nil {
+			return err
+		}
 		result = Eval(statement, env)
 
 		if result != nil {
 			rt := result.Type()
-			if rt == RETURN_OBJ || rt == ERROR_OBJ || rt == BREAK_OBJ || rt == CONTINUE_OBJ {
+			if rt == ERROR_OBJ {
+				return locateError(result.(*Error), statement, env)
+			}
+			if rt == RETURN_OBJ || rt == BREAK_OBJ || rt == CONTINUE_OBJ {
 				return result
 			}
 		}
@@ -191,6 +307,43 @@ func evalBlockStatement(block *parser.BlockStatement, env *Environment) Object {
 	return result
 }
 
+// locateError records the innermost statement an error came from
+func locateError(err *Error, stmt parser.Statement, env *Environment) *Error {
+	if !err.Located {
+		if tok := parser.StatementToken(stmt); tok.Offset >= 0 {
+			err.Offset = tok.Offset
+			err.Located = true
+			err.Path = env.root().path
+			errorHook(err, env)
+		}
+	}
+	return err
+}
+
+// locateAt records that err came from the expression at offset, unless
+// it already knows where it came from
+func locateAt(err *Error, offset int, env *Environment) *Error {
+	if !err.Located {
+		err.Offset = offset
+		err.Located = true
+		err.Path = env.root().path
+		errorHook(err, env)
+	}
+	return err
+}
+
+// Diagnostic converts a runtime error for rendering against its source
+func (e *Error) Diagnostic() diagnostics.Diagnostic {
+	d := diagnostics.Diagnostic{Severity: diagnostics.Error, Message: e.Message, Offset: -1, Length: 1, Code: string(e.code())}
+	if e.Function != "" {
+		d.Message = messages.Sprintf("%s in %s", d.Message, e.Function)
+	}
+	if e.Located {
+		d.Offset = e.Offset
+	}
+	return d
+}
+
 func nativeBoolToPyMonkeyBool(input bool) *Boolean {
 	if input {
 		return TRUE
@@ -204,8 +357,13 @@ func evalPrefixExpression(operator string, right Object) Object {
 		return evalBangOperatorExpression(right)
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
+	case "+":
+		if !hasType(numericTypes, right.Type()) {
+			return newCodedError(E_UNKNOWN_OPERATOR, "unknown operator: +%s", right.Type())
+		}
+		return right
 	default:
-		return newError("unknown operator: %s%s", operator, right.Type())
+		return newCodedError(E_UNKNOWN_OPERATOR, "unknown operator: %s%s", operator, right.Type())
 	}
 }
 
@@ -228,8 +386,14 @@ func evalMinusPrefixOperatorExpression(right Object) Object {
 		return &Integer{Value: -right.Value}
 	case *Float:
 		return &Float{Value: -right.Value}
+	case *Complex:
+		return &Complex{Value: -right.Value}
+	case *Fraction:
+		return &Fraction{Value: new(big.Rat).Neg(right.Value)}
+	case *Decimal:
+		return &Decimal{Unscaled: new(big.Int).Neg(right.Unscaled), Scale: right.Scale}
 	default:
-		return newError("unknown operator: -%s", right.Type())
+		return newCodedError(E_UNKNOWN_OPERATOR, "unknown operator: -%s", right.Type())
 	}
 }
 
@@ -237,8 +401,16 @@ func evalInfixExpression(operator string, left, right Object) Object {
 	switch {
 	case left.Type() == INTEGER_OBJ && right.Type() == INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
-	case left.Type() == FLOAT_OBJ || right.Type() == FLOAT_OBJ:
+	case operator == "<" || operator == ">":
+		return evalComparisonExpression(operator, left, right)
+	case isNumber(left) && isNumber(right):
 		return evalFloatInfixExpression(operator, left, right)
+	case isComplexOperation(left, right):
+		return evalComplexInfixExpression(operator, left, right)
+	case isFractionOperation(left, right):
+		return evalFractionInfixExpression(operator, left, right)
+	case isDecimalOperation(left, right):
+		return evalDecimalInfixExpression(operator, left, right)
 	case left.Type() == STRING_OBJ && right.Type() == STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
 	case left.Type() == BOOLEAN_OBJ && right.Type() == BOOLEAN_OBJ:
@@ -252,9 +424,9 @@ func evalInfixExpression(operator string, left, right Object) Object {
 	case operator == "||":
 		return evalLogicalOrExpression(left, right)
 	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+		return newCodedError(E_TYPE_MISMATCH, "type mismatch: %s %s %s", left.Type(), operator, right.Type())
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newCodedError(E_UNKNOWN_OPERATOR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
@@ -271,7 +443,7 @@ func evalIntegerInfixExpression(operator string, left, right Object) Object {
 		return &Integer{Value: leftVal * rightVal}
 	case "/":
 		if rightVal == 0 {
-			return newError("division by zero")
+			return newCodedError(E_DIV_ZERO, "division by zero")
 		}
 		return &Integer{Value: leftVal / rightVal}
 	case "<":
@@ -283,7 +455,7 @@ func evalIntegerInfixExpression(operator string, left, right Object) Object {
 	case "!=":
 		return nativeBoolToPyMonkeyBool(leftVal != rightVal)
 	default:
-		return newError("unknown operator: %s", operator)
+		return newCodedError(E_UNKNOWN_OPERATOR, "unknown operator: %s", operator)
 	}
 }
 
@@ -310,20 +482,14 @@ func evalFloatInfixExpression(operator string, left, right Object) Object {
 	case "*":
 		return &Float{Value: leftVal * rightVal}
 	case "/":
-		if rightVal == 0 {
-			return newError("division by zero")
-		}
+		// Dividing by zero gives Inf, -Inf or NaN, as floats do everywhere
 		return &Float{Value: leftVal / rightVal}
-	case "<":
-		return nativeBoolToPyMonkeyBool(leftVal < rightVal)
-	case ">":
-		return nativeBoolToPyMonkeyBool(leftVal > rightVal)
 	case "==":
 		return nativeBoolToPyMonkeyBool(leftVal == rightVal)
 	case "!=":
 		return nativeBoolToPyMonkeyBool(leftVal != rightVal)
 	default:
-		return newError("unknown operator: %s", operator)
+		return newCodedError(E_UNKNOWN_OPERATOR, "unknown operator: %s", operator)
 	}
 }
 
@@ -339,7 +505,7 @@ func evalStringInfixExpression(operator string, left, right Object) Object {
 	case "!=":
 		return nativeBoolToPyMonkeyBool(leftVal != rightVal)
 	default:
-		return newError("unknown operator: %s", operator)
+		return newCodedError(E_UNKNOWN_OPERATOR, "unknown operator: %s", operator)
 	}
 }
 
@@ -357,7 +523,7 @@ func evalBooleanInfixExpression(operator string, left, right Object) Object {
 	case "||":
 		return nativeBoolToPyMonkeyBool(leftVal || rightVal)
 	default:
-		return newError("unknown operator: %s", operator)
+		return newCodedError(E_UNKNOWN_OPERATOR, "unknown operator: %s", operator)
 	}
 }
 
@@ -403,18 +569,61 @@ func isTruthy(obj Object) bool {
 	}
 }
 
+// evalIdentifier resolves a name to a variable, or failing that to a
+// builtin function or module, so variables such as sum can shadow builtins
 func evalIdentifier(node *parser.Identifier, env *Environment) Object {
-	if builtin, ok := builtins[node.Value]; ok {
+	if builtin, ok := env.session.resolved[node.Ident]; ok {
 		return builtin
 	}
-
-	val, ok := env.Get(node.Value)
+	val, ok := env.get(node.Ident)
 	if !ok {
-		return newError("identifier not found: %s", node.Value)
+		if builtin, ok := env.session.builtins[node.Value]; ok {
+			return builtin
+		}
+		if module := env.session.globalModule(node.Value); module != nil {
+			return module
+		}
+		return undefinedIdentError(node.Value, env)
 	}
 	return val
 }
 
+// undefinedIdentError reports that name is not defined, suggesting the
+// closest name in scope, builtin, module or keyword when it looks like a
+// typo of one
+func undefinedIdentError(name string, env *Environment) *Error {
+	if env.session.hidden[name] {
+		return newCodedError(E_UNDEFINED_IDENT, "identifier not found: %s; the %s module must be imported first: import \"std/%s\";", name, name, name)
+	}
+
+	var candidates []string
+	for scope := env; scope != nil; scope = scope.outer {
+		candidates = append(candidates, sortedNames(scope.Bindings())...)
+	}
+	candidates = append(candidates, sortedNames(env.session.builtins)...)
+	for _, module := range sortedNames(env.session.modules) {
+		if !env.session.hidden[module] {
+			candidates = append(candidates, module)
+		}
+	}
+	candidates = append(candidates, env.keywords()...)
+
+	if suggestion := diagnostics.Suggest(name, candidates); suggestion != "" {
+		return newCodedError(E_UNDEFINED_IDENT, "identifier not found: %s; did you mean '%s'?", name, suggestion)
+	}
+	return newCodedError(E_UNDEFINED_IDENT, "identifier not found: %s", name)
+}
+
+// sortedNames returns the keys of m in order
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func evalExpressions(exps []parser.Expression, env *Environment) []Object {
 	var result []Object
 
@@ -434,9 +643,18 @@ func evalIndexExpression(left, index Object) Object {
 	case left.Type() == ARRAY_OBJ && index.Type() == INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
 	case left.Type() == HASH_OBJ:
+		if hook := protocolHook(left, "__index__"); hook != nil {
+			return applyMethod(hook, left, []Object{index})
+		}
 		return evalHashIndexExpression(left, index)
+	case left.Type() == RECORD_OBJ:
+		name, err := fieldName(index)
+		if err != nil {
+			return err
+		}
+		return left.(*Record).field(name)
 	default:
-		return newError("index operator not supported: %s", left.Type())
+		return newCodedError(E_TYPE_MISMATCH, "index operator not supported: %s", left.Type())
 	}
 }
 
@@ -455,39 +673,65 @@ func evalArrayIndexExpression(array, index Object) Object {
 func evalHashIndexExpression(hash, index Object) Object {
 	hashObject := hash.(*Hash)
 
-	key, ok := index.(Hashable)
-	if !ok {
-		return newError("unusable as hash key: %T", index)
+	key, err := hashKeyOf(index)
+	if err != nil {
+		return err
 	}
 
-	pair, ok := hashObject.Pairs[key.HashKey()]
+	return hashLookup(hashObject, key)
+}
+
+// hashLookup returns the value stored under key, or null
+func hashLookup(hash *Hash, key HashKey) Object {
+	pair, ok := hash.Pairs[key]
 	if !ok {
 		return NULL
 	}
-
 	return pair.Value
 }
 
+// evalDotExpression looks up the property name of left; cache is the
+// inline cache of the expression doing so
+func evalDotExpression(left Object, name string, cache *parser.KeyCache) Object {
+	if hash, ok := left.(*Hash); ok {
+		return hashLookup(hash, cachedKey(cache, name))
+	}
+	if record, ok := left.(*Record); ok {
+		return record.field(name)
+	}
+
+	holder, ok := left.(MemberHolder)
+	if !ok {
+		return newCodedError(E_TYPE_MISMATCH, "property access not supported: %s", left.Type())
+	}
+
+	member, ok := holder.Member(name)
+	if !ok {
+		return newCodedError(E_UNKNOWN_MEMBER, "unknown member %s on %s", name, left.Type())
+	}
+
+	return member
+}
+
 func evalObjectLiteral(node *parser.ObjectLiteral, env *Environment) Object {
 	pairs := make(map[HashKey]HashPair)
 
-	for keyNode, valueNode := range node.Pairs {
-		key := Eval(keyNode, env)
+	for _, pair := range node.Pairs {
+		key := Eval(pair.Key, env)
 		if isError(key) {
 			return key
 		}
 
-		hashKey, ok := key.(Hashable)
-		if !ok {
-			return newError("unusable as hash key: %T", key)
+		hashed, err := hashKeyOf(key)
+		if err != nil {
+			return locateAt(err, pair.Key.Range().Start, env)
 		}
 
-		value := Eval(valueNode, env)
+		value := Eval(pair.Value, env)
 		if isError(value) {
 			return value
 		}
 
-		hashed := hashKey.HashKey()
 		pairs[hashed] = HashPair{Key: key, Value: value}
 	}
 
@@ -495,11 +739,17 @@ func evalObjectLiteral(node *parser.ObjectLiteral, env *Environment) Object {
 }
 
 func newError(format string, a ...interface{}) *Error {
-	return &Error{Message: fmt.Sprintf(format, a...)}
+	return &Error{Message: messages.Sprintf(format, a...)}
 }
 
 // Assignment expression evaluation
 func evalAssignmentExpression(ae *parser.AssignmentExpression, env *Environment) Object {
+	if ae.Name == nil && !parser.IsNil(ae.Target) {
+		return evalTargetAssignment(ae, env)
+	}
+	if ae.Name == nil {
+		return newError("assignment is missing a target")
+	}
 	val := Eval(ae.Value, env)
 	if isError(val) {
 		return val
@@ -508,55 +758,202 @@ func evalAssignmentExpression(ae *parser.AssignmentExpression, env *Environment)
 	// Handle different assignment operators
 	switch ae.Operator {
 	case "=":
-		env.Set(ae.Name.Value, val)
+		env.assign(ae.Name.Ident, val)
 		return val
 	case "+=":
-		current, exists := env.Get(ae.Name.Value)
+		current, exists := env.get(ae.Name.Ident)
 		if !exists {
-			return newError("identifier not found: %s", ae.Name.Value)
+			return undefinedIdentError(ae.Name.Value, env)
 		}
 		result := evalInfixExpression("+", current, val)
 		if isError(result) {
 			return result
 		}
-		env.Set(ae.Name.Value, result)
+		env.assign(ae.Name.Ident, result)
 		return result
 	case "-=":
-		current, exists := env.Get(ae.Name.Value)
+		current, exists := env.get(ae.Name.Ident)
 		if !exists {
-			return newError("identifier not found: %s", ae.Name.Value)
+			return undefinedIdentError(ae.Name.Value, env)
 		}
 		result := evalInfixExpression("-", current, val)
 		if isError(result) {
 			return result
 		}
-		env.Set(ae.Name.Value, result)
+		env.assign(ae.Name.Ident, result)
 		return result
 	case "*=":
-		current, exists := env.Get(ae.Name.Value)
+		current, exists := env.get(ae.Name.Ident)
 		if !exists {
-			return newError("identifier not found: %s", ae.Name.Value)
+			return undefinedIdentError(ae.Name.Value, env)
 		}
 		result := evalInfixExpression("*", current, val)
 		if isError(result) {
 			return result
 		}
-		env.Set(ae.Name.Value, result)
+		env.assign(ae.Name.Ident, result)
 		return result
 	case "/=":
-		current, exists := env.Get(ae.Name.Value)
+		current, exists := env.get(ae.Name.Ident)
 		if !exists {
-			return newError("identifier not found: %s", ae.Name.Value)
+			return undefinedIdentError(ae.Name.Value, env)
 		}
 		result := evalInfixExpression("/", current, val)
 		if isError(result) {
 			return result
 		}
-		env.Set(ae.Name.Value, result)
+		env.assign(ae.Name.Ident, result)
 		return result
 	default:
-		return newError("unknown assignment operator: %s", ae.Operator)
+		return newCodedError(E_UNKNOWN_OPERATOR, "unknown assignment operator: %s", ae.Operator)
+	}
+}
+
+// evalTargetAssignment assigns to an element of an array or hash, as in
+// arr[0] = 1 or obj.name = "gokid"
+func evalTargetAssignment(ae *parser.AssignmentExpression, env *Environment) Object {
+	var container, key Object
+	switch target := ae.Target.(type) {
+	case *parser.IndexExpression:
+		container = Eval(target.Left, env)
+		if isError(container) {
+			return container
+		}
+		key = Eval(target.Index, env)
+		if isError(key) {
+			return key
+		}
+		if container.Type() == HASH_OBJ {
+			if _, err := hashKeyOf(key); err != nil {
+				return locateAt(err, target.Index.Range().Start, env)
+			}
+		}
+	case *parser.DotExpression:
+		if target.Property == nil {
+			return newError("property access is missing a name")
+		}
+		container = Eval(target.Left, env)
+		if isError(container) {
+			return container
+		}
+		if container.Type() != HASH_OBJ && container.Type() != RECORD_OBJ {
+			return newCodedError(E_TYPE_MISMATCH, "property assignment not supported: %s", container.Type())
+		}
+		key = &String{Value: target.Property.Value}
+	default:
+		return newCodedError(E_TYPE_MISMATCH, "cannot assign to %T", ae.Target)
+	}
+
+	val := Eval(ae.Value, env)
+	if isError(val) {
+		return val
 	}
+
+	switch ae.Operator {
+	case "=":
+	case "+=", "-=", "*=", "/=":
+		// The value stored is the one replaced, even in an object with
+		// an __index__ method
+		var current Object
+		if container.Type() == HASH_OBJ {
+			current = evalHashIndexExpression(container, key)
+		} else {
+			current = evalIndexExpression(container, key)
+		}
+		if isError(current) {
+			return current
+		}
+		val = evalInfixExpression(strings.TrimSuffix(ae.Operator, "="), current, val)
+		if isError(val) {
+			return val
+		}
+	default:
+		return newCodedError(E_UNKNOWN_OPERATOR, "unknown assignment operator: %s", ae.Operator)
+	}
+
+	if err := setIndex(container, key, val); err != nil {
+		return err
+	}
+	return val
+}
+
+// setIndex stores value in an array or hash. Assigning one past the end
+// of an array appends to it.
+func setIndex(container, key, value Object) *Error {
+	if err := checkMutable(container); err != nil {
+		return err
+	}
+
+	switch container := container.(type) {
+	case *Array:
+		index, ok := key.(*Integer)
+		if !ok {
+			return newCodedError(E_TYPE_MISMATCH, "array index must be INTEGER, got %s", key.Type())
+		}
+		length := int64(len(container.Elements))
+		switch {
+		case index.Value < 0 || index.Value > length:
+			return newCodedError(E_INDEX, "index out of range: %d (length %d)", index.Value, length)
+		case index.Value == length:
+			container.Elements = append(container.Elements, value)
+		default:
+			container.Elements[index.Value] = value
+		}
+		return nil
+	case *Hash:
+		hashKey, err := hashKeyOf(key)
+		if err != nil {
+			return err
+		}
+		container.Pairs[hashKey] = HashPair{Key: key, Value: value}
+		return nil
+	case *Record:
+		name, err := fieldName(key)
+		if err != nil {
+			return err
+		}
+		return container.setField(name, value)
+	default:
+		return newCodedError(E_TYPE_MISMATCH, "index assignment not supported: %s", container.Type())
+	}
+}
+
+// checkMutable reports an error for arrays and hashes that have been
+// frozen. Anything that changes an array or hash in place checks it first.
+func checkMutable(obj Object) *Error {
+	switch obj := obj.(type) {
+	case *Array:
+		if obj.Frozen {
+			return newCodedError(E_FROZEN, "cannot modify a frozen ARRAY")
+		}
+	case *Hash:
+		if obj.Frozen {
+			return newCodedError(E_FROZEN, "cannot modify a frozen HASH")
+		}
+	}
+	return nil
+}
+
+// evalGlobalStatement makes later assignments to the named variables in
+// this scope, and in scopes nested in it, target the top-level scope
+func evalGlobalStatement(gs *parser.GlobalStatement, env *Environment) Object {
+	for _, name := range gs.Names {
+		if name == nil {
+			return newError("global statement is missing a name")
+		}
+		env.declareGlobal(name.Ident)
+	}
+	return NULL
+}
+
+// evalPragmaStatement applies a file's pragma to the interpreter running
+// it; #strict, #no-semicolons, #dialect and #lang only change how the
+// file is parsed
+func evalPragmaStatement(ps *parser.PragmaStatement, env *Environment) Object {
+	if ps.Name == "deterministic" {
+		env.session.deterministic = true
+	}
+	return NULL
 }
 
 func isError(obj Object) bool {
@@ -566,28 +963,148 @@ func isError(obj Object) bool {
 	return false
 }
 
+// evalCall applies fn at a call site. Errors raised by the call itself,
+// such as a wrong argument count, point at the called name.
+func evalCall(call *parser.CallExpression, fn Object, args []Object, env *Environment) Object {
+	name, offset := callee(call)
+
+	var result Object
+	if function, ok := fn.(*Function); ok && function.Clauses == nil && len(args) != len(function.Parameters) {
+		if function.Name != "" {
+			name = function.Name
+		}
+		result = arityError(name, len(args), len(function.Parameters))
+	} else if builtin, ok := fn.(*Builtin); ok {
+		result = callBuiltin(builtin, args, env)
+	} else {
+		result = applyFunction(fn, args)
+	}
+
+	if err, ok := result.(*Error); ok && offset >= 0 {
+		return locateAt(err, offset, env)
+	}
+	return result
+}
+
+// callee returns the name a call refers to its function by, if any, and
+// the offset of that name
+func callee(call *parser.CallExpression) (string, int) {
+	switch fn := call.Function.(type) {
+	case *parser.Identifier:
+		return fn.Value, fn.Token.Offset
+	case *parser.DotExpression:
+		if fn.Property != nil {
+			return fn.Property.Value, fn.Property.Token.Offset
+		}
+	}
+	return "", call.Token.Offset
+}
+
+func arityError(name string, got, want int) *Error {
+	if name == "" {
+		return newCodedError(E_ARITY, "wrong number of arguments. got=%d, want=%d", got, want)
+	}
+	return newCodedError(E_ARITY, "wrong number of arguments to `%s`. got=%d, want=%d", name, got, want)
+}
+
 // Function application
 func applyFunction(fn Object, args []Object) Object {
 	switch fn := fn.(type) {
 	case *Function:
-		extendedEnv := extendFunctionEnv(fn, args)
+		if err := fn.Env.session.tick(); err != nil {
+			return err
+		}
+		fn, err := fn.choose(args)
+		if err != nil {
+			return err
+		}
+		extendedEnv, err := extendFunctionEnv(fn, args)
+		if err != nil {
+			return err
+		}
 		evaluated := Eval(fn.Body, extendedEnv)
+		extendedEnv.release()
+		addFrame(evaluated, fn)
 		return unwrapReturnValue(evaluated)
 	case *Builtin:
-		return fn.Fn(args...)
+		return callBuiltin(fn, args, nil)
 	default:
-		return newError("not a function: %T", fn)
+		return newCodedError(E_NOT_CALLABLE, "not a function: %T", fn)
+	}
+}
+
+// callBuiltin runs a builtin called from env, which is nil when the call
+// comes from Go code, such as a callback passed to another builtin
+func callBuiltin(b *Builtin, args []Object, env *Environment) Object {
+	if err := b.checkArgs(args); err != nil {
+		return err
+	}
+
+	var result Object
+	if b.EnvFn != nil {
+		if env == nil {
+			return newError("`%s` can only be called directly", b.Name)
+		}
+		env.capture()
+		result = b.EnvFn(env, args...)
+	} else {
+		result = b.Fn(args...)
 	}
+
+	if result == nil {
+		return NULL
+	}
+	return result
 }
 
-func extendFunctionEnv(fn *Function, args []Object) *Environment {
-	env := NewEnclosedEnvironment(fn.Env)
+// isConstantCall reports whether call, which called fn and gave result,
+// gives that result every time: fn is pure, its arguments are literals and
+// the result is a value nothing can change
+func isConstantCall(call *parser.CallExpression, fn, result Object) bool {
+	if b, ok := fn.(*Builtin); !ok || !b.Pure {
+		return false
+	}
+	for _, arg := range call.Arguments {
+		if !isConstant(arg) {
+			return false
+		}
+	}
+	switch result.(type) {
+	case *Integer, *Float, *String, *Boolean, *Null:
+		return true
+	}
+	return false
+}
+
+// isConstant reports whether node is a literal number, string, boolean
+// or null, or a negated number
+func isConstant(node parser.Expression) bool {
+	switch node := node.(type) {
+	case *parser.IntegerLiteral, *parser.FloatLiteral, *parser.StringLiteral, *parser.BooleanLiteral, *parser.NullLiteral:
+		return true
+	case *parser.PrefixExpression:
+		switch node.Right.(type) {
+		case *parser.IntegerLiteral, *parser.FloatLiteral:
+			return node.Operator == "-"
+		}
+	}
+	return false
+}
+
+func extendFunctionEnv(fn *Function, args []Object) (*Environment, *Error) {
+	if len(args) != len(fn.Parameters) {
+		return nil, arityError(fn.Name, len(args), len(fn.Parameters))
+	}
+
+	env := newFunctionEnvironment(fn.Env)
 
 	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+		if param != nil {
+			env.set(param.Ident, args[paramIdx])
+		}
 	}
 
-	return env
+	return env, nil
 }
 
 func unwrapReturnValue(obj Object) Object {
@@ -597,9 +1114,127 @@ func unwrapReturnValue(obj Object) Object {
 	return obj
 }
 
+// evalSwitchStatement runs the first case matching the switch value, or
+// the default case when none does. Cases don't fall through, and a break
+// leaves the switch.
+func evalSwitchStatement(ss *parser.SwitchStatement, env *Environment) Object {
+	value := Eval(ss.Value, env)
+	if isError(value) {
+		return value
+	}
+
+	for _, c := range ss.Cases {
+		var matched bool
+		if ss.TypeSwitch {
+			matched = matchesType(value, c.Types)
+		} else {
+			caseValue := Eval(c.Value, env)
+			if isError(caseValue) {
+				return caseValue
+			}
+			matched = evalInfixExpression("==", value, caseValue) == TRUE
+		}
+		if matched {
+			return switchResult(Eval(c.Body, env))
+		}
+	}
+
+	if ss.Default != nil {
+		return switchResult(Eval(ss.Default.Body, env))
+	}
+	return NULL
+}
+
+// evalTryStatement runs the try block and, if it fails, the catch block
+// with what was thrown. The finally block runs last; an error, return,
+// break or continue from it replaces the outcome of the other two.
+func evalTryStatement(ts *parser.TryStatement, env *Environment) Object {
+	result := Eval(ts.Body, env)
+	if err, ok := result.(*Error); ok && err.catchable() && ts.Catch != nil {
+		catchEnv := newBlockEnvironment(env)
+		if ts.Catch.Parameter != nil {
+			catchEnv.set(ts.Catch.Parameter.Ident, caughtValue(err))
+		}
+		result = Eval(ts.Catch.Body, catchEnv)
+	}
+
+	if ts.Finally != nil {
+		final := Eval(ts.Finally.Body, env)
+		if final != nil {
+			switch final.Type() {
+			case ERROR_OBJ, RETURN_OBJ, BREAK_OBJ, CONTINUE_OBJ:
+				return final
+			}
+		}
+	}
+	return result
+}
+
+// evalThrowStatement raises a value as an error. Its message is the string
+// thrown, or the message property of a thrown object.
+func evalThrowStatement(ts *parser.ThrowStatement, env *Environment) Object {
+	value := Eval(ts.Value, env)
+	if isError(value) {
+		return value
+	}
+
+	message := value.Inspect()
+	switch value := value.(type) {
+	case *String:
+		message = value.Value
+	case *Hash:
+		if m, ok := hashGet(value, "message").(*String); ok {
+			message = m.Value
+		}
+	}
+	return &Error{Message: message, Code: E_THROWN, Thrown: value}
+}
+
+func switchResult(result Object) Object {
+	if result != nil && result.Type() == BREAK_OBJ {
+		return NULL
+	}
+	return result
+}
+
+// typeNames maps the type names used in type switches to object types.
+// Other names match the object type of the same name, such as stack.
+var typeNames = map[string][]ObjectType{
+	"int":      {INTEGER_OBJ},
+	"float":    {FLOAT_OBJ},
+	"string":   {STRING_OBJ},
+	"bool":     {BOOLEAN_OBJ},
+	"array":    {ARRAY_OBJ},
+	"object":   {HASH_OBJ},
+	"null":     {NULL_OBJ},
+	"fn":       {FUNCTION_OBJ, BUILTIN_OBJ},
+	"function": {FUNCTION_OBJ, BUILTIN_OBJ},
+}
+
+func matchesType(value Object, names []*parser.Identifier) bool {
+	for _, name := range names {
+		if name == nil {
+			continue
+		}
+		// A record also matches the name of its type, as in case Point:
+		if record, ok := value.(*Record); ok && record.Def.Name == name.Value {
+			return true
+		}
+		types, ok := typeNames[name.Value]
+		if !ok {
+			types = []ObjectType{ObjectType(strings.ToUpper(name.Value))}
+		}
+		if hasType(types, value.Type()) {
+			return true
+		}
+	}
+	return false
+}
+
 // Loop evaluations
 func evalWhileStatement(ws *parser.WhileStatement, env *Environment) Object {
 	var result Object = NULL
+	guard := env.guardLoop()
 
 	for {
 		condition := Eval(ws.Condition, env)
@@ -610,26 +1245,94 @@ func evalWhileStatement(ws *parser.WhileStatement, env *Environment) Object {
 		if !isTruthy(condition) {
 			break
 		}
+		if err := guard.next(); err != nil {
+			return err
+		}
 
-		result = Eval(ws.Body, env)
-		if result != nil {
-			switch result.Type() {
-			case RETURN_OBJ, ERROR_OBJ:
-				return result
-			case BREAK_OBJ:
-				return NULL
-			case CONTINUE_OBJ:
-				continue
-			}
+		var done bool
+		if result, done = evalLoopBody(ws.Body, env, result); done {
+			return result
 		}
 	}
 
 	return result
 }
 
+// evalForOfStatement runs the body for each element of an array, or each
+// character of a string, bound to the loop's name in a scope of its own.
+// A string's characters are its runes, each a one-character string.
+func evalForOfStatement(fs *parser.ForOfStatement, env *Environment) Object {
+	if fs.Name == nil {
+		return newError("for-of statement is missing a name")
+	}
+	iterable := Eval(fs.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+
+	// The loop runs over the elements as they are when it starts, so
+	// changes the body makes to the array or object are not seen
+	var elements []Object
+	switch iterable := iterable.(type) {
+	case *Array:
+		elements = slices.Clone(iterable.Elements)
+	case *Hash:
+		keys := hashKeys(iterable)
+		if isError(keys) {
+			return keys
+		}
+		elements = slices.Clone(keys.(*Array).Elements)
+	case *String:
+		elements = make([]Object, 0, utf8.RuneCountInString(iterable.Value))
+		for _, r := range iterable.Value {
+			elements = append(elements, &String{Value: string(r)})
+		}
+	default:
+		return newCodedError(E_TYPE_MISMATCH, "for-of needs an array, an object or a string, got %s", iterable.Type())
+	}
+
+	var result Object = NULL
+	guard := env.guardLoop()
+	for _, element := range elements {
+		if err := guard.next(); err != nil {
+			return err
+		}
+		iterEnv := newBlockEnvironment(env)
+		iterEnv.set(fs.Name.Ident, element)
+
+		var done bool
+		if result, done = evalLoopBody(fs.Body, iterEnv, result); done {
+			return result
+		}
+	}
+
+	return result
+}
+
+// evalLoopBody runs one iteration of a loop, given the loop's value so
+// far. It returns the loop's new value and whether the loop ends with it.
+// continue ends only the iteration, break ends the loop with the value of
+// the last iteration that completed, and return values and errors leave
+// the loop as they are.
+func evalLoopBody(body *parser.BlockStatement, env *Environment, result Object) (Object, bool) {
+	value := Eval(body, env)
+	if value == nil {
+		return result, false
+	}
+	switch value.Type() {
+	case RETURN_OBJ, ERROR_OBJ:
+		return value, true
+	case BREAK_OBJ:
+		return result, true
+	case CONTINUE_OBJ:
+		return result, false
+	}
+	return value, false
+}
+
 func evalForStatement(fs *parser.ForStatement, env *Environment) Object {
 	// Create new environment for for loop scope
-	forEnv := NewEnclosedEnvironment(env)
+	forEnv := newBlockEnvironment(env)
 
 	// Initialize
 	if fs.Initializer != nil {
@@ -639,7 +1342,15 @@ func evalForStatement(fs *parser.ForStatement, env *Environment) Object {
 		}
 	}
 
+	// A variable declared with let gets a fresh binding each iteration,
+	// so closures created in the body keep the value it had then
+	var perIteration tokens.Ident
+	if let, ok := fs.Initializer.(*parser.LetStatement); ok && let.Name != nil {
+		perIteration = let.Name.Ident
+	}
+
 	var result Object = NULL
+	guard := forEnv.guardLoop()
 
 	for {
 		// Check condition
@@ -652,20 +1363,21 @@ func evalForStatement(fs *parser.ForStatement, env *Environment) Object {
 				break
 			}
 		}
+		if err := guard.next(); err != nil {
+			return err
+		}
 
-		// Execute body
-		result = Eval(fs.Body, forEnv)
-		if result != nil {
-			switch result.Type() {
-			case RETURN_OBJ, ERROR_OBJ:
-				return result
-			case BREAK_OBJ:
-				return NULL
-			case CONTINUE_OBJ:
-				// Continue to increment
-			default:
-				// Continue normally
-			}
+		// Execute body; after continue the increment still runs
+		var done bool
+		if result, done = evalLoopBody(fs.Body, forEnv, result); done {
+			return result
+		}
+
+		if perIteration != 0 {
+			next := newBlockEnvironment(env)
+			value, _, _ := forEnv.lookup(perIteration)
+			next.store[perIteration] = value
+			forEnv = next
 		}
 
 		// Increment
@@ -0,0 +1,135 @@
+package evaluator
+
+import "fmt"
+
+const EMITTER_OBJ = "EMITTER"
+
+func init() {
+	registerModule("events", map[string]Object{
+		"emitter": &Builtin{
+			Doc: "Creates an event emitter with no listeners.",
+			Fn: func(args ...Object) Object {
+				return NewEmitter()
+			},
+		},
+	})
+}
+
+// Emitter object dispatches named events to registered GoKid callbacks.
+// Native modules reuse it to deliver their own events to scripts.
+type Emitter struct {
+	listeners map[string][]Object
+}
+
+// NewEmitter creates an emitter with no listeners
+func NewEmitter() *Emitter {
+	return &Emitter{listeners: make(map[string][]Object)}
+}
+
+func (e *Emitter) Type() ObjectType { return EMITTER_OBJ }
+func (e *Emitter) Inspect() string {
+	count := 0
+	for _, listeners := range e.listeners {
+		count += len(listeners)
+	}
+	return fmt.Sprintf("emitter(%d listeners)", count)
+}
+
+// On registers fn to be called whenever the named event is emitted
+func (e *Emitter) On(name string, fn Object) {
+	e.listeners[name] = append(e.listeners[name], fn)
+}
+
+// Off removes fn from the named event, or every listener when fn is nil
+func (e *Emitter) Off(name string, fn Object) {
+	if fn == nil {
+		delete(e.listeners, name)
+		return
+	}
+
+	remaining := []Object{}
+	for _, listener := range e.listeners[name] {
+		if listener != fn {
+			remaining = append(remaining, listener)
+		}
+	}
+	if len(remaining) == 0 {
+		delete(e.listeners, name)
+		return
+	}
+	e.listeners[name] = remaining
+}
+
+// Emit calls every listener of the named event in registration order.
+// It returns TRUE if any listener ran, or the first error raised.
+func (e *Emitter) Emit(name string, args ...Object) Object {
+	listeners := append([]Object{}, e.listeners[name]...)
+	for _, listener := range listeners {
+		result := applyFunction(listener, args)
+		if isError(result) {
+			return result
+		}
+	}
+	return nativeBoolToPyMonkeyBool(len(listeners) > 0)
+}
+
+func (e *Emitter) Member(name string) (Object, bool) {
+	switch name {
+	case "on":
+		return method(func(args ...Object) Object {
+			if err := checkArity("on", args, 2); err != nil {
+				return err
+			}
+			event, ok := args[0].(*String)
+			if !ok {
+				return newCodedError(E_TYPE_MISMATCH, "event name must be STRING, got %s", args[0].Type())
+			}
+			switch args[1].(type) {
+			case *Function, *Builtin:
+			default:
+				return newCodedError(E_TYPE_MISMATCH, "event listener must be FUNCTION, got %s", args[1].Type())
+			}
+			e.On(event.Value, args[1])
+			return e
+		}), true
+	case "off":
+		return method(func(args ...Object) Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newCodedError(E_ARITY, "wrong number of arguments to `off`. got=%d, want=1 or 2", len(args))
+			}
+			event, ok := args[0].(*String)
+			if !ok {
+				return newCodedError(E_TYPE_MISMATCH, "event name must be STRING, got %s", args[0].Type())
+			}
+			var fn Object
+			if len(args) == 2 {
+				fn = args[1]
+			}
+			e.Off(event.Value, fn)
+			return e
+		}), true
+	case "emit":
+		return method(func(args ...Object) Object {
+			if len(args) < 1 {
+				return newCodedError(E_ARITY, "wrong number of arguments to `emit`. got=%d, want at least 1", len(args))
+			}
+			event, ok := args[0].(*String)
+			if !ok {
+				return newCodedError(E_TYPE_MISMATCH, "event name must be STRING, got %s", args[0].Type())
+			}
+			return e.Emit(event.Value, args[1:]...)
+		}), true
+	case "listeners":
+		return method(func(args ...Object) Object {
+			if err := checkArity("listeners", args, 1); err != nil {
+				return err
+			}
+			event, ok := args[0].(*String)
+			if !ok {
+				return newCodedError(E_TYPE_MISMATCH, "event name must be STRING, got %s", args[0].Type())
+			}
+			return &Integer{Value: int64(len(e.listeners[event.Value]))}
+		}), true
+	}
+	return nil, false
+}
@@ -0,0 +1,77 @@
+package evaluator
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Fixtures give a test file the input its code reads and check what it
+// prints, so programs that talk to the user can be tested end to end. The
+// file declares the input with stdin(text), and what its code should have
+// printed since it started, or since the last check, with
+// expectOutput(text).
+type Fixtures struct {
+	env     *Environment
+	out     bytes.Buffer
+	checked int // bytes of out already checked
+}
+
+// UseFixtures binds stdin and expectOutput in env and captures what its
+// programs print instead of writing it. Until stdin is called, input finds
+// the input empty.
+func (e *Environment) UseFixtures() *Fixtures {
+	f := &Fixtures{env: e}
+	e.SetOutput(&f.out, nil)
+	e.SetInput(strings.NewReader(""))
+	e.Set("stdin", &Builtin{
+		Name:   "stdin",
+		Params: []Param{{Name: "text", Types: []ObjectType{STRING_OBJ}}},
+		Doc:    "Makes input read the lines of text.",
+		Fn: func(args ...Object) Object {
+			e.SetInput(strings.NewReader(args[0].(*String).Value))
+			return NULL
+		},
+	})
+	e.Set("expectOutput", &Builtin{
+		Name:   "expectOutput",
+		Params: []Param{{Name: "text", Types: []ObjectType{STRING_OBJ}}},
+		Doc:    "Fails unless what was printed since the test started, or since the last expectOutput, is text.",
+		Fn:     f.expectOutput,
+	})
+	return f
+}
+
+// Output returns everything the programs printed
+func (f *Fixtures) Output() string {
+	f.env.Flush()
+	return f.out.String()
+}
+
+func (f *Fixtures) expectOutput(args ...Object) Object {
+	printed := f.Output()[f.checked:]
+	f.checked = f.out.Len()
+	got, want := outputLines(printed), outputLines(args[0].(*String).Value)
+	for i := 0; i < max(len(got), len(want)); i++ {
+		wantLine, gotLine := "(no more lines)", "(no more lines)"
+		if i < len(want) {
+			wantLine = want[i]
+		}
+		if i < len(got) {
+			gotLine = got[i]
+		}
+		if wantLine != gotLine {
+			return newError("%s", fmt.Sprintf("output differs at line %d:\n    want: %s\n    got:  %s", i+1, wantLine, gotLine))
+		}
+	}
+	return NULL
+}
+
+// outputLines splits output into lines, taking a final newline to end the
+// last line rather than start another
+func outputLines(output string) []string {
+	if output == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+}
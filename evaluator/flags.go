@@ -0,0 +1,209 @@
+package evaluator
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	registerModule("flags", map[string]Object{
+		"define": &Builtin{
+			Params: []Param{
+				{Name: "name", Types: []ObjectType{STRING_OBJ}},
+				{Name: "default", Types: []ObjectType{INTEGER_OBJ, FLOAT_OBJ, STRING_OBJ, BOOLEAN_OBJ}},
+				{Name: "help", Types: []ObjectType{STRING_OBJ}, Optional: true},
+			},
+			Doc:   "Declares a command-line option, whose type follows its default value.",
+			EnvFn: defineFlag,
+		},
+		"parse": &Builtin{
+			Params: []Param{{Name: "args", Types: []ObjectType{ARRAY_OBJ}, Optional: true}},
+			Doc:    "Parses os.args, or the given array, and returns a hash of option values. With --help it prints the usage and ends the program.",
+			EnvFn:  parseFlags,
+		},
+		"args": &Builtin{
+			Doc: "Returns the positional arguments left over by flags.parse.",
+			EnvFn: func(env *Environment, args ...Object) Object {
+				flags := env.session.lockFlags()
+				defer env.session.unlockFlags()
+				return &Array{Elements: append([]Object{}, flags.args...)}
+			},
+		},
+		"usage": &Builtin{
+			Doc: "Prints a usage message listing the declared options.",
+			EnvFn: func(env *Environment, args ...Object) Object {
+				flags := env.session.lockFlags()
+				usage := flags.usage()
+				env.session.unlockFlags()
+				io.WriteString(env.session.out(), usage)
+				return NULL
+			},
+		},
+	})
+}
+
+// flagDef is an option declared by the script with flags.define
+type flagDef struct {
+	name  string
+	value Object
+	help  string
+}
+
+// flagState is what the flags module knows of an interpreter's options:
+// those declared and the positional arguments the last parse left over
+type flagState struct {
+	defs []flagDef
+	args []Object
+}
+
+// lockFlags returns the interpreter's flag state, locking the session
+// when it is shared between goroutines, until unlockFlags
+func (s *session) lockFlags() *flagState {
+	if s.concurrent {
+		s.mu.Lock()
+	}
+	return &s.flags
+}
+
+func (s *session) unlockFlags() {
+	if s.concurrent {
+		s.mu.Unlock()
+	}
+}
+
+func defineFlag(env *Environment, args ...Object) Object {
+	name := args[0].(*String)
+
+	help := ""
+	if len(args) == 3 {
+		help = args[2].(*String).Value
+	}
+
+	flags := env.session.lockFlags()
+	defer env.session.unlockFlags()
+	for i, def := range flags.defs {
+		if def.name == name.Value {
+			flags.defs[i] = flagDef{name: name.Value, value: args[1], help: help}
+			return NULL
+		}
+	}
+	flags.defs = append(flags.defs, flagDef{name: name.Value, value: args[1], help: help})
+
+	return NULL
+}
+
+// parseFlags parses os.args (or the given array) against the defined flags
+// and returns a hash of option values. Positional arguments are available
+// afterwards through flags.args(). With --help the usage goes to the
+// interpreter's output and the program ends, as with os.exit(0).
+func parseFlags(env *Environment, args ...Object) Object {
+	var input []string
+	if len(args) == 1 {
+		for _, el := range args[0].(*Array).Elements {
+			input = append(input, el.Inspect())
+		}
+	} else if osArgs := modules["os"].Members["args"].(*Array); len(osArgs.Elements) > 1 {
+		for _, el := range osArgs.Elements[1:] {
+			input = append(input, el.Inspect())
+		}
+	}
+
+	s := env.session
+	flags := s.lockFlags()
+	fs, values := flags.newFlagSet()
+	var output bytes.Buffer
+	fs.SetOutput(&output)
+
+	if err := fs.Parse(input); err != nil {
+		usage := flags.usage()
+		s.unlockFlags()
+		if errors.Is(err, flag.ErrHelp) {
+			io.WriteString(s.out(), usage)
+			return exitError(0)
+		}
+		return newCodedError(E_VALUE, "%s\n%s", err, strings.TrimRight(usage, "\n"))
+	}
+	defer s.unlockFlags()
+
+	pairs := make(map[HashKey]HashPair)
+	for _, def := range flags.defs {
+		value, err := flagValue(def.value, values[def.name].String())
+		if err != nil {
+			return err
+		}
+		key := &String{Value: def.name}
+		pairs[key.HashKey()] = HashPair{Key: key, Value: value}
+	}
+
+	flags.args = []Object{}
+	for _, arg := range fs.Args() {
+		flags.args = append(flags.args, &String{Value: arg})
+	}
+
+	return &Hash{Pairs: pairs}
+}
+
+func (flags *flagState) newFlagSet() (*flag.FlagSet, map[string]flag.Value) {
+	fs := flag.NewFlagSet(scriptName(), flag.ContinueOnError)
+	for _, def := range flags.defs {
+		switch v := def.value.(type) {
+		case *Integer:
+			fs.Int64(def.name, v.Value, def.help)
+		case *Float:
+			fs.Float64(def.name, v.Value, def.help)
+		case *String:
+			fs.String(def.name, v.Value, def.help)
+		case *Boolean:
+			fs.Bool(def.name, v.Value, def.help)
+		}
+	}
+
+	values := make(map[string]flag.Value)
+	fs.VisitAll(func(f *flag.Flag) {
+		values[f.Name] = f.Value
+	})
+	return fs, values
+}
+
+func flagValue(def Object, raw string) (Object, *Error) {
+	switch def.(type) {
+	case *Integer:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, newCodedError(E_VALUE, "invalid integer flag value: %s", raw)
+		}
+		return &Integer{Value: n}, nil
+	case *Float:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, newCodedError(E_VALUE, "invalid float flag value: %s", raw)
+		}
+		return &Float{Value: f}, nil
+	case *Boolean:
+		return nativeBoolToPyMonkeyBool(raw == "true"), nil
+	default:
+		return &String{Value: raw}, nil
+	}
+}
+
+func (flags *flagState) usage() string {
+	fs, _ := flags.newFlagSet()
+	var out bytes.Buffer
+	fs.SetOutput(&out)
+	fmt.Fprintf(&out, "Usage of %s:\n", scriptName())
+	fs.PrintDefaults()
+	return out.String()
+}
+
+func scriptName() string {
+	osArgs := modules["os"].Members["args"].(*Array)
+	if len(osArgs.Elements) == 0 {
+		return "gokid"
+	}
+	return osArgs.Elements[0].Inspect()
+}
@@ -0,0 +1,294 @@
+package evaluator
+
+import (
+	"bufio"
+	"gokid/tokens"
+	"slices"
+)
+
+// Fork returns a copy of the interpreter env belongs to, for hosts that
+// want to run code without affecting the original, such as a sandboxed
+// eval or a test that must start from the same state every time. The
+// copy has env's scope and the scopes around it; the environment returned
+// is the copy of env.
+//
+// Arrays, objects, records, the collections module's stacks, queues,
+// deques, heaps and sorted maps, string builders, event emitters,
+// functions, imported modules and the functions partial, compose, memoize
+// and rpc.handler return are copied, so a change made to them on one side
+// is never seen on the other, and forking costs time in proportion to the
+// values bound. Other builtins are the copy's own, and parsed code is
+// shared, as are streams, servers, WebSockets and runtime.counters(),
+// which hold state outside the interpreter or can't be copied. The copy
+// writes to the same output and has the same loop guard, but no step hook.
+func (e *Environment) Fork() *Environment {
+	return newForker(false).scope(e)
+}
+
+// forker copies an interpreter so the copy can run code at the same time
+// as the original without sharing any variables. Scopes are copied along
+// with the arrays and objects bound in them, and functions are re-bound to
+// the copied scopes.
+type forker struct {
+	sessions map[*session]*session
+	scopes   map[*Environment]*Environment
+	values   map[Object]Object
+
+	// isolated makes copies that leave signals and host tasks to the
+	// original, for copies running on other goroutines
+	isolated bool
+}
+
+func newForker(isolated bool) *forker {
+	return &forker{
+		sessions: map[*session]*session{},
+		scopes:   map[*Environment]*Environment{},
+		values:   map[Object]Object{},
+		isolated: isolated,
+	}
+}
+
+// scope returns the copy of env, copying it and the scopes around it on
+// first use
+func (f *forker) scope(env *Environment) *Environment {
+	if env == nil {
+		return nil
+	}
+	if copied, ok := f.scopes[env]; ok {
+		return copied
+	}
+
+	copied := &Environment{
+		session: f.session(env.session),
+		path:    env.path,
+		lines:   env.lines,
+		exports: env.exports,
+		block:   env.block,
+	}
+	f.scopes[env] = copied
+	copied.outer = f.scope(env.outer)
+
+	env.rlock()
+	bindings := make(map[tokens.Ident]Object, len(env.store))
+	for name, value := range env.store {
+		bindings[name] = value
+	}
+	env.runlock()
+	copied.store = make(map[tokens.Ident]Object, len(bindings))
+	for name, value := range bindings {
+		copied.store[name] = f.value(value)
+	}
+	env.rlock()
+	if env.globals != nil {
+		copied.globals = make(map[tokens.Ident]bool, len(env.globals))
+		for name := range env.globals {
+			copied.globals[name] = true
+		}
+	}
+	env.runlock()
+	return copied
+}
+
+// value returns the copy of obj: arrays, objects, records, collections,
+// string builders, emitters, functions, modules and builtins made by other
+// builtins are copied, other values are immutable, can't be copied, such
+// as streams, or belong to the host, and are shared
+func (f *forker) value(obj Object) Object {
+	if copied, ok := f.values[obj]; ok {
+		return copied
+	}
+
+	switch obj := obj.(type) {
+	case *Array:
+		arr := &Array{Elements: make([]Object, len(obj.Elements)), Frozen: obj.Frozen}
+		f.values[obj] = arr
+		for i, element := range obj.Elements {
+			arr.Elements[i] = f.value(element)
+		}
+		return arr
+	case *Hash:
+		hash := &Hash{Pairs: make(map[HashKey]HashPair, len(obj.Pairs)), Frozen: obj.Frozen}
+		f.values[obj] = hash
+		for key, pair := range obj.Pairs {
+			hash.Pairs[key] = HashPair{Key: pair.Key, Value: f.value(pair.Value)}
+		}
+		return hash
+	case *Record:
+		record := &Record{Def: obj.Def, Values: make([]Object, len(obj.Values))}
+		f.values[obj] = record
+		for i, value := range obj.Values {
+			record.Values[i] = f.value(value)
+		}
+		return record
+	case *Function:
+		fn := *obj
+		f.values[obj] = &fn
+		fn.Env = f.scope(obj.Env)
+		if obj.Clauses != nil {
+			fn.Clauses = make([]*Function, len(obj.Clauses))
+			for i, clause := range obj.Clauses {
+				fn.Clauses[i] = f.value(clause).(*Function)
+			}
+		}
+		return &fn
+	case *Stack:
+		stack := &Stack{}
+		f.values[obj] = stack
+		stack.Elements = f.elements(obj.Elements)
+		return stack
+	case *Queue:
+		queue := &Queue{}
+		f.values[obj] = queue
+		queue.Elements = f.elements(obj.Elements)
+		return queue
+	case *Deque:
+		deque := &Deque{}
+		f.values[obj] = deque
+		deque.Elements = f.elements(obj.Elements)
+		return deque
+	case *Heap:
+		heap := &Heap{Entries: make([]HeapEntry, len(obj.Entries))}
+		f.values[obj] = heap
+		if obj.KeyFn != nil {
+			heap.KeyFn = f.value(obj.KeyFn)
+		}
+		for i, entry := range obj.Entries {
+			heap.Entries[i] = HeapEntry{Key: f.value(entry.Key), Value: f.value(entry.Value)}
+		}
+		return heap
+	case *SortedMap:
+		sorted := &SortedMap{Entries: make([]HashPair, len(obj.Entries))}
+		f.values[obj] = sorted
+		for i, entry := range obj.Entries {
+			sorted.Entries[i] = HashPair{Key: entry.Key, Value: f.value(entry.Value)}
+		}
+		return sorted
+	case *StringBuilder:
+		sb := &StringBuilder{}
+		sb.builder.WriteString(obj.builder.String())
+		f.values[obj] = sb
+		return sb
+	case *Emitter:
+		emitter := NewEmitter()
+		f.values[obj] = emitter
+		for event, listeners := range obj.listeners {
+			emitter.listeners[event] = f.elements(listeners)
+		}
+		return emitter
+	case *Builtin:
+		// A builtin made by another, such as the function partial
+		// returns, is built again around copies of the values it works
+		// with; the copy is registered first, for values that refer back
+		// to it
+		if obj.build == nil {
+			return obj
+		}
+		b := &Builtin{}
+		f.values[obj] = b
+		*b = *obj
+		b.captured = f.elements(obj.captured)
+		b.Fn = obj.build(b.captured)
+		return b
+	case *Module:
+		// A module's functions run in its own scope, which is copied
+		// with them
+		module := &Module{Name: obj.Name, Members: make(map[string]Object, len(obj.Members))}
+		f.values[obj] = module
+		for name, member := range obj.Members {
+			module.Members[name] = f.value(member)
+		}
+		return module
+	default:
+		return obj
+	}
+}
+
+// elements returns copies of objs
+func (f *forker) elements(objs []Object) []Object {
+	copied := make([]Object, len(objs))
+	for i, obj := range objs {
+		copied[i] = f.value(obj)
+	}
+	return copied
+}
+
+// session returns the copy of s. The copy has its own builtins, bound to
+// its own output.
+func (f *forker) session(s *session) *session {
+	if copied, ok := f.sessions[s]; ok {
+		return copied
+	}
+
+	copied := &session{
+		loopLimit:       s.loopLimit,
+		loopTimeout:     s.loopTimeout,
+		evalDisabled:    s.evalDisabled,
+		importsDisabled: s.importsDisabled,
+		deterministic:   s.deterministic,
+		stdout:          s.stdout,
+		stderr:          s.stderr,
+		stdin:           s.stdin,
+		builtins:        make(map[string]*Builtin, len(s.builtins)),
+		modules:         make(map[string]*Module, len(s.modules)),
+		isolated:        f.isolated,
+		meter:           s.meter,
+		coverage:        s.coverage,
+		hooks:           s.hooks,
+		counters:        s.counters,
+		ctx:             s.ctx,
+	}
+	// A fork is a new interpreter with a meter of its own, starting from
+	// the original's limits; isolated copies run the same program and
+	// share the original's
+	if !f.isolated {
+		copied.meter = &meter{}
+		copied.meter.limits.Store(s.meter.limits.Load())
+	}
+	// Isolated copies share their output with other goroutines, which a
+	// buffer of their own would interleave at random points
+	if s.buffer != nil && !f.isolated {
+		copied.buffer = bufio.NewWriterSize(copied.rawOut(), s.buffer.Size())
+	}
+	// A fork imports modules afresh; isolated copies share the original's
+	// modules, which they copy as they import them
+	copied.imports = newModuleCache()
+	if f.isolated {
+		copied.forker = f
+		copied.imports = s.imports
+	}
+	f.sessions[s] = copied
+	// Builtins and standard modules bound to the original, wherever they
+	// are bound in its scopes, become the copy's
+	for name, b := range s.builtins {
+		copied.builtins[name] = copied.bind(b)
+		f.values[b] = copied.builtins[name]
+	}
+	for name, m := range s.modules {
+		copied.modules[name] = copied.bindModule(m)
+		f.values[m] = copied.modules[name]
+		for member, value := range m.Members {
+			f.values[value] = copied.modules[name].Members[member]
+		}
+	}
+	for _, hook := range s.exitHooks {
+		copied.exitHooks = append(copied.exitHooks, f.value(hook))
+	}
+	copied.flags = flagState{defs: slices.Clone(s.flags.defs), args: f.elements(s.flags.args)}
+	if s.hidden != nil {
+		copied.hidden = make(map[string]bool, len(s.hidden))
+		for name := range s.hidden {
+			copied.hidden[name] = true
+		}
+	}
+	if s.resolved != nil {
+		copied.resolved = make(map[tokens.Ident]Object, len(s.resolved))
+		for id := range s.resolved {
+			if b, ok := copied.builtins[id.Name()]; ok {
+				copied.resolved[id] = b
+			} else {
+				copied.resolved[id] = copied.modules[id.Name()]
+			}
+		}
+	}
+	return copied
+}
@@ -0,0 +1,57 @@
+package evaluator
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Formatter writes a result as text, for the REPL and for the final value
+// of a program run with --output
+type Formatter func(obj Object) (string, error)
+
+var (
+	formattersMu sync.RWMutex
+	formatters   = map[string]Formatter{
+		"pretty": func(obj Object) (string, error) {
+			return Pretty(obj, DefaultPrettyOptions), nil
+		},
+		"raw": func(obj Object) (string, error) {
+			return obj.Inspect(), nil
+		},
+		"json": func(obj Object) (string, error) {
+			value, err := toJSONValue(obj)
+			if err != nil {
+				return "", err
+			}
+			data, err := json.Marshal(value)
+			return string(data), err
+		},
+	}
+)
+
+// RegisterFormatter adds a formatter, or replaces the one with its name,
+// so hosts can offer other output formats
+func RegisterFormatter(name string, f Formatter) {
+	formattersMu.Lock()
+	defer formattersMu.Unlock()
+	formatters[name] = f
+}
+
+// LookupFormatter returns the formatter called name. The error lists the
+// formatters there are.
+func LookupFormatter(name string) (Formatter, error) {
+	formattersMu.RLock()
+	defer formattersMu.RUnlock()
+	if f, ok := formatters[name]; ok {
+		return f, nil
+	}
+	names := make([]string, 0, len(formatters))
+	for name := range formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("unknown output format %s; use %s", name, strings.Join(names, ", "))
+}
@@ -0,0 +1,93 @@
+package evaluator
+
+import "math/big"
+
+const FRACTION_OBJ = "FRACTION"
+
+func init() {
+	registerBuiltin(&Builtin{
+		Name: "frac",
+		Params: []Param{
+			{Name: "numerator", Types: []ObjectType{INTEGER_OBJ}},
+			{Name: "denominator", Types: []ObjectType{INTEGER_OBJ}, Optional: true},
+		},
+		Doc: "Returns the exact fraction numerator/denominator, in lowest terms.",
+		Fn: func(args ...Object) Object {
+			denominator := int64(1)
+			if len(args) == 2 {
+				denominator = args[1].(*Integer).Value
+			}
+			if denominator == 0 {
+				return newCodedError(E_DIV_ZERO, "division by zero")
+			}
+			return &Fraction{Value: big.NewRat(args[0].(*Integer).Value, denominator)}
+		},
+	})
+}
+
+// Fraction object, an exact rational number. Its value is never changed
+// once created.
+type Fraction struct {
+	Value *big.Rat
+}
+
+func (f *Fraction) Type() ObjectType { return FRACTION_OBJ }
+func (f *Fraction) Inspect() string  { return f.Value.RatString() }
+
+// isFractionOperation reports whether an infix operation mixes a fraction
+// with an integer, float or fraction
+func isFractionOperation(left, right Object) bool {
+	if left.Type() != FRACTION_OBJ && right.Type() != FRACTION_OBJ {
+		return false
+	}
+	return hasType([]ObjectType{INTEGER_OBJ, FLOAT_OBJ, FRACTION_OBJ}, left.Type()) &&
+		hasType([]ObjectType{INTEGER_OBJ, FLOAT_OBJ, FRACTION_OBJ}, right.Type())
+}
+
+// toRat converts an integer or fraction to a big.Rat
+func toRat(obj Object) *big.Rat {
+	if f, ok := obj.(*Fraction); ok {
+		return f.Value
+	}
+	return new(big.Rat).SetInt64(obj.(*Integer).Value)
+}
+
+// Fractions are exact with integers, and become floats when mixed with one
+func evalFractionInfixExpression(operator string, left, right Object) Object {
+	if left.Type() == FLOAT_OBJ || right.Type() == FLOAT_OBJ {
+		return evalFloatInfixExpression(operator, fractionToFloat(left), fractionToFloat(right))
+	}
+
+	leftVal := toRat(left)
+	rightVal := toRat(right)
+
+	switch operator {
+	case "+":
+		return &Fraction{Value: new(big.Rat).Add(leftVal, rightVal)}
+	case "-":
+		return &Fraction{Value: new(big.Rat).Sub(leftVal, rightVal)}
+	case "*":
+		return &Fraction{Value: new(big.Rat).Mul(leftVal, rightVal)}
+	case "/":
+		if rightVal.Sign() == 0 {
+			return newCodedError(E_DIV_ZERO, "division by zero")
+		}
+		return &Fraction{Value: new(big.Rat).Quo(leftVal, rightVal)}
+	case "==":
+		return nativeBoolToPyMonkeyBool(leftVal.Cmp(rightVal) == 0)
+	case "!=":
+		return nativeBoolToPyMonkeyBool(leftVal.Cmp(rightVal) != 0)
+	default:
+		return newCodedError(E_UNKNOWN_OPERATOR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// fractionToFloat converts a fraction to the nearest float, leaving other
+// values alone
+func fractionToFloat(obj Object) Object {
+	if f, ok := obj.(*Fraction); ok {
+		value, _ := f.Value.Float64()
+		return &Float{Value: value}
+	}
+	return obj
+}
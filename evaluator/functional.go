@@ -0,0 +1,207 @@
+package evaluator
+
+import (
+	"fmt"
+	"gokid/diagnostics"
+	"sort"
+	"strings"
+)
+
+func init() {
+	registerBuiltin(&Builtin{
+		Name:   "memoize",
+		Params: []Param{{Name: "fn", Types: callableTypes}},
+		Doc:    "Returns a function that calls fn, caching its results by argument.",
+		Fn:     memoize,
+	})
+	registerBuiltin(&Builtin{
+		Name:   "apply",
+		Params: []Param{{Name: "fn", Types: callableTypes}, {Name: "args", Types: []ObjectType{ARRAY_OBJ}}},
+		Doc:    "Calls fn with the elements of args as its arguments.",
+		Fn: func(args ...Object) Object {
+			return applyFunction(args[0], args[1].(*Array).Elements)
+		},
+	})
+	registerBuiltin(&Builtin{
+		Name: "call",
+		Params: []Param{
+			{Name: "fn", Types: callableTypes},
+			{Name: "this"},
+			{Name: "args", Variadic: true},
+		},
+		Doc: "Calls fn with args, binding `this` to the given receiver inside GoKid functions.",
+		Fn: func(args ...Object) Object {
+			return applyMethod(args[0], args[1], args[2:])
+		},
+	})
+	registerBuiltin(&Builtin{
+		Name: "dispatch",
+		Params: []Param{
+			{Name: "table", Types: []ObjectType{HASH_OBJ}},
+			{Name: "key"},
+			{Name: "args", Variadic: true},
+		},
+		Doc: "Calls the function table holds under key with args, binding `this` to table, for command tables.",
+		Fn:  dispatch,
+	})
+	registerBuiltin(&Builtin{
+		Name:   "partial",
+		Params: []Param{{Name: "fn", Types: callableTypes}, {Name: "args", Variadic: true}},
+		Doc:    "Returns a function that calls fn with args followed by its own arguments.",
+		Fn: func(args ...Object) Object {
+			return closure(append([]Object{}, args...), func(captured []Object) BuiltinFunction {
+				fn, bound := captured[0], captured[1:]
+				return func(args ...Object) Object {
+					return applyFunction(fn, append(append([]Object{}, bound...), args...))
+				}
+			})
+		},
+	})
+	registerBuiltin(&Builtin{
+		Name:   "attempt",
+		Params: []Param{{Name: "fn", Types: callableTypes}, {Name: "args", Variadic: true}},
+		Doc:    "Calls fn with args and returns [result, null], or [null, error] with what a catch block would receive if it fails.",
+		Fn: func(args ...Object) Object {
+			result := applyFunction(args[0], args[1:])
+			if err, ok := result.(*Error); ok {
+				if !err.catchable() {
+					return err
+				}
+				return &Array{Elements: []Object{NULL, caughtValue(err)}}
+			}
+			return &Array{Elements: []Object{result, NULL}}
+		},
+	})
+	registerBuiltin(&Builtin{
+		Name:   "compose",
+		Params: []Param{{Name: "fn", Types: callableTypes}, {Name: "fns", Types: callableTypes, Variadic: true}},
+		Doc:    "Returns a function that applies the given functions from right to left, so compose(f, g)(x) is f(g(x)).",
+		Fn: func(args ...Object) Object {
+			return closure(append([]Object{}, args...), func(fns []Object) BuiltinFunction {
+				return func(args ...Object) Object {
+					result := applyFunction(fns[len(fns)-1], args)
+					for i := len(fns) - 2; i >= 0 && !isError(result); i-- {
+						result = applyFunction(fns[i], []Object{result})
+					}
+					return result
+				}
+			})
+		},
+	})
+	registerBuiltin(&Builtin{
+		Name:   "pipe",
+		Params: []Param{{Name: "value"}, {Name: "fns", Types: callableTypes, Variadic: true}},
+		Doc:    "Passes value through the given functions from left to right, so pipe(x, f, g) is g(f(x)).",
+		Fn: func(args ...Object) Object {
+			result := args[0]
+			for _, fn := range args[1:] {
+				result = applyFunction(fn, []Object{result})
+				if isError(result) {
+					break
+				}
+			}
+			return result
+		},
+	})
+}
+
+// applyMethod calls fn with this bound to a receiver. Builtins have no
+// `this` and are called with args alone.
+func applyMethod(fn Object, this Object, args []Object) Object {
+	function, ok := fn.(*Function)
+	if !ok {
+		return applyFunction(fn, args)
+	}
+
+	if err := function.Env.session.tick(); err != nil {
+		return err
+	}
+	function, err := function.choose(args)
+	if err != nil {
+		return err
+	}
+	env, err := extendFunctionEnv(function, args)
+	if err != nil {
+		return err
+	}
+	env.Set("this", this)
+	result := Eval(function.Body, env)
+	env.release()
+	addFrame(result, function)
+	return unwrapReturnValue(result)
+}
+
+// dispatch calls the handler a table holds under a key, as in
+// dispatch(commands, "add", 1, 2). A key with no handler is an error that
+// names the closest one when it looks like a typo.
+func dispatch(args ...Object) Object {
+	table := args[0].(*Hash)
+	key, err := hashKeyOf(args[1])
+	if err != nil {
+		return err
+	}
+
+	pair, ok := table.Pairs[key]
+	if !ok {
+		// A one-character key, such as an operator, is as close to every
+		// other one-character key as to the one meant
+		if name, ok := args[1].(*String); ok && len(name.Value) > 1 {
+			var names []string
+			for _, pair := range table.Pairs {
+				if s, ok := pair.Key.(*String); ok {
+					names = append(names, s.Value)
+				}
+			}
+			sort.Strings(names)
+			if suggestion := diagnostics.Suggest(name.Value, names); suggestion != "" {
+				return newCodedError(E_UNKNOWN_MEMBER, "no handler for %s; did you mean '%s'?", name.Value, suggestion)
+			}
+		}
+		return newCodedError(E_UNKNOWN_MEMBER, "no handler for %s", args[1].Inspect())
+	}
+	if !isCallable(pair.Value) {
+		return newCodedError(E_NOT_CALLABLE, "handler for %s is not a function: %s", args[1].Inspect(), pair.Value.Type())
+	}
+	return applyMethod(pair.Value, table, args[2:])
+}
+
+// memoize wraps fn with a cache keyed on the types and hash keys of its
+// arguments. Calls with unhashable arguments are passed through uncached.
+// The cache is a hash of those keys, so a copy of the interpreter gets a
+// copy of it.
+func memoize(args ...Object) Object {
+	return closure([]Object{args[0], &Hash{Pairs: map[HashKey]HashPair{}}}, func(captured []Object) BuiltinFunction {
+		fn, cache := captured[0], captured[1].(*Hash)
+		return func(args ...Object) Object {
+			key, ok := argumentsKey(args)
+			if !ok {
+				return applyFunction(fn, args)
+			}
+
+			name := &String{Value: key}
+			if cached, ok := cache.Pairs[name.HashKey()]; ok {
+				return cached.Value
+			}
+
+			result := applyFunction(fn, args)
+			if !isError(result) {
+				cache.Pairs[name.HashKey()] = HashPair{Key: name, Value: result}
+			}
+			return result
+		}
+	})
+}
+
+func argumentsKey(args []Object) (string, bool) {
+	var out strings.Builder
+	for _, arg := range args {
+		hashable, ok := arg.(Hashable)
+		if !ok {
+			return "", false
+		}
+		// 1 and 1.0 share a hash key but may give different results
+		hashKey := hashable.HashKey()
+		fmt.Fprintf(&out, "%s:%s:%d|", arg.Type(), hashKey.Type, hashKey.Value)
+	}
+	return out.String(), true
+}
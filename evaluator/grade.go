@@ -0,0 +1,233 @@
+package evaluator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"gokid/parser"
+	"io"
+	"runtime"
+	"runtime/metrics"
+	"strings"
+	"time"
+)
+
+// GradeOptions are the limits a graded solution runs under. A zero field
+// means no limit.
+type GradeOptions struct {
+	Path    string        // the solution's file, for its imports
+	Timeout time.Duration // for the solution's own statements, and for each test
+	Memory  uint64        // bytes the heap may grow by while the solution or a test runs
+	Output  int64         // bytes the solution may print in all
+}
+
+// GradeReport is how a solution did against a spec
+type GradeReport struct {
+	Score    float64      `json:"score"`
+	MaxScore float64      `json:"maxScore"`
+	Passed   int          `json:"passed"`
+	Failed   int          `json:"failed"`
+	Tests    []TestResult `json:"tests"`
+	Error    string       `json:"error,omitempty"` // why the solution or the spec stopped outside a test
+}
+
+// TestResult is the outcome of one test of a spec
+type TestResult struct {
+	Name     string  `json:"name"`
+	Points   float64 `json:"points"`
+	Earned   float64 `json:"earned"`
+	Passed   bool    `json:"passed"`
+	Message  string  `json:"message,omitempty"` // why it failed
+	Duration float64 `json:"ms"`
+}
+
+// grader runs a solution and the tests of a spec, stopping either when it
+// goes over a limit
+type grader struct {
+	options  GradeOptions
+	env      *Environment
+	cancel   context.CancelFunc // ends the running part's context
+	output   bytes.Buffer       // what the solution printed that the spec hasn't read
+	running  bool               // whether the solution or a test is running, under the limits
+	deadline time.Time
+	heap     uint64 // heap size when the running part started
+	stopped  string // why the running part was stopped
+	report   GradeReport
+}
+
+// Grade runs solution, then spec in a scope inside the solution's so it
+// sees the solution's variables, and scores the tests spec declares. A
+// spec declares a test with test(name, fn, points?), which passes when fn
+// returns without an error, and checks values with expect(actual,
+// expected, message?). output() returns the lines the solution printed
+// since the last call. The solution runs under the limits of options; a
+// test that goes over one fails. It can't use eval, the http, rpc and os
+// modules, or imports other than standard modules, and input reads no
+// input. The limits and these removals are all Grade does to contain the
+// solution, which can still use the CPU and memory it is allowed: it is
+// not a sandbox, and untrusted solutions should be graded in one.
+func Grade(solution, spec string, options GradeOptions) *GradeReport {
+	g := &grader{options: options, report: GradeReport{Tests: []TestResult{}}}
+	env := NewEnvironment()
+	g.env = env
+	env.SetPath(options.Path)
+	env.DisableEval()
+	env.DisableImports()
+	for _, name := range []string{"http", "rpc", "os"} {
+		env.RemoveBuiltin(name)
+	}
+	env.SetInput(strings.NewReader(""))
+	env.SetLimits(Limits{WriteBytes: options.Output})
+	env.SetOutput(&g.output, io.Discard)
+	env.SetStepHook(100, func(int, parser.Statement, *Environment) bool { return g.within() })
+	// A loop with an empty body runs no statements for the hook to stop
+	env.SetLoopGuard(0, options.Timeout)
+
+	g.start()
+	_, err := Run(env, solution)
+	g.stop()
+	if err != nil {
+		g.report.Error = "solution: " + g.reason(err)
+	}
+
+	specEnv := NewEnclosedEnvironment(env)
+	specEnv.Set("test", &Builtin{
+		Name:   "test",
+		Params: []Param{{Name: "name", Types: []ObjectType{STRING_OBJ}}, {Name: "fn", Types: callableTypes}, {Name: "points", Types: []ObjectType{INTEGER_OBJ, FLOAT_OBJ}, Optional: true}},
+		Fn:     g.test,
+	})
+	specEnv.Set("expect", &Builtin{
+		Name:   "expect",
+		Params: []Param{{Name: "actual"}, {Name: "expected"}, {Name: "message", Types: []ObjectType{STRING_OBJ}, Optional: true}},
+		Fn:     expect,
+	})
+	specEnv.Set("output", &Builtin{
+		Name: "output",
+		Fn: func(args ...Object) Object {
+			env.Flush()
+			out := strings.TrimSuffix(g.output.String(), "\n")
+			g.output.Reset()
+			lines := []Object{}
+			if out != "" {
+				for _, line := range strings.Split(out, "\n") {
+					lines = append(lines, &String{Value: line})
+				}
+			}
+			return &Array{Elements: lines}
+		},
+	})
+	if _, err := Run(specEnv, spec); err != nil && g.report.Error == "" {
+		g.report.Error = "spec: " + g.reason(err)
+	}
+	return &g.report
+}
+
+// test runs one test of the spec and records how it did
+func (g *grader) test(args ...Object) Object {
+	result := TestResult{Name: args[0].(*String).Value, Points: 1}
+	if len(args) > 2 {
+		result.Points = realToFloat(args[2])
+	}
+
+	started := time.Now()
+	g.start()
+	value := applyFunction(args[1], nil)
+	g.stop()
+	result.Duration = float64(time.Since(started).Microseconds()) / 1000
+
+	if err, ok := value.(*Error); ok {
+		result.Message = g.reason(err)
+		g.report.Failed++
+	} else {
+		result.Passed, result.Earned = true, result.Points
+		g.report.Passed++
+		g.report.Score += result.Points
+	}
+	g.report.MaxScore += result.Points
+	g.report.Tests = append(g.report.Tests, result)
+	return NULL
+}
+
+// expect fails unless actual equals expected. Arrays and objects are
+// equal when they hold equal values.
+func expect(args ...Object) Object {
+	actual, expected := args[0], args[1]
+	if evalInfixExpression("==", actual, expected) == TRUE ||
+		actual.Type() == expected.Type() && actual.Inspect() == expected.Inspect() {
+		return NULL
+	}
+	message := fmt.Sprintf("expected %s, got %s", expected.Inspect(), actual.Inspect())
+	if len(args) > 2 {
+		message = args[2].(*String).Value + ": " + message
+	}
+	return newError("%s", message)
+}
+
+// start begins timing and measuring a part of the run. Its deadline is
+// also the interpreter's context, so builtins that block, such as input
+// and http.get, return when it passes.
+func (g *grader) start() {
+	g.running, g.stopped = true, ""
+	if g.options.Timeout > 0 {
+		g.deadline = time.Now().Add(g.options.Timeout)
+		ctx, cancel := context.WithDeadlineCause(context.Background(), g.deadline,
+			fmt.Errorf("took longer than %s", g.options.Timeout))
+		g.env.SetContext(ctx)
+		g.cancel = cancel
+	}
+	if g.options.Memory > 0 {
+		g.heap = heapSize()
+	}
+}
+
+// stop ends a part of the run
+func (g *grader) stop() {
+	g.running = false
+	if g.cancel != nil {
+		g.env.SetContext(nil)
+		g.cancel()
+		g.cancel = nil
+	}
+}
+
+// within reports whether the running part is within its limits, noting
+// why it isn't when it isn't
+func (g *grader) within() bool {
+	if !g.running {
+		return true
+	}
+	if g.options.Timeout > 0 && time.Now().After(g.deadline) {
+		g.stopped = fmt.Sprintf("took longer than %s", g.options.Timeout)
+		return false
+	}
+	if g.options.Memory > 0 && heapSize() > g.heap+g.options.Memory {
+		// Garbage counts until it is collected
+		runtime.GC()
+		if heapSize() > g.heap+g.options.Memory {
+			g.stopped = fmt.Sprintf("used more than %d bytes of memory", g.options.Memory)
+			return false
+		}
+	}
+	return true
+}
+
+// reason says why a part of the run failed with err
+func (g *grader) reason(err error) string {
+	if g.stopped != "" {
+		return g.stopped
+	}
+	if e, ok := err.(*Error); ok && e.Code == E_QUOTA {
+		return fmt.Sprintf("printed more than %d bytes", g.options.Output)
+	}
+	if e, ok := err.(*Error); ok && (e.Code == E_LIMIT || e.Code == E_STOPPED) {
+		return fmt.Sprintf("took longer than %s", g.options.Timeout)
+	}
+	return strings.TrimSpace(err.Error())
+}
+
+// heapSize returns the bytes of heap objects, live or not yet collected
+func heapSize() uint64 {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	metrics.Read(sample)
+	return sample[0].Value.Uint64()
+}
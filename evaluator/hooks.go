@@ -0,0 +1,77 @@
+package evaluator
+
+import "gokid/parser"
+
+// Hooks are called as a program runs, so a host such as a debugger,
+// tracer, profiler or grader can watch it without changing the evaluator.
+// A nil hook is not called. Hooks run on the goroutine running the
+// program; forks and HTTP workers share them, so hooks given to a program
+// that uses those must be safe for concurrent use.
+type Hooks struct {
+	// OnStatement is called before each statement, with where it starts
+	OnStatement func(pos Position)
+
+	// OnCall is called before each call the program makes, with the name
+	// of the function or builtin called, such as "area" or "math.abs", or
+	// "" for an anonymous function. Functions that builtins such as map
+	// call back are not reported.
+	OnCall func(name string)
+
+	// OnError is called once for each runtime error, where it is raised,
+	// even one a try catches. os.exit is not reported.
+	OnError func(err *Error)
+
+	// OnPrint is called with each piece of text the program writes to its
+	// standard output
+	OnPrint func(text string)
+}
+
+// Position is where a statement is in a program's source
+type Position struct {
+	Path   string // file, "" when unknown
+	Line   int    // line, 0 when unknown
+	Offset int    // byte offset into the file
+}
+
+// SetHooks replaces the interpreter's hooks. Passing Hooks{} removes them.
+func (e *Environment) SetHooks(hooks Hooks) {
+	e.session.hooks = hooks
+}
+
+// statementHook reports stmt to the OnStatement hook
+func (e *Environment) statementHook(stmt parser.Statement) {
+	e.session.hooks.OnStatement(e.statementPosition(stmt))
+}
+
+// statementPosition returns where stmt, run in e, starts
+func (e *Environment) statementPosition(stmt parser.Statement) Position {
+	offset := stmt.Range().Start
+	path, line := e.position(offset)
+	if path == "" {
+		path = e.root().path
+	}
+	return Position{Path: path, Line: line, Offset: offset}
+}
+
+// callHook reports a call of fn to the OnCall hook
+func (e *Environment) callHook(call *parser.CallExpression, fn Object) {
+	name, _ := callee(call)
+	switch fn := fn.(type) {
+	case *Function:
+		if fn.Name != "" {
+			name = fn.Name
+		}
+	case *Builtin:
+		if fn.Name != "" {
+			name = fn.Name
+		}
+	}
+	e.session.hooks.OnCall(name)
+}
+
+// errorHook reports err, which has just been located, to the OnError hook
+func errorHook(err *Error, env *Environment) {
+	if onError := env.session.hooks.OnError; onError != nil && err.Code != E_EXIT {
+		onError(err)
+	}
+}
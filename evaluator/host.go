@@ -0,0 +1,46 @@
+package evaluator
+
+import "sync"
+
+// callbackMu serializes GoKid callbacks invoked from network goroutines,
+// since the evaluator itself is single-threaded
+var callbackMu sync.Mutex
+
+func callFromHost(fn Object, args ...Object) Object {
+	callbackMu.Lock()
+	defer callbackMu.Unlock()
+	return applyFunction(fn, args)
+}
+
+// hostTasks carries work from other goroutines, such as remote REPL
+// sessions, that must run while the interpreter is at a safe point:
+// between statements, or while idle in a blocking builtin
+var hostTasks = make(chan func())
+
+// RunOnInterpreter queues fn to run on the interpreter and waits for it
+func RunOnInterpreter(fn func()) {
+	done := make(chan struct{})
+	hostTasks <- func() {
+		defer close(done)
+		fn()
+	}
+	<-done
+}
+
+// RunHostTasks runs any queued host tasks without blocking
+func RunHostTasks() {
+	for {
+		select {
+		case task := <-hostTasks:
+			task()
+		default:
+			return
+		}
+	}
+}
+
+// HostTasks exposes the task queue to hosts that idle outside the
+// evaluator, such as the REPL waiting for input
+func HostTasks() <-chan func() {
+	return hostTasks
+}
@@ -0,0 +1,598 @@
+package evaluator
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const SERVER_OBJ = "SERVER"
+
+// httpMaxBody is the largest request body a server reads and response
+// body a client reads, the same as the largest WebSocket message
+const httpMaxBody = wsMaxMessage
+
+func init() {
+	registerModule("http", map[string]Object{
+		"get": &Builtin{
+			Params: []Param{
+				{Name: "url", Types: []ObjectType{STRING_OBJ}},
+				{Name: "options", Types: []ObjectType{HASH_OBJ}, Optional: true},
+			},
+			Doc:        "Sends a GET request and returns the response as a hash of status, headers and body.",
+			capability: capHTTP,
+			sessionFn: func(s *session, args ...Object) Object {
+				opts := defaultRequestOptions()
+				if len(args) == 2 {
+					if err := opts.parse(args[1]); err != nil {
+						return err
+					}
+				}
+				return doRequest(s.context(), "GET", args[0].(*String).Value, "", opts)
+			},
+		},
+		"post": &Builtin{
+			Params: []Param{
+				{Name: "url", Types: []ObjectType{STRING_OBJ}},
+				{Name: "body"},
+				{Name: "options", Types: []ObjectType{STRING_OBJ, HASH_OBJ}, Optional: true},
+			},
+			Doc:        "Sends a POST request with body; options is a content type or an options hash.",
+			capability: capHTTP,
+			sessionFn: func(s *session, args ...Object) Object {
+				opts := defaultRequestOptions()
+				opts.headers["Content-Type"] = "text/plain"
+				if len(args) == 3 {
+					// The third argument is a content type or an options hash
+					if ct, ok := args[2].(*String); ok {
+						opts.headers["Content-Type"] = ct.Value
+					} else if err := opts.parse(args[2]); err != nil {
+						return err
+					}
+				}
+				return doRequest(s.context(), "POST", args[0].(*String).Value, args[1].Inspect(), opts)
+			},
+		},
+		"request": &Builtin{
+			Params:     []Param{{Name: "options", Types: []ObjectType{HASH_OBJ}}},
+			Doc:        "Sends a request described by an options hash, which must include a url.",
+			capability: capHTTP,
+			sessionFn: func(s *session, args ...Object) Object {
+				opts := defaultRequestOptions()
+				if err := opts.parse(args[0]); err != nil {
+					return err
+				}
+				if opts.url == "" {
+					return newCodedError(E_VALUE, "request options must include a url")
+				}
+				return doRequest(s.context(), opts.method, opts.url, opts.body, opts)
+			},
+		},
+		"server": &Builtin{
+			Doc: "Creates a server to register route handlers on before listening.",
+			sessionFn: func(s *session, args ...Object) Object {
+				return newServer(s)
+			},
+		},
+		"serve": &Builtin{
+			Params: []Param{
+				{Name: "address", Types: []ObjectType{STRING_OBJ}},
+				{Name: "handler", Types: callableTypes},
+			},
+			Doc: "Serves every request at address with handler until the program exits.",
+			sessionFn: func(s *session, args ...Object) Object {
+				server := newServer(s)
+				if err := server.Handle("/", args[1]); err != nil {
+					return err
+				}
+				return server.Listen(args[0].(*String).Value, "", "")
+			},
+		},
+		"serveTLS": &Builtin{
+			Params: []Param{
+				{Name: "address", Types: []ObjectType{STRING_OBJ}},
+				{Name: "cert", Types: []ObjectType{STRING_OBJ}},
+				{Name: "key", Types: []ObjectType{STRING_OBJ}},
+				{Name: "handler", Types: callableTypes},
+			},
+			Doc: "Serves every request over HTTPS at address with handler, using the cert and key files.",
+			sessionFn: func(s *session, args ...Object) Object {
+				server := newServer(s)
+				if err := server.Handle("/", args[3]); err != nil {
+					return err
+				}
+				return server.Listen(args[0].Inspect(), args[1].Inspect(), args[2].Inspect())
+			},
+		},
+		"websocket": &Builtin{
+			Params:     []Param{{Name: "url", Types: []ObjectType{STRING_OBJ}}},
+			Doc:        "Opens a WebSocket connection to url.",
+			capability: capHTTP,
+			sessionFn: func(s *session, args ...Object) Object {
+				return dialWebSocket(s.context, args[0].(*String).Value)
+			},
+		},
+	})
+}
+
+// requestOptions control a single client request
+type requestOptions struct {
+	method       string
+	url          string
+	body         string
+	headers      map[string]string
+	timeout      time.Duration
+	maxRedirects int
+	insecure     bool // skip TLS certificate verification
+	caFile       string
+}
+
+func defaultRequestOptions() *requestOptions {
+	return &requestOptions{
+		method:       "GET",
+		headers:      make(map[string]string),
+		timeout:      30 * time.Second,
+		maxRedirects: 10,
+	}
+}
+
+// parse reads an options hash such as
+// {method, url, body, headers, timeout, maxRedirects, insecure, caFile}
+func (o *requestOptions) parse(obj Object) *Error {
+	hash, ok := obj.(*Hash)
+	if !ok {
+		return newCodedError(E_TYPE_MISMATCH, "request options must be HASH, got %s", obj.Type())
+	}
+
+	for _, pair := range sortedPairs(hash) {
+		name := pair.Key.Inspect()
+		value := pair.Value
+		switch name {
+		case "method", "url", "body", "caFile":
+			if name != "body" && value.Type() != STRING_OBJ {
+				return newCodedError(E_TYPE_MISMATCH, "request option %s must be STRING, got %s", name, value.Type())
+			}
+			switch name {
+			case "method":
+				o.method = strings.ToUpper(value.Inspect())
+			case "url":
+				o.url = value.Inspect()
+			case "body":
+				o.body = value.Inspect()
+			case "caFile":
+				o.caFile = value.Inspect()
+			}
+		case "headers":
+			headers, ok := value.(*Hash)
+			if !ok {
+				return newCodedError(E_TYPE_MISMATCH, "request option headers must be HASH, got %s", value.Type())
+			}
+			for _, header := range headers.Pairs {
+				o.headers[header.Key.Inspect()] = header.Value.Inspect()
+			}
+		case "timeout":
+			if !isNumber(value) {
+				return newCodedError(E_VALUE, "request option timeout must be a number of seconds, got %s", value.Type())
+			}
+			o.timeout = time.Duration(toFloat(value) * float64(time.Second))
+		case "maxRedirects":
+			n, ok := value.(*Integer)
+			if !ok {
+				return newCodedError(E_TYPE_MISMATCH, "request option maxRedirects must be INTEGER, got %s", value.Type())
+			}
+			o.maxRedirects = int(n.Value)
+		case "insecure":
+			o.insecure = isTruthy(value)
+		default:
+			return newCodedError(E_VALUE, "unknown request option: %s", name)
+		}
+	}
+
+	return nil
+}
+
+func (o *requestOptions) client() (*http.Client, *Error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: o.insecure}
+	if o.caFile != "" {
+		pem, err := os.ReadFile(o.caFile)
+		if err != nil {
+			return nil, newCodedError(E_IO, "http: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, newCodedError(E_IO, "http: no certificates found in %s", o.caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	maxRedirects := o.maxRedirects
+	return &http.Client{
+		Timeout:   o.timeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}, nil
+}
+
+// doRequest sends a request, giving up with ctx's E_STOPPED error once
+// ctx is done
+func doRequest(ctx context.Context, method, url, body string, opts *requestOptions) Object {
+	req, err := http.NewRequestWithContext(ctx, method, url, strings.NewReader(body))
+	if err != nil {
+		return newCodedError(E_IO, "http: %s", err)
+	}
+	for name, value := range opts.headers {
+		req.Header.Set(name, value)
+	}
+
+	client, clientErr := opts.client()
+	if clientErr != nil {
+		return clientErr
+	}
+
+	resp, err := client.Do(req)
+	if err != nil && ctx.Err() != nil {
+		return stoppedError(ctx)
+	}
+	if err != nil {
+		return newCodedError(E_IO, "http: %s", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, httpMaxBody+1))
+	if err != nil && ctx.Err() != nil {
+		return stoppedError(ctx)
+	}
+	if err != nil {
+		return newCodedError(E_IO, "http: %s", err)
+	}
+	if len(data) > httpMaxBody {
+		return newCodedError(E_IO, "http: response body is larger than %d bytes", httpMaxBody)
+	}
+
+	return newHash(map[string]Object{
+		"status":  &Integer{Value: int64(resp.StatusCode)},
+		"headers": headersToHash(resp.Header),
+		"body":    &String{Value: string(data)},
+	})
+}
+
+func headersToHash(header http.Header) *Hash {
+	headers := make(map[string]Object)
+	for name := range header {
+		headers[strings.ToLower(name)] = &String{Value: header.Get(name)}
+	}
+	return newHash(headers)
+}
+
+// Server object routes HTTP requests and WebSocket connections to GoKid
+// functions
+type Server struct {
+	mux    *http.ServeMux
+	server *http.Server
+
+	// workers, set by server.workers(n), is how many copies of the
+	// interpreter handle requests at once. With none, requests are
+	// handled one at a time by the interpreter itself.
+	workers  int
+	handlers []Object
+	pool     chan *worker
+
+	// sockets are the WebSocket connections the server has open, for
+	// os.shutdown to close; drained is closed once it has stopped the server
+	mu       sync.Mutex
+	sockets  map[*WebSocket]bool
+	draining bool
+	drained  chan struct{}
+
+	// ctx returns the context of the interpreter that made the server;
+	// Listen returns once it is done
+	ctx func() context.Context
+}
+
+// worker is a copy of the interpreter that handles one request at a time,
+// with the server's handlers re-bound to it
+type worker struct {
+	handlers map[Object]Object
+}
+
+// NewServer creates a server with no routes
+func NewServer() *Server {
+	return &Server{mux: http.NewServeMux(), ctx: context.Background}
+}
+
+// newServer creates a server that stops listening once the context of
+// the interpreter s is done
+func newServer(s *session) *Server {
+	server := NewServer()
+	server.ctx = s.context
+	return server
+}
+
+func (s *Server) Type() ObjectType { return SERVER_OBJ }
+func (s *Server) Inspect() string {
+	if s.server != nil {
+		return "server(" + s.server.Addr + ")"
+	}
+	return "server"
+}
+
+// Handle routes requests matching pattern to handler. The handler receives
+// a request hash and returns a string body or a hash with status, headers
+// and body.
+func (s *Server) Handle(pattern string, handler Object) *Error {
+	if !isCallable(handler) {
+		return newCodedError(E_TYPE_MISMATCH, "handler must be FUNCTION, got %s", handler.Type())
+	}
+
+	s.handlers = append(s.handlers, handler)
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		request, err := requestToHash(w, r)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+		writeResponse(w, s.call(handler, request))
+	})
+	return nil
+}
+
+// call runs handler for a request on a free worker, or on the interpreter
+// itself when the server has no workers
+func (s *Server) call(handler Object, request *Hash) Object {
+	if s.pool == nil {
+		return callFromHost(handler, request)
+	}
+	w := <-s.pool
+	defer func() { s.pool <- w }()
+	return applyFunction(w.handlers[handler], []Object{request})
+}
+
+// startWorkers copies the interpreter once per worker. Copies are made
+// when the server starts, so each sees the variables as they are then and
+// changes made by one request are not seen by others. Workers share the
+// interpreter's output, which is written through a lock.
+func (s *Server) startWorkers() {
+	s.pool = nil
+	if s.workers == 0 {
+		return
+	}
+	var mu sync.Mutex
+	pool := make(chan *worker, s.workers)
+	for range s.workers {
+		f := newForker(true)
+		w := &worker{handlers: make(map[Object]Object, len(s.handlers))}
+		for _, handler := range s.handlers {
+			w.handlers[handler] = f.value(handler)
+		}
+		for original, copied := range f.sessions {
+			original.flush()
+			copied.stdout = &lockedWriter{mu: &mu, w: original.rawOut()}
+			copied.stderr = &lockedWriter{mu: &mu, w: original.errOut()}
+		}
+		pool <- w
+	}
+	s.pool = pool
+}
+
+// lockedWriter serializes writes from several goroutines
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// Listen serves until the server is closed, running signal handlers and
+// host tasks as they arrive. When certFile and keyFile are given it serves HTTPS.
+// After os.shutdown it returns the exit it asked for, once the requests in
+// progress have finished, and once the interpreter's context is done it
+// closes the server and returns its E_STOPPED error.
+func (s *Server) Listen(addr, certFile, keyFile string) Object {
+	ctx := s.ctx()
+	s.startWorkers()
+	s.server = &http.Server{Addr: addr, Handler: s.mux, ErrorLog: log.New(io.Discard, "", 0)}
+	s.drained = make(chan struct{})
+	s.started()
+	defer s.stopped()
+
+	done := make(chan error, 1)
+	go func() {
+		if certFile != "" || keyFile != "" {
+			done <- s.server.ListenAndServeTLS(certFile, keyFile)
+			return
+		}
+		done <- s.server.ListenAndServe()
+	}()
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return newCodedError(E_IO, "http: %s", err)
+			}
+			if stoppingExit() == nil {
+				return NULL
+			}
+			// Keep running host tasks while the requests finish
+			done = nil
+		case <-s.drained:
+			return stoppingExit()
+		case <-ctx.Done():
+			s.server.Close()
+			return stoppedError(ctx)
+		case sig := <-pendingSignals:
+			callbackMu.Lock()
+			err := runSignalHandler(sig)
+			callbackMu.Unlock()
+			if err != nil {
+				s.server.Close()
+				return err
+			}
+		case task := <-hostTasks:
+			callbackMu.Lock()
+			task()
+			callbackMu.Unlock()
+		}
+	}
+}
+
+func (s *Server) Member(name string) (Object, bool) {
+	switch name {
+	case "handle", "websocket":
+		return method(func(args ...Object) Object {
+			if err := checkArity(name, args, 2); err != nil {
+				return err
+			}
+			pattern, ok := args[0].(*String)
+			if !ok {
+				return newCodedError(E_TYPE_MISMATCH, "route pattern must be STRING, got %s", args[0].Type())
+			}
+			var err *Error
+			if name == "handle" {
+				err = s.Handle(pattern.Value, args[1])
+			} else {
+				err = s.HandleWebSocket(pattern.Value, args[1])
+			}
+			if err != nil {
+				return err
+			}
+			return s
+		}), true
+	case "workers":
+		return method(func(args ...Object) Object {
+			if err := checkArity("workers", args, 1); err != nil {
+				return err
+			}
+			n, ok := args[0].(*Integer)
+			if !ok || n.Value < 0 {
+				return newCodedError(E_VALUE, "workers must be a non-negative INTEGER, got %s", args[0].Inspect())
+			}
+			s.workers = int(n.Value)
+			return s
+		}), true
+	case "listen":
+		return method(func(args ...Object) Object {
+			if err := checkArity("listen", args, 1); err != nil {
+				return err
+			}
+			addr, ok := args[0].(*String)
+			if !ok {
+				return newCodedError(E_TYPE_MISMATCH, "address must be STRING, got %s", args[0].Type())
+			}
+			return s.Listen(addr.Value, "", "")
+		}), true
+	case "listenTLS":
+		return method(func(args ...Object) Object {
+			if err := checkArity("listenTLS", args, 3); err != nil {
+				return err
+			}
+			for _, arg := range args {
+				if arg.Type() != STRING_OBJ {
+					return newCodedError(E_TYPE_MISMATCH, "address, cert and key must be STRING, got %s", arg.Type())
+				}
+			}
+			return s.Listen(args[0].Inspect(), args[1].Inspect(), args[2].Inspect())
+		}), true
+	case "close":
+		return method(func(args ...Object) Object {
+			if err := checkArity("close", args, 0); err != nil {
+				return err
+			}
+			if s.server != nil {
+				// Shut down from a new goroutine, since close is usually
+				// called from inside a handler that Shutdown would wait for
+				go s.server.Shutdown(context.Background())
+			}
+			return NULL
+		}), true
+	}
+	return nil, false
+}
+
+// requestToHash reads a request into the hash a handler receives. It
+// fails if the body is larger than httpMaxBody.
+func requestToHash(w http.ResponseWriter, r *http.Request) (*Hash, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, httpMaxBody))
+	if err != nil {
+		return nil, err
+	}
+
+	query := make(map[string]Object)
+	for name := range r.URL.Query() {
+		query[name] = &String{Value: r.URL.Query().Get(name)}
+	}
+
+	return newHash(map[string]Object{
+		"method":  &String{Value: r.Method},
+		"path":    &String{Value: r.URL.Path},
+		"query":   newHash(query),
+		"headers": headersToHash(r.Header),
+		"body":    &String{Value: string(body)},
+	}), nil
+}
+
+// writeResponse answers with what a handler returned. A handler that
+// fails, or returns a status outside 100-999, gets a 500 that doesn't
+// show the client what went wrong inside the server.
+func writeResponse(w http.ResponseWriter, result Object) {
+	switch result := result.(type) {
+	case *Error:
+		internalError(w)
+	case *Null:
+		w.WriteHeader(http.StatusNoContent)
+	case *Hash:
+		status := http.StatusOK
+		if value := hashGet(result, "status"); value != nil {
+			if code, ok := value.(*Integer); ok {
+				status = int(code.Value)
+			}
+		}
+		if status < 100 || status > 999 {
+			internalError(w)
+			return
+		}
+		if headers, ok := hashGet(result, "headers").(*Hash); ok {
+			for _, pair := range headers.Pairs {
+				w.Header().Set(pair.Key.Inspect(), pair.Value.Inspect())
+			}
+		}
+		w.WriteHeader(status)
+		if body := hashGet(result, "body"); body != nil && body != NULL {
+			fmt.Fprint(w, body.Inspect())
+		}
+	default:
+		fmt.Fprint(w, result.Inspect())
+	}
+}
+
+// internalError answers with a 500 and a generic body
+func internalError(w http.ResponseWriter) {
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+func isCallable(obj Object) bool {
+	switch obj.(type) {
+	case *Function, *Builtin:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,84 @@
+package evaluator
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+func init() {
+	registerBuiltin(&Builtin{
+		Name:   "input",
+		Params: []Param{{Name: "prompt", Types: []ObjectType{STRING_OBJ}, Optional: true}},
+		Doc:    "Prints prompt, if given, and returns the next line of standard input without its newline, or null at the end of the input.",
+		sessionFn: func(s *session, args ...Object) Object {
+			if len(args) > 0 {
+				out := s.out()
+				io.WriteString(out, args[0].(*String).Value)
+				if err := s.meter.refused.Swap(nil); err != nil {
+					return err
+				}
+			}
+			s.flush()
+			line, err := s.readLine()
+			if stopped, ok := err.(*Error); ok {
+				return stopped
+			}
+			if err != nil && line == "" {
+				return NULL
+			}
+			return &String{Value: strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")}
+		},
+	})
+}
+
+// SetInput makes input read from r instead of the process's standard
+// input. A nil reader restores the default.
+func (e *Environment) SetInput(r io.Reader) {
+	e.session.stdin, e.session.reading = nil, nil
+	if r != nil {
+		e.session.stdin = bufio.NewReader(r)
+	}
+}
+
+// in is the standard input input reads from
+func (s *session) in() *bufio.Reader {
+	if s.stdin == nil {
+		s.stdin = bufio.NewReader(os.Stdin)
+	}
+	return s.stdin
+}
+
+// lineRead is a line read from standard input, and why the read ended
+// there if it wasn't a newline
+type lineRead struct {
+	line string
+	err  error
+}
+
+// readLine reads the next line of standard input, returning the
+// interpreter's E_STOPPED error once the context given to SetContext is
+// done. A read stopped that way carries on, and the next call gets its
+// line.
+func (s *session) readLine() (string, error) {
+	ctx := s.context()
+	if ctx.Done() == nil && s.reading == nil {
+		return s.in().ReadString('\n')
+	}
+	if s.reading == nil {
+		reading, in := make(chan lineRead, 1), s.in()
+		go func() {
+			line, err := in.ReadString('\n')
+			reading <- lineRead{line, err}
+		}()
+		s.reading = reading
+	}
+	select {
+	case read := <-s.reading:
+		s.reading = nil
+		return read.line, read.err
+	case <-ctx.Done():
+		return "", stoppedError(ctx)
+	}
+}
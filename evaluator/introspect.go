@@ -0,0 +1,30 @@
+package evaluator
+
+func init() {
+	registerBuiltin(&Builtin{
+		Name: "globals",
+		Doc:  "Returns the top-level variables of the current file as a hash of names to values.",
+		EnvFn: func(env *Environment, args ...Object) Object {
+			return newHash(env.root().Bindings())
+		},
+	})
+	registerBuiltin(&Builtin{
+		Name: "locals",
+		Doc:  "Returns the variables of the innermost scope as a hash of names to values.",
+		EnvFn: func(env *Environment, args ...Object) Object {
+			return newHash(env.Bindings())
+		},
+	})
+	registerBuiltin(&Builtin{
+		Name:   "defined",
+		Params: []Param{{Name: "name", Types: []ObjectType{STRING_OBJ}}},
+		Doc:    "Reports whether name refers to a variable, builtin or module in the current scope.",
+		EnvFn: func(env *Environment, args ...Object) Object {
+			name := args[0].(*String).Value
+			if _, ok := env.Get(name); ok {
+				return TRUE
+			}
+			return nativeBoolToPyMonkeyBool(env.Defines(name))
+		},
+	})
+}
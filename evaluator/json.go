@@ -0,0 +1,144 @@
+package evaluator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// toJSONValue converts a GoKid value to plain Go data for encoding/json
+func toJSONValue(obj Object) (interface{}, error) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return obj.Value, nil
+	case *Float:
+		if math.IsInf(obj.Value, 0) || math.IsNaN(obj.Value) {
+			return nil, fmt.Errorf("cannot convert %s to JSON", obj.Inspect())
+		}
+		return obj.Value, nil
+	case *String:
+		return obj.Value, nil
+	case *Boolean:
+		return obj.Value, nil
+	case *Null:
+		return nil, nil
+	case *Array:
+		values := make([]interface{}, len(obj.Elements))
+		for i, el := range obj.Elements {
+			value, err := toJSONValue(el)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	case *Hash:
+		members := make(jsonObject, 0, len(obj.Pairs))
+		seen := make(map[string]bool, len(obj.Pairs))
+		for _, pair := range sortedPairs(obj) {
+			name := pair.Key.Inspect()
+			if seen[name] {
+				return nil, fmt.Errorf("cannot convert to JSON: two keys are both %q", name)
+			}
+			seen[name] = true
+			value, err := toJSONValue(pair.Value)
+			if err != nil {
+				return nil, err
+			}
+			members = append(members, jsonMember{name: name, value: value})
+		}
+		return members, nil
+	case *Record:
+		members := make(jsonObject, 0, len(obj.Values))
+		for i, field := range obj.Values {
+			value, err := toJSONValue(field)
+			if err != nil {
+				return nil, err
+			}
+			members = append(members, jsonMember{name: obj.Def.Fields[i], value: value})
+		}
+		return members, nil
+	default:
+		return nil, fmt.Errorf("cannot convert %s to JSON", obj.Type())
+	}
+}
+
+// jsonObject is an object encoded with its members in the order its keys
+// are shown in, where encoding/json would sort them as strings and put
+// "10" before "2"
+type jsonObject []jsonMember
+
+type jsonMember struct {
+	name  string
+	value interface{}
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, member := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		name, err := json.Marshal(member.name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(member.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// fromJSONValue converts data decoded with UseNumber back to GoKid values
+func fromJSONValue(value interface{}) Object {
+	switch value := value.(type) {
+	case nil:
+		return NULL
+	case bool:
+		return nativeBoolToPyMonkeyBool(value)
+	case json.Number:
+		if n, err := value.Int64(); err == nil && !strings.ContainsAny(value.String(), ".eE") {
+			return &Integer{Value: n}
+		}
+		f, _ := value.Float64()
+		return &Float{Value: f}
+	case float64:
+		return &Float{Value: value}
+	case string:
+		return &String{Value: value}
+	case []interface{}:
+		elements := make([]Object, len(value))
+		for i, el := range value {
+			elements[i] = fromJSONValue(el)
+		}
+		return &Array{Elements: elements}
+	case map[string]interface{}:
+		pairs := make(map[string]Object, len(value))
+		for name, el := range value {
+			pairs[name] = fromJSONValue(el)
+		}
+		return newHash(pairs)
+	default:
+		return NULL
+	}
+}
+
+// decodeJSON parses JSON text, keeping integers distinct from floats
+func decodeJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
@@ -0,0 +1,91 @@
+package evaluator
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultGrace is how long os.shutdown lets requests in progress finish
+// when it isn't given a time
+const DefaultGrace = 10 * time.Second
+
+// lifecycle holds the servers the process is listening with, so
+// os.shutdown can stop them all. Like signal handlers, it is process-wide:
+// a port belongs to the process, not to one interpreter.
+var lifecycle struct {
+	sync.Mutex
+	servers map[*Server]bool
+	// stopping is the exit os.shutdown asked for, which Listen returns
+	// once its server has drained
+	stopping *Error
+}
+
+// started records that s is listening
+func (s *Server) started() {
+	lifecycle.Lock()
+	defer lifecycle.Unlock()
+	if lifecycle.servers == nil {
+		lifecycle.servers = map[*Server]bool{}
+	}
+	lifecycle.servers[s] = true
+}
+
+// stopped records that s is no longer listening
+func (s *Server) stopped() {
+	lifecycle.Lock()
+	defer lifecycle.Unlock()
+	delete(lifecycle.servers, s)
+}
+
+// shutdown stops every server listening and ends the program with code.
+// Servers stop accepting connections at once, and requests in progress
+// have grace to finish before their connections are closed. Since a
+// request may be what called it, shutdown doesn't wait: each server's
+// Listen returns the exit once the server has drained, so the program
+// unwinds from there and its atexit hooks run. With no server listening
+// it exits straight away, as os.exit does.
+func shutdown(code int, grace time.Duration) Object {
+	exit := exitError(code)
+
+	lifecycle.Lock()
+	defer lifecycle.Unlock()
+	if len(lifecycle.servers) == 0 {
+		return exit
+	}
+	if lifecycle.stopping != nil {
+		return NULL // already shutting down
+	}
+	lifecycle.stopping = exit
+	for s := range lifecycle.servers {
+		go s.drain(grace)
+	}
+	return NULL
+}
+
+// stoppingExit returns the exit os.shutdown asked for, or nil before it has
+// been called
+func stoppingExit() *Error {
+	lifecycle.Lock()
+	defer lifecycle.Unlock()
+	return lifecycle.stopping
+}
+
+// drain stops s accepting connections and waits up to grace for the
+// requests in progress, then closes what is left, WebSockets included,
+// which the HTTP server stops tracking once they are upgraded
+func (s *Server) drain(grace time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	if err := s.server.Shutdown(ctx); err != nil {
+		s.server.Close()
+	}
+	s.mu.Lock()
+	sockets := s.sockets
+	s.sockets, s.draining = nil, true
+	s.mu.Unlock()
+	for ws := range sockets {
+		ws.Close()
+	}
+	close(s.drained)
+}
@@ -0,0 +1,121 @@
+package evaluator
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// Limits caps what the programs an interpreter runs may do outside it, for
+// hosts running code they don't trust. A zero field means no limit. A
+// builtin that would go over a limit fails with E_QUOTA instead.
+//
+// GoKid has no builtins that write files or start processes, so there is
+// nothing to limit there.
+type Limits struct {
+	ReadBytes    int64 // bytes of module files read by import
+	WriteBytes   int64 // bytes of output written by print and the other builtins that write
+	HTTPRequests int64 // outbound HTTP requests, RPC calls and WebSocket connections
+}
+
+// Usage is how much of each limit an interpreter's programs have used
+type Usage struct {
+	ReadBytes    int64
+	WriteBytes   int64
+	HTTPRequests int64
+}
+
+// capabilities a builtin may use, each with its own quota
+const (
+	capHTTP = "http"
+)
+
+// meter counts what an interpreter uses against its limits. Copies of an
+// interpreter running on other goroutines, such as HTTP workers, share the
+// original's meter.
+type meter struct {
+	limits   atomic.Pointer[Limits]
+	read     atomic.Int64
+	written  atomic.Int64
+	requests atomic.Int64
+
+	// refused holds the error for output a write quota turned away, for
+	// the builtin that wrote it to return
+	refused atomic.Pointer[Error]
+}
+
+// SetLimits sets the limits of the interpreter env belongs to. What was
+// used before counts toward them.
+func (e *Environment) SetLimits(limits Limits) {
+	e.session.meter.limits.Store(&limits)
+}
+
+// Usage returns what the interpreter env belongs to has used so far
+func (e *Environment) Usage() Usage {
+	m := e.session.meter
+	return Usage{ReadBytes: m.read.Load(), WriteBytes: m.written.Load(), HTTPRequests: m.requests.Load()}
+}
+
+// take counts n more of what counter measures, failing without counting
+// if that would go over limit
+func take(counter *atomic.Int64, n, limit int64, what string) *Error {
+	if limit <= 0 {
+		counter.Add(n)
+		return nil
+	}
+	for {
+		used := counter.Load()
+		if used+n > limit {
+			return newCodedError(E_QUOTA, "quota exceeded: %s limit is %d, %d used", what, limit, used)
+		}
+		if counter.CompareAndSwap(used, used+n) {
+			return nil
+		}
+	}
+}
+
+func (m *meter) currentLimits() Limits {
+	if l := m.limits.Load(); l != nil {
+		return *l
+	}
+	return Limits{}
+}
+
+// useRead counts n bytes of files read
+func (m *meter) useRead(n int) *Error {
+	return take(&m.read, int64(n), m.currentLimits().ReadBytes, "read bytes")
+}
+
+// use counts one call of a builtin that uses capability
+func (m *meter) use(capability string) *Error {
+	switch capability {
+	case capHTTP:
+		return take(&m.requests, 1, m.currentLimits().HTTPRequests, "HTTP requests")
+	}
+	return nil
+}
+
+// meteredOutput is the session's standard output as builtins see it. It
+// counts what they write, turning away output past the write quota.
+type meteredOutput struct {
+	s *session
+}
+
+func (o meteredOutput) Write(p []byte) (int, error) {
+	m := o.s.meter
+	if err := take(&m.written, int64(len(p)), m.currentLimits().WriteBytes, "written bytes"); err != nil {
+		m.refused.Store(err)
+		return 0, err
+	}
+	n, err := o.s.target().Write(p)
+	if o.s.hooks.OnPrint != nil && n > 0 {
+		o.s.hooks.OnPrint(string(p[:n]))
+	}
+	return n, err
+}
+
+// Flush writes what the session's output buffer holds, for flushOutput
+func (o meteredOutput) Flush() error {
+	return o.s.flush()
+}
+
+var _ io.Writer = meteredOutput{}
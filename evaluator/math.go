@@ -0,0 +1,111 @@
+package evaluator
+
+import (
+	"math"
+	"math/big"
+	"math/cmplx"
+)
+
+// numericTypes are the types that support arithmetic
+var numericTypes = []ObjectType{INTEGER_OBJ, FLOAT_OBJ, COMPLEX_OBJ, FRACTION_OBJ, DECIMAL_OBJ}
+
+// complexTypes are the types complex math functions accept
+var complexTypes = []ObjectType{INTEGER_OBJ, FLOAT_OBJ, COMPLEX_OBJ}
+
+func init() {
+	registerBuiltin(&Builtin{
+		Name:   "isNaN",
+		Params: []Param{{Name: "x", Types: numericTypes}},
+		Doc:    "Reports whether a number is NaN, the result of a float operation such as 0.0 / 0.0 that has no answer.",
+		Pure:   true,
+		Fn: func(args ...Object) Object {
+			switch x := args[0].(type) {
+			case *Float:
+				return nativeBoolToPyMonkeyBool(math.IsNaN(x.Value))
+			case *Complex:
+				return nativeBoolToPyMonkeyBool(cmplx.IsNaN(x.Value))
+			}
+			return FALSE
+		},
+	})
+
+	registerBuiltin(&Builtin{
+		Name:   "isFinite",
+		Params: []Param{{Name: "x", Types: numericTypes}},
+		Doc:    "Reports whether a number is neither infinite nor NaN.",
+		Pure:   true,
+		Fn: func(args ...Object) Object {
+			switch x := args[0].(type) {
+			case *Float:
+				return nativeBoolToPyMonkeyBool(!math.IsInf(x.Value, 0) && !math.IsNaN(x.Value))
+			case *Complex:
+				return nativeBoolToPyMonkeyBool(!cmplx.IsInf(x.Value) && !cmplx.IsNaN(x.Value))
+			}
+			return TRUE
+		},
+	})
+
+	registerModule("math", map[string]Object{
+		"inf": &Float{Value: math.Inf(1)},
+		"nan": &Float{Value: math.NaN()},
+		"abs": &Builtin{
+			Params: []Param{{Name: "x", Types: numericTypes}},
+			Doc:    "Returns the absolute value of a number, or the magnitude of a complex number.",
+			Pure:   true,
+			Fn: func(args ...Object) Object {
+				switch x := args[0].(type) {
+				case *Integer:
+					if x.Value < 0 {
+						return &Integer{Value: -x.Value}
+					}
+					return x
+				case *Float:
+					return &Float{Value: math.Abs(x.Value)}
+				case *Complex:
+					return &Float{Value: cmplx.Abs(x.Value)}
+				case *Fraction:
+					return &Fraction{Value: new(big.Rat).Abs(x.Value)}
+				case *Decimal:
+					return &Decimal{Unscaled: new(big.Int).Abs(x.Unscaled), Scale: x.Scale}
+				}
+				return NULL
+			},
+		},
+		"arg": &Builtin{
+			Params: []Param{{Name: "z", Types: complexTypes}},
+			Doc:    "Returns the angle of a complex number in radians, between -pi and pi.",
+			Pure:   true,
+			Fn: func(args ...Object) Object {
+				z, _ := toComplex(args[0])
+				return &Float{Value: cmplx.Phase(z)}
+			},
+		},
+		"conj": &Builtin{
+			Params: []Param{{Name: "z", Types: complexTypes}},
+			Doc:    "Returns the complex conjugate of a complex number.",
+			Pure:   true,
+			Fn: func(args ...Object) Object {
+				z, _ := toComplex(args[0])
+				return &Complex{Value: cmplx.Conj(z)}
+			},
+		},
+		"real": &Builtin{
+			Params: []Param{{Name: "z", Types: complexTypes}},
+			Doc:    "Returns the real part of a complex number.",
+			Pure:   true,
+			Fn: func(args ...Object) Object {
+				z, _ := toComplex(args[0])
+				return &Float{Value: real(z)}
+			},
+		},
+		"imag": &Builtin{
+			Params: []Param{{Name: "z", Types: complexTypes}},
+			Doc:    "Returns the imaginary part of a complex number.",
+			Pure:   true,
+			Fn: func(args ...Object) Object {
+				z, _ := toComplex(args[0])
+				return &Float{Value: imag(z)}
+			},
+		},
+	})
+}
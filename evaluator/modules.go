@@ -0,0 +1,367 @@
+package evaluator
+
+import (
+	"fmt"
+	"gokid/lexer"
+	"gokid/logging"
+	"gokid/parser"
+	"gokid/project"
+	"gokid/tokens"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// loadedModule is a source file imported by a program
+type loadedModule struct {
+	path    string
+	module  *Module
+	modTime time.Time
+	loading bool
+	session *session // of the interpreter that imported the module
+}
+
+// moduleCache holds an interpreter's imported modules by absolute path, so
+// every import of a file shares one Module object whose members are
+// rebound on reload. Each interpreter has its own, so a module runs with
+// the builtins and output of the interpreter that imported it; copies
+// running a server's handlers share the original's.
+type moduleCache struct {
+	mu      sync.Mutex
+	modules map[string]*loadedModule
+}
+
+func newModuleCache() *moduleCache {
+	return &moduleCache{modules: map[string]*loadedModule{}}
+}
+
+func init() {
+	registerBuiltin(&Builtin{
+		Name:   "reload",
+		Params: []Param{{Name: "module"}},
+		Doc:    "Re-runs an imported module, given as the module, its name or its path, and updates its exports.",
+		EnvFn: func(env *Environment, args ...Object) Object {
+			loaded := env.session.imports.find(args[0])
+			if loaded == nil {
+				return newCodedError(E_IMPORT, "module not loaded: %s", args[0].Inspect())
+			}
+			if err := loadModule(loaded); err != nil {
+				return err
+			}
+			return loaded.module
+		},
+	})
+}
+
+// SetPath records the file a top-level environment was loaded from, so its
+// imports resolve relative to that file
+func (e *Environment) SetPath(path string) {
+	e.path = path
+}
+
+// SetSource records the text a top-level environment was parsed from, so
+// functions defined in it know the line they start on, os.data() returns
+// the lines after its __data__ line, and typos are matched against the
+// keywords of its dialect
+func (e *Environment) SetSource(source string) {
+	e.lines = []int{0}
+	for i := 0; i < len(source); i++ {
+		if source[i] == '\n' {
+			e.lines = append(e.lines, i+1)
+		}
+	}
+	if data, ok := lexer.Data(source); ok {
+		e.data = &String{Value: data}
+	}
+	e.dialect = lexer.NewLexer(source).Dialect()
+}
+
+// keywords returns the keywords of the nearest scope with a known source,
+// or of the default dialect
+func (e *Environment) keywords() []string {
+	for ; e != nil; e = e.outer {
+		if e.dialect != nil {
+			return e.dialect.Words()
+		}
+	}
+	return lexer.NewLexer("").Dialect().Words()
+}
+
+// position returns the file and line of an offset into the source of the
+// nearest scope with a known source. The line is 0 when it is unknown.
+func (e *Environment) position(offset int) (string, int) {
+	for ; e != nil; e = e.outer {
+		if e.lines != nil {
+			return e.path, sort.SearchInts(e.lines, offset+1)
+		}
+	}
+	return "", 0
+}
+
+func (e *Environment) root() *Environment {
+	for e.outer != nil {
+		e = e.outer
+	}
+	return e
+}
+
+func evalImportStatement(is *parser.ImportStatement, env *Environment) Object {
+	if is.Path == nil {
+		return newError("import statement is missing a path")
+	}
+	if name, ok := strings.CutPrefix(is.Path.Value, "std/"); ok {
+		return importStandardModule(name, is, env)
+	}
+	if env.session.importsDisabled {
+		return newCodedError(E_DISABLED, "importing %s is disabled in this interpreter", is.Path.Value)
+	}
+
+	from := env.root().path
+	path := ResolveImport(is.Path.Value, from)
+	if project.IsURL(is.Path.Value) {
+		// Modules imported by URL are pinned in the lock file of the
+		// importing program's project
+		var err error
+		path, err = project.FetchURL(is.Path.Value, project.LockPath(filepath.Dir(from)))
+		if err != nil {
+			return newCodedError(E_IMPORT, "cannot import %s: %s", is.Path.Value, err)
+		}
+	}
+	if format, ok := dataFormats[strings.ToLower(filepath.Ext(path))]; ok {
+		return importData(path, format, is, env)
+	}
+
+	cache := env.session.imports
+	cache.mu.Lock()
+	loaded, ok := cache.modules[path]
+	if !ok {
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		loaded = &loadedModule{path: path, module: &Module{Name: name, Members: map[string]Object{}}, session: env.session}
+		cache.modules[path] = loaded
+	}
+	cache.mu.Unlock()
+
+	// A module that is still loading is part of an import cycle; bind it
+	// now and let its exports fill in once it finishes
+	if ok {
+		logging.Debug("module cache hit", "path", path)
+	} else {
+		startAccounting(env)
+		if err := loadModule(loaded); err != nil {
+			cache.mu.Lock()
+			delete(cache.modules, path)
+			cache.mu.Unlock()
+			return err
+		}
+	}
+
+	module := loaded.module
+	if f := env.session.forker; f != nil {
+		// A copy running on another goroutine gets a copy of the module
+		module = f.value(module).(*Module)
+	}
+	name := module.Name
+	if is.Alias != nil {
+		name = is.Alias.Value
+	}
+	env.Set(name, module)
+	return NULL
+}
+
+// DisableImports makes imports of files, URLs and data fail in the
+// interpreter env belongs to, leaving the standard modules, for hosts
+// that run untrusted programs
+func (e *Environment) DisableImports() {
+	e.session.importsDisabled = true
+}
+
+// importStandardModule binds the standard module name, such as math for
+// import "std/math", in env
+func importStandardModule(name string, is *parser.ImportStatement, env *Environment) Object {
+	module, ok := env.session.modules[name]
+	if !ok {
+		return newCodedError(E_IMPORT, "cannot import %s: there is no standard module %s", is.Path.Value, name)
+	}
+	if is.Alias != nil {
+		name = is.Alias.Value
+	}
+	env.Set(name, module)
+	return NULL
+}
+
+// ResolveImport returns the absolute path of the file an import of path
+// from the file from refers to. Paths are relative to from's directory;
+// a bare name such as "geometry" that isn't found there is looked for in
+// the gokid_modules directory there or in the nearest directory above.
+func ResolveImport(path, from string) string {
+	if project.IsURL(path) {
+		return path
+	}
+	if filepath.Ext(path) == "" {
+		path += ".gokid"
+	}
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	dir := "."
+	if from != "" {
+		dir = filepath.Dir(from)
+	}
+	dir, _ = filepath.Abs(dir)
+	local := filepath.Join(dir, path)
+	if _, err := os.Stat(local); err == nil || strings.HasPrefix(path, ".") {
+		return local
+	}
+	for d := dir; ; d = filepath.Dir(d) {
+		candidate := filepath.Join(d, project.ModulesDir, path)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+		if filepath.Dir(d) == d {
+			return local
+		}
+	}
+}
+
+// loadModule evaluates a module's source in a fresh top-level scope of the
+// interpreter that imported it, and rebinds its exports on the shared
+// Module object
+func loadModule(loaded *loadedModule) *Error {
+	info, err := os.Stat(loaded.path)
+	if err != nil {
+		return newCodedError(E_IMPORT, "cannot import %s: %s", loaded.path, err)
+	}
+	source, err := os.ReadFile(loaded.path)
+	if err != nil {
+		return newCodedError(E_IMPORT, "cannot import %s: %s", loaded.path, err)
+	}
+	if err := loaded.session.meter.useRead(len(source)); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	p := parser.New(lexer.NewLexer(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return newCodedError(E_IMPORT, "parse errors in %s: %s", loaded.path, strings.Join(p.Errors(), "; "))
+	}
+
+	env := &Environment{store: make(map[tokens.Ident]Object), session: loaded.session}
+	env.path = loaded.path
+	env.SetSource(string(source))
+	env.exports = []string{}
+
+	loaded.loading = true
+	result := Eval(program, env)
+	loaded.loading = false
+	if errObj, ok := result.(*Error); ok {
+		if errObj.Code == E_EXIT {
+			return errObj
+		}
+		return newCodedError(E_IMPORT, "error in module %s: %s", loaded.path, errObj.Message)
+	}
+
+	members := make(map[string]Object, len(env.exports))
+	for _, name := range env.exports {
+		if value, ok := env.Get(name); ok {
+			members[name] = value
+		}
+	}
+
+	cache := loaded.session.imports
+	cache.mu.Lock()
+	loaded.module.Members = members
+	loaded.modTime = info.ModTime()
+	cache.mu.Unlock()
+
+	logging.Debug("module loaded", "path", loaded.path, "exports", len(members), "duration", time.Since(start))
+	return nil
+}
+
+func evalExportStatement(es *parser.ExportStatement, env *Environment) Object {
+	result := Eval(es.Value, env)
+	if isError(result) {
+		return result
+	}
+
+	var name string
+	switch stmt := es.Value.(type) {
+	case *parser.LetStatement:
+		name = stmt.Name.Value
+	case *parser.ConstStatement:
+		name = stmt.Name.Value
+	case *parser.VarStatement:
+		name = stmt.Name.Value
+	default:
+		return newError("export must declare a variable with let, const or var")
+	}
+
+	root := env.root()
+	root.exports = append(root.exports, name)
+	return result
+}
+
+// find matches a Module object, an import name or a path
+func (c *moduleCache) find(target Object) *loadedModule {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if module, ok := target.(*Module); ok {
+		for _, loaded := range c.modules {
+			if loaded.module == module {
+				return loaded
+			}
+		}
+		return nil
+	}
+
+	name := target.Inspect()
+	abs, _ := filepath.Abs(name)
+	for _, loaded := range c.modules {
+		if loaded.module.Name == name || loaded.path == abs || loaded.path == abs+".gokid" {
+			return loaded
+		}
+	}
+	return nil
+}
+
+// EnableHotReload polls the files of the modules the interpreter imports
+// every interval and reloads any that changed, running the reload on the
+// interpreter between statements
+func (e *Environment) EnableHotReload(interval time.Duration) {
+	cache := e.session.imports
+	go func() {
+		for {
+			time.Sleep(interval)
+
+			cache.mu.Lock()
+			var changed []*loadedModule
+			for _, loaded := range cache.modules {
+				info, err := os.Stat(loaded.path)
+				if err == nil && !loaded.loading && info.ModTime().After(loaded.modTime) {
+					changed = append(changed, loaded)
+				}
+			}
+			cache.mu.Unlock()
+
+			for _, loaded := range changed {
+				RunOnInterpreter(func() {
+					logging.Info("hot reload", "path", loaded.path)
+					if err := loadModule(loaded); err != nil {
+						fmt.Fprintf(loaded.session.errOut(), "hot reload failed: %s\n", err.Message)
+						// Don't retry until the file changes again
+						if info, statErr := os.Stat(loaded.path); statErr == nil {
+							cache.mu.Lock()
+							loaded.modTime = info.ModTime()
+							cache.mu.Unlock()
+						}
+					}
+				})
+			}
+		}
+	}()
+}
@@ -0,0 +1,197 @@
+package evaluator
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// maxDigits bounds the digits toFixed and toPrecision write
+const maxDigits = 100
+
+func init() {
+	registerBuiltin(&Builtin{
+		Name:   "toFixed",
+		Params: []Param{{Name: "x", Types: []ObjectType{INTEGER_OBJ, FLOAT_OBJ}}, {Name: "digits", Types: []ObjectType{INTEGER_OBJ}}},
+		Doc:    "Formats a number with exactly digits digits after the decimal point, rounding to the nearest and halves to even.",
+		Pure:   true,
+		Fn: func(args ...Object) Object {
+			digits, err := formatDigits("toFixed", args[1], 0)
+			if err != nil {
+				return err
+			}
+			switch x := args[0].(type) {
+			case *Integer:
+				// Exact, even past the integers a float can hold
+				text := strconv.FormatInt(x.Value, 10)
+				if digits > 0 {
+					text += "." + strings.Repeat("0", digits)
+				}
+				return &String{Value: text}
+			default:
+				f := toFloat(x)
+				if math.IsInf(f, 0) || math.IsNaN(f) {
+					return &String{Value: formatFloat(f)}
+				}
+				text := strconv.FormatFloat(f, 'f', digits, 64)
+				// A small negative number rounds to 0, not -0
+				if strings.Trim(text, "-0.") == "" {
+					text = strings.TrimPrefix(text, "-")
+				}
+				return &String{Value: text}
+			}
+		},
+	})
+
+	registerBuiltin(&Builtin{
+		Name:   "toPrecision",
+		Params: []Param{{Name: "x", Types: []ObjectType{INTEGER_OBJ, FLOAT_OBJ}}, {Name: "digits", Types: []ObjectType{INTEGER_OBJ}}},
+		Doc:    "Formats a number with digits significant digits, in exponent form when it is very large or small.",
+		Pure:   true,
+		Fn: func(args ...Object) Object {
+			digits, err := formatDigits("toPrecision", args[1], 1)
+			if err != nil {
+				return err
+			}
+			return &String{Value: toPrecision(toFloat(args[0]), digits)}
+		},
+	})
+
+	registerBuiltin(&Builtin{
+		Name:   "thousands",
+		Params: []Param{{Name: "x", Types: []ObjectType{INTEGER_OBJ, FLOAT_OBJ, STRING_OBJ}}, {Name: "separator", Types: []ObjectType{STRING_OBJ}, Optional: true}},
+		Doc:    "Writes a number, or a number already formatted such as by toFixed, with its whole part in groups of three digits.",
+		Pure:   true,
+		Fn: func(args ...Object) Object {
+			separator := ","
+			if len(args) == 2 {
+				separator = args[1].(*String).Value
+			}
+			var text string
+			switch x := args[0].(type) {
+			case *Integer:
+				text = strconv.FormatInt(x.Value, 10)
+			case *Float:
+				if math.IsInf(x.Value, 0) || math.IsNaN(x.Value) {
+					return newCodedError(E_VALUE, "`thousands` needs a finite number, got %s", x.Inspect())
+				}
+				text = strconv.FormatFloat(x.Value, 'f', -1, 64)
+			case *String:
+				text = strings.TrimSpace(x.Value)
+				if _, err := strconv.ParseFloat(text, 64); err != nil || strings.ContainsAny(text, "eEiInN_xXpP") {
+					return newCodedError(E_VALUE, "`thousands` needs a number written in digits, got %q", x.Value)
+				}
+			}
+			return &String{Value: groupThousands(text, separator)}
+		},
+	})
+
+	registerBuiltin(&Builtin{
+		Name:   "toString",
+		Params: []Param{{Name: "value"}, {Name: "base", Types: []ObjectType{INTEGER_OBJ}, Optional: true}},
+		Doc:    "Returns the text print writes for a value, or an integer's digits in base 2 to 36.",
+		Pure:   true,
+		Fn: func(args ...Object) Object {
+			if len(args) == 1 {
+				return &String{Value: args[0].Inspect()}
+			}
+			n, ok := args[0].(*Integer)
+			if !ok {
+				return newCodedError(E_TYPE_MISMATCH, "`toString` with a base needs an INTEGER, got %s", args[0].Type())
+			}
+			base, err := numberBase("toString", args[1])
+			if err != nil {
+				return err
+			}
+			return &String{Value: strconv.FormatInt(n.Value, base)}
+		},
+	})
+
+	registerBuiltin(&Builtin{
+		Name:   "parseIntBase",
+		Params: []Param{{Name: "s", Types: []ObjectType{STRING_OBJ}}, {Name: "base", Types: []ObjectType{INTEGER_OBJ}}},
+		Doc:    "Reads an integer written in base 2 to 36, such as parseIntBase(\"ff\", 16).",
+		Pure:   true,
+		Fn: func(args ...Object) Object {
+			base, err := numberBase("parseIntBase", args[1])
+			if err != nil {
+				return err
+			}
+			s := args[0].(*String).Value
+			n, parseErr := strconv.ParseInt(strings.TrimSpace(s), base, 64)
+			if parseErr != nil {
+				if errors.Is(parseErr, strconv.ErrRange) {
+					return newCodedError(E_VALUE, "%q is too large for an integer", s)
+				}
+				return newCodedError(E_VALUE, "cannot read %q as a base-%d integer", s, base)
+			}
+			return &Integer{Value: n}
+		},
+	})
+}
+
+// formatDigits checks the digits given to name, which must be between min
+// and maxDigits
+func formatDigits(name string, arg Object, min int64) (int, *Error) {
+	digits := arg.(*Integer).Value
+	if digits < min || digits > maxDigits {
+		return 0, newCodedError(E_VALUE, "digits given to `%s` must be between %d and %d, got %d", name, min, maxDigits, digits)
+	}
+	return int(digits), nil
+}
+
+// numberBase checks the base given to name
+func numberBase(name string, arg Object) (int, *Error) {
+	base := arg.(*Integer).Value
+	if base < 2 || base > 36 {
+		return 0, newCodedError(E_VALUE, "base given to `%s` must be between 2 and 36, got %d", name, base)
+	}
+	return int(base), nil
+}
+
+// toPrecision writes x with digits significant digits: in plain digits,
+// keeping trailing zeros, unless its exponent is below -6 or at least
+// digits, when it is written as 1.23e+5
+func toPrecision(x float64, digits int) string {
+	if math.IsInf(x, 0) || math.IsNaN(x) {
+		return formatFloat(x)
+	}
+	// Rounding can carry into a new digit, so the exponent is read from
+	// the rounded number
+	scientific := strconv.FormatFloat(x, 'e', digits-1, 64)
+	mantissa, exponent, _ := strings.Cut(scientific, "e")
+	exp, _ := strconv.Atoi(exponent)
+	if exp < -6 || exp >= digits {
+		sign := "+"
+		if exp < 0 {
+			sign, exp = "-", -exp
+		}
+		return mantissa + "e" + sign + strconv.Itoa(exp)
+	}
+	return strconv.FormatFloat(x, 'f', digits-1-exp, 64)
+}
+
+// groupThousands puts separator between each group of three digits of
+// the whole part of a number written in digits
+func groupThousands(text, separator string) string {
+	sign := ""
+	if strings.HasPrefix(text, "-") || strings.HasPrefix(text, "+") {
+		sign, text = text[:1], text[1:]
+	}
+	whole, fraction, hasFraction := strings.Cut(text, ".")
+
+	var b strings.Builder
+	b.WriteString(sign)
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(separator)
+		}
+		b.WriteRune(digit)
+	}
+	if hasFraction {
+		b.WriteString(".")
+		b.WriteString(fraction)
+	}
+	return b.String()
+}
@@ -3,8 +3,11 @@ package evaluator
 import (
 	"fmt"
 	"gokid/parser"
-	"hash/fnv"
+	"math"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 )
 
 // ObjectType represents the type of objects in our language
@@ -15,6 +18,7 @@ const (
 	FLOAT_OBJ    = "FLOAT"
 	BOOLEAN_OBJ  = "BOOLEAN"
 	STRING_OBJ   = "STRING"
+	SYMBOL_OBJ   = "SYMBOL"
 	NULL_OBJ     = "NULL"
 	RETURN_OBJ   = "RETURN_VALUE"
 	ERROR_OBJ    = "ERROR"
@@ -24,6 +28,7 @@ const (
 	HASH_OBJ     = "HASH"
 	BREAK_OBJ    = "BREAK"
 	CONTINUE_OBJ = "CONTINUE"
+	MODULE_OBJ   = "MODULE"
 )
 
 // Object interface - all values in our language implement this
@@ -46,7 +51,19 @@ type Float struct {
 }
 
 func (f *Float) Type() ObjectType { return FLOAT_OBJ }
-func (f *Float) Inspect() string  { return fmt.Sprintf("%g", f.Value) }
+func (f *Float) Inspect() string  { return formatFloat(f.Value) }
+
+// formatFloat writes f with the fewest digits that read back as the same
+// float, and Inf, -Inf and NaN for the values that aren't numbers
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
 
 // Boolean object
 type Boolean struct {
@@ -64,6 +81,33 @@ type String struct {
 func (s *String) Type() ObjectType { return STRING_OBJ }
 func (s *String) Inspect() string  { return s.Value }
 
+// Symbol object, written :name. Symbols are interned, so two symbols with
+// the same name are the same object and compare by identity.
+type Symbol struct {
+	Name string
+	id   uint64
+}
+
+func (s *Symbol) Type() ObjectType { return SYMBOL_OBJ }
+func (s *Symbol) Inspect() string  { return ":" + s.Name }
+
+var symbols = struct {
+	sync.Mutex
+	byName map[string]*Symbol
+}{byName: make(map[string]*Symbol)}
+
+// Intern returns the symbol called name, creating it on first use
+func Intern(name string) *Symbol {
+	symbols.Lock()
+	defer symbols.Unlock()
+	if s, ok := symbols.byName[name]; ok {
+		return s
+	}
+	s := &Symbol{Name: name, id: uint64(len(symbols.byName))}
+	symbols.byName[name] = s
+	return s
+}
+
 // Null object
 type Null struct{}
 
@@ -81,6 +125,26 @@ func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 // Error object
 type Error struct {
 	Message string
+	Offset  int    // source offset of the statement that failed
+	Located bool   // whether Offset is known
+	Path    string // file the statement is in, if known
+
+	// Function describes the innermost function the error was raised in,
+	// such as "function 'area' (shapes.gokid:12)"
+	Function string
+
+	// Code says what kind of error this is, E_RUNTIME when empty. Thrown
+	// is the value given to throw, for E_THROWN.
+	Code   ErrorCode
+	Thrown Object
+
+	// Stack lists the functions the error passed out of, innermost first.
+	// Dropped counts the outer ones left off a very deep stack.
+	Stack   []string
+	Dropped int
+
+	// Status is the exit status given to os.exit, for E_EXIT
+	Status int
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
@@ -89,24 +153,16 @@ func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
 // Array object
 type Array struct {
 	Elements []Object
+	Frozen   bool // set by freeze; frozen arrays reject assignment
 }
 
 func (ao *Array) Type() ObjectType { return ARRAY_OBJ }
-func (ao *Array) Inspect() string {
-	var out strings.Builder
-	elements := []string{}
-	for _, e := range ao.Elements {
-		elements = append(elements, e.Inspect())
-	}
-	out.WriteString("[")
-	out.WriteString(strings.Join(elements, ", "))
-	out.WriteString("]")
-	return out.String()
-}
+func (ao *Array) Inspect() string  { return Pretty(ao, PrettyOptions{}) }
 
 // Hash object (for objects/dictionaries)
 type Hash struct {
-	Pairs map[HashKey]HashPair
+	Pairs  map[HashKey]HashPair
+	Frozen bool // set by freeze; frozen hashes reject assignment
 }
 
 type HashKey struct {
@@ -120,24 +176,53 @@ type HashPair struct {
 }
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
-func (h *Hash) Inspect() string {
-	var out strings.Builder
-	pairs := []string{}
-	for _, pair := range h.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s: %s",
-			pair.Key.Inspect(), pair.Value.Inspect()))
+func (h *Hash) Inspect() string  { return Pretty(h, PrettyOptions{}) }
+
+// newHash builds a hash with string keys
+func newHash(pairs map[string]Object) *Hash {
+	hash := &Hash{Pairs: make(map[HashKey]HashPair)}
+	for name, value := range pairs {
+		key := &String{Value: name}
+		hash.Pairs[key.HashKey()] = HashPair{Key: key, Value: value}
 	}
-	out.WriteString("{")
-	out.WriteString(strings.Join(pairs, ", "))
-	out.WriteString("}")
-	return out.String()
+	return hash
 }
 
-// Hashable interface for objects that can be hash keys
+// hashGet looks up a string key, returning nil when it is missing
+func hashGet(hash *Hash, name string) Object {
+	if pair, ok := hash.Pairs[stringHashKey(name)]; ok {
+		return pair.Value
+	}
+	return nil
+}
+
+// MemberHolder is implemented by objects that expose members through dot access
+type MemberHolder interface {
+	Member(name string) (Object, bool)
+}
+
+// Hashable interface for objects that can be hash keys. Two values have
+// the same key exactly when == says they are equal: 1 and 1.0 are one key,
+// while true and 1 are two.
 type Hashable interface {
 	HashKey() HashKey
 }
 
+// hashKeyOf returns the key obj is stored under in a hash, or an error
+// naming obj when it can't be a key. NaN, which is not equal to itself,
+// can't be.
+func hashKeyOf(obj Object) (HashKey, *Error) {
+	if f, ok := obj.(*Float); ok && math.IsNaN(f.Value) {
+		return HashKey{}, newCodedError(E_VALUE, "unusable as hash key: NaN is not equal to itself")
+	}
+	hashable, ok := obj.(Hashable)
+	if !ok {
+		return HashKey{}, newCodedError(E_TYPE_MISMATCH, "unusable as hash key: %s %s",
+			obj.Type(), Pretty(obj, PrettyOptions{MaxItems: 3, MaxDepth: 1}))
+	}
+	return hashable.HashKey(), nil
+}
+
 func (b *Boolean) HashKey() HashKey {
 	var value uint64
 	if b.Value {
@@ -152,26 +237,119 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+// HashKey of a whole float is the key of the integer it equals, so h[1.0]
+// and h[1] are the same entry
+func (f *Float) HashKey() HashKey {
+	if f.Value == math.Trunc(f.Value) && f.Value >= math.MinInt64 && f.Value < math.MaxInt64 {
+		return HashKey{Type: INTEGER_OBJ, Value: uint64(int64(f.Value))}
+	}
+	return HashKey{Type: FLOAT_OBJ, Value: math.Float64bits(f.Value)}
+}
+
+func (s *Symbol) HashKey() HashKey {
+	return HashKey{Type: s.Type(), Value: s.id}
+}
+
 func (s *String) HashKey() HashKey {
-	h := fnv.New64a()
-	h.Write([]byte(s.Value))
-	return HashKey{Type: s.Type(), Value: h.Sum64()}
+	return stringHashKey(s.Value)
+}
+
+// stringHashKey returns the hash key of a string with the value s. The
+// hash is 64-bit FNV-1a, computed inline so that hashing doesn't allocate.
+func stringHashKey(s string) HashKey {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= 1099511628211
+	}
+	return HashKey{Type: STRING_OBJ, Value: h}
+}
+
+// cachedKey returns the hash key of the string name, using and filling
+// the inline cache of the node that looks it up
+func cachedKey(cache *parser.KeyCache, name string) HashKey {
+	if h, ok := cache.Load(); ok {
+		return HashKey{Type: STRING_OBJ, Value: h}
+	}
+	key := stringHashKey(name)
+	cache.Store(key.Value)
+	return key
 }
 
 // Function object
 type Function struct {
-	Parameters []*parser.Identifier
+	Parameters []*parser.Identifier // nil where the parameter is a pattern
 	Body       *parser.BlockStatement
 	Env        *Environment
+	Source     string
+	Name       string
+	Doc        string // the comment above the function's declaration
+
+	Offset int    // source offset of the function literal
+	Path   string // file of the module the function was defined in
+	Line   int    // line the function starts on, 0 when unknown
+
+	// Patterns holds, for each parameter, the value its argument must
+	// equal, or nil for a name. It is nil when no parameter is a pattern.
+	Patterns []Object
+
+	// Clauses are the function's clauses, this one first, when it was
+	// declared in more than one. A call runs the first that matches.
+	Clauses []*Function
+}
+
+// Signature describes how to call f, such as "area(width, height)"
+func (f *Function) Signature() string {
+	params := f.parameterNames()
+	name := f.Name
+	if name == "" {
+		name = "function"
+	}
+	return name + "(" + strings.Join(params, ", ") + ")"
+}
+
+// parameterNames returns the names of f's parameters, with the pattern
+// of each that has one instead
+func (f *Function) parameterNames() []string {
+	names := make([]string, len(f.Parameters))
+	for i, param := range f.Parameters {
+		if param == nil {
+			names[i] = literal(f.Patterns[i])
+			continue
+		}
+		names[i] = param.Value
+	}
+	return names
+}
+
+// Location returns where the function was defined, such as "calc.gokid:12",
+// or "" when that is unknown
+func (f *Function) Location() string {
+	switch {
+	case f.Line == 0:
+		return ""
+	case f.Path == "":
+		return fmt.Sprintf("line %d", f.Line)
+	}
+	return fmt.Sprintf("%s:%d", filepath.Base(f.Path), f.Line)
+}
+
+// describe names the function for messages, with its location if known
+func (f *Function) describe() string {
+	desc := "anonymous function"
+	if f.Name != "" {
+		desc = fmt.Sprintf("function '%s'", f.Name)
+	}
+	if loc := f.Location(); loc != "" {
+		desc += " (" + loc + ")"
+	}
+	return desc
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
 func (f *Function) Inspect() string {
 	var out strings.Builder
-	parameters := []string{}
-	for _, p := range f.Parameters {
-		parameters = append(parameters, p.Value)
-	}
+	parameters := f.parameterNames()
 	out.WriteString("fn")
 	out.WriteString("(")
 	out.WriteString(strings.Join(parameters, ", "))
@@ -192,3 +370,17 @@ type Continue struct{}
 
 func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
 func (c *Continue) Inspect() string  { return "continue" }
+
+// Module object groups related built-in members under one name
+type Module struct {
+	Name    string
+	Members map[string]Object
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return "<module " + m.Name + ">" }
+
+func (m *Module) Member(name string) (Object, bool) {
+	member, ok := m.Members[name]
+	return member, ok
+}
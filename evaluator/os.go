@@ -0,0 +1,208 @@
+package evaluator
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+func init() {
+	registerModule("os", map[string]Object{
+		"args": &Array{Elements: []Object{}},
+		"onSignal": &Builtin{
+			Params: []Param{
+				{Name: "name", Types: []ObjectType{STRING_OBJ}},
+				{Name: "handler", Types: []ObjectType{FUNCTION_OBJ, BUILTIN_OBJ, NULL_OBJ}},
+			},
+			Doc: "Calls handler when the process receives the named signal, or restores the default when handler is null.",
+			Fn:  onSignal,
+		},
+		"atexit": &Builtin{
+			Params: []Param{{Name: "fn", Types: callableTypes}},
+			Doc:    "Registers fn to run when the program ends, whether it finishes, calls os.exit or fails with an uncaught error. The last registered runs first.",
+			EnvFn: func(env *Environment, args ...Object) Object {
+				s := env.session
+				if s.concurrent {
+					s.mu.Lock()
+					defer s.mu.Unlock()
+				}
+				s.exitHooks = append(s.exitHooks, args[0])
+				return NULL
+			},
+		},
+		"data": &Builtin{
+			Doc: "Returns the text after the __data__ line that ends the program's code, or null if it has none.",
+			EnvFn: func(env *Environment, args ...Object) Object {
+				for ; env != nil; env = env.outer {
+					if env.data != nil {
+						return env.data
+					}
+				}
+				return NULL
+			},
+		},
+		"exit": &Builtin{
+			Params: []Param{{Name: "code", Types: []ObjectType{INTEGER_OBJ}, Optional: true}},
+			Doc:    "Ends the program with the given exit code, 0 by default. Finally blocks run on the way out; catch blocks don't.",
+			Fn: func(args ...Object) Object {
+				code := 0
+				if len(args) == 1 {
+					code = int(args[0].(*Integer).Value)
+				}
+				return exitError(code)
+			},
+		},
+		"shutdown": &Builtin{
+			Params: []Param{
+				{Name: "code", Types: []ObjectType{INTEGER_OBJ}, Optional: true},
+				{Name: "grace", Types: []ObjectType{INTEGER_OBJ, FLOAT_OBJ}, Optional: true},
+			},
+			Doc: "Stops every server listening, gives requests in progress grace seconds (10 by default) to finish, then ends the program with the given exit code like os.exit.",
+			Fn: func(args ...Object) Object {
+				code, grace := 0, DefaultGrace
+				if len(args) >= 1 {
+					code = int(args[0].(*Integer).Value)
+				}
+				if len(args) == 2 {
+					seconds := toFloat(args[1])
+					if seconds < 0 {
+						return newCodedError(E_VALUE, "grace must not be negative, got %s", args[1].Inspect())
+					}
+					grace = time.Duration(seconds * float64(time.Second))
+				}
+				return shutdown(code, grace)
+			},
+		},
+	})
+}
+
+// exitError is the error that ends the program with code, as os.exit does
+func exitError(code int) *Error {
+	return &Error{Message: fmt.Sprintf("exit status %d", code), Code: E_EXIT, Status: code}
+}
+
+// SetArgs exposes the script path and its command-line arguments as os.args
+func SetArgs(args []string) {
+	elements := make([]Object, len(args))
+	for i, arg := range args {
+		elements[i] = &String{Value: arg}
+	}
+	modules["os"].Members["args"] = &Array{Elements: elements}
+}
+
+// RunExitHooks calls the functions registered with os.atexit, the last
+// registered first, and forgets them. Hosts call it once the program has
+// ended, before reporting how. Every hook runs even if one fails; the first
+// error a hook raises, which may be an os.exit, is returned.
+func (e *Environment) RunExitHooks() *Error {
+	s := e.session
+	var first *Error
+	for {
+		if s.concurrent {
+			s.mu.Lock()
+		}
+		n := len(s.exitHooks)
+		var hook Object
+		if n > 0 {
+			hook = s.exitHooks[n-1]
+			s.exitHooks = s.exitHooks[:n-1]
+		}
+		if s.concurrent {
+			s.mu.Unlock()
+		}
+		if hook == nil {
+			return first
+		}
+		if err, ok := applyFunction(hook, nil).(*Error); ok && first == nil {
+			first = err
+		}
+	}
+}
+
+var signalNames = map[string]os.Signal{
+	"INT":  os.Interrupt,
+	"TERM": syscall.SIGTERM,
+	"HUP":  syscall.SIGHUP,
+	"QUIT": syscall.SIGQUIT,
+}
+
+// Signals are process-wide, so their handlers are too. Delivered signals
+// are queued and dispatched by the evaluator between statements, keeping
+// handlers on the interpreter's goroutine.
+var (
+	signalMu       sync.Mutex
+	signalHandlers = map[os.Signal]Object{}
+	pendingSignals = make(chan os.Signal, 16)
+)
+
+func onSignal(args ...Object) Object {
+	name := args[0].(*String)
+	sig, ok := signalNames[strings.TrimPrefix(strings.ToUpper(name.Value), "SIG")]
+	if !ok {
+		return newCodedError(E_VALUE, "unknown signal: %s", name.Value)
+	}
+
+	signalMu.Lock()
+	defer signalMu.Unlock()
+
+	switch handler := args[1].(type) {
+	case *Null:
+		delete(signalHandlers, sig)
+		signal.Reset(sig)
+	default:
+		signalHandlers[sig] = handler
+		signal.Notify(pendingSignals, sig)
+	}
+
+	return NULL
+}
+
+// HandlesSignal reports whether the program has a handler for sig, given
+// with os.onSignal, so hosts can leave the signal to it
+func HandlesSignal(sig os.Signal) bool {
+	signalMu.Lock()
+	defer signalMu.Unlock()
+	_, ok := signalHandlers[sig]
+	return ok
+}
+
+// dispatchSignals runs the handlers of any signals delivered since the
+// last statement, returning the first error a handler raises
+func dispatchSignals() *Error {
+	for {
+		select {
+		case sig := <-pendingSignals:
+			if err := runSignalHandler(sig); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+func runSignalHandler(sig os.Signal) *Error {
+	signalMu.Lock()
+	handler, ok := signalHandlers[sig]
+	signalMu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	name := "INT"
+	for n, s := range signalNames {
+		if s == sig {
+			name = n
+		}
+	}
+
+	result := applyFunction(handler, []Object{&String{Value: name}})
+	if err, ok := result.(*Error); ok {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package evaluator
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// PrettyOptions controls how Pretty lays out values. The zero value prints
+// everything on one line, as Inspect does.
+type PrettyOptions struct {
+	Width    int  // collections longer than this are split over several lines; 0 never splits
+	Indent   int  // spaces per nesting level when a collection is split
+	MaxItems int  // elements shown per collection before "… N more"; 0 shows all
+	MaxDepth int  // nesting levels shown before collections print as […]; 0 shows all
+	Plain    bool // write "..." instead of "…", which screen readers may not say
+}
+
+// DefaultPrettyOptions is used by the REPL to show values
+var DefaultPrettyOptions = PrettyOptions{Width: 80, Indent: 2, MaxItems: 100}
+
+func init() {
+	registerBuiltin(&Builtin{
+		Name: "pretty",
+		Params: []Param{
+			{Name: "value"},
+			{Name: "options", Types: []ObjectType{HASH_OBJ}, Optional: true},
+		},
+		Doc: "Formats a value for reading, splitting long collections over lines. Options: width, indent, maxItems, maxDepth.",
+		Fn: func(args ...Object) Object {
+			opts := DefaultPrettyOptions
+			if len(args) == 2 {
+				if err := prettyOptions(args[1].(*Hash), &opts); err != nil {
+					return err
+				}
+			}
+			return &String{Value: Pretty(args[0], opts)}
+		},
+	})
+}
+
+// prettyOptions reads the options hash given to pretty into opts
+func prettyOptions(options *Hash, opts *PrettyOptions) *Error {
+	for _, pair := range sortedPairs(options) {
+		var field *int
+		switch pair.Key.Inspect() {
+		case "width":
+			field = &opts.Width
+		case "indent":
+			field = &opts.Indent
+		case "maxItems":
+			field = &opts.MaxItems
+		case "maxDepth":
+			field = &opts.MaxDepth
+		default:
+			return newCodedError(E_VALUE, "unknown option %s to `pretty`", pair.Key.Inspect())
+		}
+
+		value, ok := pair.Value.(*Integer)
+		if !ok || value.Value < 0 {
+			return newCodedError(E_VALUE, "option %s must be a non-negative INTEGER, got %s", pair.Key.Inspect(), pair.Value.Inspect())
+		}
+		*field = int(value.Value)
+	}
+	return nil
+}
+
+// Pretty formats a value. Collections that contain themselves print the
+// inner reference as [...] instead of recursing forever.
+func Pretty(obj Object, opts PrettyOptions) string {
+	p := &printer{opts: opts, active: make(map[Object]bool)}
+	return p.print(obj, 0)
+}
+
+type printer struct {
+	opts   PrettyOptions
+	active map[Object]bool // collections being printed, to detect cycles
+}
+
+// entry is an element of a collection; key is nil except for maps
+type entry struct {
+	key   Object
+	value Object
+}
+
+func (p *printer) print(obj Object, depth int) string {
+	open, close, entries, ok := collectionParts(obj)
+	if !ok {
+		return obj.Inspect()
+	}
+	if p.active[obj] {
+		return open + "..." + close
+	}
+	ellipsis := "…"
+	if p.opts.Plain {
+		ellipsis = "..."
+	}
+	if p.opts.MaxDepth > 0 && depth >= p.opts.MaxDepth && len(entries) > 0 {
+		return open + ellipsis + close
+	}
+	p.active[obj] = true
+	defer delete(p.active, obj)
+
+	shown := entries
+	if p.opts.MaxItems > 0 && len(entries) > p.opts.MaxItems {
+		shown = entries[:p.opts.MaxItems]
+	}
+	items := make([]string, 0, len(shown)+1)
+	for _, e := range shown {
+		item := p.print(e.value, depth+1)
+		if e.key != nil {
+			item = p.print(e.key, depth+1) + ": " + item
+		}
+		items = append(items, item)
+	}
+	if len(shown) < len(entries) {
+		items = append(items, fmt.Sprintf("%s %s more", ellipsis, groupDigits(len(entries)-len(shown))))
+	}
+
+	line := open + strings.Join(items, ", ") + close
+	if p.opts.Width == 0 || len(items) == 0 ||
+		(depth*p.opts.Indent+utf8.RuneCountInString(line) <= p.opts.Width && !strings.Contains(line, "\n")) {
+		return line
+	}
+
+	indent := strings.Repeat(" ", (depth+1)*p.opts.Indent)
+	var out strings.Builder
+	out.WriteString(open)
+	for i, item := range items {
+		out.WriteString("\n" + indent + item)
+		if i < len(items)-1 {
+			out.WriteString(",")
+		}
+	}
+	out.WriteString("\n" + strings.Repeat(" ", depth*p.opts.Indent) + close)
+	return out.String()
+}
+
+// keyLess orders the keys of an object as they are shown: by type, then
+// by value, with integers and floats ordered together as numbers
+func keyLess(a, b Object) bool {
+	if hasType(realTypes, a.Type()) && hasType(realTypes, b.Type()) {
+		if c, ok := compareKeys(a, b); ok && c != 0 {
+			return c < 0
+		}
+	}
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+	if c, ok := compareKeys(a, b); ok {
+		return c < 0
+	}
+	return a.Inspect() < b.Inspect()
+}
+
+// sortedPairs returns the pairs of a hash in the order of their keys.
+// Everything that shows, encodes or walks a hash's entries goes through
+// it, so a program's output never depends on Go's map order.
+func sortedPairs(hash *Hash) []HashPair {
+	pairs := make([]HashPair, 0, len(hash.Pairs))
+	for _, pair := range hash.Pairs {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool { return keyLess(pairs[i].Key, pairs[j].Key) })
+	return pairs
+}
+
+// collectionParts splits a collection into its brackets and entries.
+// Hash entries are sorted by key type and then key, so output is stable.
+func collectionParts(obj Object) (string, string, []entry, bool) {
+	switch obj := obj.(type) {
+	case *Array:
+		return "[", "]", valueEntries(obj.Elements), true
+	case *Hash:
+		entries := make([]entry, 0, len(obj.Pairs))
+		for _, pair := range sortedPairs(obj) {
+			entries = append(entries, entry{key: pair.Key, value: pair.Value})
+		}
+		return "{", "}", entries, true
+	case *Record:
+		entries := make([]entry, len(obj.Values))
+		for i, value := range obj.Values {
+			entries[i] = entry{key: &String{Value: obj.Def.Fields[i]}, value: value}
+		}
+		return obj.Def.Name + "{", "}", entries, true
+	case *Stack:
+		return "stack([", "])", valueEntries(obj.Elements), true
+	case *Queue:
+		return "queue([", "])", valueEntries(obj.Elements), true
+	case *Deque:
+		return "deque([", "])", valueEntries(obj.Elements), true
+	case *Heap:
+		return "heap([", "])", valueEntries(obj.values()), true
+	case *SortedMap:
+		entries := make([]entry, len(obj.Entries))
+		for i, pair := range obj.Entries {
+			entries[i] = entry{key: pair.Key, value: pair.Value}
+		}
+		return "sortedMap({", "})", entries, true
+	}
+	return "", "", nil, false
+}
+
+// Entries returns the entries of a collection in the order pretty shows
+// them, and whether obj is one. Keys are nil for the elements of arrays,
+// stacks, queues, deques and heaps.
+func Entries(obj Object) (keys, values []Object, ok bool) {
+	_, _, entries, ok := collectionParts(obj)
+	keys, values = make([]Object, len(entries)), make([]Object, len(entries))
+	for i, e := range entries {
+		keys[i], values[i] = e.key, e.value
+	}
+	return keys, values, ok
+}
+
+func valueEntries(values []Object) []entry {
+	entries := make([]entry, len(values))
+	for i, value := range values {
+		entries[i] = entry{value: value}
+	}
+	return entries
+}
+
+// groupDigits writes n with commas between groups of three digits
+func groupDigits(n int) string {
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
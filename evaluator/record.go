@@ -0,0 +1,102 @@
+package evaluator
+
+import (
+	"gokid/diagnostics"
+	"gokid/parser"
+	"strings"
+)
+
+const RECORD_OBJ = "RECORD"
+
+// RecordType is a record declared with record Point {x, y}: its name and
+// fields, in the order they were declared
+type RecordType struct {
+	Name   string
+	Fields []string
+	index  map[string]int
+}
+
+// Record object is a value of a record type. It has exactly its type's
+// fields, so reading or assigning any other name is an error rather than
+// a silent null or a new key, as it would be in a hash.
+type Record struct {
+	Def    *RecordType
+	Values []Object // in the order of Def.Fields
+}
+
+func (r *Record) Type() ObjectType { return RECORD_OBJ }
+func (r *Record) Inspect() string  { return Pretty(r, PrettyOptions{}) }
+
+// Member returns the field called name, for templates
+func (r *Record) Member(name string) (Object, bool) {
+	i, ok := r.Def.index[name]
+	if !ok {
+		return nil, false
+	}
+	return r.Values[i], true
+}
+
+// field returns the field called name, or an error naming the fields the
+// record has
+func (r *Record) field(name string) Object {
+	if value, ok := r.Member(name); ok {
+		return value
+	}
+	return r.Def.unknownField(name)
+}
+
+// setField assigns the field called name
+func (r *Record) setField(name string, value Object) *Error {
+	i, ok := r.Def.index[name]
+	if !ok {
+		return r.Def.unknownField(name)
+	}
+	r.Values[i] = value
+	return nil
+}
+
+// unknownField is the error for reading or assigning a field t doesn't
+// have, which suggests the field meant when name looks like a typo
+func (t *RecordType) unknownField(name string) *Error {
+	if suggestion := diagnostics.Suggest(name, t.Fields); suggestion != "" {
+		return newCodedError(E_UNKNOWN_MEMBER, "%s has no field %s; did you mean '%s'?", t.Name, name, suggestion)
+	}
+	return newCodedError(E_UNKNOWN_MEMBER, "%s has no field %s; its fields are %s", t.Name, name, strings.Join(t.Fields, ", "))
+}
+
+// fieldName reads the key of record[key], which must be a string
+func fieldName(key Object) (string, *Error) {
+	name, ok := key.(*String)
+	if !ok {
+		return "", newCodedError(E_TYPE_MISMATCH, "record fields are named by STRING, got %s", key.Type())
+	}
+	return name.Value, nil
+}
+
+// evalRecordLiteral makes the constructor a record declaration binds:
+// a function taking a value for each field, in order
+func evalRecordLiteral(node *parser.RecordLiteral) Object {
+	def := &RecordType{Name: node.Name, index: make(map[string]int, len(node.Fields))}
+	params := make([]Param, 0, len(node.Fields))
+	for _, field := range node.Fields {
+		if field == nil {
+			continue
+		}
+		def.index[field.Value] = len(def.Fields)
+		def.Fields = append(def.Fields, field.Value)
+		params = append(params, Param{Name: field.Value})
+	}
+
+	doc := node.Doc
+	if doc == "" {
+		doc = "Makes a " + def.Name + " record from its fields, in order: " + strings.Join(def.Fields, ", ") + "."
+	}
+	return &Builtin{
+		Name:   def.Name,
+		Params: params,
+		Doc:    doc,
+		Fn: func(args ...Object) Object {
+			return &Record{Def: def, Values: append([]Object{}, args...)}
+		},
+	}
+}
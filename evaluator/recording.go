@@ -0,0 +1,114 @@
+package evaluator
+
+import (
+	"gokid/parser"
+	"sort"
+	"sync"
+)
+
+// Recording keeps the history of a run: a log of every statement run and,
+// every few statements, a snapshot of the variables in scope. A debugger
+// reads it to step backwards, showing how the program's state evolved.
+// Values are recorded as shown, so later changes to an array or object
+// don't rewrite the past.
+type Recording struct {
+	every int // statements between snapshots
+	limit int // most statements kept, 0 for all
+
+	mu        sync.Mutex
+	steps     int // statements recorded so far
+	log       []Position
+	snapshots []recordedSnapshot
+}
+
+type recordedSnapshot struct {
+	step      int
+	variables map[string]string
+}
+
+// Frame is the state of a recorded run just before one of its statements
+type Frame struct {
+	Step     int // 1 for the first statement run
+	Position Position
+
+	// Variables are the variables in scope, as shown, at step Taken: the
+	// last snapshot at or before Step
+	Variables map[string]string
+	Taken     int
+}
+
+// NewRecording makes a recording that snapshots the variables before every
+// every-th statement, keeping the last limit statements, or all of them
+// when limit is 0
+func NewRecording(every, limit int) *Recording {
+	return &Recording{every: max(every, 1), limit: max(limit, 0)}
+}
+
+// SetRecording makes the interpreter record into r from its next
+// statement. Passing nil stops recording.
+func (e *Environment) SetRecording(r *Recording) {
+	e.session.recording = r
+}
+
+// Steps returns the first and last steps still held; first is past last
+// before anything is recorded
+func (r *Recording) Steps() (first, last int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.steps - len(r.log) + 1, r.steps
+}
+
+// At returns the frame of step. It reports false when the step was never
+// recorded, or is older than what the recording keeps.
+func (r *Recording) At(step int) (Frame, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	first := r.steps - len(r.log) + 1
+	if step < first || step > r.steps {
+		return Frame{}, false
+	}
+	f := Frame{Step: step, Position: r.log[step-first]}
+	i := sort.Search(len(r.snapshots), func(i int) bool { return r.snapshots[i].step > step })
+	if i > 0 {
+		f.Variables = r.snapshots[i-1].variables
+		f.Taken = r.snapshots[i-1].step
+	}
+	return f, true
+}
+
+// record logs stmt, about to run in env, and snapshots the variables in
+// scope when one is due
+func (r *Recording) record(stmt parser.Statement, env *Environment) {
+	pos := env.statementPosition(stmt)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.steps++
+	r.log = append(r.log, pos)
+	if (r.steps-1)%r.every == 0 {
+		r.snapshots = append(r.snapshots, recordedSnapshot{step: r.steps, variables: visibleVariables(env)})
+	}
+	if r.limit > 0 && len(r.log) > r.limit {
+		r.log = r.log[len(r.log)-r.limit:]
+		first := r.steps - len(r.log) + 1
+		// Keep the snapshot the oldest kept step reads from
+		i := sort.Search(len(r.snapshots), func(i int) bool { return r.snapshots[i].step > first })
+		if i > 1 {
+			r.snapshots = r.snapshots[i-1:]
+		}
+	}
+}
+
+// visibleVariables shows each variable in scope in env, where a variable
+// of an inner scope hides one of the same name further out
+func visibleVariables(env *Environment) map[string]string {
+	variables := map[string]string{}
+	for ; env != nil; env = env.outer {
+		for name, value := range env.Bindings() {
+			if _, ok := variables[name]; !ok {
+				variables[name] = value.Inspect()
+			}
+		}
+	}
+	return variables
+}
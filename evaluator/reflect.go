@@ -0,0 +1,87 @@
+package evaluator
+
+func init() {
+	registerModule("reflect", map[string]Object{
+		"arity": &Builtin{
+			Params: []Param{{Name: "fn", Types: callableTypes}},
+			Doc:    "Returns the number of arguments a function requires.",
+			Fn: func(args ...Object) Object {
+				switch fn := args[0].(type) {
+				case *Function:
+					return &Integer{Value: int64(len(fn.Parameters))}
+				case *Builtin:
+					min, _ := fn.Arity()
+					return &Integer{Value: int64(min)}
+				}
+				return NULL
+			},
+		},
+		"params": &Builtin{
+			Params: []Param{{Name: "fn", Types: callableTypes}},
+			Doc:    "Returns the parameter names of a function as an array of strings, with patterns as written.",
+			Fn: func(args ...Object) Object {
+				names := []Object{}
+				switch fn := args[0].(type) {
+				case *Function:
+					for _, name := range fn.parameterNames() {
+						names = append(names, &String{Value: name})
+					}
+				case *Builtin:
+					for _, param := range fn.Params {
+						names = append(names, &String{Value: param.Name})
+					}
+				}
+				return &Array{Elements: names}
+			},
+		},
+		"name": &Builtin{
+			Params: []Param{{Name: "fn", Types: callableTypes}},
+			Doc:    "Returns the name a function was defined with, or null for anonymous functions.",
+			Fn: func(args ...Object) Object {
+				var name string
+				switch fn := args[0].(type) {
+				case *Function:
+					name = fn.Name
+				case *Builtin:
+					name = fn.Name
+				}
+				if name == "" {
+					return NULL
+				}
+				return &String{Value: name}
+			},
+		},
+		"source": &Builtin{
+			Params: []Param{{Name: "fn", Types: callableTypes}},
+			Doc:    "Returns the source code of a function, or null for builtins.",
+			Fn: func(args ...Object) Object {
+				if fn, ok := args[0].(*Function); ok && fn.Source != "" {
+					return &String{Value: fn.Source}
+				}
+				return NULL
+			},
+		},
+		"location": &Builtin{
+			Params: []Param{{Name: "fn", Types: callableTypes}},
+			Doc:    "Returns where a function was defined as {path, line}, or null when unknown.",
+			Fn: func(args ...Object) Object {
+				fn, ok := args[0].(*Function)
+				if !ok || fn.Line == 0 {
+					return NULL
+				}
+				var path Object = NULL
+				if fn.Path != "" {
+					path = &String{Value: fn.Path}
+				}
+				return newHash(map[string]Object{"path": path, "line": &Integer{Value: int64(fn.Line)}})
+			},
+		},
+		"isBuiltin": &Builtin{
+			Params: []Param{{Name: "value"}},
+			Doc:    "Reports whether a value is a builtin function.",
+			Fn: func(args ...Object) Object {
+				return nativeBoolToPyMonkeyBool(args[0].Type() == BUILTIN_OBJ)
+			},
+		},
+	})
+}
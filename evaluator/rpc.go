@@ -0,0 +1,266 @@
+package evaluator
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcServerError    = -32000
+)
+
+func init() {
+	registerModule("rpc", map[string]Object{
+		"handler": &Builtin{
+			Params: []Param{{Name: "methods", Types: []ObjectType{HASH_OBJ}}},
+			Doc:    "Returns an HTTP handler that serves the functions in methods over JSON-RPC 2.0.",
+			Fn: func(args ...Object) Object {
+				return rpcHandler(args[0])
+			},
+		},
+		"serve": &Builtin{
+			Params: []Param{
+				{Name: "address", Types: []ObjectType{STRING_OBJ}},
+				{Name: "methods", Types: []ObjectType{HASH_OBJ}},
+			},
+			Doc: "Serves the functions in methods over JSON-RPC 2.0 at address until the program exits.",
+			sessionFn: func(s *session, args ...Object) Object {
+				handler := rpcHandler(args[1])
+				if isError(handler) {
+					return handler
+				}
+				server := newServer(s)
+				if err := server.Handle("/", handler); err != nil {
+					return err
+				}
+				return server.Listen(args[0].(*String).Value, "", "")
+			},
+		},
+		"call": &Builtin{
+			Params: []Param{
+				{Name: "url", Types: []ObjectType{STRING_OBJ}},
+				{Name: "method", Types: []ObjectType{STRING_OBJ}},
+				{Name: "args", Variadic: true},
+			},
+			Doc:        "Calls a remote JSON-RPC method with args and returns its result.",
+			sessionFn:  rpcCall,
+			capability: capHTTP,
+		},
+	})
+}
+
+// rpcHandler builds an HTTP handler exposing the functions of table
+// (name -> function) over JSON-RPC 2.0
+func rpcHandler(table Object) Object {
+	hash, ok := table.(*Hash)
+	if !ok {
+		return newCodedError(E_TYPE_MISMATCH, "rpc method table must be HASH, got %s", table.Type())
+	}
+
+	var names []string
+	var fns []Object
+	for _, pair := range sortedPairs(hash) {
+		if !isCallable(pair.Value) {
+			return newCodedError(E_TYPE_MISMATCH, "rpc method %s must be FUNCTION, got %s", pair.Key.Inspect(), pair.Value.Type())
+		}
+		names = append(names, pair.Key.Inspect())
+		fns = append(fns, pair.Value)
+	}
+
+	return closure(fns, func(fns []Object) BuiltinFunction {
+		methods := make(map[string]Object, len(names))
+		for i, name := range names {
+			methods[name] = fns[i]
+		}
+		return rpcServe(methods)
+	})
+}
+
+// rpcServe returns the function of an rpc handler serving methods
+func rpcServe(methods map[string]Object) BuiltinFunction {
+	return func(args ...Object) Object {
+		if err := checkArity("rpc handler", args, 1); err != nil {
+			return err
+		}
+		req, ok := args[0].(*Hash)
+		if !ok {
+			return newCodedError(E_TYPE_MISMATCH, "rpc handler request must be HASH, got %s", args[0].Type())
+		}
+		if method := hashGet(req, "method"); method == nil || method.Inspect() != "POST" {
+			return newHash(map[string]Object{
+				"status": &Integer{Value: 405},
+				"body":   &String{Value: "JSON-RPC requests must use POST"},
+			})
+		}
+
+		var body []byte
+		if value := hashGet(req, "body"); value != nil {
+			body = []byte(value.Inspect())
+		}
+		var response interface{}
+
+		decoded, err := decodeJSON(body)
+		switch batch := decoded.(type) {
+		case []interface{}:
+			if len(batch) == 0 {
+				// An empty batch is one invalid request, not no requests
+				response = rpcError(nil, rpcInvalidRequest, "invalid request")
+				break
+			}
+			responses := []interface{}{}
+			for _, call := range batch {
+				if resp := dispatchRPC(methods, call); resp != nil {
+					responses = append(responses, resp)
+				}
+			}
+			if len(responses) > 0 {
+				response = responses
+			}
+		default:
+			if err != nil {
+				response = rpcError(nil, rpcParseError, "parse error")
+			} else {
+				response = dispatchRPC(methods, decoded)
+			}
+		}
+
+		if response == nil {
+			return newHash(map[string]Object{"status": &Integer{Value: 204}})
+		}
+		data, _ := json.Marshal(response)
+		return newHash(map[string]Object{
+			"headers": newHash(map[string]Object{"Content-Type": &String{Value: "application/json"}}),
+			"body":    &String{Value: string(data)},
+		})
+	}
+}
+
+// dispatchRPC runs one call, returning nil for notifications
+func dispatchRPC(methods map[string]Object, call interface{}) interface{} {
+	request, ok := call.(map[string]interface{})
+	if !ok {
+		return rpcError(nil, rpcInvalidRequest, "invalid request")
+	}
+
+	id, hasID := request["id"]
+	name, ok := request["method"].(string)
+	if !ok {
+		return rpcError(id, rpcInvalidRequest, "invalid request")
+	}
+
+	fn, ok := methods[name]
+	if !ok {
+		if !hasID {
+			return nil
+		}
+		return rpcError(id, rpcMethodNotFound, "method not found: "+name)
+	}
+
+	args, err := rpcArguments(fn, request["params"])
+	if err != nil {
+		if !hasID {
+			return nil
+		}
+		return rpcError(id, rpcInvalidParams, err.Message)
+	}
+
+	result := applyFunction(fn, args)
+	if !hasID {
+		return nil
+	}
+	if errObj, ok := result.(*Error); ok {
+		return rpcError(id, rpcServerError, errObj.Message)
+	}
+
+	value, convErr := toJSONValue(result)
+	if convErr != nil {
+		return rpcError(id, rpcServerError, convErr.Error())
+	}
+	return map[string]interface{}{"jsonrpc": "2.0", "result": value, "id": id}
+}
+
+// rpcArguments converts positional params, or named params matched
+// against the function's parameter names
+func rpcArguments(fn Object, params interface{}) ([]Object, *Error) {
+	switch params := params.(type) {
+	case nil:
+		return []Object{}, nil
+	case []interface{}:
+		args := make([]Object, len(params))
+		for i, param := range params {
+			args[i] = fromJSONValue(param)
+		}
+		return args, nil
+	case map[string]interface{}:
+		function, ok := fn.(*Function)
+		if !ok {
+			return nil, newCodedError(E_VALUE, "named params require a GoKid function")
+		}
+		if function.Patterns != nil || function.Clauses != nil {
+			return nil, newCodedError(E_VALUE, "named params require a function with one clause and no patterns")
+		}
+		args := make([]Object, len(function.Parameters))
+		for i, param := range function.Parameters {
+			value, ok := params[param.Value]
+			if !ok {
+				return nil, newCodedError(E_VALUE, "missing param: %s", param.Value)
+			}
+			args[i] = fromJSONValue(value)
+		}
+		return args, nil
+	default:
+		return nil, newCodedError(E_VALUE, "params must be an array or object")
+	}
+}
+
+func rpcError(id interface{}, code int, message string) interface{} {
+	return map[string]interface{}{
+		"jsonrpc": "2.0",
+		"error":   map[string]interface{}{"code": code, "message": message},
+		"id":      id,
+	}
+}
+
+// rpcCall invokes a remote method: rpc.call(url, method, args...)
+func rpcCall(s *session, args ...Object) Object {
+	url := args[0].(*String)
+	name := args[1].(*String)
+
+	params := make([]interface{}, 0, len(args)-2)
+	for _, arg := range args[2:] {
+		value, err := toJSONValue(arg)
+		if err != nil {
+			return newCodedError(E_IO, "rpc: %s", err)
+		}
+		params = append(params, value)
+	}
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0", "method": name.Value, "params": params, "id": 1,
+	})
+
+	opts := defaultRequestOptions()
+	opts.headers["Content-Type"] = "application/json"
+	resp := doRequest(s.context(), "POST", url.Value, string(payload), opts)
+	if isError(resp) {
+		return resp
+	}
+
+	decoded, err := decodeJSON([]byte(hashGet(resp.(*Hash), "body").Inspect()))
+	if err != nil {
+		return newCodedError(E_IO, "rpc: invalid response: %s", strings.TrimSpace(err.Error()))
+	}
+	response, ok := decoded.(map[string]interface{})
+	if !ok {
+		return newCodedError(E_IO, "rpc: invalid response")
+	}
+	if rpcErr, ok := response["error"].(map[string]interface{}); ok {
+		return newCodedError(E_IO, "rpc: %v", rpcErr["message"])
+	}
+	return fromJSONValue(response["result"])
+}
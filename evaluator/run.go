@@ -0,0 +1,97 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"gokid/diagnostics"
+	"gokid/lexer"
+	"gokid/logging"
+	"gokid/parser"
+	"time"
+)
+
+// Exit statuses of a program run by gokid. The two failures use the codes
+// of BSD's sysexits.h, so scripts and CI can tell them apart; a program
+// that calls os.exit(n) exits with n.
+const (
+	ExitOK       = 0
+	ExitParse    = 65 // EX_DATAERR: the program doesn't parse
+	ExitUncaught = 70 // EX_SOFTWARE: the program raised an error nothing caught
+)
+
+// ParseError is returned by Run for a program that doesn't parse
+type ParseError struct {
+	Path        string
+	Diagnostics []diagnostics.Diagnostic
+}
+
+func (e *ParseError) Error() string {
+	message := "cannot parse program"
+	if e.Path != "" {
+		message = "cannot parse " + e.Path
+	}
+	if len(e.Diagnostics) > 0 {
+		message += ": " + e.Diagnostics[0].Message
+	}
+	return message
+}
+
+// ExitError is returned by Run when the program ends itself with os.exit,
+// whatever the status
+type ExitError struct {
+	Status int
+}
+
+func (e *ExitError) Error() string { return fmt.Sprintf("exit status %d", e.Status) }
+
+// Run parses source and runs it in env, as gokid runs a file, and returns
+// the program's value. It returns a *ParseError for source that doesn't
+// parse, an *ExitError when the program calls os.exit, and the *Error for
+// an error nothing caught, with the functions it passed out of in Stack.
+// Functions registered with os.atexit run before it returns, and an error
+// one of them raises is returned if the program itself succeeded. Nothing
+// is printed and the process never exits.
+func Run(env *Environment, source string) (Object, error) {
+	p := parser.New(lexer.NewLexer(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, &ParseError{Path: env.root().path, Diagnostics: p.Diagnostics()}
+	}
+
+	env.SetSource(source)
+	start := time.Now()
+	result := Eval(program, env)
+	logging.Debug("ran program", "path", env.root().path, "steps", env.Steps(), "duration", time.Since(start))
+	LogStats()
+	if err := env.RunExitHooks(); err != nil && !isError(result) {
+		result = err
+	}
+	env.Flush()
+	if err, ok := result.(*Error); ok {
+		if err.Code == E_EXIT {
+			return nil, &ExitError{Status: err.Status}
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+// ExitCode returns the status a process should exit with after Run
+// returned err. It also takes the *Error an Eval returned.
+func ExitCode(err error) int {
+	var parseErr *ParseError
+	var exitErr *ExitError
+	var evalErr *Error
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.As(err, &parseErr):
+		return ExitParse
+	case errors.As(err, &exitErr):
+		return exitErr.Status
+	case errors.As(err, &evalErr) && evalErr.Code == E_EXIT:
+		return evalErr.Status
+	default:
+		return ExitUncaught
+	}
+}
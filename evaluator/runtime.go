@@ -0,0 +1,114 @@
+package evaluator
+
+import (
+	"gokid/logging"
+	"runtime"
+	"time"
+)
+
+func init() {
+	registerModule("runtime", map[string]Object{
+		"stats": &Builtin{
+			Doc: "Returns counts of the values reachable from the current scope by type, the number of statements evaluated and Go memory statistics.",
+			EnvFn: func(env *Environment, args ...Object) Object {
+				counts := make(map[string]Object)
+				for t, n := range countObjects(env) {
+					counts[string(t)] = &Integer{Value: int64(n)}
+				}
+
+				var mem runtime.MemStats
+				runtime.ReadMemStats(&mem)
+
+				return newHash(map[string]Object{
+					"objects": newHash(counts),
+					"steps":   &Integer{Value: int64(env.Steps())},
+					"memory": newHash(map[string]Object{
+						"heapAlloc":   &Integer{Value: int64(mem.HeapAlloc)},
+						"heapObjects": &Integer{Value: int64(mem.HeapObjects)},
+						"totalAlloc":  &Integer{Value: int64(mem.TotalAlloc)},
+						"sys":         &Integer{Value: int64(mem.Sys)},
+						"numGC":       &Integer{Value: int64(mem.NumGC)},
+					}),
+				})
+			},
+		},
+		"moduleStats": &Builtin{
+			Doc:   "Returns what the code of each file has used since the program first imported a module: statements run, heap bytes allocated and milliseconds, the busiest file first.",
+			EnvFn: func(env *Environment, args ...Object) Object { return moduleStats(env) },
+		},
+		"counters": &Builtin{
+			Doc:   "Returns the interpreter's named counters: register(names...), inc(name, n?), get(name), all() and reset(). gokid run --stats prints them at exit.",
+			EnvFn: func(env *Environment, args ...Object) Object { return env.Counters() },
+		},
+		"gc": &Builtin{
+			Doc: "Runs the Go garbage collector and returns the number of heap bytes it freed.",
+			Fn: func(args ...Object) Object {
+				var before, after runtime.MemStats
+				runtime.ReadMemStats(&before)
+				start := time.Now()
+				runtime.GC()
+				elapsed := time.Since(start)
+				runtime.ReadMemStats(&after)
+
+				freed := int64(before.HeapAlloc) - int64(after.HeapAlloc)
+				if freed < 0 {
+					freed = 0
+				}
+				logging.Debug("gc", "freed", freed, "heapAlloc", after.HeapAlloc, "duration", elapsed)
+				return &Integer{Value: freed}
+			},
+		},
+	})
+}
+
+// countObjects counts the values reachable from env and its outer scopes
+// by type, following array elements, hash keys and values, module members
+// and the scopes functions close over. Each value is counted once.
+func countObjects(env *Environment) map[ObjectType]int {
+	counts := make(map[ObjectType]int)
+	seen := make(map[Object]bool)
+	scopes := make(map[*Environment]bool)
+
+	var visitScope func(env *Environment)
+	var visit func(obj Object)
+	visit = func(obj Object) {
+		if obj == nil || seen[obj] {
+			return
+		}
+		seen[obj] = true
+		counts[obj.Type()]++
+
+		switch obj := obj.(type) {
+		case *Array:
+			for _, element := range obj.Elements {
+				visit(element)
+			}
+		case *Hash:
+			for _, pair := range obj.Pairs {
+				visit(pair.Key)
+				visit(pair.Value)
+			}
+		case *Record:
+			for _, value := range obj.Values {
+				visit(value)
+			}
+		case *Module:
+			for _, member := range obj.Members {
+				visit(member)
+			}
+		case *Function:
+			visitScope(obj.Env)
+		}
+	}
+	visitScope = func(env *Environment) {
+		for ; env != nil && !scopes[env]; env = env.outer {
+			scopes[env] = true
+			for _, value := range env.Bindings() {
+				visit(value)
+			}
+		}
+	}
+
+	visitScope(env)
+	return counts
+}
@@ -0,0 +1,213 @@
+package evaluator
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	registerModule("schema", map[string]Object{
+		"validate": &Builtin{
+			Params: []Param{{Name: "data"}, {Name: "schema", Types: []ObjectType{HASH_OBJ}}},
+			Doc:    "Checks data against a schema and returns an array of {path, message} problems, empty when data is valid.",
+			Fn: func(args ...Object) Object {
+				problems := []Object{}
+				if err := validateSchema(args[0], args[1].(*Hash), []Object{}, &problems); err != nil {
+					return err
+				}
+				return &Array{Elements: problems}
+			},
+		},
+	})
+}
+
+// schemaKeys are the rules a schema may contain
+var schemaKeys = map[string]bool{
+	"type": true, "enum": true, "min": true, "max": true, "minLength": true,
+	"maxLength": true, "required": true, "properties": true, "items": true,
+}
+
+// validateSchema appends a problem for every rule value breaks, with the
+// path of keys and indexes that leads to it. An error is returned only
+// when the schema itself is invalid.
+func validateSchema(value Object, schema *Hash, path []Object, problems *[]Object) *Error {
+	report := func(format string, a ...interface{}) {
+		*problems = append(*problems, newHash(map[string]Object{
+			"path":    &Array{Elements: append([]Object{}, path...)},
+			"message": &String{Value: fmt.Sprintf(format, a...)},
+		}))
+	}
+
+	for _, pair := range sortedPairs(schema) {
+		key, ok := pair.Key.(*String)
+		if !ok || !schemaKeys[key.Value] {
+			return newCodedError(E_VALUE, "invalid schema: unknown rule %s", pair.Key.Inspect())
+		}
+	}
+
+	if rule := hashGet(schema, "type"); rule != nil {
+		names, err := schemaTypeNames(rule)
+		if err != nil {
+			return err
+		}
+		if !schemaTypeMatches(value, names) {
+			report("expected %s, got %s", strings.Join(names, " or "), value.Type())
+			// The remaining rules assume the right type
+			return nil
+		}
+	}
+
+	if rule := hashGet(schema, "enum"); rule != nil {
+		options, ok := rule.(*Array)
+		if !ok {
+			return newCodedError(E_VALUE, "invalid schema: enum must be an ARRAY, got %s", rule.Type())
+		}
+		found := false
+		for _, option := range options.Elements {
+			if isTruthy(evalInfixExpression("==", value, option)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			report("must be one of %s", options.Inspect())
+		}
+	}
+
+	for _, bound := range []string{"min", "max"} {
+		rule := hashGet(schema, bound)
+		if rule == nil || !isNumber(value) {
+			continue
+		}
+		if !isNumber(rule) {
+			return newCodedError(E_VALUE, "invalid schema: %s must be a number, got %s", bound, rule.Type())
+		}
+		if bound == "min" && toFloat(value) < toFloat(rule) {
+			report("must be at least %s", rule.Inspect())
+		}
+		if bound == "max" && toFloat(value) > toFloat(rule) {
+			report("must be at most %s", rule.Inspect())
+		}
+	}
+
+	for _, bound := range []string{"minLength", "maxLength"} {
+		rule := hashGet(schema, bound)
+		if rule == nil {
+			continue
+		}
+		limit, ok := rule.(*Integer)
+		if !ok {
+			return newCodedError(E_VALUE, "invalid schema: %s must be an INTEGER, got %s", bound, rule.Type())
+		}
+		var length int64
+		switch value := value.(type) {
+		case *String:
+			length = int64(len(value.Value))
+		case *Array:
+			length = int64(len(value.Elements))
+		default:
+			continue
+		}
+		if bound == "minLength" && length < limit.Value {
+			report("length must be at least %d, got %d", limit.Value, length)
+		}
+		if bound == "maxLength" && length > limit.Value {
+			report("length must be at most %d, got %d", limit.Value, length)
+		}
+	}
+
+	if hash, ok := value.(*Hash); ok {
+		if rule := hashGet(schema, "required"); rule != nil {
+			required, ok := rule.(*Array)
+			if !ok {
+				return newCodedError(E_VALUE, "invalid schema: required must be an ARRAY, got %s", rule.Type())
+			}
+			for _, key := range required.Elements {
+				field := evalHashIndexExpression(hash, key)
+				if isError(field) || field == NULL {
+					report("missing required key %s", key.Inspect())
+				}
+			}
+		}
+
+		if rule := hashGet(schema, "properties"); rule != nil {
+			properties, ok := rule.(*Hash)
+			if !ok {
+				return newCodedError(E_VALUE, "invalid schema: properties must be a HASH, got %s", rule.Type())
+			}
+			for _, pair := range sortedPairs(properties) {
+				nested, ok := pair.Value.(*Hash)
+				if !ok {
+					return newCodedError(E_VALUE, "invalid schema: property %s must be a HASH, got %s", pair.Key.Inspect(), pair.Value.Type())
+				}
+				field := evalHashIndexExpression(hash, pair.Key)
+				if isError(field) || field == NULL {
+					continue
+				}
+				if err := validateSchema(field, nested, append(path, pair.Key), problems); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if arr, ok := value.(*Array); ok {
+		if rule := hashGet(schema, "items"); rule != nil {
+			items, ok := rule.(*Hash)
+			if !ok {
+				return newCodedError(E_VALUE, "invalid schema: items must be a HASH, got %s", rule.Type())
+			}
+			for i, element := range arr.Elements {
+				if err := validateSchema(element, items, append(path, &Integer{Value: int64(i)}), problems); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// schemaTypeNames reads a type rule, which is a type name or an array of
+// them
+func schemaTypeNames(rule Object) ([]string, *Error) {
+	switch rule := rule.(type) {
+	case *String:
+		return []string{rule.Value}, nil
+	case *Array:
+		names := make([]string, 0, len(rule.Elements))
+		for _, element := range rule.Elements {
+			name, ok := element.(*String)
+			if !ok {
+				return nil, newCodedError(E_VALUE, "invalid schema: type names must be STRING, got %s", element.Type())
+			}
+			names = append(names, name.Value)
+		}
+		return names, nil
+	}
+	return nil, newCodedError(E_VALUE, "invalid schema: type must be a STRING or ARRAY, got %s", rule.Type())
+}
+
+// schemaTypeMatches accepts the type names of type switches, such as "int"
+// and "object", as well as "number" and "any"
+func schemaTypeMatches(value Object, names []string) bool {
+	for _, name := range names {
+		switch name {
+		case "any":
+			return true
+		case "number":
+			if isNumber(value) {
+				return true
+			}
+			continue
+		}
+		types, ok := typeNames[name]
+		if !ok {
+			types = []ObjectType{ObjectType(strings.ToUpper(name))}
+		}
+		if hasType(types, value.Type()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,290 @@
+package evaluator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gokid/lexer"
+	"gokid/parser"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	registerBuiltin(&Builtin{
+		Name:   "serialize",
+		Params: []Param{{Name: "value"}},
+		Doc:    "Encodes a value, functions included, as a JSON string.",
+		Fn: func(args ...Object) Object {
+			data, err := Serialize(args[0])
+			if err != nil {
+				return newCodedError(E_VALUE, "serialize: %s", err)
+			}
+			return &String{Value: string(data)}
+		},
+	})
+	registerBuiltin(&Builtin{
+		Name:   "deserialize",
+		Params: []Param{{Name: "data", Types: []ObjectType{STRING_OBJ}}},
+		Doc:    "Decodes a value encoded by serialize.",
+		Fn: func(args ...Object) Object {
+			data := args[0].(*String)
+			obj, err := Deserialize([]byte(data.Value), NewEnvironment())
+			if err != nil {
+				return newCodedError(E_VALUE, "deserialize: %s", err)
+			}
+			return obj
+		},
+	})
+}
+
+// Serialize encodes a value as a compact JSON envelope
+func Serialize(obj Object) ([]byte, error) {
+	encoded, err := encodeValue(obj, map[Object]bool{})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(encoded)
+}
+
+// Deserialize decodes a value written by Serialize. Functions are
+// rebuilt from their source in env.
+func Deserialize(data []byte, env *Environment) (Object, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var encoded encodedValue
+	if err := decoder.Decode(&encoded); err != nil {
+		return nil, err
+	}
+	return decodeValue(encoded, env)
+}
+
+// encodedValue is the JSON envelope for one GoKid value. Floats are kept as
+// strings so they round-trip exactly, and functions as their source.
+type encodedValue struct {
+	Type   ObjectType     `json:"type"`
+	Value  interface{}    `json:"value,omitempty"`
+	Items  []encodedValue `json:"items,omitempty"`
+	Pairs  []encodedPair  `json:"pairs,omitempty"`
+	Source string         `json:"source,omitempty"`
+}
+
+type encodedPair struct {
+	Key   encodedValue `json:"key"`
+	Value encodedValue `json:"value"`
+}
+
+// errCyclic is the error for a value that contains itself, which the
+// envelope has no way to write
+var errCyclic = errors.New("cannot serialize cyclic value")
+
+// encodeValue encodes obj; visiting holds the arrays and hashes obj is
+// inside of, so one that contains itself is an error rather than endless
+func encodeValue(obj Object, visiting map[Object]bool) (encodedValue, error) {
+	switch obj.(type) {
+	case *Array, *Hash:
+		if visiting[obj] {
+			return encodedValue{}, errCyclic
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+	}
+
+	switch obj := obj.(type) {
+	case *Integer:
+		return encodedValue{Type: INTEGER_OBJ, Value: obj.Value}, nil
+	case *Float:
+		return encodedValue{Type: FLOAT_OBJ, Value: strconv.FormatFloat(obj.Value, 'g', -1, 64)}, nil
+	case *String:
+		return encodedValue{Type: STRING_OBJ, Value: obj.Value}, nil
+	case *Symbol:
+		return encodedValue{Type: SYMBOL_OBJ, Value: obj.Name}, nil
+	case *Boolean:
+		return encodedValue{Type: BOOLEAN_OBJ, Value: obj.Value}, nil
+	case *Null:
+		return encodedValue{Type: NULL_OBJ}, nil
+	case *Array:
+		items := make([]encodedValue, 0, len(obj.Elements))
+		for _, el := range obj.Elements {
+			item, err := encodeValue(el, visiting)
+			if err != nil {
+				return encodedValue{}, err
+			}
+			items = append(items, item)
+		}
+		return encodedValue{Type: ARRAY_OBJ, Items: items}, nil
+	case *Hash:
+		pairs := make([]encodedPair, 0, len(obj.Pairs))
+		for _, pair := range sortedPairs(obj) {
+			key, err := encodeValue(pair.Key, visiting)
+			if err != nil {
+				return encodedValue{}, err
+			}
+			value, err := encodeValue(pair.Value, visiting)
+			if err != nil {
+				return encodedValue{}, err
+			}
+			pairs = append(pairs, encodedPair{Key: key, Value: value})
+		}
+		return encodedValue{Type: HASH_OBJ, Pairs: pairs}, nil
+	case *Function:
+		if obj.Source == "" {
+			return encodedValue{}, fmt.Errorf("function source is not available")
+		}
+		if obj.Clauses != nil {
+			return encodedValue{}, fmt.Errorf("cannot serialize a function declared in clauses")
+		}
+		return encodedValue{Type: FUNCTION_OBJ, Source: obj.Source}, nil
+	}
+	return encodedValue{}, fmt.Errorf("cannot serialize %s", obj.Type())
+}
+
+// decodeValue rebuilds a value. Functions are evaluated from their source
+// in env, so they close over env rather than their original scope.
+func decodeValue(v encodedValue, env *Environment) (Object, error) {
+	switch v.Type {
+	case INTEGER_OBJ:
+		n, ok := v.Value.(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("invalid INTEGER value")
+		}
+		i, err := n.Int64()
+		if err != nil {
+			return nil, err
+		}
+		return &Integer{Value: i}, nil
+	case FLOAT_OBJ:
+		s, ok := v.Value.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid FLOAT value")
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, err
+		}
+		return &Float{Value: f}, nil
+	case STRING_OBJ:
+		s, _ := v.Value.(string)
+		return &String{Value: s}, nil
+	case SYMBOL_OBJ:
+		name, _ := v.Value.(string)
+		return Intern(name), nil
+	case BOOLEAN_OBJ:
+		b, _ := v.Value.(bool)
+		return nativeBoolToPyMonkeyBool(b), nil
+	case NULL_OBJ:
+		return NULL, nil
+	case ARRAY_OBJ:
+		elements := make([]Object, 0, len(v.Items))
+		for _, item := range v.Items {
+			el, err := decodeValue(item, env)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, el)
+		}
+		return &Array{Elements: elements}, nil
+	case HASH_OBJ:
+		pairs := make(map[HashKey]HashPair, len(v.Pairs))
+		for _, p := range v.Pairs {
+			key, err := decodeValue(p.Key, env)
+			if err != nil {
+				return nil, err
+			}
+			hashKey, keyErr := hashKeyOf(key)
+			if keyErr != nil {
+				return nil, errors.New(keyErr.Message)
+			}
+			value, err := decodeValue(p.Value, env)
+			if err != nil {
+				return nil, err
+			}
+			pairs[hashKey] = HashPair{Key: key, Value: value}
+		}
+		return &Hash{Pairs: pairs}, nil
+	case FUNCTION_OBJ:
+		return decodeFunction(v.Source, env)
+	}
+	return nil, fmt.Errorf("unknown value type %q", v.Type)
+}
+
+func decodeFunction(source string, env *Environment) (Object, error) {
+	p := parser.New(lexer.NewLexer(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, fmt.Errorf("invalid function source: %s", strings.Join(p.Errors(), "; "))
+	}
+	if len(program.Statements) != 1 {
+		return nil, fmt.Errorf("invalid function source")
+	}
+	stmt, ok := program.Statements[0].(*parser.ExpressionStatement)
+	if !ok {
+		return nil, fmt.Errorf("invalid function source")
+	}
+	if _, ok := stmt.Expression.(*parser.FunctionLiteral); !ok {
+		return nil, fmt.Errorf("invalid function source")
+	}
+	return Eval(stmt.Expression, env), nil
+}
+
+// savedSession is the file format written by SaveSession
+type savedSession struct {
+	Version  int                     `json:"version"`
+	Bindings map[string]encodedValue `json:"bindings"`
+}
+
+// SaveSession writes the bindings of env to w. Values that cannot be
+// serialized, such as builtins, modules and arrays that contain
+// themselves, are skipped; each is returned as its name and the reason,
+// such as "a (cannot serialize cyclic value)".
+func SaveSession(env *Environment, w io.Writer) ([]string, error) {
+	saved := savedSession{Version: 1, Bindings: map[string]encodedValue{}}
+	skipped := []string{}
+	for name, value := range env.Bindings() {
+		encoded, err := encodeValue(value, map[Object]bool{})
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s (%s)", name, err))
+			continue
+		}
+		saved.Bindings[name] = encoded
+	}
+	sort.Strings(skipped)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return skipped, encoder.Encode(saved)
+}
+
+// LoadSession restores bindings written by SaveSession into env and
+// returns their names
+func LoadSession(env *Environment, r io.Reader) ([]string, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+
+	var saved savedSession
+	if err := decoder.Decode(&saved); err != nil {
+		return nil, err
+	}
+	if saved.Version != 1 {
+		return nil, fmt.Errorf("unsupported session version %d", saved.Version)
+	}
+
+	names := make([]string, 0, len(saved.Bindings))
+	for name := range saved.Bindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value, err := decodeValue(saved.Bindings[name], env)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		env.Set(name, value)
+	}
+	return names, nil
+}
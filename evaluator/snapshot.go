@@ -0,0 +1,57 @@
+package evaluator
+
+import "sort"
+
+// Snapshot records the variables bound in an environment at one moment,
+// to compare against later
+type Snapshot struct {
+	values map[string]Object
+	shown  map[string]string
+}
+
+// Change describes a variable that differs between a snapshot and the
+// environment it was taken from. Kind is "added", "changed" or "removed".
+// Old and New are the values as shown; Old is empty for added variables
+// and New for removed ones.
+type Change struct {
+	Name string
+	Kind string
+	Old  string
+	New  string
+}
+
+// Snapshot records the variables bound in env itself. Values are also
+// recorded as shown, so arrays and objects changed in place count as
+// changed.
+func (e *Environment) Snapshot() *Snapshot {
+	s := &Snapshot{values: e.Bindings()}
+	s.shown = make(map[string]string, len(s.values))
+	for name, value := range s.values {
+		s.shown[name] = value.Inspect()
+	}
+	return s
+}
+
+// Diff lists the variables of env that were added, changed or removed
+// since s was taken, sorted by name
+func (s *Snapshot) Diff(env *Environment) []Change {
+	var changes []Change
+	current := env.Bindings()
+	for name, value := range current {
+		old, ok := s.values[name]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Name: name, Kind: "added", New: value.Inspect()})
+		case old != value || s.shown[name] != value.Inspect():
+			changes = append(changes, Change{Name: name, Kind: "changed", Old: s.shown[name], New: value.Inspect()})
+		}
+	}
+	for name := range s.values {
+		if _, ok := current[name]; !ok {
+			changes = append(changes, Change{Name: name, Kind: "removed", Old: s.shown[name]})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
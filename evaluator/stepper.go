@@ -0,0 +1,108 @@
+package evaluator
+
+import "gokid/parser"
+
+// Stepper runs a program one pause point at a time, letting hosts such as
+// visualizers animate execution. The program runs on its own goroutine and
+// blocks before every n-th statement until Next is called again.
+type Stepper struct {
+	program *parser.Program
+	env     *Environment
+
+	resume chan bool
+	paused chan parser.Statement
+	done   chan Object
+
+	current  parser.Statement
+	result   Object
+	started  bool
+	finished bool
+	stopped  bool
+}
+
+// NewStepper prepares program for step-wise evaluation in env, pausing
+// before every n-th statement
+func NewStepper(program *parser.Program, env *Environment, n int) *Stepper {
+	s := &Stepper{
+		program: program,
+		env:     env,
+		resume:  make(chan bool),
+		paused:  make(chan parser.Statement),
+		done:    make(chan Object, 1),
+	}
+
+	env.SetStepHook(n, func(step int, stmt parser.Statement, env *Environment) bool {
+		if s.stopped {
+			return false
+		}
+		s.paused <- stmt
+		if !<-s.resume {
+			s.stopped = true
+			return false
+		}
+		return true
+	})
+
+	return s
+}
+
+// Next runs the program until the next pause point. It returns false once
+// the program has finished, after which Result holds its final value.
+func (s *Stepper) Next() bool {
+	if s.finished {
+		return false
+	}
+
+	if !s.started {
+		s.started = true
+		go func() {
+			s.done <- Eval(s.program, s.env)
+		}()
+	} else {
+		s.resume <- true
+	}
+
+	select {
+	case stmt := <-s.paused:
+		s.current = stmt
+		return true
+	case result := <-s.done:
+		s.finish(result)
+		return false
+	}
+}
+
+// Statement returns the statement about to be evaluated at the current pause
+func (s *Stepper) Statement() parser.Statement {
+	return s.current
+}
+
+// Env returns the environment the program is evaluated in
+func (s *Stepper) Env() *Environment {
+	return s.env
+}
+
+// Result returns the program's final value once stepping has finished
+func (s *Stepper) Result() Object {
+	return s.result
+}
+
+// Stop abandons a paused program
+func (s *Stepper) Stop() {
+	if s.finished {
+		return
+	}
+	if s.started {
+		s.resume <- false
+		s.finish(<-s.done)
+		return
+	}
+	s.finish(NULL)
+}
+
+func (s *Stepper) finish(result Object) {
+	s.result = result
+	s.current = nil
+	s.finished = true
+	s.env.SetStepHook(1, nil)
+}
@@ -0,0 +1,168 @@
+package evaluator
+
+import "slices"
+
+const STREAM_OBJ = "STREAM"
+
+func init() {
+	registerBuiltin(&Builtin{
+		Name:   "stream",
+		Params: []Param{{Name: "source", Types: []ObjectType{ARRAY_OBJ, FUNCTION_OBJ, BUILTIN_OBJ}}},
+		Doc:    "Creates a lazy stream over an array, or over source(0), source(1), ... when given a function.",
+		Fn: func(args ...Object) Object {
+			switch source := args[0].(type) {
+			case *Array:
+				// The stream reads the array as it was when the stream
+				// was made, whatever happens to it before it is consumed
+				elements := slices.Clone(source.Elements)
+				i := 0
+				return &Stream{next: func() Object {
+					if i >= len(elements) {
+						return nil
+					}
+					i++
+					return elements[i-1]
+				}}
+			default:
+				var i int64
+				return &Stream{next: func() Object {
+					i++
+					return applyFunction(source, []Object{&Integer{Value: i - 1}})
+				}}
+			}
+		},
+	})
+}
+
+// Stream object is a lazy sequence. Operations like map and filter wrap it
+// in another stream, and no work is done until values are pulled out by
+// collect or forEach. A stream can be consumed once.
+type Stream struct {
+	// next returns the next value, an error, or nil when the stream ends
+	next func() Object
+}
+
+func (s *Stream) Type() ObjectType { return STREAM_OBJ }
+func (s *Stream) Inspect() string  { return "stream" }
+
+func (s *Stream) Member(name string) (Object, bool) {
+	switch name {
+	case "map":
+		return method(func(args ...Object) Object {
+			if err := checkCallback("map", args); err != nil {
+				return err
+			}
+			return &Stream{next: func() Object {
+				value := s.next()
+				if value == nil || isError(value) {
+					return value
+				}
+				return applyFunction(args[0], []Object{value})
+			}}
+		}), true
+	case "filter":
+		return method(func(args ...Object) Object {
+			if err := checkCallback("filter", args); err != nil {
+				return err
+			}
+			return &Stream{next: func() Object {
+				for {
+					value := s.next()
+					if value == nil || isError(value) {
+						return value
+					}
+					keep := applyFunction(args[0], []Object{value})
+					if isError(keep) {
+						return keep
+					}
+					if isTruthy(keep) {
+						return value
+					}
+				}
+			}}
+		}), true
+	case "take":
+		return method(func(args ...Object) Object {
+			n, err := streamCount("take", args)
+			if err != nil {
+				return err
+			}
+			return &Stream{next: func() Object {
+				if n <= 0 {
+					return nil
+				}
+				n--
+				return s.next()
+			}}
+		}), true
+	case "skip":
+		return method(func(args ...Object) Object {
+			n, err := streamCount("skip", args)
+			if err != nil {
+				return err
+			}
+			return &Stream{next: func() Object {
+				for ; n > 0; n-- {
+					value := s.next()
+					if value == nil || isError(value) {
+						return value
+					}
+				}
+				return s.next()
+			}}
+		}), true
+	case "collect":
+		return method(func(args ...Object) Object {
+			if err := checkArity("collect", args, 0); err != nil {
+				return err
+			}
+			elements := []Object{}
+			for value := s.next(); value != nil; value = s.next() {
+				if isError(value) {
+					return value
+				}
+				elements = append(elements, value)
+			}
+			return &Array{Elements: elements}
+		}), true
+	case "forEach":
+		return method(func(args ...Object) Object {
+			if err := checkCallback("forEach", args); err != nil {
+				return err
+			}
+			for value := s.next(); value != nil; value = s.next() {
+				if isError(value) {
+					return value
+				}
+				if result := applyFunction(args[0], []Object{value}); isError(result) {
+					return result
+				}
+			}
+			return NULL
+		}), true
+	}
+	return nil, false
+}
+
+// checkCallback checks that a method was given a single function
+func checkCallback(name string, args []Object) *Error {
+	if err := checkArity(name, args, 1); err != nil {
+		return err
+	}
+	if !hasType(callableTypes, args[0].Type()) {
+		return newCodedError(E_TYPE_MISMATCH, "argument to `%s` must be %s, got %s", name, joinTypes(callableTypes), args[0].Type())
+	}
+	return nil
+}
+
+// streamCount reads the non-negative count given to take or skip
+func streamCount(name string, args []Object) (int64, *Error) {
+	if err := checkArity(name, args, 1); err != nil {
+		return 0, err
+	}
+	n, ok := args[0].(*Integer)
+	if !ok || n.Value < 0 {
+		return 0, newCodedError(E_VALUE, "argument to `%s` must be a non-negative INTEGER, got %s", name, args[0].Inspect())
+	}
+	return n.Value, nil
+}
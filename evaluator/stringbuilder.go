@@ -0,0 +1,69 @@
+package evaluator
+
+import (
+	"fmt"
+	"strings"
+)
+
+const STRING_BUILDER_OBJ = "STRING_BUILDER"
+
+func init() {
+	registerBuiltin(&Builtin{
+		Name:   "stringBuilder",
+		Params: []Param{{Name: "initial", Types: []ObjectType{STRING_OBJ}, Optional: true}},
+		Doc:    "Creates a string builder, for building a long string from many pieces in linear time.",
+		Fn: func(args ...Object) Object {
+			sb := &StringBuilder{}
+			if len(args) == 1 {
+				sb.builder.WriteString(args[0].(*String).Value)
+			}
+			return sb
+		},
+	})
+}
+
+// StringBuilder object accumulates a string. Appending copies only the new
+// piece, unlike repeated string concatenation.
+type StringBuilder struct {
+	builder strings.Builder
+}
+
+func (sb *StringBuilder) Type() ObjectType { return STRING_BUILDER_OBJ }
+func (sb *StringBuilder) Inspect() string {
+	return fmt.Sprintf("stringBuilder(%d bytes)", sb.builder.Len())
+}
+
+func (sb *StringBuilder) Member(name string) (Object, bool) {
+	switch name {
+	case "append":
+		return method(func(args ...Object) Object {
+			for _, arg := range args {
+				sb.builder.WriteString(arg.Inspect())
+			}
+			return sb
+		}), true
+	case "toString":
+		return method(func(args ...Object) Object {
+			if err := checkArity("toString", args, 0); err != nil {
+				return err
+			}
+			return &String{Value: sb.builder.String()}
+		}), true
+	case "length":
+		return method(func(args ...Object) Object {
+			if err := checkArity("length", args, 0); err != nil {
+				return err
+			}
+			return &Integer{Value: int64(sb.builder.Len())}
+		}), true
+	case "reset":
+		return method(func(args ...Object) Object {
+			if err := checkArity("reset", args, 0); err != nil {
+				return err
+			}
+			sb.builder.Reset()
+			return sb
+		}), true
+	}
+	return nil, false
+}
@@ -0,0 +1,193 @@
+package evaluator
+
+import (
+	"html"
+	"strings"
+)
+
+func init() {
+	registerModule("template", map[string]Object{
+		"render": &Builtin{
+			Params: []Param{{Name: "template", Types: []ObjectType{STRING_OBJ}}, {Name: "data"}},
+			Doc:    "Renders a mustache-style template, filling {{name}} tags from data.",
+			Fn: func(args ...Object) Object {
+				nodes, err := parseTemplate(args[0].(*String).Value)
+				if err != nil {
+					return err
+				}
+
+				var out strings.Builder
+				renderTemplate(&out, nodes, []Object{args[1]})
+				return &String{Value: out.String()}
+			},
+		},
+	})
+}
+
+// templateNode is one piece of a parsed mustache-style template
+type templateNode struct {
+	text     string // literal text when name is empty
+	name     string
+	raw      bool // {{{name}}} or {{&name}} skip HTML escaping
+	section  bool // {{#name}}...{{/name}}
+	inverted bool // {{^name}}...{{/name}}
+	children []*templateNode
+}
+
+func parseTemplate(src string) ([]*templateNode, *Error) {
+	root := &templateNode{section: true}
+	stack := []*templateNode{root}
+
+	for len(src) > 0 {
+		start := strings.Index(src, "{{")
+		if start < 0 {
+			start = len(src)
+		}
+		current := stack[len(stack)-1]
+		if start > 0 {
+			current.children = append(current.children, &templateNode{text: src[:start]})
+		}
+		if start == len(src) {
+			break
+		}
+		src = src[start+2:]
+
+		closing := "}}"
+		if strings.HasPrefix(src, "{") {
+			closing = "}}}"
+		}
+		end := strings.Index(src, closing)
+		if end < 0 {
+			return nil, newCodedError(E_VALUE, "template: unclosed tag")
+		}
+		tag := src[:end]
+		src = src[end+len(closing):]
+
+		if closing == "}}}" {
+			name := strings.TrimSpace(tag[1:])
+			current.children = append(current.children, &templateNode{name: name, raw: true})
+			continue
+		}
+
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			return nil, newCodedError(E_VALUE, "template: empty tag")
+		}
+
+		switch tag[0] {
+		case '!':
+			// Comment
+		case '#', '^':
+			node := &templateNode{
+				name:     strings.TrimSpace(tag[1:]),
+				section:  true,
+				inverted: tag[0] == '^',
+			}
+			current.children = append(current.children, node)
+			stack = append(stack, node)
+		case '/':
+			name := strings.TrimSpace(tag[1:])
+			if len(stack) == 1 || current.name != name {
+				return nil, newCodedError(E_VALUE, "template: unexpected closing tag {{/%s}}", name)
+			}
+			stack = stack[:len(stack)-1]
+		case '&':
+			current.children = append(current.children, &templateNode{name: strings.TrimSpace(tag[1:]), raw: true})
+		default:
+			current.children = append(current.children, &templateNode{name: tag})
+		}
+	}
+
+	if len(stack) > 1 {
+		return nil, newCodedError(E_VALUE, "template: unclosed section {{#%s}}", stack[len(stack)-1].name)
+	}
+
+	return root.children, nil
+}
+
+func renderTemplate(out *strings.Builder, nodes []*templateNode, context []Object) {
+	for _, node := range nodes {
+		switch {
+		case node.name == "":
+			out.WriteString(node.text)
+
+		case node.section:
+			value := lookupTemplateName(node.name, context)
+			items := templateSectionItems(value)
+			if node.inverted {
+				if len(items) == 0 {
+					renderTemplate(out, node.children, context)
+				}
+				continue
+			}
+			for _, item := range items {
+				renderTemplate(out, node.children, append(context, item))
+			}
+
+		default:
+			value := lookupTemplateName(node.name, context)
+			if value == nil || value == NULL {
+				continue
+			}
+			text := value.Inspect()
+			if !node.raw {
+				text = html.EscapeString(text)
+			}
+			out.WriteString(text)
+		}
+	}
+}
+
+// templateSectionItems returns the contexts a section renders with:
+// one per array element, none for falsy values, or the value itself
+func templateSectionItems(value Object) []Object {
+	if value == nil {
+		return nil
+	}
+	if arr, ok := value.(*Array); ok {
+		return arr.Elements
+	}
+	if !isTruthy(value) {
+		return nil
+	}
+	return []Object{value}
+}
+
+// lookupTemplateName resolves a dotted name against the context stack,
+// innermost first. "." refers to the current item.
+func lookupTemplateName(name string, context []Object) Object {
+	if name == "." {
+		return context[len(context)-1]
+	}
+
+	parts := strings.Split(name, ".")
+	for i := len(context) - 1; i >= 0; i-- {
+		value := templateMember(context[i], parts[0])
+		if value == nil {
+			continue
+		}
+		for _, part := range parts[1:] {
+			value = templateMember(value, part)
+			if value == nil {
+				return nil
+			}
+		}
+		return value
+	}
+	return nil
+}
+
+func templateMember(obj Object, name string) Object {
+	switch obj := obj.(type) {
+	case *Hash:
+		key := &String{Value: name}
+		if pair, ok := obj.Pairs[key.HashKey()]; ok {
+			return pair.Value
+		}
+	case MemberHolder:
+		if member, ok := obj.Member(name); ok {
+			return member
+		}
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package evaluator
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	_ "time/tzdata" // time zones work without a system zone database
+)
+
+const TIME_OBJ = "TIME"
+
+func init() {
+	stringType := []ObjectType{STRING_OBJ}
+	timeType := []ObjectType{TIME_OBJ}
+
+	registerModule("time", map[string]Object{
+		"now": &Builtin{
+			Doc: "Returns the current time in the local time zone.",
+			EnvFn: func(env *Environment, args ...Object) Object {
+				if env.session.deterministic {
+					return &Time{Value: fixedTime}
+				}
+				return &Time{Value: time.Now()}
+			},
+		},
+		"fromUnix": &Builtin{
+			Params: []Param{{Name: "seconds", Types: []ObjectType{INTEGER_OBJ, FLOAT_OBJ}}},
+			Doc:    "Returns the UTC time a number of seconds after 1970-01-01.",
+			Fn: func(args ...Object) Object {
+				seconds := toFloat(args[0])
+				return &Time{Value: time.Unix(0, int64(seconds*1e9)).UTC()}
+			},
+		},
+		"parse": &Builtin{
+			Params: []Param{{Name: "text", Types: stringType}, {Name: "layout", Types: stringType}, {Name: "zone", Types: stringType, Optional: true}},
+			Doc:    "Reads a time written in layout, such as \"%Y-%m-%d %H:%M\". Times without a zone are in zone, UTC by default.",
+			Fn: func(args ...Object) Object {
+				layout, err := goLayout(args[1].(*String).Value)
+				if err != nil {
+					return err
+				}
+				loc := time.UTC
+				if len(args) == 3 {
+					if loc, err = loadZone(args[2].(*String).Value); err != nil {
+						return err
+					}
+				}
+				t, parseErr := time.ParseInLocation(layout, args[0].(*String).Value, loc)
+				if parseErr != nil {
+					return newCodedError(E_VALUE, "time: cannot parse %q as %q", args[0].(*String).Value, args[1].(*String).Value)
+				}
+				return &Time{Value: t}
+			},
+		},
+		"format": &Builtin{
+			Params: []Param{{Name: "time", Types: timeType}, {Name: "layout", Types: stringType}},
+			Doc:    "Writes a time using a layout of strftime directives, such as \"%d %b %Y\".",
+			Fn: func(args ...Object) Object {
+				return args[0].(*Time).format(args[1].(*String).Value)
+			},
+		},
+		"inZone": &Builtin{
+			Params: []Param{{Name: "time", Types: timeType}, {Name: "zone", Types: stringType}},
+			Doc:    "Returns the same instant in another time zone, such as \"Asia/Dhaka\", \"UTC\" or \"Local\".",
+			Fn: func(args ...Object) Object {
+				loc, err := loadZone(args[1].(*String).Value)
+				if err != nil {
+					return err
+				}
+				return &Time{Value: args[0].(*Time).Value.In(loc)}
+			},
+		},
+	})
+}
+
+func init() {
+	registerBuiltin(&Builtin{
+		Name:   "timeit",
+		Params: []Param{{Name: "fn", Types: callableTypes}, {Name: "runs", Types: []ObjectType{INTEGER_OBJ}, Optional: true}},
+		Doc:    "Calls fn runs times (10 by default), prints a summary and returns the min, avg and max duration in seconds.",
+		OutFn: func(out io.Writer, args ...Object) Object {
+			runs := int64(10)
+			if len(args) == 2 {
+				runs = args[1].(*Integer).Value
+				if runs < 1 {
+					return newCodedError(E_VALUE, "runs given to `timeit` must be at least 1, got %d", runs)
+				}
+			}
+
+			var total, fastest, slowest time.Duration
+			for i := int64(0); i < runs; i++ {
+				start := time.Now()
+				if result := applyFunction(args[0], nil); isError(result) {
+					return result
+				}
+				elapsed := time.Since(start)
+
+				total += elapsed
+				if i == 0 || elapsed < fastest {
+					fastest = elapsed
+				}
+				if elapsed > slowest {
+					slowest = elapsed
+				}
+			}
+			average := total / time.Duration(runs)
+
+			fmt.Fprintf(out, "%d runs: min %v, avg %v, max %v\n", runs, fastest, average, slowest)
+			return newHash(map[string]Object{
+				"runs": &Integer{Value: runs},
+				"min":  &Float{Value: fastest.Seconds()},
+				"avg":  &Float{Value: average.Seconds()},
+				"max":  &Float{Value: slowest.Seconds()},
+			})
+		},
+	})
+}
+
+// fixedTime is the time time.now returns in an interpreter running a file
+// with #deterministic, so the program's output is the same on every run
+var fixedTime = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Time object, an instant in a particular time zone
+type Time struct {
+	Value time.Time
+}
+
+func (t *Time) Type() ObjectType { return TIME_OBJ }
+func (t *Time) Inspect() string  { return t.Value.Format(time.RFC3339) }
+
+func (t *Time) Member(name string) (Object, bool) {
+	fields := map[string]func() Object{
+		"year":    func() Object { return &Integer{Value: int64(t.Value.Year())} },
+		"month":   func() Object { return &Integer{Value: int64(t.Value.Month())} },
+		"day":     func() Object { return &Integer{Value: int64(t.Value.Day())} },
+		"hour":    func() Object { return &Integer{Value: int64(t.Value.Hour())} },
+		"minute":  func() Object { return &Integer{Value: int64(t.Value.Minute())} },
+		"second":  func() Object { return &Integer{Value: int64(t.Value.Second())} },
+		"weekday": func() Object { return &String{Value: t.Value.Weekday().String()} },
+		"zone":    func() Object { return &String{Value: t.Value.Location().String()} },
+		"unix":    func() Object { return &Integer{Value: t.Value.Unix()} },
+	}
+	if field, ok := fields[name]; ok {
+		return method(func(args ...Object) Object {
+			if err := checkArity(name, args, 0); err != nil {
+				return err
+			}
+			return field()
+		}), true
+	}
+	if name == "format" {
+		return method(func(args ...Object) Object {
+			if err := checkArity("format", args, 1); err != nil {
+				return err
+			}
+			layout, ok := args[0].(*String)
+			if !ok {
+				return newCodedError(E_TYPE_MISMATCH, "argument to `format` must be STRING, got %s", args[0].Type())
+			}
+			return t.format(layout.Value)
+		}), true
+	}
+	return nil, false
+}
+
+func (t *Time) format(layout string) Object {
+	converted, err := goLayout(layout)
+	if err != nil {
+		return err
+	}
+	return &String{Value: t.Value.Format(converted)}
+}
+
+// strftime maps strftime directives to Go layout elements
+var strftime = map[byte]string{
+	'Y': "2006", 'y': "06", 'm': "01", 'd': "02", 'e': "_2", 'j': "002",
+	'H': "15", 'I': "03", 'M': "04", 'S': "05", 'f': "000000", 'p': "PM",
+	'b': "Jan", 'B': "January", 'a': "Mon", 'A': "Monday",
+	'Z': "MST", 'z': "-0700", 'F': "2006-01-02", 'T': "15:04:05", '%': "%",
+}
+
+// goLayout converts a layout of strftime directives into a Go time layout.
+// Layouts without a % are taken to be Go layouts already.
+func goLayout(layout string) (string, *Error) {
+	if !strings.Contains(layout, "%") {
+		return layout, nil
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(layout); i++ {
+		if layout[i] != '%' {
+			out.WriteByte(layout[i])
+			continue
+		}
+		if i+1 == len(layout) {
+			return "", newCodedError(E_VALUE, "time: layout %q ends with %%", layout)
+		}
+		i++
+		element, ok := strftime[layout[i]]
+		if !ok {
+			return "", newCodedError(E_VALUE, "time: unknown directive %%%c in layout %q", layout[i], layout)
+		}
+		out.WriteString(element)
+	}
+	return out.String(), nil
+}
+
+func loadZone(name string) (*time.Location, *Error) {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, newCodedError(E_VALUE, "time: unknown time zone %q", name)
+	}
+	return loc, nil
+}
@@ -0,0 +1,72 @@
+package evaluator
+
+import (
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// Version is the version of the GoKid language this interpreter runs
+const Version = "1.0.0"
+
+// Engines are the ways this interpreter can run a program. There is only
+// the tree-walking evaluator for now.
+var Engines = []string{"tree-walk"}
+
+// BuildInfo describes the interpreter binary
+type BuildInfo struct {
+	Version   string
+	Commit    string // the git commit built, "" when unknown
+	Modified  bool   // whether the working tree had uncommitted changes
+	GoVersion string
+	Engines   []string
+}
+
+// Build returns what is known about how the interpreter was built. The
+// commit is recorded by go build in a git checkout.
+func Build() BuildInfo {
+	info := BuildInfo{Version: Version, GoVersion: runtime.Version(), Engines: Engines}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.Commit = setting.Value
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	return info
+}
+
+func init() {
+	registerBuiltin(&Builtin{
+		Name: "version",
+		Doc:  "Returns the interpreter's version as {version, major, minor, patch, commit, go, engines}, for scripts that need a newer feature.",
+		Fn: func(args ...Object) Object {
+			info := Build()
+			parts := strings.SplitN(info.Version, ".", 3)
+			number := func(i int) Object {
+				if i >= len(parts) {
+					return &Integer{Value: 0}
+				}
+				n, _ := strconv.ParseInt(parts[i], 10, 64)
+				return &Integer{Value: n}
+			}
+			engines := make([]Object, len(info.Engines))
+			for i, engine := range info.Engines {
+				engines[i] = &String{Value: engine}
+			}
+			return newHash(map[string]Object{
+				"version": &String{Value: info.Version},
+				"major":   number(0),
+				"minor":   number(1),
+				"patch":   number(2),
+				"commit":  &String{Value: info.Commit},
+				"go":      &String{Value: info.GoVersion},
+				"engines": &Array{Elements: engines},
+			})
+		},
+	})
+}
@@ -0,0 +1,62 @@
+package evaluator
+
+import (
+	"gokid/diagnostics"
+	"gokid/messages"
+	"gokid/parser"
+)
+
+// Warning is a non-fatal problem noticed while evaluating
+type Warning struct {
+	Message string
+	Offset  int    // source offset the warning points at
+	Path    string // file the offset is in, if known
+}
+
+// Diagnostic converts a warning for rendering against its source
+func (w *Warning) Diagnostic() diagnostics.Diagnostic {
+	return diagnostics.Diagnostic{Severity: diagnostics.Warning, Message: w.Message, Offset: w.Offset, Length: 1}
+}
+
+// OnWarning sets fn to be called with each new runtime warning instead of
+// collecting it
+func (e *Environment) OnWarning(fn func(*Warning)) {
+	e.session.onWarning = fn
+}
+
+// TakeWarnings returns the runtime warnings collected since the last call
+func (e *Environment) TakeWarnings() []*Warning {
+	s := e.session
+	if s.concurrent {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+	warnings := s.warnings
+	s.warnings = nil
+	return warnings
+}
+
+// warn reports a warning about node, at offset, once; repeats, such as
+// from a loop, are dropped before the message is formatted. A node is in
+// one file, so two files warning at the same offset stay apart.
+func (e *Environment) warn(node parser.Node, offset int, format string, args ...interface{}) {
+	s := e.session
+	if s.concurrent {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+	if s.warned[node] {
+		return
+	}
+	if s.warned == nil {
+		s.warned = map[parser.Node]bool{}
+	}
+	s.warned[node] = true
+
+	w := Warning{Message: messages.Sprintf(format, args...), Offset: offset, Path: e.root().path}
+	if s.onWarning != nil {
+		s.onWarning(&w)
+		return
+	}
+	s.warnings = append(s.warnings, &w)
+}
@@ -0,0 +1,464 @@
+package evaluator
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const WEBSOCKET_OBJ = "WEBSOCKET"
+
+// WebSocket frame opcodes (RFC 6455)
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// wsMaxMessage is the largest message, and so frame, a WebSocket accepts.
+// A peer sending a larger one is closed with status wsTooBig instead of
+// having the interpreter allocate whatever length its header claims.
+const wsMaxMessage = 32 << 20
+
+// wsTooBig is the close status for a message over wsMaxMessage (RFC 6455)
+const wsTooBig = 1009
+
+var errMessageTooBig = errors.New("websocket: message too big")
+
+// WebSocket object is one end of a WebSocket connection. Incoming messages
+// are delivered to "message" listeners and closure to "close" listeners.
+type WebSocket struct {
+	conn     net.Conn
+	reader   *bufio.Reader
+	isClient bool // clients must mask the frames they send
+	events   *Emitter
+
+	// ctx returns the context of the interpreter the connection belongs
+	// to; Receive returns once it is done
+	ctx func() context.Context
+
+	writeMu sync.Mutex
+	closed  bool
+}
+
+func (ws *WebSocket) Type() ObjectType { return WEBSOCKET_OBJ }
+func (ws *WebSocket) Inspect() string {
+	return "websocket(" + ws.conn.RemoteAddr().String() + ")"
+}
+
+// HandleWebSocket upgrades requests matching pattern and passes each new
+// connection to handler
+func (s *Server) HandleWebSocket(pattern string, handler Object) *Error {
+	if !isCallable(handler) {
+		return newCodedError(E_TYPE_MISMATCH, "handler must be FUNCTION, got %s", handler.Type())
+	}
+
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgradeWebSocket(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ws.ctx = s.ctx
+		s.track(ws, true)
+		defer s.track(ws, false)
+		result := callFromHost(handler, ws)
+		if isError(result) {
+			ws.Close()
+			return
+		}
+		ws.serve()
+	})
+	return nil
+}
+
+// track adds ws to the connections os.shutdown closes, or removes it once
+// it has closed. A connection upgraded while the server drains is closed
+// straight away.
+func (s *Server) track(ws *WebSocket, open bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case !open:
+		delete(s.sockets, ws)
+	case s.draining:
+		ws.Close()
+	default:
+		if s.sockets == nil {
+			s.sockets = map[*WebSocket]bool{}
+		}
+		s.sockets[ws] = true
+	}
+}
+
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*WebSocket, error) {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") ||
+		!strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade") {
+		return nil, errors.New("websocket: not an upgrade request")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, errors.New("websocket: missing Sec-WebSocket-Key")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("websocket: connection cannot be upgraded")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	rw.WriteString("Upgrade: websocket\r\n")
+	rw.WriteString("Connection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + websocketAccept(key) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &WebSocket{conn: conn, reader: rw.Reader, events: NewEmitter()}, nil
+}
+
+func dialWebSocket(ctx func() context.Context, rawURL string) Object {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return newCodedError(E_IO, "websocket: %s", err)
+	}
+
+	host := u.Host
+	var conn net.Conn
+	switch u.Scheme {
+	case "ws":
+		if u.Port() == "" {
+			host += ":80"
+		}
+		conn, err = (&net.Dialer{}).DialContext(ctx(), "tcp", host)
+	case "wss":
+		if u.Port() == "" {
+			host += ":443"
+		}
+		dialer := &tls.Dialer{Config: &tls.Config{ServerName: u.Hostname()}}
+		conn, err = dialer.DialContext(ctx(), "tcp", host)
+	default:
+		return newCodedError(E_IO, "websocket: unsupported scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return newCodedError(E_IO, "websocket: %s", err)
+	}
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req := &http.Request{
+		Method: "GET",
+		URL:    u,
+		Host:   u.Host,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {key},
+			"Sec-WebSocket-Version": {"13"},
+		},
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return newCodedError(E_IO, "websocket: %s", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return newCodedError(E_IO, "websocket: %s", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		resp.Header.Get("Sec-WebSocket-Accept") != websocketAccept(key) {
+		conn.Close()
+		return newCodedError(E_IO, "websocket: handshake failed with status %d", resp.StatusCode)
+	}
+
+	return &WebSocket{conn: conn, reader: reader, isClient: true, events: NewEmitter(), ctx: ctx}
+}
+
+func websocketAccept(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// serve delivers incoming messages to listeners until the connection closes
+func (ws *WebSocket) serve() {
+	for {
+		msg, err := ws.Receive()
+		if err != nil {
+			break
+		}
+		callbackMu.Lock()
+		result := ws.events.Emit("message", &String{Value: msg})
+		callbackMu.Unlock()
+		if isError(result) {
+			break
+		}
+	}
+
+	ws.Close()
+	callbackMu.Lock()
+	ws.events.Emit("close")
+	callbackMu.Unlock()
+}
+
+// Receive reads the next complete text or binary message, answering pings
+// along the way. Once the interpreter's context is done it closes the
+// connection and returns the interpreter's E_STOPPED error.
+func (ws *WebSocket) Receive() (string, error) {
+	ctx := context.Background()
+	if ws.ctx != nil {
+		ctx = ws.ctx()
+	}
+	stop := context.AfterFunc(ctx, ws.Close)
+	defer stop()
+
+	var message []byte
+	for {
+		fin, opcode, payload, err := ws.readFrame()
+		if err == nil && len(message)+len(payload) > wsMaxMessage {
+			err = errMessageTooBig
+		}
+		if err == errMessageTooBig {
+			ws.close(binary.BigEndian.AppendUint16(nil, wsTooBig))
+		}
+		if err != nil && ctx.Err() != nil {
+			return "", stoppedError(ctx)
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch opcode {
+		case wsText, wsBinary, wsContinuation:
+			message = append(message, payload...)
+			if fin {
+				return string(message), nil
+			}
+		case wsPing:
+			ws.writeFrame(wsPong, payload)
+		case wsPong:
+		case wsClose:
+			ws.Close()
+			return "", io.EOF
+		}
+	}
+}
+
+// Send writes a text message
+func (ws *WebSocket) Send(msg string) error {
+	return ws.writeFrame(wsText, []byte(msg))
+}
+
+// Close sends a close frame and closes the connection
+func (ws *WebSocket) Close() {
+	ws.close(nil)
+}
+
+// close sends a close frame with payload, a status code or nothing, and
+// closes the connection
+func (ws *WebSocket) close(payload []byte) {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+
+	if ws.closed {
+		return
+	}
+	ws.writeFrameLocked(wsClose, payload)
+	ws.closed = true
+	ws.conn.Close()
+}
+
+func (ws *WebSocket) readFrame() (bool, byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(ws.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := header[0]&0x80 != 0
+	opcode := header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	if length > wsMaxMessage {
+		return false, 0, nil, errMessageTooBig
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(ws.reader, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(ws.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+
+	return fin, opcode, payload, nil
+}
+
+func (ws *WebSocket) writeFrame(opcode byte, payload []byte) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	return ws.writeFrameLocked(opcode, payload)
+}
+
+func (ws *WebSocket) writeFrameLocked(opcode byte, payload []byte) error {
+	if ws.closed {
+		return errors.New("websocket: connection closed")
+	}
+
+	frame := []byte{0x80 | opcode}
+	maskBit := byte(0)
+	if ws.isClient {
+		maskBit = 0x80
+	}
+
+	switch length := len(payload); {
+	case length < 126:
+		frame = append(frame, maskBit|byte(length))
+	case length <= 0xFFFF:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+
+	if ws.isClient {
+		var mask [4]byte
+		rand.Read(mask[:])
+		frame = append(frame, mask[:]...)
+		masked := make([]byte, len(payload))
+		for i := range payload {
+			masked[i] = payload[i] ^ mask[i%4]
+		}
+		payload = masked
+	}
+
+	_, err := ws.conn.Write(append(frame, payload...))
+	return err
+}
+
+func (ws *WebSocket) Member(name string) (Object, bool) {
+	switch name {
+	case "send":
+		return method(func(args ...Object) Object {
+			if err := checkArity("send", args, 1); err != nil {
+				return err
+			}
+			if err := ws.Send(args[0].Inspect()); err != nil {
+				return newCodedError(E_IO, "websocket: %s", err)
+			}
+			return NULL
+		}), true
+	case "receive":
+		// Blocking read of the next message, null once the connection closes
+		return method(func(args ...Object) Object {
+			if err := checkArity("receive", args, 0); err != nil {
+				return err
+			}
+			msg, err := ws.Receive()
+			if stopped, ok := err.(*Error); ok {
+				return stopped
+			}
+			if err != nil {
+				ws.Close()
+				return NULL
+			}
+			return &String{Value: msg}
+		}), true
+	case "onMessage", "onClose":
+		return method(func(args ...Object) Object {
+			if err := checkArity(name, args, 1); err != nil {
+				return err
+			}
+			if !isCallable(args[0]) {
+				return newCodedError(E_TYPE_MISMATCH, "listener must be FUNCTION, got %s", args[0].Type())
+			}
+			ws.events.On(strings.ToLower(strings.TrimPrefix(name, "on")), args[0])
+			return ws
+		}), true
+	case "on", "off":
+		return ws.events.Member(name)
+	case "listen":
+		// Client side: deliver messages to listeners until the connection closes
+		return method(func(args ...Object) Object {
+			if err := checkArity("listen", args, 0); err != nil {
+				return err
+			}
+			for {
+				msg, err := ws.Receive()
+				if stopped, ok := err.(*Error); ok {
+					return stopped
+				}
+				if err != nil {
+					break
+				}
+				if result := ws.events.Emit("message", &String{Value: msg}); isError(result) {
+					ws.Close()
+					return result
+				}
+			}
+			ws.Close()
+			return ws.events.Emit("close")
+		}), true
+	case "close":
+		return method(func(args ...Object) Object {
+			if err := checkArity("close", args, 0); err != nil {
+				return err
+			}
+			ws.Close()
+			return NULL
+		}), true
+	}
+	return nil, false
+}
@@ -0,0 +1,98 @@
+package evaluator
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestServerWorkers serves requests on worker copies with handlers made by
+// partial, memoize, compose and rpc.handler, which must run on the copies
+// rather than the original interpreter. Run it with -race.
+func TestServerWorkers(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	var out strings.Builder
+	env := NewEnvironment()
+	env.SetOutput(&out, &out)
+	done := make(chan error, 1)
+	go func() {
+		_, err := Run(env, `
+import "std/http";
+import "std/rpc";
+let counts = [0];
+let bump = function(n, req) { counts[0] = counts[0] + n; return "bumped"; };
+let server = http.server();
+server.workers(4);
+server.handle("/partial", partial(bump, 1));
+server.handle("/memoize", memoize(function(req) { counts[0] = counts[0] + 1; return "memoized"; }));
+server.handle("/compose", compose(function(s) { return s; }, partial(bump, 2)));
+server.handle("/rpc", rpc.handler({"add": function(a, b) { counts[0] = counts[0] + 1; return a + b; }}));
+server.handle("/stop", function(req) { server.close(); return "bye"; });
+server.listen("`+addr+`");
+print(counts[0]);
+`)
+		done <- err
+	}()
+
+	get := func(path string, body string) string {
+		var resp *http.Response
+		var err error
+		for range 50 {
+			if body == "" {
+				resp, err = http.Get("http://" + addr + path)
+			} else {
+				resp, err = http.Post("http://"+addr+path, "application/json", strings.NewReader(body))
+			}
+			if err == nil {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		if err != nil {
+			t.Error(err)
+			return ""
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return string(data)
+	}
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 10 {
+				for path, want := range map[string]string{"/partial": "bumped", "/memoize": "memoized", "/compose": "bumped"} {
+					if got := get(path, ""); got != want {
+						t.Errorf("%s: got %q, want %q", path, got, want)
+					}
+				}
+				if got := get("/rpc", `{"jsonrpc":"2.0","method":"add","params":[1,2],"id":1}`); !strings.Contains(got, `"result":3`) {
+					t.Errorf("/rpc: got %q", got)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	get("/stop", "")
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	env.Flush()
+	// Requests change the workers' copies of counts, never the original's
+	if out.String() != "0\n" {
+		t.Errorf("original counts[0]: got %q, want \"0\\n\"", out.String())
+	}
+}
@@ -0,0 +1,83 @@
+package evaluator
+
+import (
+	"context"
+	"runtime"
+)
+
+// yieldEvery is how many loop iterations and function calls run between
+// yield points. Statements already yield, but a loop with an empty body,
+// or recursion that stays inside expressions, runs none.
+const yieldEvery = 256
+
+// SetContext makes the interpreter stop with an E_STOPPED error at its
+// next yield point once ctx is done, which is within a few hundred loop
+// iterations or calls even in code that runs no statements. A nil ctx
+// removes it.
+func (e *Environment) SetContext(ctx context.Context) {
+	s := e.session
+	if s.concurrent {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+	s.ctx = ctx
+}
+
+// tick counts a loop iteration or a function call, yielding every
+// yieldEvery of them
+func (s *session) tick() *Error {
+	if s.ticks.Add(1)%yieldEvery != 0 {
+		return nil
+	}
+	return s.yield()
+}
+
+// yield lets the rest of the process have its turn: it stops if the host's
+// context is done, dispatches pending signals and host tasks, and, when
+// other goroutines run code in the interpreter, lets them run
+func (s *session) yield() *Error {
+	if err := s.cancelled(); err != nil {
+		return err
+	}
+	if !s.isolated {
+		if err := dispatchSignals(); err != nil {
+			return err
+		}
+		RunHostTasks()
+	}
+	if s.concurrent || s.isolated {
+		runtime.Gosched()
+	}
+	return nil
+}
+
+// cancelled returns an E_STOPPED error once the context given to
+// SetContext is done
+func (s *session) cancelled() *Error {
+	if s.concurrent {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+	if s.ctx == nil || s.ctx.Err() == nil {
+		return nil
+	}
+	return stoppedError(s.ctx)
+}
+
+// context returns the context given to SetContext, or one that is never
+// done, for builtins that block to return once it is done
+func (s *session) context() context.Context {
+	if s.concurrent {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// stoppedError is the error the interpreter stops with once ctx is done
+func stoppedError(ctx context.Context) *Error {
+	return newCodedError(E_STOPPED, "execution stopped: %s", context.Cause(ctx))
+}
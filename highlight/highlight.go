@@ -0,0 +1,146 @@
+package highlight
+
+import (
+	"gokid/tokenizer"
+	"gokid/tokens"
+	"html"
+	"strings"
+)
+
+// Class is the syntax category of a piece of source
+type Class string
+
+const (
+	Plain    Class = ""
+	Keyword  Class = "keyword"
+	Constant Class = "constant" // true, false, null
+	Builtin  Class = "builtin"
+	Number   Class = "number"
+	String   Class = "string"
+	Comment  Class = "comment"
+	Operator Class = "operator"
+)
+
+// Span is a run of source text of one class
+type Span struct {
+	Class Class
+	Text  string
+}
+
+// ANSI color for each class
+var ansiColors = map[Class]string{
+	Keyword:  "\033[35m",
+	Constant: "\033[36m",
+	Builtin:  "\033[34m",
+	Number:   "\033[33m",
+	String:   "\033[32m",
+	Comment:  "\033[90m",
+	Operator: "\033[37m",
+}
+
+const ansiReset = "\033[0m"
+
+// builtinNames are the core builtins shown as such. They are ordinary
+// identifiers to the language, and a program may rebind them.
+var builtinNames = map[string]bool{"print": true, "len": true, "type": true}
+
+// Spans splits source into classified spans, keeping all whitespace and
+// comments so the spans concatenate back to source
+func Spans(source string) []Span {
+	var spans []Span
+	afterDot := false
+	for _, piece := range tokenizer.NewTokenizer(source).GetPieces() {
+		spans = append(spans, triviaSpans(piece.Trivia)...)
+		if piece.Text != "" {
+			class := classify(piece.Token)
+			// A word after a dot is a property name, as in value.len
+			if afterDot && (class == Keyword || class == Builtin || class == Constant) {
+				class = Plain
+			}
+			spans = append(spans, Span{Class: class, Text: piece.Text})
+		}
+		afterDot = piece.Token.Type == tokens.DOT
+	}
+	return spans
+}
+
+func triviaSpans(trivia string) []Span {
+	var spans []Span
+	for trivia != "" {
+		i := strings.Index(trivia, "//")
+		if i < 0 {
+			return append(spans, Span{Text: trivia})
+		}
+		if i > 0 {
+			spans = append(spans, Span{Text: trivia[:i]})
+		}
+		end := strings.IndexByte(trivia[i:], '\n')
+		if end < 0 {
+			end = len(trivia) - i
+		}
+		spans = append(spans, Span{Class: Comment, Text: trivia[i : i+end]})
+		trivia = trivia[i+end:]
+	}
+	return spans
+}
+
+func classify(tok tokens.Token) Class {
+	if tok.Type == tokens.IDENT && builtinNames[tok.Literal] {
+		return Builtin
+	}
+	switch tok.Type {
+	case tokens.IDENT, tokens.ILLEGAL, tokens.EOF:
+		return Plain
+	case tokens.INT, tokens.FLOAT, tokens.IMAG, tokens.DECIMAL:
+		return Number
+	case tokens.STRING:
+		return String
+	case tokens.TRUE, tokens.FALSE, tokens.NULL, tokens.SYMBOL:
+		return Constant
+	}
+	if tok.Ident != 0 {
+		return Keyword
+	}
+	switch tok.Type {
+	case tokens.LPAREN, tokens.RPAREN, tokens.LBRACE, tokens.RBRACE,
+		tokens.LBRACKET, tokens.RBRACKET, tokens.COMMA, tokens.SEMICOLON,
+		tokens.COLON, tokens.DOT:
+		return Plain
+	}
+	return Operator
+}
+
+// ANSI renders source with terminal color escapes
+func ANSI(source string) string {
+	var out strings.Builder
+	for _, span := range Spans(source) {
+		color, ok := ansiColors[span.Class]
+		if !ok {
+			out.WriteString(span.Text)
+			continue
+		}
+		out.WriteString(color)
+		out.WriteString(span.Text)
+		out.WriteString(ansiReset)
+	}
+	return out.String()
+}
+
+// HTML renders source as a <pre> block whose spans carry "gk-<class>" CSS
+// classes
+func HTML(source string) string {
+	var out strings.Builder
+	out.WriteString(`<pre class="gokid">`)
+	for _, span := range Spans(source) {
+		text := html.EscapeString(span.Text)
+		if span.Class == Plain {
+			out.WriteString(text)
+			continue
+		}
+		out.WriteString(`<span class="gk-` + string(span.Class) + `">`)
+		out.WriteString(text)
+		out.WriteString(`</span>`)
+	}
+	out.WriteString("</pre>\n")
+	return out.String()
+}
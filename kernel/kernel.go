@@ -0,0 +1,389 @@
+package kernel
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gokid/evaluator"
+	"gokid/lexer"
+	"gokid/parser"
+	"html"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const protocolVersion = "5.3"
+
+const delimiter = "<IDS|MSG>"
+
+// connectionInfo is the connection file a Jupyter frontend starts the
+// kernel with
+type connectionInfo struct {
+	Transport       string `json:"transport"`
+	IP              string `json:"ip"`
+	ShellPort       int    `json:"shell_port"`
+	ControlPort     int    `json:"control_port"`
+	StdinPort       int    `json:"stdin_port"`
+	IOPubPort       int    `json:"iopub_port"`
+	HBPort          int    `json:"hb_port"`
+	SignatureScheme string `json:"signature_scheme"`
+	Key             string `json:"key"`
+}
+
+type header struct {
+	MsgID    string `json:"msg_id"`
+	Session  string `json:"session"`
+	Username string `json:"username"`
+	Date     string `json:"date"`
+	MsgType  string `json:"msg_type"`
+	Version  string `json:"version"`
+}
+
+// message is a decoded Jupyter wire message
+type message struct {
+	identities [][]byte
+	header     header
+	parent     json.RawMessage
+	content    map[string]interface{}
+}
+
+// Kernel evaluates notebook cells in one GoKid environment
+type Kernel struct {
+	version string
+	session string
+	key     []byte
+
+	env    *evaluator.Environment
+	evalMu sync.Mutex
+	count  int
+
+	iopub    *publisher
+	done     chan struct{}
+	shutdown sync.Once
+}
+
+// Start runs a kernel for the frontend that wrote connectionFile until it
+// is asked to shut down
+func Start(connectionFile, version string) error {
+	data, err := os.ReadFile(connectionFile)
+	if err != nil {
+		return err
+	}
+	var info connectionInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return fmt.Errorf("invalid connection file: %v", err)
+	}
+	if info.Transport != "tcp" {
+		return fmt.Errorf("unsupported transport %q", info.Transport)
+	}
+	if info.SignatureScheme != "" && info.SignatureScheme != "hmac-sha256" {
+		return fmt.Errorf("unsupported signature scheme %q", info.SignatureScheme)
+	}
+
+	k := &Kernel{
+		version: version,
+		session: newID(),
+		key:     []byte(info.Key),
+		env:     evaluator.NewEnvironment(),
+		iopub:   newPublisher(),
+		done:    make(chan struct{}),
+	}
+
+	sockets := []struct {
+		port       int
+		socketType string
+		handle     func(*conn)
+	}{
+		{info.ShellPort, "ROUTER", k.serveRequests},
+		{info.ControlPort, "ROUTER", k.serveRequests},
+		{info.StdinPort, "ROUTER", func(c *conn) {}},
+		{info.IOPubPort, "PUB", k.iopub.add},
+		{info.HBPort, "REP", heartbeat},
+	}
+	for _, s := range sockets {
+		listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", info.IP, s.port))
+		if err != nil {
+			return err
+		}
+		defer listener.Close()
+		go serve(listener, s.socketType, s.handle)
+	}
+
+	<-k.done
+	return nil
+}
+
+// heartbeat echoes every message back
+func heartbeat(c *conn) {
+	defer c.Close()
+	for {
+		msg, err := c.readMessage()
+		if err != nil {
+			return
+		}
+		c.writeMessage(msg)
+	}
+}
+
+func (k *Kernel) serveRequests(c *conn) {
+	defer c.Close()
+	for {
+		parts, err := c.readMessage()
+		if err != nil {
+			return
+		}
+		msg, err := k.decode(parts)
+		if err != nil {
+			continue
+		}
+		k.handle(c, msg)
+	}
+}
+
+func (k *Kernel) handle(c *conn, msg *message) {
+	k.publish(msg, "status", map[string]interface{}{"execution_state": "busy"})
+	defer k.publish(msg, "status", map[string]interface{}{"execution_state": "idle"})
+
+	switch msg.header.MsgType {
+	case "kernel_info_request":
+		k.reply(c, msg, "kernel_info_reply", map[string]interface{}{
+			"status":                 "ok",
+			"protocol_version":       protocolVersion,
+			"implementation":         "gokid",
+			"implementation_version": k.version,
+			"language_info": map[string]interface{}{
+				"name":           "gokid",
+				"version":        k.version,
+				"mimetype":       "text/x-gokid",
+				"file_extension": ".gokid",
+			},
+			"banner":     "GoKid " + k.version,
+			"help_links": []interface{}{},
+		})
+	case "execute_request":
+		k.execute(c, msg)
+	case "is_complete_request":
+		code, _ := msg.content["code"].(string)
+		status := "complete"
+		if strings.Count(code, "{") > strings.Count(code, "}") ||
+			strings.Count(code, "(") > strings.Count(code, ")") ||
+			strings.Count(code, "[") > strings.Count(code, "]") {
+			status = "incomplete"
+		}
+		k.reply(c, msg, "is_complete_reply", map[string]interface{}{"status": status, "indent": ""})
+	case "comm_info_request":
+		k.reply(c, msg, "comm_info_reply", map[string]interface{}{"status": "ok", "comms": map[string]interface{}{}})
+	case "shutdown_request":
+		restart, _ := msg.content["restart"].(bool)
+		k.reply(c, msg, "shutdown_reply", map[string]interface{}{"status": "ok", "restart": restart})
+		k.shutdown.Do(func() { close(k.done) })
+	}
+}
+
+func (k *Kernel) execute(c *conn, msg *message) {
+	code, _ := msg.content["code"].(string)
+	silent, _ := msg.content["silent"].(bool)
+
+	k.evalMu.Lock()
+	defer k.evalMu.Unlock()
+
+	if !silent {
+		k.count++
+	}
+	k.publish(msg, "execute_input", map[string]interface{}{"code": code, "execution_count": k.count})
+
+	result, output, evalErr := k.evaluate(code)
+	if output != "" && !silent {
+		k.publish(msg, "stream", map[string]interface{}{"name": "stdout", "text": output})
+	}
+
+	if evalErr != nil {
+		// Runtime errors are named by their code, such as E_DIV_ZERO
+		ename := "Error"
+		var errCode evaluator.ErrorCode
+		if errors.As(evalErr, &errCode) {
+			ename = string(errCode)
+		}
+		content := map[string]interface{}{
+			"status":          "error",
+			"execution_count": k.count,
+			"ename":           ename,
+			"evalue":          evalErr.Error(),
+			"traceback":       []string{evalErr.Error()},
+		}
+		k.publish(msg, "error", content)
+		k.reply(c, msg, "execute_reply", content)
+		return
+	}
+
+	if result != nil && result != evaluator.NULL && !silent {
+		k.publish(msg, "execute_result", map[string]interface{}{
+			"execution_count": k.count,
+			"data":            displayData(result),
+			"metadata":        map[string]interface{}{},
+		})
+	}
+	k.reply(c, msg, "execute_reply", map[string]interface{}{
+		"status":           "ok",
+		"execution_count":  k.count,
+		"payload":          []interface{}{},
+		"user_expressions": map[string]interface{}{},
+	})
+}
+
+// evaluate runs a cell, capturing what it prints
+func (k *Kernel) evaluate(code string) (evaluator.Object, string, error) {
+	p := parser.New(lexer.NewLexer(code))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, "", errors.New("parser errors:\n" + strings.Join(p.Errors(), "\n"))
+	}
+
+	var captured bytes.Buffer
+	k.env.SetOutput(&captured, &captured)
+	result := evaluator.Eval(program, k.env)
+	k.env.SetOutput(nil, nil)
+
+	if errObj, ok := result.(*evaluator.Error); ok {
+		return nil, captured.String(), errObj
+	}
+	return result, captured.String(), nil
+}
+
+// displayData renders a result as plain text, and arrays and objects
+// also as HTML tables
+func displayData(obj evaluator.Object) map[string]interface{} {
+	data := map[string]interface{}{"text/plain": obj.Inspect()}
+
+	var rows [][2]string
+	switch obj := obj.(type) {
+	case *evaluator.Array:
+		for i, el := range obj.Elements {
+			rows = append(rows, [2]string{fmt.Sprint(i), el.Inspect()})
+		}
+	case *evaluator.Hash:
+		for _, pair := range obj.Pairs {
+			rows = append(rows, [2]string{pair.Key.Inspect(), pair.Value.Inspect()})
+		}
+		sort.Slice(rows, func(i, j int) bool { return rows[i][0] < rows[j][0] })
+	default:
+		return data
+	}
+
+	var out strings.Builder
+	out.WriteString("<table>")
+	for _, row := range rows {
+		fmt.Fprintf(&out, "<tr><th>%s</th><td>%s</td></tr>", html.EscapeString(row[0]), html.EscapeString(row[1]))
+	}
+	out.WriteString("</table>")
+	data["text/html"] = out.String()
+	return data
+}
+
+func (k *Kernel) decode(parts [][]byte) (*message, error) {
+	i := 0
+	for i < len(parts) && string(parts[i]) != delimiter {
+		i++
+	}
+	if len(parts) < i+6 {
+		return nil, fmt.Errorf("malformed message")
+	}
+
+	frames := parts[i+2 : i+6]
+	if len(k.key) > 0 && !hmac.Equal([]byte(k.sign(frames)), parts[i+1]) {
+		return nil, fmt.Errorf("invalid signature")
+	}
+
+	msg := &message{identities: parts[:i], parent: frames[0]}
+	if err := json.Unmarshal(frames[0], &msg.header); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(frames[3], &msg.content); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (k *Kernel) encode(identities [][]byte, parent json.RawMessage, msgType string, content interface{}) [][]byte {
+	h, _ := json.Marshal(header{
+		MsgID:    newID(),
+		Session:  k.session,
+		Username: "kernel",
+		Date:     time.Now().UTC().Format(time.RFC3339Nano),
+		MsgType:  msgType,
+		Version:  protocolVersion,
+	})
+	c, _ := json.Marshal(content)
+	frames := [][]byte{h, parent, []byte("{}"), c}
+
+	parts := append([][]byte{}, identities...)
+	parts = append(parts, []byte(delimiter), []byte(k.sign(frames)))
+	return append(parts, frames...)
+}
+
+func (k *Kernel) sign(frames [][]byte) string {
+	if len(k.key) == 0 {
+		return ""
+	}
+	mac := hmac.New(sha256.New, k.key)
+	for _, f := range frames {
+		mac.Write(f)
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (k *Kernel) reply(c *conn, msg *message, msgType string, content interface{}) {
+	c.writeMessage(k.encode(msg.identities, msg.parent, msgType, content))
+}
+
+func (k *Kernel) publish(parent *message, msgType string, content interface{}) {
+	topic := [][]byte{[]byte("kernel." + k.session + "." + msgType)}
+	k.iopub.publish(k.encode(topic, parent.parent, msgType, content))
+}
+
+// Install writes a kernel spec so Jupyter can start executable as the
+// GoKid kernel, returning the spec's directory
+func Install(executable string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	var dataDir string
+	switch runtime.GOOS {
+	case "darwin":
+		dataDir = filepath.Join(home, "Library", "Jupyter")
+	case "windows":
+		dataDir = filepath.Join(os.Getenv("APPDATA"), "jupyter")
+	default:
+		dataDir = filepath.Join(home, ".local", "share", "jupyter")
+	}
+	dir := filepath.Join(dataDir, "kernels", "gokid")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	spec, _ := json.MarshalIndent(map[string]interface{}{
+		"argv":         []string{executable, "kernel", "{connection_file}"},
+		"display_name": "GoKid",
+		"language":     "gokid",
+	}, "", "  ")
+	return dir, os.WriteFile(filepath.Join(dir, "kernel.json"), spec, 0644)
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
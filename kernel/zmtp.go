@@ -0,0 +1,208 @@
+package kernel
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+// Just enough of ZMTP 3.0 with the NULL security mechanism to talk to
+// Jupyter frontends. Every connection is its own peer, so ROUTER replies
+// go back on the connection the request arrived on.
+
+const (
+	flagMore    = 0x01
+	flagLong    = 0x02
+	flagCommand = 0x04
+)
+
+// conn is one ZMTP connection
+type conn struct {
+	net.Conn
+	reader  *bufio.Reader
+	writeMu sync.Mutex
+}
+
+func greeting() []byte {
+	g := make([]byte, 64)
+	g[0] = 0xFF
+	g[9] = 0x7F
+	g[10] = 3 // version 3.0
+	g[11] = 0
+	copy(g[12:32], "NULL")
+	return g
+}
+
+// handshake exchanges greetings and READY commands
+func handshake(c net.Conn, socketType string) (*conn, error) {
+	zc := &conn{Conn: c, reader: bufio.NewReader(c)}
+
+	if _, err := c.Write(greeting()); err != nil {
+		return nil, err
+	}
+	peer := make([]byte, 64)
+	if _, err := io.ReadFull(zc.reader, peer); err != nil {
+		return nil, err
+	}
+	if peer[0] != 0xFF || peer[9] != 0x7F || peer[10] < 3 {
+		return nil, errors.New("zmtp: unsupported peer greeting")
+	}
+
+	ready := []byte{5}
+	ready = append(ready, "READY"...)
+	ready = appendProperty(ready, "Socket-Type", socketType)
+	if err := zc.writeFrame(flagCommand, ready); err != nil {
+		return nil, err
+	}
+
+	flags, _, err := zc.readFrame()
+	if err != nil {
+		return nil, err
+	}
+	if flags&flagCommand == 0 {
+		return nil, errors.New("zmtp: expected READY command")
+	}
+	return zc, nil
+}
+
+func appendProperty(b []byte, name, value string) []byte {
+	b = append(b, byte(len(name)))
+	b = append(b, name...)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(value)))
+	return append(b, value...)
+}
+
+func (c *conn) readFrame() (byte, []byte, error) {
+	flags, err := c.reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var size uint64
+	if flags&flagLong != 0 {
+		var ext [8]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(ext[:])
+	} else {
+		b, err := c.reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		size = uint64(b)
+	}
+	if size > 1<<30 {
+		return 0, nil, errors.New("zmtp: frame too large")
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(c.reader, body); err != nil {
+		return 0, nil, err
+	}
+	return flags, body, nil
+}
+
+func (c *conn) writeFrame(flags byte, body []byte) error {
+	frame := make([]byte, 0, len(body)+9)
+	if len(body) > 255 {
+		frame = append(frame, flags|flagLong)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(body)))
+	} else {
+		frame = append(frame, flags, byte(len(body)))
+	}
+	_, err := c.Write(append(frame, body...))
+	return err
+}
+
+// readMessage reads a multipart message, skipping commands
+func (c *conn) readMessage() ([][]byte, error) {
+	var parts [][]byte
+	for {
+		flags, body, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		if flags&flagCommand != 0 {
+			continue
+		}
+		parts = append(parts, body)
+		if flags&flagMore == 0 {
+			return parts, nil
+		}
+	}
+}
+
+func (c *conn) writeMessage(parts [][]byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	for i, part := range parts {
+		var flags byte
+		if i < len(parts)-1 {
+			flags = flagMore
+		}
+		if err := c.writeFrame(flags, part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publisher is a PUB socket that sends every message to all subscribers
+type publisher struct {
+	mu    sync.Mutex
+	conns map[*conn]bool
+}
+
+func newPublisher() *publisher {
+	return &publisher{conns: map[*conn]bool{}}
+}
+
+func (p *publisher) add(c *conn) {
+	p.mu.Lock()
+	p.conns[c] = true
+	p.mu.Unlock()
+
+	// Subscriptions are ignored; everything is published to everyone
+	go func() {
+		for {
+			if _, err := c.readMessage(); err != nil {
+				p.mu.Lock()
+				delete(p.conns, c)
+				p.mu.Unlock()
+				c.Close()
+				return
+			}
+		}
+	}()
+}
+
+func (p *publisher) publish(parts [][]byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for c := range p.conns {
+		c.writeMessage(parts)
+	}
+}
+
+// serve accepts ZMTP connections of socketType on listener
+func serve(listener net.Listener, socketType string, handle func(*conn)) {
+	for {
+		c, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			zc, err := handshake(c, socketType)
+			if err != nil {
+				c.Close()
+				return
+			}
+			handle(zc)
+		}()
+	}
+}
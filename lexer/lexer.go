@@ -2,6 +2,7 @@ package lexer
 
 import (
 	"gokid/tokens"
+	"strings"
 )
 
 type Lexer struct {
@@ -9,10 +10,34 @@ type Lexer struct {
 	position     int
 	readPosition int
 	ch           byte
+
+	data    string // the text after a DataMarker line
+	hasData bool
+
+	replay    []tokens.Token // the tokens left to return, for a lexer made by Replay
+	replaying bool
+
+	dialect tokens.Dialect // the keywords of the input, nil for English
 }
 
+// DataMarker, on a line of its own, ends a program's code. The lines
+// after it are data the program reads with os.data().
+const DataMarker = "__data__"
+
+// DefaultDialect is the dialect of input without a #dialect pragma; nil
+// is English. gokid --dialect sets it.
+var DefaultDialect tokens.Dialect
+
 func NewLexer(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, dialect: dialectOf(input)}
+	l.readChar()
+	return l
+}
+
+// NewLexerAt creates a lexer that starts reading input at offset, keeping
+// token offsets relative to the whole input
+func NewLexerAt(input string, offset int) *Lexer {
+	l := &Lexer{input: input, readPosition: offset, dialect: dialectOf(input)}
 	l.readChar()
 	return l
 }
@@ -34,144 +59,224 @@ func (l *Lexer) peekChar() byte {
 	return l.input[l.readPosition]
 }
 
+// NextToken returns the next token, recording where it starts and ends in
+// the input
 func (l *Lexer) NextToken() tokens.Token {
-	var tok tokens.Token
-
+	if l.replaying {
+		return l.nextReplayed()
+	}
 	l.skipWhitespace()
+	for l.ch == '/' && l.peekChar() == '/' {
+		l.skipComment()
+		l.skipWhitespace()
+	}
+
+	start := l.position
+	if l.atDataMarker() {
+		// Everything from the marker on is data, not code
+		l.data, l.hasData = strings.TrimPrefix(strings.TrimPrefix(l.input[start+len(DataMarker):], "\r"), "\n"), true
+		l.input = l.input[:start]
+		l.readPosition = start
+		l.readChar()
+	}
+	tok := l.readToken()
+	tok.Offset = start
+	tok.End = min(l.position, len(l.input))
+	return tok
+}
+
+// PeekToken returns the token NextToken will return next, without reading
+// it
+func (l *Lexer) PeekToken() tokens.Token {
+	ahead := *l
+	return ahead.NextToken()
+}
+
+// atDataMarker reports whether the lexer is at a DataMarker line
+func (l *Lexer) atDataMarker() bool {
+	start := l.position
+	if start >= len(l.input) || start > 0 && l.input[start-1] != '\n' || !strings.HasPrefix(l.input[start:], DataMarker) {
+		return false
+	}
+	rest := strings.TrimPrefix(l.input[start+len(DataMarker):], "\r")
+	return rest == "" || rest[0] == '\n'
+}
+
+// Data returns the text after the DataMarker line that ends source's
+// code, and whether it has one
+func Data(source string) (string, bool) {
+	if !strings.HasPrefix(source, DataMarker) && !strings.Contains(source, "\n"+DataMarker) {
+		return "", false
+	}
+	l := NewLexer(source)
+	for l.NextToken().Type != tokens.EOF {
+	}
+	return l.data, l.hasData
+}
+
+// dialectOf returns the dialect named by input's #dialect pragma, or
+// DefaultDialect. Pragmas come before the first statement, so only the
+// lines starting with # at the top of input are read.
+func dialectOf(input string) tokens.Dialect {
+	if !strings.Contains(input, "#dialect") {
+		return DefaultDialect
+	}
+	l := &Lexer{input: input}
+	l.readChar()
+	tok := l.NextToken()
+	for tok.Type == tokens.HASH {
+		last := l.NextToken()
+		if last.Literal == "dialect" && last.Offset == tok.End {
+			if d, ok := tokens.LookupDialect(l.NextToken().Literal); ok {
+				return d
+			}
+		}
+		// The next pragma, if there is one, starts the next line
+		for tok = l.NextToken(); tok.Type != tokens.EOF && !strings.Contains(l.input[last.End:tok.Offset], "\n"); tok = l.NextToken() {
+			last = tok
+		}
+	}
+	return DefaultDialect
+}
+
+// Dialect returns the dialect of the input's keywords
+func (l *Lexer) Dialect() tokens.Dialect {
+	if l.dialect == nil {
+		return tokens.English
+	}
+	return l.dialect
+}
+
+// Input returns the whole input, or once the lexer has reached a
+// DataMarker line, the code before it
+func (l *Lexer) Input() string {
+	return l.input
+}
+
+// Slice returns the input between two offsets
+func (l *Lexer) Slice(start, end int) string {
+	if start < 0 || end > len(l.input) || start > end {
+		return ""
+	}
+	return l.input[start:end]
+}
+
+func (l *Lexer) readToken() tokens.Token {
+	var tok tokens.Token
 
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
-			ch := l.ch
 			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = tokens.Token{Type: tokens.EQ, Literal: literal}
+			tok = newToken(tokens.EQ)
 		} else if l.peekChar() == '>' {
-			ch := l.ch
 			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = tokens.Token{Type: tokens.ARROW, Literal: literal}
+			tok = newToken(tokens.ARROW)
 		} else {
-			tok = newToken(tokens.ASSIGN, l.ch)
+			tok = newToken(tokens.ASSIGN)
 		}
 	case '+':
 		if l.peekChar() == '=' {
-			ch := l.ch
 			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = tokens.Token{Type: tokens.PLUS_ASSIGN, Literal: literal}
+			tok = newToken(tokens.PLUS_ASSIGN)
 		} else {
-			tok = newToken(tokens.PLUS, l.ch)
+			tok = newToken(tokens.PLUS)
 		}
 	case '-':
 		if l.peekChar() == '=' {
-			ch := l.ch
 			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = tokens.Token{Type: tokens.MINUS_ASSIGN, Literal: literal}
+			tok = newToken(tokens.MINUS_ASSIGN)
 		} else {
-			tok = newToken(tokens.MINUS, l.ch)
+			tok = newToken(tokens.MINUS)
 		}
 	case '*':
 		if l.peekChar() == '*' {
-			ch := l.ch
 			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = tokens.Token{Type: tokens.POWER, Literal: literal}
+			tok = newToken(tokens.POWER)
 		} else if l.peekChar() == '=' {
-			ch := l.ch
 			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = tokens.Token{Type: tokens.MULTIPLY_ASSIGN, Literal: literal}
+			tok = newToken(tokens.MULTIPLY_ASSIGN)
 		} else {
-			tok = newToken(tokens.ASTERISK, l.ch)
+			tok = newToken(tokens.ASTERISK)
 		}
 	case '/':
 		if l.peekChar() == '=' {
-			ch := l.ch
 			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = tokens.Token{Type: tokens.DIVIDE_ASSIGN, Literal: literal}
-		} else if l.peekChar() == '/' {
-			// Skip single-line comment
-			l.skipComment()
-			return l.NextToken()
+			tok = newToken(tokens.DIVIDE_ASSIGN)
 		} else {
-			tok = newToken(tokens.SLASH, l.ch)
+			tok = newToken(tokens.SLASH)
 		}
 	case '%':
-		tok = newToken(tokens.MODULO, l.ch)
+		tok = newToken(tokens.MODULO)
 	case '!':
 		if l.peekChar() == '=' {
-			ch := l.ch
 			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = tokens.Token{Type: tokens.NOT_EQ, Literal: literal}
+			tok = newToken(tokens.NOT_EQ)
 		} else {
-			tok = newToken(tokens.NOT, l.ch)
+			tok = newToken(tokens.NOT)
 		}
 	case '<':
 		if l.peekChar() == '=' {
-			ch := l.ch
 			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = tokens.Token{Type: tokens.LTE, Literal: literal}
+			tok = newToken(tokens.LTE)
 		} else {
-			tok = newToken(tokens.LT, l.ch)
+			tok = newToken(tokens.LT)
 		}
 	case '>':
 		if l.peekChar() == '=' {
-			ch := l.ch
 			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = tokens.Token{Type: tokens.GTE, Literal: literal}
+			tok = newToken(tokens.GTE)
 		} else {
-			tok = newToken(tokens.GT, l.ch)
+			tok = newToken(tokens.GT)
 		}
 	case '&':
 		if l.peekChar() == '&' {
-			ch := l.ch
 			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = tokens.Token{Type: tokens.AND, Literal: literal}
+			tok = newToken(tokens.AND)
 		} else {
-			tok = newToken(tokens.ILLEGAL, l.ch)
+			tok = l.illegalToken()
 		}
 	case '|':
 		if l.peekChar() == '|' {
-			ch := l.ch
 			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = tokens.Token{Type: tokens.OR, Literal: literal}
+			tok = newToken(tokens.OR)
 		} else {
-			tok = newToken(tokens.ILLEGAL, l.ch)
+			tok = l.illegalToken()
 		}
 	case '(':
-		tok = newToken(tokens.LPAREN, l.ch)
+		tok = newToken(tokens.LPAREN)
 	case ')':
-		tok = newToken(tokens.RPAREN, l.ch)
+		tok = newToken(tokens.RPAREN)
 	case '{':
-		tok = newToken(tokens.LBRACE, l.ch)
+		tok = newToken(tokens.LBRACE)
 	case '}':
-		tok = newToken(tokens.RBRACE, l.ch)
+		tok = newToken(tokens.RBRACE)
 	case '[':
-		tok = newToken(tokens.LBRACKET, l.ch)
+		tok = newToken(tokens.LBRACKET)
 	case ']':
-		tok = newToken(tokens.RBRACKET, l.ch)
+		tok = newToken(tokens.RBRACKET)
 	case ',':
-		tok = newToken(tokens.COMMA, l.ch)
+		tok = newToken(tokens.COMMA)
 	case ';':
-		tok = newToken(tokens.SEMICOLON, l.ch)
+		tok = newToken(tokens.SEMICOLON)
 	case ':':
-		tok = newToken(tokens.COLON, l.ch)
+		if isLetter(l.peekChar()) && l.symbolMayStart() {
+			return tokens.Token{Type: tokens.SYMBOL, Literal: l.readSymbol()}
+		}
+		tok = newToken(tokens.COLON)
 	case '.':
-		tok = newToken(tokens.DOT, l.ch)
+		if l.peekChar() == '.' {
+			l.readChar()
+			tok = newToken(tokens.RANGE)
+		} else {
+			tok = newToken(tokens.DOT)
+		}
 	case '?':
-		tok = newToken(tokens.QUESTION, l.ch)
+		tok = newToken(tokens.QUESTION)
 	case '@':
-		tok = newToken(tokens.AT, l.ch)
+		tok = newToken(tokens.AT)
 	case '#':
-		tok = newToken(tokens.HASH, l.ch)
+		tok = newToken(tokens.HASH)
 	case '"':
 		tok.Type = tokens.STRING
 		tok.Literal = l.readString()
@@ -181,15 +286,18 @@ func (l *Lexer) NextToken() tokens.Token {
 	default:
 		if isLetter(l.ch) {
 			literal := l.readIdentifier()
-			tokType := tokens.LookupIdent(literal)
-			tok = tokens.Token{Type: tokType, Literal: literal}
+			tokType, id := tokens.LookupWord(literal)
+			if l.dialect != nil {
+				tokType = l.dialect.Lookup(literal)
+			}
+			tok = tokens.Token{Type: tokType, Literal: literal, Ident: id}
 			return tok
 		} else if isDigit(l.ch) {
 			literal, tokenType := l.readNumber()
 			tok = tokens.Token{Type: tokenType, Literal: literal}
 			return tok
 		} else {
-			tok = newToken(tokens.ILLEGAL, l.ch)
+			tok = l.illegalToken()
 		}
 	}
 
@@ -197,8 +305,16 @@ func (l *Lexer) NextToken() tokens.Token {
 	return tok
 }
 
-func newToken(tokenType tokens.TokenType, ch byte) tokens.Token {
-	return tokens.Token{Type: tokenType, Literal: string(ch)}
+// newToken returns an operator or delimiter token. Their types are spelt
+// like them, so the literal is the type's constant and lexing one doesn't
+// allocate.
+func newToken(tokenType tokens.TokenType) tokens.Token {
+	return tokens.Token{Type: tokenType, Literal: string(tokenType)}
+}
+
+// illegalToken returns the current character as an illegal token
+func (l *Lexer) illegalToken() tokens.Token {
+	return tokens.Token{Type: tokens.ILLEGAL, Literal: l.input[l.position:l.readPosition]}
 }
 
 func (l *Lexer) skipWhitespace() {
@@ -222,6 +338,24 @@ func isDigit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
 }
 
+// radixDigits returns the digits allowed after 0 and prefix, or "" when
+// prefix doesn't start a radix
+func radixDigits(prefix byte) string {
+	switch prefix {
+	case 'x', 'X':
+		return "0123456789abcdefABCDEF"
+	case 'o', 'O':
+		return "01234567"
+	case 'b', 'B':
+		return "01"
+	}
+	return ""
+}
+
+func isDigitIn(digits string, ch byte) bool {
+	return ch != 0 && strings.IndexByte(digits, ch) >= 0
+}
+
 func (l *Lexer) readIdentifier() string {
 	pos := l.position
 	for isLetter(l.ch) {
@@ -230,10 +364,45 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[pos:l.position]
 }
 
+// symbolMayStart reports whether a colon followed by a letter starts a
+// symbol rather than separating a key or case from a value, as in {a:b} or
+// case 1:. A colon right after a name, number, string or closing bracket is
+// a separator.
+func (l *Lexer) symbolMayStart() bool {
+	if l.position == 0 {
+		return true
+	}
+	prev := l.input[l.position-1]
+	return !isLetter(prev) && !isDigit(prev) && !strings.ContainsRune(`")]}`, rune(prev))
+}
+
+// readSymbol reads a colon and the name after it
+func (l *Lexer) readSymbol() string {
+	pos := l.position
+	l.readChar()
+	for isLetter(l.ch) || isDigit(l.ch) {
+		l.readChar()
+	}
+	return l.input[pos:l.position]
+}
+
 func (l *Lexer) readNumber() (string, tokens.TokenType) {
 	pos := l.position
 	var tokenType tokens.TokenType = tokens.INT
 
+	// 0x, 0o and 0b start hexadecimal, octal and binary integers
+	if l.ch == '0' && l.readPosition+1 < len(l.input) {
+		if isDigitIn(radixDigits(l.peekChar()), l.input[l.readPosition+1]) {
+			digits := radixDigits(l.peekChar())
+			l.readChar()
+			l.readChar()
+			for isDigitIn(digits, l.ch) {
+				l.readChar()
+			}
+			return l.input[pos:l.position], tokenType
+		}
+	}
+
 	for isDigit(l.ch) {
 		l.readChar()
 	}
@@ -247,6 +416,16 @@ func (l *Lexer) readNumber() (string, tokens.TokenType) {
 		}
 	}
 
+	// An i or d directly after a number, and not starting a name, makes
+	// it imaginary or decimal
+	if (l.ch == 'i' || l.ch == 'd') && !isLetter(l.peekChar()) && !isDigit(l.peekChar()) {
+		tokenType = tokens.IMAG
+		if l.ch == 'd' {
+			tokenType = tokens.DECIMAL
+		}
+		l.readChar()
+	}
+
 	return l.input[pos:l.position], tokenType
 }
 
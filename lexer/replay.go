@@ -0,0 +1,34 @@
+package lexer
+
+import "gokid/tokens"
+
+// Replay creates a lexer that returns toks, read from input earlier,
+// instead of reading input again, so tools can keep or pass on the tokens
+// of a program and parse it later. toks ends with the EOF token; when it
+// is at a DataMarker line, the rest of input is the program's data.
+func Replay(input string, toks []tokens.Token) *Lexer {
+	end := len(input)
+	if n := len(toks); n > 0 && toks[n-1].Type == tokens.EOF {
+		end = toks[n-1].Offset
+	} else {
+		toks = append(toks[:n:n], tokens.Token{Type: tokens.EOF, Offset: end, End: end})
+	}
+
+	l := &Lexer{input: input, readPosition: end, replay: toks, replaying: true}
+	l.readChar()
+	if l.atDataMarker() {
+		l.data, l.hasData = Data(input[end:])
+		l.input = input[:end]
+	}
+	return l
+}
+
+// nextReplayed returns the next of the tokens given to Replay, and EOF
+// once they have all been returned
+func (l *Lexer) nextReplayed() tokens.Token {
+	tok := l.replay[0]
+	if len(l.replay) > 1 {
+		l.replay = l.replay[1:]
+	}
+	return tok
+}
@@ -0,0 +1,59 @@
+package lexer
+
+import "gokid/tokens"
+
+// Values interns the literals of names, numbers, strings and symbols,
+// numbering each distinct literal once. A compiler can lex with
+// NextIndexed and keep the numbers as its constant and name tables,
+// comparing literals as integers instead of strings.
+type Values struct {
+	indexes  map[string]int
+	literals []string
+}
+
+// NewValues returns an empty table
+func NewValues() *Values {
+	return &Values{indexes: map[string]int{}}
+}
+
+// Index returns the number of literal, adding it if it is new
+func (v *Values) Index(literal string) int {
+	if i, ok := v.indexes[literal]; ok {
+		return i
+	}
+	v.literals = append(v.literals, literal)
+	v.indexes[literal] = len(v.literals) - 1
+	return len(v.literals) - 1
+}
+
+// Literal returns the literal numbered i
+func (v *Values) Literal(i int) string {
+	return v.literals[i]
+}
+
+// Len returns how many literals the table holds
+func (v *Values) Len() int {
+	return len(v.literals)
+}
+
+// IndexedToken is a token whose literal is a number in a Values table
+type IndexedToken struct {
+	Type   tokens.TokenType
+	Value  int // the literal's number, or -1 for keywords and operators
+	Offset int
+	End    int
+}
+
+// NextIndexed is NextToken for tokens numbered in values. Keywords and
+// operators are told apart by their type alone, so only the literals of
+// the other tokens are added to the table.
+func (l *Lexer) NextIndexed(values *Values) IndexedToken {
+	tok := l.NextToken()
+	indexed := IndexedToken{Type: tok.Type, Value: -1, Offset: tok.Offset, End: tok.End}
+	switch tok.Type {
+	case tokens.IDENT, tokens.INT, tokens.FLOAT, tokens.IMAG, tokens.DECIMAL,
+		tokens.STRING, tokens.SYMBOL, tokens.ILLEGAL:
+		indexed.Value = values.Index(tok.Literal)
+	}
+	return indexed
+}
@@ -0,0 +1,63 @@
+// Package logging is the interpreter's internal logger, which reports what
+// the lexer, parser and evaluator are doing, such as how long parsing took
+// or whether an import came from the module cache. It is off unless a host
+// or gokid --log turns it on, and costs an atomic load per check when off.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+)
+
+// current is the logger in use, nil when logging is off
+var current atomic.Pointer[slog.Logger]
+
+// Enable logs messages at level and above to w, as JSON lines when json is
+// set and as key=value text otherwise
+func Enable(w io.Writer, level slog.Level, json bool) {
+	opts := &slog.HandlerOptions{Level: level}
+	if json {
+		SetLogger(slog.New(slog.NewJSONHandler(w, opts)))
+	} else {
+		SetLogger(slog.New(slog.NewTextHandler(w, opts)))
+	}
+}
+
+// SetLogger logs to l, for hosts with a logger of their own. A nil l turns
+// logging off.
+func SetLogger(l *slog.Logger) {
+	current.Store(l)
+}
+
+// On reports whether messages at level are logged. Callers check it before
+// gathering what they would log.
+func On(level slog.Level) bool {
+	l := current.Load()
+	return l != nil && l.Enabled(context.Background(), level)
+}
+
+// Debugging reports whether debug messages are logged
+func Debugging() bool {
+	return On(slog.LevelDebug)
+}
+
+// ParseLevel reads a level name: debug, info, warn or error
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(strings.ToUpper(name)))
+	return level, err
+}
+
+func Debug(msg string, args ...any) { log(slog.LevelDebug, msg, args) }
+func Info(msg string, args ...any)  { log(slog.LevelInfo, msg, args) }
+func Warn(msg string, args ...any)  { log(slog.LevelWarn, msg, args) }
+func Error(msg string, args ...any) { log(slog.LevelError, msg, args) }
+
+func log(level slog.Level, msg string, args []any) {
+	if l := current.Load(); l != nil {
+		l.Log(context.Background(), level, msg, args...)
+	}
+}
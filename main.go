@@ -2,19 +2,289 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
+	"gokid/bundle"
+	"gokid/conformance"
+	"gokid/cover"
+	"gokid/crash"
+	"gokid/diagnostics"
 	"gokid/evaluator"
+	"gokid/highlight"
+	"gokid/kernel"
 	"gokid/lexer"
+	"gokid/logging"
+	"gokid/messages"
 	"gokid/parser"
+	"gokid/perf"
+	"gokid/project"
+	"gokid/refactor"
 	"gokid/repl"
+	"gokid/tokenizer"
+	"gokid/tokens"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
 )
 
-const VERSION = "1.0.0"
+const VERSION = evaluator.Version
+
+// replAddr, when set by --listen, serves remote REPL sessions that share
+// the interpreter's environment
+var replAddr string
+
+// errorFormat is "human" for annotated messages or, with
+// --error-format json, "json" for editors
+var errorFormat = "human"
+
+// hotReload, when set by --hot, reloads imported modules whose files change
+var hotReload bool
+
+// noEval, when set by --no-eval, disables the eval and evalIn builtins
+var noEval bool
+
+// strictSemicolons, when set by --strict, makes semicolons after
+// statements mandatory
+var strictSemicolons bool
+
+// maxIterations and loopTimeout, set by --max-iterations and
+// --loop-timeout, stop runaway loops. They are off for run and default to
+// the REPL's guard for repl.
+var (
+	maxIterations int
+	loopTimeout   time.Duration
+)
+
+// bufferOutput, when set by --buffer, buffers the program's output
+var bufferOutput bool
+
+// preloadStd, when set by --preload-std, makes the standard modules global
+// names without import "std/<name>", as older programs expect
+var preloadStd bool
+
+// noBanner, prompt and noStartup, set by --no-banner, --prompt and
+// --no-rc or by GOKID_NO_BANNER and GOKID_PROMPT, change how the REPL
+// starts
+var (
+	noBanner  bool
+	prompt    string
+	noStartup bool
+)
+
+// showStats, when set by --stats, prints the program's runtime.counters()
+// when it ends
+var showStats bool
+
+// interactive, when set by -i, starts a REPL in the program's environment
+// once it has run
+var interactive bool
+
+// outputFormat, set by --output, names the formatter that shows the REPL's
+// results and a program's final value. A program's value is only shown,
+// without the lines around its output, when it is set.
+var outputFormat string
+
+// logLevel and logFormat, set by --log and --log-format, turn on the
+// interpreter's internal log on stderr
+var (
+	logLevel  string
+	logFormat = "text"
+)
+
+// parseOptions extracts leading "--listen addr", "--hot", "--no-eval",
+// "--strict", "--preload-std", "--buffer", "-i", "--max-iterations n",
+// "--loop-timeout duration", "--error-format format", "--log level",
+// "--log-format format", "--lang locale", "--dialect name",
+// "--gokid version", "--plain", "--output format", "--minimize-crash",
+// "--stats", "--no-banner", "--prompt text" and "--no-rc" options
+func parseOptions(args []string) []string {
+	defer startLogging()
+	for len(args) > 0 {
+		switch {
+		case len(args) >= 2 && (args[0] == "--listen" || args[0] == "-listen"):
+			replAddr = args[1]
+			args = args[2:]
+		case args[0] == "--hot" || args[0] == "-hot":
+			hotReload = true
+			args = args[1:]
+		case args[0] == "--no-eval":
+			noEval = true
+			args = args[1:]
+		case args[0] == "--strict":
+			strictSemicolons = true
+			args = args[1:]
+		case args[0] == "--preload-std":
+			preloadStd = true
+			args = args[1:]
+		case args[0] == "--buffer":
+			bufferOutput = true
+			args = args[1:]
+		case args[0] == "--no-banner":
+			noBanner = true
+			args = args[1:]
+		case len(args) >= 2 && args[0] == "--prompt":
+			prompt = args[1]
+			args = args[2:]
+		case args[0] == "--no-rc":
+			noStartup = true
+			args = args[1:]
+		case args[0] == "-i" || args[0] == "--interactive":
+			interactive = true
+			args = args[1:]
+		case len(args) >= 2 && args[0] == "--max-iterations":
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 0 {
+				fmt.Printf("Error: invalid --max-iterations %q\n", args[1])
+				os.Exit(1)
+			}
+			maxIterations = n
+			args = args[2:]
+		case len(args) >= 2 && args[0] == "--loop-timeout":
+			d, err := time.ParseDuration(args[1])
+			if err != nil || d < 0 {
+				fmt.Printf("Error: invalid --loop-timeout %q\n", args[1])
+				os.Exit(1)
+			}
+			loopTimeout = d
+			args = args[2:]
+		case len(args) >= 2 && args[0] == "--error-format":
+			errorFormat = args[1]
+			args = args[2:]
+		case len(args) >= 2 && args[0] == "--log":
+			logLevel = args[1]
+			args = args[2:]
+		case args[0] == "--plain":
+			diagnostics.Plain = true
+			args = args[1:]
+		case args[0] == "--minimize-crash":
+			crash.Minimizing = true
+			args = args[1:]
+		case args[0] == "--stats":
+			showStats = true
+			args = args[1:]
+		case len(args) >= 2 && args[0] == "--output":
+			setOutputFormat(args[1])
+			args = args[2:]
+		case strings.HasPrefix(args[0], "--output="):
+			setOutputFormat(strings.TrimPrefix(args[0], "--output="))
+			args = args[1:]
+		case len(args) >= 2 && args[0] == "--dialect":
+			setDialect(args[1])
+			args = args[2:]
+		case len(args) >= 2 && args[0] == "--gokid":
+			setLanguageVersion(args[1])
+			args = args[2:]
+		case len(args) >= 2 && args[0] == "--lang":
+			setLanguage(args[1])
+			args = args[2:]
+		case len(args) >= 2 && args[0] == "--log-format":
+			if args[1] != "text" && args[1] != "json" {
+				fmt.Printf("Error: invalid --log-format %q; use text or json\n", args[1])
+				os.Exit(1)
+			}
+			logFormat = args[1]
+			args = args[2:]
+		default:
+			return args
+		}
+	}
+	return args
+}
+
+// setOutputFormat shows results with the formatter called name
+func setOutputFormat(name string) {
+	if _, err := evaluator.LookupFormatter(name); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	outputFormat = name
+	repl.Output = name
+}
+
+// setDialect makes name the dialect of files without a #dialect pragma
+func setDialect(name string) {
+	d, ok := tokens.LookupDialect(name)
+	if !ok {
+		fmt.Printf("Error: unknown dialect %s; the dialects are %s\n", name, strings.Join(tokens.Dialects(), ", "))
+		os.Exit(1)
+	}
+	lexer.DefaultDialect = d
+}
+
+// setLanguageVersion makes version, such as 0.2, the grammar of files
+// without a #lang pragma
+func setLanguageVersion(version string) {
+	v, err := parser.ParseLanguageVersion(version)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	parser.DefaultLanguage = v
+}
+
+// setLanguage shows messages in the language of locale, such as "es", or
+// of the catalog in a .json file
+func setLanguage(locale string) {
+	var err error
+	if strings.HasSuffix(locale, ".json") {
+		locale, err = messages.LoadFile(locale)
+	}
+	if err == nil {
+		err = messages.SetLocale(locale)
+	}
+	if err != nil {
+		fmt.Printf("Error: invalid --lang: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// startLogging turns on the internal log if --log was given
+func startLogging() {
+	if logLevel == "" {
+		return
+	}
+	level, err := logging.ParseLevel(logLevel)
+	if err != nil {
+		fmt.Printf("Error: invalid --log %q; use debug, info, warn or error\n", logLevel)
+		os.Exit(1)
+	}
+	logging.Enable(os.Stderr, level, logFormat == "json")
+}
+
+// listenForREPL starts serving remote REPL sessions on replAddr, if set
+func listenForREPL(env *evaluator.Environment) {
+	if replAddr == "" {
+		return
+	}
+	listener, err := repl.Listen(replAddr, env)
+	if err != nil {
+		fmt.Printf("Error: cannot listen for REPL sessions: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("REPL sessions: gokid attach %s\n", listener.Addr())
+}
 
 func main() {
+	defer crash.Recover()
+	if name, source, ok := embeddedScript(); ok {
+		runEmbedded(name, source, os.Args[1:])
+		return
+	}
+
+	if locale := os.Getenv("GOKID_LANG"); locale != "" {
+		setLanguage(locale)
+	}
+	if os.Getenv("GOKID_PLAIN") != "" {
+		diagnostics.Plain = true
+	}
+
 	if len(os.Args) < 2 {
 		printUsage()
 		return
@@ -24,14 +294,130 @@ func main() {
 
 	switch command {
 	case "run":
-		if len(os.Args) < 3 {
+		args := parseOptions(os.Args[2:])
+		if len(args) < 1 {
 			fmt.Println("Error: Please specify a .gokid file to run")
-			fmt.Println("Usage: gokid run <file.gokid>")
+			fmt.Println("Usage: gokid run [-i] [--listen addr] [--hot] <file.gokid>")
 			os.Exit(1)
 		}
-		runFile(os.Args[2])
+		runFile(args[0], args[1:])
 	case "repl", "interactive":
+		maxIterations, loopTimeout = repl.DefaultMaxIterations, repl.DefaultLoopTimeout
+		parseOptions(os.Args[2:])
 		startREPL()
+	case "build":
+		args := os.Args[2:]
+		if len(args) < 1 {
+			fmt.Println("Error: Please specify a .gokid file to build")
+			fmt.Println("Usage: gokid build <file.gokid> [-o output]")
+			os.Exit(1)
+		}
+		output := strings.TrimSuffix(filepath.Base(args[0]), filepath.Ext(args[0]))
+		if len(args) >= 3 && args[1] == "-o" {
+			output = args[2]
+		}
+		if err := buildBinary(args[0], output); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Built %s\n", output)
+	case "kernel":
+		if len(os.Args) < 3 {
+			fmt.Println("Error: Please specify a Jupyter connection file or --install")
+			fmt.Println("Usage: gokid kernel <connection-file> | --install")
+			os.Exit(1)
+		}
+		if os.Args[2] == "--install" {
+			self, err := os.Executable()
+			if err == nil {
+				var dir string
+				if dir, err = kernel.Install(self); err == nil {
+					fmt.Printf("Installed GoKid kernel spec in %s\n", dir)
+					return
+				}
+			}
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := kernel.Start(os.Args[2], VERSION); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	case "highlight":
+		args := os.Args[2:]
+		html := len(args) > 0 && args[0] == "--html"
+		if html {
+			args = args[1:]
+		}
+		if len(args) < 1 {
+			fmt.Println("Error: Please specify a .gokid file to highlight")
+			fmt.Println("Usage: gokid highlight [--html] <file.gokid>")
+			os.Exit(1)
+		}
+		source, err := os.ReadFile(args[0])
+		if err != nil {
+			fmt.Printf("Error reading file '%s': %v\n", args[0], err)
+			os.Exit(1)
+		}
+		switch {
+		case html:
+			fmt.Print(highlight.HTML(string(source)))
+		case diagnostics.Plain:
+			fmt.Print(string(source))
+		default:
+			fmt.Print(highlight.ANSI(string(source)))
+		}
+	case "attach":
+		if len(os.Args) < 3 {
+			fmt.Println("Error: Please specify the host:port to attach to")
+			fmt.Println("Usage: gokid attach <host:port>")
+			os.Exit(1)
+		}
+		if err := repl.Attach(os.Args[2], os.Stdin, os.Stdout); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	case "bundle":
+		if !runBundle(os.Args[2:]) {
+			os.Exit(1)
+		}
+	case "tokens":
+		if !runTokens(os.Args[2:]) {
+			os.Exit(1)
+		}
+	case "minimize":
+		if !runMinimize(os.Args[2:]) {
+			os.Exit(1)
+		}
+	case "check":
+		if !runCheck(os.Args[2:]) {
+			os.Exit(1)
+		}
+	case "refactor":
+		if !runRefactor(os.Args[2:]) {
+			os.Exit(1)
+		}
+	case "get":
+		if err := getDependencies(); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	case "perf":
+		if !runPerf(os.Args[2:]) {
+			os.Exit(1)
+		}
+	case "grade":
+		if !runGrade(os.Args[2:]) {
+			os.Exit(1)
+		}
+	case "test":
+		if !runTests(os.Args[2:]) {
+			os.Exit(1)
+		}
+	case "selftest":
+		if !runSelftest(os.Args[2:]) {
+			os.Exit(1)
+		}
 	case "version", "--version", "-v":
 		printVersion()
 	case "help", "--help", "-h":
@@ -39,7 +425,7 @@ func main() {
 	default:
 		// If it ends with .gokid, try to run it
 		if strings.HasSuffix(command, ".gokid") {
-			runFile(command)
+			runFile(command, os.Args[2:])
 		} else {
 			fmt.Printf("Unknown command: %s\n", command)
 			printUsage()
@@ -53,11 +439,58 @@ func printUsage() {
 	fmt.Println("Created by xspoilt-dev")
 	fmt.Println()
 	fmt.Println("Usage:")
-	fmt.Println("  gokid run <file.gokid>    Execute a GoKid source file")
-	fmt.Println("  gokid repl               Start interactive REPL")
-	fmt.Println("  gokid <file.gokid>       Execute a GoKid source file (shorthand)")
-	fmt.Println("  gokid version            Show version information")
-	fmt.Println("  gokid help               Show this help message")
+	fmt.Println("  gokid run <file.gokid> [args...]  Execute a GoKid source file")
+	fmt.Println("  gokid repl                        Start interactive REPL")
+	fmt.Println("  gokid <file.gokid> [args...]      Execute a GoKid source file (shorthand)")
+	fmt.Println("  gokid build <file.gokid> [-o out] Build a standalone executable")
+	fmt.Println("  gokid bundle <file> [-o out]      Combine a program and its modules into one file")
+	fmt.Println("  gokid highlight [--html] <file>   Print a source file with syntax colors")
+	fmt.Println("  gokid tokens [--binary] <file>    List a file's tokens, or save them for run with -o out.gkt")
+	fmt.Println("  gokid minimize <file>             Shrink a program that crashes gokid, for a bug report")
+	fmt.Println("  gokid attach <host:port>          Attach to a remote REPL session")
+	fmt.Println("  gokid kernel --install            Register GoKid as a Jupyter kernel")
+	fmt.Println("  gokid check [options] <files>     Report problems without running the files")
+	fmt.Println("  gokid refactor rename <old> <new> <file>")
+	fmt.Println("                                    Rename a variable, everywhere it is used")
+	fmt.Println("  gokid refactor extract <lines> <name> <file>")
+	fmt.Println("                                    Move lines such as 4-9 into a new function")
+	fmt.Println("  gokid refactor dialect <name> <file>")
+	fmt.Println("                                    Write a file's keywords in a dialect, such as es or en")
+	fmt.Println("  gokid get                         Fetch the dependencies listed in gokid.toml")
+	fmt.Println("  gokid perf [options] [files...]   Measure lexing, parsing and evaluation speed")
+	fmt.Println("  gokid test [--cover] [paths...]   Run the *_test.gokid files, reporting coverage with --cover")
+	fmt.Println("  gokid grade <file> --spec <spec>  Score a solution against a spec's tests, as JSON")
+	fmt.Println("  gokid selftest [--update] [dir]   Run the conformance suite, or the cases in dir")
+	fmt.Println("  gokid version                     Show version information")
+	fmt.Println("  gokid help                        Show this help message")
+	fmt.Println()
+	fmt.Println("Options for run and repl:")
+	fmt.Println("  --listen <addr>                   Serve remote REPL sessions on addr, 127.0.0.1 unless it names a host.")
+	fmt.Println("                                    Anyone who can connect can run any code as you")
+	fmt.Println("  --hot                             Reload imported modules when their files change")
+	fmt.Println("  --no-eval                         Disable the eval and evalIn builtins")
+	fmt.Println("  --strict                          Require a semicolon after every statement")
+	fmt.Println("  --max-iterations <n>              Stop any loop after n iterations (0 for no limit)")
+	fmt.Println("  --loop-timeout <duration>         Stop any loop running longer, such as 5s (0 for no limit)")
+	fmt.Println("  --buffer                          Buffer the program's output, writing it when full or flushed")
+	fmt.Println("  --stats                           Print the program's runtime.counters() when it ends")
+	fmt.Println("  --preload-std                     Make math, http and the other standard modules global without import")
+	fmt.Println("  -i                                Start a REPL with the program's variables after run")
+	fmt.Println("  --prompt <text>                   Show text as the REPL prompt instead of >>")
+	fmt.Println("  --no-banner                       Start the REPL without the banner")
+	fmt.Println("  --no-rc                           Start the REPL without running ~/.gokidrc.gk")
+	fmt.Println("  --error-format json               Print errors as JSON for editors")
+	fmt.Println("  --log <level>                     Log interpreter internals to stderr: debug, info, warn or error")
+	fmt.Println("  --log-format json                 Write the log as JSON lines instead of text")
+	fmt.Println("  --dialect <name>                  Read keywords in a dialect, such as es, in files without #dialect")
+	fmt.Println("  --gokid <version>                 Read files without #lang with the grammar of a version, such as 0.2")
+	fmt.Println("  --plain                           Print without color, drawings or symbols, for screen readers")
+	fmt.Println("  --output <format>                 Show results as json, pretty or raw; run prints the final value")
+	fmt.Println("  --lang <locale>                   Show errors in another language, such as es, or from a .json catalog")
+	fmt.Println("  --minimize-crash                  If gokid crashes, shrink the program in the crash report")
+	fmt.Println()
+	fmt.Println("Options for bundle:")
+	fmt.Println("  --minify                          Leave out comments and spaces, and shorten local names")
 	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("  gokid run hello.gokid")
@@ -65,8 +498,676 @@ func printUsage() {
 	fmt.Println("  gokid repl")
 }
 
+// runBundle writes a program and the modules it imports as one file, to
+// the file given by -o or to stdout, and reports what it left out on
+// stderr. With --minify the file is as small as it can be made. It
+// returns whether the bundle was written.
+func runBundle(args []string) bool {
+	minify := len(args) > 0 && args[0] == "--minify"
+	if minify {
+		args = args[1:]
+	}
+	if len(args) != 1 && (len(args) != 3 || args[1] != "-o") {
+		fmt.Println("Usage: gokid bundle [--minify] <file.gokid> [-o output]")
+		return false
+	}
+	result, err := bundle.Bundle(args[0])
+	if err == nil && minify {
+		result.Source, err = bundle.Minify(result.Source, evaluator.NewEnvironment().Defines)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return false
+	}
+	if len(args) == 1 {
+		fmt.Print(result.Source)
+	} else if err := os.WriteFile(args[2], []byte(result.Source), 0o644); err != nil {
+		fmt.Printf("Error writing file '%s': %v\n", args[2], err)
+		return false
+	}
+	noun := "modules"
+	if len(result.Modules) == 1 {
+		noun = "module"
+	}
+	fmt.Fprintf(os.Stderr, "bundled %d %s", len(result.Modules), noun)
+	if len(result.Removed) > 0 {
+		fmt.Fprintf(os.Stderr, ", leaving out %s", strings.Join(result.Removed, ", "))
+	}
+	fmt.Fprintln(os.Stderr)
+	return true
+}
+
+// runMinimize prints a smaller program that crashes the interpreter the
+// same way as the one in the file given, such as the program of a crash
+// report. It returns whether the program crashed it.
+func runMinimize(args []string) bool {
+	if len(args) != 1 {
+		fmt.Println("Error: Please specify the .gokid file that crashes gokid")
+		fmt.Println("Usage: gokid minimize <file.gokid>")
+		return false
+	}
+	source, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Printf("Error reading file '%s': %v\n", args[0], err)
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "Minimizing %s, for up to %s...\n", args[0], crash.MinimizeTime)
+	repro, ok := crash.Minimize(args[0], string(source), crash.MinimizeTime)
+	if !ok {
+		fmt.Printf("Error: %s does not crash gokid; there is nothing to minimize\n", args[0])
+		return false
+	}
+	fmt.Print(repro)
+	return true
+}
+
+// runTokens lists the tokens of a program, one a line, or with --binary
+// writes them as a token stream that gokid run and the parser can read
+// later without lexing the program again. The output goes to the file
+// given by -o or to stdout. It returns whether the tokens were written.
+func runTokens(args []string) bool {
+	stream := len(args) > 0 && args[0] == "--binary"
+	if stream {
+		args = args[1:]
+	}
+	if len(args) != 1 && (len(args) != 3 || args[1] != "-o") {
+		fmt.Println("Usage: gokid tokens [--binary] <file.gokid> [-o output]")
+		return false
+	}
+	source, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Printf("Error reading file '%s': %v\n", args[0], err)
+		return false
+	}
+
+	var out bytes.Buffer
+	if stream {
+		tokenizer.WriteStream(&out, string(source))
+	} else {
+		src := diagnostics.NewSource(args[0], string(source))
+		for _, tok := range tokenizer.NewTokenizer(string(source)).GetTokens() {
+			line, column := src.Position(tok.Offset)
+			fmt.Fprintf(&out, "%d:%d\t%s\t%q\n", line, column, tok.Type, tok.Literal)
+		}
+	}
+	if len(args) == 1 {
+		os.Stdout.Write(out.Bytes())
+	} else if err := os.WriteFile(args[2], out.Bytes(), 0o644); err != nil {
+		fmt.Printf("Error writing file '%s': %v\n", args[2], err)
+		return false
+	}
+	return true
+}
+
+// runCheck parses files without running them and reports their errors,
+// warnings and style suggestions, in the format given by --error-format.
+// With --resolve it also reports names that are never defined, and with
+// --fix it first applies the fixes the problems come with and rewrites
+// the files. It returns whether every file was free of errors.
+func runCheck(args []string) bool {
+	resolve, fix := false, false
+	for len(args) > 0 && (args[0] == "--resolve" || args[0] == "--fix") {
+		resolve = resolve || args[0] == "--resolve"
+		fix = fix || args[0] == "--fix"
+		args = args[1:]
+	}
+	args = parseOptions(args)
+	if len(args) < 1 {
+		fmt.Println("Error: Please specify the .gokid files to check")
+		fmt.Println("Usage: gokid check [--resolve] [--fix] [--strict] [--error-format json] <files...>")
+		os.Exit(1)
+	}
+
+	// Only diagnostics outlive each file's parse, so one arena serves them all
+	arena := parser.NewArena()
+	ok := true
+	for _, filename := range args {
+		source, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Printf("Error reading file '%s': %v\n", filename, err)
+			ok = false
+			continue
+		}
+
+		diags := checkSource(string(source), resolve, arena)
+		if fix {
+			fixed, n := diagnostics.ApplyFixes(string(source), diags)
+			if n > 0 {
+				if err := os.WriteFile(filename, []byte(fixed), 0o644); err != nil {
+					fmt.Printf("Error writing file '%s': %v\n", filename, err)
+					ok = false
+					continue
+				}
+				if errorFormat != "json" {
+					noun := "problems"
+					if n == 1 {
+						noun = "problem"
+					}
+					fmt.Printf("fixed %d %s in %s\n", n, noun, filename)
+				}
+				source = []byte(fixed)
+				diags = checkSource(fixed, resolve, arena)
+			}
+		}
+
+		for _, d := range diags {
+			if d.Severity == diagnostics.Error {
+				ok = false
+			}
+		}
+		if len(diags) > 0 || errorFormat == "json" {
+			reportDiagnostics(os.Stdout, diagnostics.NewSource(filename, string(source)), diags)
+		}
+	}
+	return ok
+}
+
+// checkSource returns the problems gokid check reports in source, in
+// source order. It parses into arena, after resetting it.
+func checkSource(source string, resolve bool, arena *parser.Arena) []diagnostics.Diagnostic {
+	arena.Reset()
+	p := parser.NewWithArena(lexer.NewLexer(source), arena)
+	p.SetStrictSemicolons(strictSemicolons)
+	program := p.ParseProgram()
+	diags := append(p.Diagnostics(), p.Warnings()...)
+	if len(p.Errors()) == 0 {
+		diags = append(diags, parser.Suggestions(program)...)
+	}
+	if resolve && len(p.Errors()) == 0 {
+		env := evaluator.NewEnvironment()
+		if preloadStd {
+			env.PreloadModules()
+		}
+		diags = append(diags, parser.Unresolved(program, env.Defines)...)
+	}
+	sort.SliceStable(diags, func(i, j int) bool { return diags[i].Offset < diags[j].Offset })
+	return diags
+}
+
+// runRefactor rewrites a file with a refactoring: renaming a variable,
+// extracting lines into a function, or writing the keywords in another
+// dialect. With --json it prints the edits for
+// an editor to apply instead. It returns whether the refactoring was made.
+func runRefactor(args []string) bool {
+	usage := func() bool {
+		fmt.Println("Usage: gokid refactor rename [--at line:column] [--json] <old> <new> <file>")
+		fmt.Println("       gokid refactor extract [--json] <first>-<last> <name> <file>")
+		fmt.Println("       gokid refactor dialect [--json] <dialect> <file>")
+		return false
+	}
+	if len(args) < 1 {
+		return usage()
+	}
+	kind, args := args[0], args[1:]
+	asJSON := false
+	at := ""
+	for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+		switch {
+		case args[0] == "--json":
+			asJSON = true
+		case args[0] == "--at" && len(args) > 1 && kind == "rename":
+			at = args[1]
+			args = args[1:]
+		default:
+			return usage()
+		}
+		args = args[1:]
+	}
+	want := 3
+	if kind == "dialect" {
+		want = 2
+	}
+	if len(args) != want || kind != "rename" && kind != "extract" && kind != "dialect" {
+		return usage()
+	}
+	filename := args[want-1]
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Printf("Error reading file '%s': %v\n", filename, err)
+		return false
+	}
+	src := diagnostics.NewSource(filename, string(source))
+	known := evaluator.NewEnvironment().Defines
+
+	var edits []diagnostics.Edit
+	var title, done string
+	switch kind {
+	case "rename":
+		offset := -1
+		if at != "" {
+			var line, column int
+			if _, err := fmt.Sscanf(at, "%d:%d", &line, &column); err != nil {
+				fmt.Printf("Error: --at wants a line and column such as 12:5, not %s\n", at)
+				return false
+			}
+			offset = src.Offset(line, column)
+		}
+		edits, err = refactor.Rename(string(source), args[0], args[1], offset, known)
+		title = fmt.Sprintf("rename %s to %s", args[0], args[1])
+		done = fmt.Sprintf("renamed %d uses of %s to %s in %s", len(edits), args[0], args[1], filename)
+	case "extract":
+		var first, last int
+		if _, err := fmt.Sscanf(args[0], "%d-%d", &first, &last); err != nil {
+			if _, err := fmt.Sscanf(args[0], "%d", &first); err != nil {
+				fmt.Printf("Error: the lines to extract are a range such as 4-9, not %s\n", args[0])
+				return false
+			}
+			last = first
+		}
+		edits, err = refactor.Extract(string(source), first, last, args[1], known)
+		title = fmt.Sprintf("extract lines %d to %d into %s", first, last, args[1])
+		done = fmt.Sprintf("extracted lines %d to %d of %s into %s", first, last, filename, args[1])
+	case "dialect":
+		edits, err = refactor.Dialect(string(source), args[0])
+		title = fmt.Sprintf("write the keywords in dialect %s", args[0])
+		done = fmt.Sprintf("wrote the keywords of %s in dialect %s", filename, args[0])
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return false
+	}
+
+	if asJSON {
+		diagnostics.WriteEditsJSON(os.Stdout, src, title, edits)
+		return true
+	}
+	if err := os.WriteFile(filename, []byte(diagnostics.ApplyEdits(string(source), edits)), 0o644); err != nil {
+		fmt.Printf("Error writing file '%s': %v\n", filename, err)
+		return false
+	}
+	fmt.Println(done)
+	return true
+}
+
+// runGrade scores a solution against the tests of a spec and prints the
+// report as JSON. It returns whether both files could be read.
+func runGrade(args []string) bool {
+	var solution, spec string
+	options := evaluator.GradeOptions{Timeout: 5 * time.Second, Memory: 256 << 20, Output: 1 << 20}
+	for i := 0; i < len(args); i++ {
+		value := ""
+		if strings.HasPrefix(args[i], "--") && i+1 < len(args) {
+			value = args[i+1]
+		}
+		var err error
+		switch args[i] {
+		case "--spec":
+			spec = value
+		case "--timeout":
+			options.Timeout, err = time.ParseDuration(value)
+		case "--memory":
+			var mb uint64
+			mb, err = strconv.ParseUint(value, 10, 64)
+			options.Memory = mb << 20
+		case "--output":
+			options.Output, err = strconv.ParseInt(value, 10, 64)
+		default:
+			solution = args[i]
+			continue
+		}
+		if err != nil || value == "" {
+			fmt.Printf("Error: bad value for %s: %q\n", args[i], value)
+			return false
+		}
+		i++
+	}
+	if solution == "" || spec == "" {
+		fmt.Println("Usage: gokid grade <solution.gokid> --spec <spec.gokid> [--timeout 5s] [--memory <MB>] [--output <bytes>]")
+		return false
+	}
+
+	solutionSource, err := os.ReadFile(solution)
+	if err != nil {
+		fmt.Printf("Error reading file '%s': %v\n", solution, err)
+		return false
+	}
+	specSource, err := os.ReadFile(spec)
+	if err != nil {
+		fmt.Printf("Error reading file '%s': %v\n", spec, err)
+		return false
+	}
+	options.Path = solution
+	report := evaluator.Grade(string(solutionSource), string(specSource), options)
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+	return true
+}
+
+// runSelftest runs the conformance suite built into gokid, or the cases
+// in a directory, with the evaluator. With --update it rewrites the
+// directory's golden files from what the evaluator gives instead.
+func runSelftest(args []string) bool {
+	update := len(args) > 0 && args[0] == "--update"
+	if update {
+		args = args[1:]
+	}
+	if update {
+		if len(args) != 1 {
+			fmt.Println("Usage: gokid selftest --update <dir>")
+			return false
+		}
+		return inDir(args[0], func() bool {
+			changed, err := conformance.Update(".", evaluatorEngine)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return false
+			}
+			for _, name := range changed {
+				fmt.Printf("updated %s\n", name)
+			}
+			return true
+		})
+	}
+
+	// The cases run in their directory, so they can import the modules
+	// beside them; the built-in suite is written out to one first
+	dir := ""
+	if len(args) > 0 {
+		dir = args[0]
+	} else {
+		tmp, err := os.MkdirTemp("", "gokid-selftest")
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return false
+		}
+		defer os.RemoveAll(tmp)
+		if err := os.CopyFS(tmp, conformance.Suite()); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return false
+		}
+		dir = tmp
+	}
+	return inDir(dir, runSuite)
+}
+
+// inDir runs fn with dir as the working directory
+func inDir(dir string, fn func() bool) bool {
+	wd, err := os.Getwd()
+	if err == nil {
+		err = os.Chdir(dir)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return false
+	}
+	defer os.Chdir(wd)
+	return fn()
+}
+
+// runSuite runs the conformance cases in the working directory, and the
+// test files in its tests directory as gokid test runs them
+func runSuite() bool {
+	cases, err := conformance.Load(os.DirFS("."))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return false
+	}
+	passed := true
+	if tests, _ := filepath.Glob(filepath.Join("tests", "*_test.gokid")); len(tests) > 0 {
+		passed = runTests(tests)
+	}
+	failed := 0
+	for _, c := range cases {
+		result := c.Run(evaluatorEngine)
+		if !result.Passed {
+			failed++
+			fmt.Printf("FAIL  %s\n", c.Name)
+			result.Report(os.Stdout)
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("FAIL  %d of %d cases\n", failed, len(cases))
+		return false
+	}
+	fmt.Printf("ok    %d cases\n", len(cases))
+	return passed
+}
+
+// evaluatorEngine runs a conformance case with the tree-walking evaluator,
+// with a loop guard so a case that never ends fails instead of hanging
+func evaluatorEngine(name, source string, out io.Writer) error {
+	env := evaluator.NewEnvironment()
+	env.SetPath(name)
+	env.SetOutput(out, out)
+	env.SetLoopGuard(repl.DefaultMaxIterations, repl.DefaultLoopTimeout)
+	_, err := evaluator.Run(env, source)
+	return err
+}
+
+// runTests runs the test files named, or the *_test.gokid files in the
+// directories named (the current one by default), each in an interpreter
+// of its own. A test fails when its file stops with an error, and what it
+// printed is shown only then; test files read their input from stdin and
+// check their output with expectOutput. With --cover
+// it then reports what the tests ran of the other files: a summary of
+// each, and the annotated source of those with statements never run. It
+// returns whether every test passed.
+func runTests(args []string) bool {
+	cover := false
+	if len(args) > 0 && args[0] == "--cover" {
+		cover = true
+		args = args[1:]
+	}
+	args = parseOptions(args)
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return false
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		matches, _ := filepath.Glob(filepath.Join(arg, "*_test.gokid"))
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		fmt.Println("no test files")
+		return true
+	}
+
+	var coverage *evaluator.Coverage
+	if cover {
+		coverage = evaluator.NewCoverage()
+	}
+	passed := true
+	for _, filename := range files {
+		source, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Printf("Error reading file '%s': %v\n", filename, err)
+			passed = false
+			continue
+		}
+
+		// Each file is a new interpreter, importing its modules afresh so
+		// they print to its own output
+		env := evaluator.NewEnvironment()
+		env.SetPath(filename)
+		env.SetLoopGuard(maxIterations, loopTimeout)
+		env.SetCoverage(coverage)
+		fixtures := env.UseFixtures()
+		if preloadStd {
+			env.PreloadModules()
+		}
+		if noEval {
+			env.DisableEval()
+		}
+		evaluator.SetArgs([]string{filename})
+		start := time.Now()
+		_, err = evaluator.Run(env, string(source))
+		elapsed := time.Since(start).Round(time.Millisecond)
+
+		if evaluator.ExitCode(err) == evaluator.ExitOK {
+			fmt.Printf("ok    %s\t%v\n", filename, elapsed)
+			continue
+		}
+		passed = false
+		fmt.Printf("FAIL  %s\t%v\n", filename, elapsed)
+		fmt.Print(fixtures.Output())
+		src := diagnostics.NewSource(filename, string(source))
+		switch err := err.(type) {
+		case *evaluator.ParseError:
+			reportDiagnostics(os.Stderr, src, err.Diagnostics)
+		case *evaluator.Error:
+			reportError(src, err)
+		case *evaluator.ExitError:
+			fmt.Fprintf(os.Stderr, "exited with status %d\n", err.Status)
+		}
+	}
+
+	if coverage != nil {
+		reportCoverage(coverage)
+	}
+	return passed
+}
+
+// reportCoverage prints what share of each file's statements ran, other
+// than the tests', followed by the source of files with statements that
+// never ran
+func reportCoverage(coverage *evaluator.Coverage) {
+	var files []*cover.File
+	statements, covered := 0, 0
+	dir, _ := os.Getwd()
+	for _, path := range coverage.Files() {
+		if strings.HasSuffix(path, "_test.gokid") {
+			continue
+		}
+		source, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		name := path
+		if rel, err := filepath.Rel(dir, path); err == nil && !strings.HasPrefix(rel, "..") {
+			name = rel
+		}
+		file, err := cover.Profile(name, string(source), coverage.Hits(path))
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			continue
+		}
+		files = append(files, file)
+		statements += file.Statements
+		covered += file.Covered
+	}
+	if len(files) == 0 {
+		fmt.Println("coverage: no statements outside the tests ran")
+		return
+	}
+
+	for _, file := range files {
+		if file.Covered < file.Statements {
+			fmt.Println()
+			fmt.Println(file.Summary())
+			file.Annotate(os.Stdout)
+		}
+	}
+	fmt.Println()
+	for _, file := range files {
+		fmt.Println(file.Summary())
+	}
+	total := &cover.File{Path: "total", Statements: statements, Covered: covered}
+	fmt.Println(total.Summary())
+}
+
+// getDependencies fetches the dependencies of the project the current
+// directory is in into its gokid_modules directory
+func getDependencies() error {
+	path := project.Find(".")
+	if path == "" {
+		return fmt.Errorf("no %s in this directory or above it", project.ManifestFile)
+	}
+	m, err := project.Load(path)
+	if err != nil {
+		return err
+	}
+	err = project.Get(m, func(dep project.Dependency, file string) {
+		fmt.Printf("fetched %s from %s\n", dep.Name, dep.Source)
+	})
+	if err == nil && len(m.Dependencies) == 0 {
+		fmt.Printf("%s lists no dependencies\n", path)
+	}
+	return err
+}
+
+// runPerf measures the bundled corpus, or the given files, and reports
+// whether every rate met the budget given by --min-tokens,
+// --min-statements and --min-evals
+func runPerf(args []string) bool {
+	var budget perf.Budget
+	duration := 200 * time.Millisecond
+	for len(args) >= 2 && strings.HasPrefix(args[0], "--") {
+		var err error
+		switch args[0] {
+		case "--time":
+			duration, err = time.ParseDuration(args[1])
+		case "--min-tokens":
+			budget.TokensPerSec, err = strconv.ParseFloat(args[1], 64)
+		case "--min-statements":
+			budget.StatementsPerSec, err = strconv.ParseFloat(args[1], 64)
+		case "--min-evals":
+			budget.EvalsPerSec, err = strconv.ParseFloat(args[1], 64)
+		default:
+			err = fmt.Errorf("unknown option")
+		}
+		if err != nil {
+			fmt.Printf("Error: invalid %s %q\n", args[0], args[1])
+			fmt.Println("Usage: gokid perf [--time 200ms] [--min-tokens n] [--min-statements n] [--min-evals n] [files...]")
+			os.Exit(1)
+		}
+		args = args[2:]
+	}
+
+	programs := perf.Corpus()
+	if len(args) > 0 {
+		programs = nil
+		for _, filename := range args {
+			source, err := os.ReadFile(filename)
+			if err != nil {
+				fmt.Printf("Error reading file '%s': %v\n", filename, err)
+				os.Exit(1)
+			}
+			programs = append(programs, perf.Program{Name: filename, Source: string(source)})
+		}
+	}
+
+	var failures []string
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "program\ttokens/s\tstatements/s\tevals/s\t")
+	for _, program := range programs {
+		r := perf.Measure(program, duration)
+		fmt.Fprintf(w, "%s\t%.0f\t%.0f\t%.0f\t\n", r.Name, r.TokensPerSec(), r.StatementsPerSec(), r.EvalsPerSec())
+		if r.Error != "" {
+			failures = append(failures, fmt.Sprintf("%s: stopped with an error: %s", r.Name, r.Error))
+		}
+		failures = append(failures, budget.Check(r)...)
+	}
+	w.Flush()
+
+	for _, failure := range failures {
+		fmt.Println(failure)
+	}
+	return len(failures) == 0
+}
+
 func printVersion() {
+	info := evaluator.Build()
 	fmt.Printf("GoKid Language Interpreter v%s\n", VERSION)
+	commit := info.Commit
+	if commit == "" {
+		commit = "unknown"
+	} else if info.Modified {
+		commit += " (modified)"
+	}
+	fmt.Printf("Commit:  %s\n", commit)
+	fmt.Printf("Go:      %s\n", info.GoVersion)
+	fmt.Printf("Engines: %s\n", strings.Join(info.Engines, ", "))
 	fmt.Println("Created by xspoilt-dev")
 	fmt.Println("GitHub: https://github.com/xspoilt-dev/gokid")
 }
@@ -75,18 +1176,30 @@ func printHelp() {
 	printUsage()
 	fmt.Println()
 	fmt.Println("GoKid Language Features:")
-	fmt.Println("  • Variables: let, const, var")
-	fmt.Println("  • Data types: integers, floats, strings, booleans, arrays, objects")
-	fmt.Println("  • Operators: arithmetic, comparison, logical, assignment")
-	fmt.Println("  • Control flow: if/else statements, while loops")
-	fmt.Println("  • Functions: function expressions and calls")
-	fmt.Println("  • Built-ins: print(), len(), type()")
-	fmt.Println("  • Interactive REPL for development and testing")
+	bullet := "  • "
+	if diagnostics.Plain {
+		bullet = "  "
+	}
+	fmt.Println(bullet + "Variables: let, const, var")
+	fmt.Println(bullet + "Data types: integers, floats, strings, booleans, arrays, objects")
+	fmt.Println(bullet + "Operators: arithmetic, comparison, logical, assignment")
+	fmt.Println(bullet + "Control flow: if/else statements, while loops")
+	fmt.Println(bullet + "Functions: function expressions and calls")
+	fmt.Println(bullet + "Built-ins: print(), len(), type()")
+	fmt.Println(bullet + "Interactive REPL for development and testing")
 	fmt.Println()
 	fmt.Println("For more information, visit: https://github.com/xspoilt-dev/gokid")
 }
 
-func runFile(filename string) {
+// divider prints a line of n dashes, which plain mode leaves out since a
+// screen reader reads each one
+func divider(n int) {
+	if !diagnostics.Plain {
+		fmt.Println(strings.Repeat("-", n))
+	}
+}
+
+func runFile(filename string, args []string) {
 	// Check if file exists
 	if _, err := os.Stat(filename); os.IsNotExist(err) {
 		fmt.Printf("Error: File '%s' not found\n", filename)
@@ -94,7 +1207,7 @@ func runFile(filename string) {
 	}
 
 	// Check file extension
-	if !strings.HasSuffix(filename, ".gokid") {
+	if !strings.HasSuffix(filename, ".gokid") && !strings.HasSuffix(filename, tokenizer.StreamExt) {
 		fmt.Printf("Warning: File '%s' doesn't have .gokid extension\n", filename)
 		fmt.Print("Continue anyway? (y/N): ")
 		reader := bufio.NewReader(os.Stdin)
@@ -116,48 +1229,379 @@ func runFile(filename string) {
 	// Get absolute path for better error reporting
 	absPath, _ := filepath.Abs(filename)
 
-	fmt.Printf("Executing: %s\n", absPath)
-	fmt.Println(strings.Repeat("-", 50))
+	if outputFormat == "" {
+		fmt.Printf("Executing: %s\n", absPath)
+		divider(50)
+	}
 
-	// Execute the program
-	executeProgram(string(content), filename)
+	// Expose the script path and its arguments as os.args
+	evaluator.SetArgs(append([]string{filename}, args...))
+
+	// Execute the program, from the tokens gokid tokens --binary kept if
+	// the file holds a token stream
+	if tokenizer.IsStream(content) {
+		source, toks, err := tokenizer.ReadStream(content)
+		if err != nil {
+			fmt.Printf("Error reading file '%s': %v\n", filename, err)
+			os.Exit(1)
+		}
+		executeProgram(source, filename, lexer.Replay(source, toks))
+		return
+	}
+	executeProgram(string(content), filename, lexer.NewLexer(string(content)))
 }
 
-func executeProgram(source string, filename string) {
-	// Create lexer and parser
-	l := lexer.NewLexer(source)
+// executeProgram parses and runs source, whose tokens l returns
+func executeProgram(source string, filename string, l *lexer.Lexer) {
+	crash.Watch(filename, source, nil)
+
+	// Create parser
 	p := parser.New(l)
+	p.SetStrictSemicolons(strictSemicolons)
 	program := p.ParseProgram()
 
 	// Check for parsing errors
-	errors := p.Errors()
-	if len(errors) > 0 {
-		fmt.Printf("Parsing errors in %s:\n", filename)
-		for i, err := range errors {
-			fmt.Printf("  %d: %s\n", i+1, err)
-		}
-		os.Exit(1)
+	if len(p.Errors()) > 0 {
+		reportDiagnostics(os.Stderr, diagnostics.NewSource(filename, source), p.Diagnostics())
+		os.Exit(evaluator.ExitParse)
+	}
+
+	// Warnings go to stderr, apart from the program's own output
+	src := diagnostics.NewSource(filename, source)
+	if len(p.Warnings()) > 0 {
+		reportDiagnostics(os.Stderr, src, p.Warnings())
 	}
 
 	// Execute the program
 	env := evaluator.NewEnvironment()
+	env.SetPath(filename)
+	env.SetSource(source)
+	env.SetLoopGuard(maxIterations, loopTimeout)
+	crash.Watch(filename, source, env)
+	if preloadStd {
+		env.PreloadModules()
+	}
+	if bufferOutput {
+		env.SetOutputBuffer(64 * 1024)
+	}
+	if noEval {
+		env.DisableEval()
+	}
+	env.OnWarning(func(w *evaluator.Warning) {
+		reportDiagnostics(os.Stderr, sourceFor(w.Path, src), []diagnostics.Diagnostic{w.Diagnostic()})
+	})
+	listenForREPL(env)
+	if hotReload {
+		env.EnableHotReload(500 * time.Millisecond)
+	}
+	start := time.Now()
 	result := evaluator.Eval(program, env)
+	logging.Debug("ran program", "path", filename, "steps", env.Steps(), "duration", time.Since(start))
+	evaluator.LogStats()
+	// With -i, os.atexit functions and the counters wait for the REPL to end
+	if !interactive {
+		if err := env.RunExitHooks(); err != nil {
+			if _, failed := result.(*evaluator.Error); !failed {
+				result = err
+			}
+		}
+	}
+	env.Flush()
+	if !interactive {
+		printCounters(env)
+	}
 
-	// Handle runtime errors
-	if result != nil && result.Type() == "ERROR" {
-		fmt.Printf("Runtime error: %s\n", result.Inspect())
-		os.Exit(1)
+	// Handle runtime errors. With -i the REPL still starts, to look at
+	// the state the program failed in, unless the program called os.exit.
+	if err, ok := result.(*evaluator.Error); ok {
+		if err.Code == evaluator.E_EXIT {
+			os.Exit(err.Status)
+		}
+		reportError(src, err)
+		if !interactive {
+			os.Exit(evaluator.ExitUncaught)
+		}
+	} else if outputFormat != "" {
+		showValue(result)
+	} else {
+		divider(50)
+		fmt.Println("Program executed successfully.")
+	}
+
+	if interactive {
+		fmt.Println("Entering REPL with the program's variables. Type 'exit' to quit.")
+		setPrompt()
+		endREPL(env, repl.Run(os.Stdin, os.Stdout, env))
 	}
+}
 
-	fmt.Println(strings.Repeat("-", 50))
-	fmt.Println("Program executed successfully.")
+// showValue prints a program's final value with the --output formatter,
+// exiting with an error when the formatter cannot show it
+func showValue(result evaluator.Object) {
+	if result == nil {
+		return
+	}
+	format, _ := evaluator.LookupFormatter(outputFormat)
+	text, err := format(result)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: cannot show the result as %s: %v\n", outputFormat, err)
+		os.Exit(evaluator.ExitUncaught)
+	}
+	fmt.Println(text)
+}
+
+// reportError prints an error nothing caught to stderr, followed in the
+// text format by the value thrown and the functions the error passed out of
+func reportError(src *diagnostics.Source, err *evaluator.Error) {
+	reportDiagnostics(os.Stderr, sourceFor(err.Path, src), []diagnostics.Diagnostic{err.Diagnostic()})
+	if errorFormat == "json" {
+		return
+	}
+	if err.Thrown != nil && err.Thrown.Type() != evaluator.STRING_OBJ {
+		fmt.Fprintf(os.Stderr, "thrown: %s\n", err.Thrown.Inspect())
+	}
+	for _, frame := range err.Stack {
+		fmt.Fprintf(os.Stderr, "    at %s\n", frame)
+	}
+	if err.Dropped > 0 {
+		fmt.Fprintf(os.Stderr, "    ... %d more\n", err.Dropped)
+	}
+}
+
+// reportDiagnostics prints diagnostics in the selected error format
+func reportDiagnostics(w io.Writer, src *diagnostics.Source, diags []diagnostics.Diagnostic) {
+	if errorFormat == "json" {
+		diagnostics.WriteJSON(w, src, diags)
+		return
+	}
+	diagnostics.Render(w, src, diags, isTerminal(w))
+}
+
+// sourceFor returns the source a runtime error or warning points into,
+// which may be an imported module rather than the program itself
+func sourceFor(path string, program *diagnostics.Source) *diagnostics.Source {
+	if path != "" && path != program.Name {
+		if text, err := os.ReadFile(path); err == nil {
+			return diagnostics.NewSource(path, string(text))
+		}
+	}
+	return program
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
 }
 
 func startREPL() {
-	fmt.Printf("GoKid Language REPL v%s\n", VERSION)
-	fmt.Println("Created by xspoilt-dev")
-	fmt.Println("Type 'exit' or press Ctrl+C to quit")
-	fmt.Println(strings.Repeat("-", 40))
+	setPrompt()
+	if os.Getenv("GOKID_NO_BANNER") != "" {
+		noBanner = true
+	}
+	if !noBanner {
+		fmt.Printf("GoKid Language REPL v%s\n", VERSION)
+		fmt.Println("Created by xspoilt-dev")
+		fmt.Println("Type 'exit' or press Ctrl+C to quit")
+		divider(40)
+	}
+
+	env := evaluator.NewEnvironment()
+	env.SetLoopGuard(maxIterations, loopTimeout)
+	if preloadStd {
+		env.PreloadModules()
+	}
+	if noEval {
+		env.DisableEval()
+	}
+	listenForREPL(env)
+	if hotReload {
+		env.EnableHotReload(500 * time.Millisecond)
+	}
+	if !noBanner {
+		fmt.Print(repl.Banner())
+	}
+	if !noStartup {
+		if path := startupFile(); path != "" {
+			if err := repl.RunStartup(path, os.Stdout, env); err != nil {
+				endREPL(env, err)
+				return
+			}
+		}
+	}
+	endREPL(env, repl.Run(os.Stdin, os.Stdout, env))
+}
+
+// setPrompt sets the REPL prompt given by --prompt or GOKID_PROMPT
+func setPrompt() {
+	if prompt == "" {
+		prompt = os.Getenv("GOKID_PROMPT")
+	}
+	if prompt != "" {
+		repl.Prompt = prompt
+	}
+}
+
+// startupFile returns the file run when the REPL starts: $GOKID_RC, or
+// .gokidrc.gk in the home directory
+func startupFile() string {
+	if path := os.Getenv("GOKID_RC"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".gokidrc.gk")
+}
 
-	repl.Start(os.Stdin, os.Stdout)
+// endREPL runs the os.atexit functions of a REPL session that ended with
+// err, then exits with the session's status
+func endREPL(env *evaluator.Environment, err error) {
+	if hookErr := env.RunExitHooks(); hookErr != nil && err == nil {
+		if hookErr.Code != evaluator.E_EXIT {
+			fmt.Fprintf(os.Stderr, "error: %s\n", hookErr.Message)
+		}
+		err = hookErr
+	}
+	env.Flush()
+	printCounters(env)
+	if err != nil {
+		os.Exit(evaluator.ExitCode(err))
+	}
+}
+
+// printCounters prints the counters of runtime.counters() to stderr, each
+// with its count, when --stats is set
+func printCounters(env *evaluator.Environment) {
+	counters := env.Counters()
+	names := counters.Names()
+	if !showStats || len(names) == 0 {
+		return
+	}
+	width := 0
+	for _, name := range names {
+		width = max(width, len(name))
+	}
+	fmt.Fprintln(os.Stderr, "counters:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-*s  %d\n", width, name, counters.Get(name))
+	}
+}
+
+// A built program is the gokid executable followed by the script name and
+// source, their length and this marker
+const embedMagic = "\x00GOKID-EMBEDDED-SCRIPT\x00"
+
+// buildBinary writes a standalone executable that runs filename
+func buildBinary(filename, output string) error {
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	p := parser.New(lexer.NewLexer(string(source)))
+	p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return fmt.Errorf("parsing errors in %s:\n  %s", filename, strings.Join(p.Errors(), "\n  "))
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	interpreter, err := os.ReadFile(self)
+	if err != nil {
+		return err
+	}
+	// Building from a built program reuses just its interpreter
+	if size, _, ok := splitEmbedded(interpreter); ok {
+		interpreter = interpreter[:size]
+	}
+
+	payload := append([]byte(filepath.Base(filename)+"\x00"), source...)
+	var out bytes.Buffer
+	out.Write(interpreter)
+	out.Write(payload)
+	binary.Write(&out, binary.BigEndian, uint64(len(payload)))
+	out.WriteString(embedMagic)
+
+	return os.WriteFile(output, out.Bytes(), 0755)
+}
+
+// splitEmbedded finds an embedded script at the end of an executable,
+// returning the size of the interpreter part and the payload
+func splitEmbedded(data []byte) (int, []byte, bool) {
+	if !bytes.HasSuffix(data, []byte(embedMagic)) {
+		return 0, nil, false
+	}
+	end := len(data) - len(embedMagic)
+	if end < 8 {
+		return 0, nil, false
+	}
+	length := binary.BigEndian.Uint64(data[end-8 : end])
+	if length > uint64(end-8) {
+		return 0, nil, false
+	}
+	start := end - 8 - int(length)
+	return start, data[start : end-8], true
+}
+
+// embeddedScript returns the script built into this executable, if any.
+// Only the tail of the file is read unless the marker is present.
+func embeddedScript() (string, string, bool) {
+	self, err := os.Executable()
+	if err != nil {
+		return "", "", false
+	}
+	file, err := os.Open(self)
+	if err != nil {
+		return "", "", false
+	}
+	defer file.Close()
+
+	tail := make([]byte, len(embedMagic))
+	if _, err := file.Seek(-int64(len(tail)), io.SeekEnd); err != nil {
+		return "", "", false
+	}
+	if _, err := io.ReadFull(file, tail); err != nil || string(tail) != embedMagic {
+		return "", "", false
+	}
+
+	file.Seek(0, io.SeekStart)
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", "", false
+	}
+	_, payload, ok := splitEmbedded(data)
+	if !ok {
+		return "", "", false
+	}
+	name, source, found := strings.Cut(string(payload), "\x00")
+	if !found {
+		return "", "", false
+	}
+	return name, source, true
+}
+
+// runEmbedded runs a built program without the interpreter's banners
+func runEmbedded(name, source string, args []string) {
+	evaluator.SetArgs(append([]string{name}, args...))
+
+	env := evaluator.NewEnvironment()
+	_, err := evaluator.Run(env, source)
+
+	src := diagnostics.NewSource(name, source)
+	switch err := err.(type) {
+	case *evaluator.ParseError:
+		reportDiagnostics(os.Stderr, src, err.Diagnostics)
+	case *evaluator.Error:
+		reportError(src, err)
+	}
+	if err != nil {
+		os.Exit(evaluator.ExitCode(err))
+	}
 }
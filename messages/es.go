@@ -0,0 +1,67 @@
+package messages
+
+// The Spanish catalog covers the messages beginners meet most
+func init() {
+	Register("es", Catalog{
+		"error":   "error",
+		"warning": "advertencia",
+		"note":    "nota",
+
+		"in %s":                        "en %s",
+		"at %s line %d, column %d: %s": "en %s, línea %d, columna %d: %s",
+
+		// Parse errors
+		"expected next token to be %s, got %s instead":       "se esperaba %s, pero se encontró %s",
+		"expected next token to be }, got EOF instead":       "se esperaba }, pero el programa terminó",
+		"no prefix parse function for %s found":              "una expresión no puede empezar con %s",
+		"; did you mean '%s'?":                               "; ¿quisiste decir '%s'?",
+		"expected ; at end of statement":                     "se esperaba ; al final de la instrucción",
+		"expected in after for %s, got %s instead":           "se esperaba in después de for %s, pero se encontró %s",
+		"could not parse %q as integer":                      "%q no es un entero válido",
+		"could not parse %q as float":                        "%q no es un número decimal válido",
+		"integer %s is too large; the largest integer is %d": "el entero %s es demasiado grande; el mayor entero es %d",
+		"unknown pragma %s":                                  "pragma desconocido %s",
+		"; did you mean '#%s'?":                              "; ¿quisiste decir '#%s'?",
+		"pragma %s must come before the first statement":     "el pragma %s debe ir antes de la primera instrucción",
+		"pragma %s must be on a line of its own":             "el pragma %s debe ir en una línea propia",
+		"expected identifier, index or property, got %T":     "se esperaba un nombre, un índice o una propiedad, pero se encontró %T",
+		"identifier not found: %s":                           "identificador no encontrado: %s",
+		"%s is declared but never used":                      "%s se declara pero nunca se usa",
+		"use let instead of var":                             "usa let en lugar de var",
+		"a decorator must come before a function declaration or a let, const or var with a value": "un decorador debe ir antes de una declaración de función o de un let, const o var con valor",
+		"the parser is stuck at %s; the rest of the input was not parsed":                         "el analizador se atascó en %s; el resto del programa no se analizó",
+
+		// Runtime errors
+		"%s in %s": "%s en %s",
+		"identifier not found: %s; did you mean '%s'?":                                       "identificador no encontrado: %s; ¿quisiste decir '%s'?",
+		"identifier not found: %s; the %s module must be imported first: import \"std/%s\";": "identificador no encontrado: %s; primero hay que importar el módulo %s: import \"std/%s\";",
+		"type mismatch: %s %s %s":                                                            "tipos incompatibles: %s %s %s",
+		"unknown operator: %s %s %s":                                                         "operador desconocido: %s %s %s",
+		"unknown operator: %s%s":                                                             "operador desconocido: %s%s",
+		"unknown operator: +%s":                                                              "operador desconocido: +%s",
+		"unknown operator: -%s":                                                              "operador desconocido: -%s",
+		"unknown operator: %s":                                                               "operador desconocido: %s",
+		"division by zero":                                                                   "división por cero",
+		"index out of range: %d (length %d)":                                                 "índice fuera de rango: %d (longitud %d)",
+		"index operator not supported: %s":                                                   "no se puede indexar un %s",
+		"array index must be INTEGER, got %s":                                                "el índice de un array debe ser INTEGER, pero es %s",
+		"property access not supported: %s":                                                  "un %s no tiene propiedades",
+		"unknown member %s on %s":                                                            "%s no existe en %s",
+		"cannot modify a frozen ARRAY":                                                       "no se puede modificar un ARRAY congelado",
+		"cannot modify a frozen HASH":                                                        "no se puede modificar un HASH congelado",
+		"not a function: %T":                                                                 "no es una función: %T",
+		"wrong number of arguments. got=%d, want=%d":                                         "número de argumentos incorrecto: se recibieron %d y se esperaban %d",
+		"wrong number of arguments to `%s`. got=%d, want=%d":                                 "número de argumentos incorrecto para `%s`: se recibieron %d y se esperaban %d",
+		"wrong number of arguments to `%s`. got=%d, want%s":                                  "número de argumentos incorrecto para `%s`: se recibieron %d y se esperaban%s",
+		"=%d":                                 " %d",
+		"=%d or %d":                           " %d o %d",
+		"=%d to %d":                           " de %d a %d",
+		" at least %d":                        " al menos %d",
+		"argument to `%s` must be %s, got %s": "el argumento de `%s` debe ser %s, pero es %s",
+		"argument `%s` to `%s` must be %s, got %s":                              "el argumento `%s` de `%s` debe ser %s, pero es %s",
+		"for-of needs an array, an object or a string, got %s":                  "for-of necesita un array, un objeto o un string, pero recibió %s",
+		"cannot convert %q to a number":                                         "no se puede convertir %q en un número",
+		"cannot import %s: %s":                                                  "no se puede importar %s: %s",
+		"comparing floats with %s is unreliable; use approxEqual(a, b) instead": "comparar decimales con %s no es fiable; usa approxEqual(a, b)",
+	})
+}
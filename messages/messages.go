@@ -0,0 +1,135 @@
+// Package messages translates the messages GoKid shows users, such as
+// parse and runtime errors, into the language of a locale.
+//
+// A message is looked up by its English format string, so code reports an
+// error with messages.Sprintf("division by zero") and a catalog maps that
+// string to its translation. A translation may reorder the arguments with
+// explicit indexes such as %[2]s. Messages a catalog lacks stay in English.
+package messages
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Catalog maps English format strings to their translations
+type Catalog map[string]string
+
+var (
+	mu       sync.RWMutex
+	catalogs = map[string]Catalog{"en": {}}
+	locale   = "en"
+)
+
+// Register adds the translations of catalog to locale's, creating the
+// locale if it is new, so hosts can add languages or correct messages
+func Register(name string, catalog Catalog) {
+	name = normalize(name)
+	mu.Lock()
+	defer mu.Unlock()
+	if catalogs[name] == nil {
+		catalogs[name] = Catalog{}
+	}
+	for english, translated := range catalog {
+		catalogs[name][english] = translated
+	}
+}
+
+// SetLocale makes messages use the language of name, such as "es" or
+// "es_MX.UTF-8", which falls back to "es". "" selects English.
+func SetLocale(name string) error {
+	name = normalize(name)
+	if name == "" {
+		name = "en"
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if catalogs[name] == nil {
+		if i := strings.IndexByte(name, '_'); i > 0 && catalogs[name[:i]] != nil {
+			name = name[:i]
+		} else {
+			return fmt.Errorf("no messages for locale %s; known locales are %s", name, strings.Join(locales(), ", "))
+		}
+	}
+	locale = name
+	return nil
+}
+
+// Locale returns the locale messages are shown in
+func Locale() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return locale
+}
+
+// Locales returns the locales with a catalog, in order
+func Locales() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return locales()
+}
+
+func locales() []string {
+	names := make([]string, 0, len(catalogs))
+	for name := range catalogs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Translate returns format in the current locale's language
+func Translate(format string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	if translated, ok := catalogs[locale][format]; ok {
+		return translated
+	}
+	return format
+}
+
+// Sprintf formats a message in the current locale's language
+func Sprintf(format string, a ...interface{}) string {
+	return fmt.Sprintf(Translate(format), a...)
+}
+
+// LoadFile registers the catalog in a JSON file of the form
+// {"locale": "fr", "messages": {"division by zero": "division par zéro"}}
+// and returns its locale
+func LoadFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var file struct {
+		Locale   string  `json:"locale"`
+		Messages Catalog `json:"messages"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return "", fmt.Errorf("%s: %v", path, err)
+	}
+	if normalize(file.Locale) == "" {
+		return "", fmt.Errorf("%s: the catalog does not name its locale", path)
+	}
+	Register(file.Locale, file.Messages)
+	return normalize(file.Locale), nil
+}
+
+// normalize reduces a locale name such as "es-MX.UTF-8" to "es_MX"
+func normalize(name string) string {
+	if i := strings.IndexAny(name, ".@"); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.ReplaceAll(name, "-", "_")
+	if i := strings.IndexByte(name, '_'); i >= 0 {
+		return strings.ToLower(name[:i]) + "_" + strings.ToUpper(name[i+1:])
+	}
+	if name == "C" || name == "POSIX" {
+		return "en"
+	}
+	return strings.ToLower(name)
+}
@@ -0,0 +1,190 @@
+package parser
+
+import "gokid/lexer"
+
+// Arena hands out the AST nodes of a parse from large blocks instead of
+// allocating them one at a time. Tools that re-parse the same files over
+// and over, such as editors checking a file on every change, can parse
+// into one arena and Reset it before the next parse, so the garbage
+// collector has far fewer objects to trace and the blocks are reused.
+//
+// Only the most common nodes (identifiers, literals, operators, calls and
+// the statements around them) come from the arena; the rest are allocated
+// as usual. Tokens are stored by value inside the nodes, so they come from
+// the arena with them.
+type Arena struct {
+	identifiers slab[Identifier]
+	integers    slab[IntegerLiteral]
+	strings     slab[StringLiteral]
+	prefixes    slab[PrefixExpression]
+	infixes     slab[InfixExpression]
+	assignments slab[AssignmentExpression]
+	calls       slab[CallExpression]
+	indexes     slab[IndexExpression]
+	dots        slab[DotExpression]
+	expressions slab[ExpressionStatement]
+	blocks      slab[BlockStatement]
+	lets        slab[LetStatement]
+	returns     slab[ReturnStatement]
+}
+
+// NewArena returns an empty arena
+func NewArena() *Arena {
+	return &Arena{}
+}
+
+// NewWithArena creates a parser that takes its nodes from a. The program
+// it returns is only valid until a is reset.
+func NewWithArena(l *lexer.Lexer, a *Arena) *Parser {
+	p := New(l)
+	p.arena = a
+	return p
+}
+
+// Reset makes the arena's blocks available to the next parse. Every node
+// handed out since the last reset is cleared, so nothing parsed into the
+// arena, including functions defined by an evaluated program, may be used
+// afterwards.
+func (a *Arena) Reset() {
+	a.identifiers.reset()
+	a.integers.reset()
+	a.strings.reset()
+	a.prefixes.reset()
+	a.infixes.reset()
+	a.assignments.reset()
+	a.calls.reset()
+	a.indexes.reset()
+	a.dots.reset()
+	a.expressions.reset()
+	a.blocks.reset()
+	a.lets.reset()
+	a.returns.reset()
+}
+
+// The node methods allocate normally on a nil arena, which is what a
+// parser made with New has
+
+func (a *Arena) identifier() *Identifier {
+	if a == nil {
+		return new(Identifier)
+	}
+	return a.identifiers.next()
+}
+
+func (a *Arena) integer() *IntegerLiteral {
+	if a == nil {
+		return new(IntegerLiteral)
+	}
+	return a.integers.next()
+}
+
+func (a *Arena) stringLiteral() *StringLiteral {
+	if a == nil {
+		return new(StringLiteral)
+	}
+	return a.strings.next()
+}
+
+func (a *Arena) prefix() *PrefixExpression {
+	if a == nil {
+		return new(PrefixExpression)
+	}
+	return a.prefixes.next()
+}
+
+func (a *Arena) infix() *InfixExpression {
+	if a == nil {
+		return new(InfixExpression)
+	}
+	return a.infixes.next()
+}
+
+func (a *Arena) assignment() *AssignmentExpression {
+	if a == nil {
+		return new(AssignmentExpression)
+	}
+	return a.assignments.next()
+}
+
+func (a *Arena) call() *CallExpression {
+	if a == nil {
+		return new(CallExpression)
+	}
+	return a.calls.next()
+}
+
+func (a *Arena) index() *IndexExpression {
+	if a == nil {
+		return new(IndexExpression)
+	}
+	return a.indexes.next()
+}
+
+func (a *Arena) dot() *DotExpression {
+	if a == nil {
+		return new(DotExpression)
+	}
+	return a.dots.next()
+}
+
+func (a *Arena) expression() *ExpressionStatement {
+	if a == nil {
+		return new(ExpressionStatement)
+	}
+	return a.expressions.next()
+}
+
+func (a *Arena) block() *BlockStatement {
+	if a == nil {
+		return new(BlockStatement)
+	}
+	return a.blocks.next()
+}
+
+func (a *Arena) let() *LetStatement {
+	if a == nil {
+		return new(LetStatement)
+	}
+	return a.lets.next()
+}
+
+func (a *Arena) ret() *ReturnStatement {
+	if a == nil {
+		return new(ReturnStatement)
+	}
+	return a.returns.next()
+}
+
+// slabSize is how many nodes of one kind a block holds
+const slabSize = 256
+
+// slab hands out values of one node type from blocks of slabSize
+type slab[T any] struct {
+	blocks [][]T
+	block  int // the block being filled
+	used   int // how much of it is handed out
+}
+
+func (s *slab[T]) next() *T {
+	if s.block == len(s.blocks) {
+		s.blocks = append(s.blocks, make([]T, slabSize))
+	}
+	n := &s.blocks[s.block][s.used]
+	if s.used++; s.used == slabSize {
+		s.block++
+		s.used = 0
+	}
+	return n
+}
+
+// reset zeroes what was handed out, so the old nodes don't keep values
+// alive, and starts again at the first block
+func (s *slab[T]) reset() {
+	for i := 0; i < s.block; i++ {
+		clear(s.blocks[i])
+	}
+	if s.block < len(s.blocks) {
+		clear(s.blocks[s.block][:s.used])
+	}
+	s.block, s.used = 0, 0
+}
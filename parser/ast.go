@@ -1,10 +1,71 @@
 package parser
 
-import "gokid/tokens"
+import (
+	"gokid/tokens"
+	"sync/atomic"
+)
 
 // Base interfaces
 type Node interface {
 	TokenLiteral() string
+	Range() Span
+}
+
+// Span is the range of source a node was parsed from, as byte offsets.
+// Every node embeds one; End is just past the node's last token.
+type Span struct {
+	Start int
+	End   int
+}
+
+// Range returns the node's span
+func (s Span) Range() Span { return s }
+
+// KeyCache is an inline cache for the evaluator: it remembers the hash of
+// the key a property or index expression looks up, so obj.field in a loop
+// doesn't hash "field" on every access. It is safe for concurrent use.
+type KeyCache struct {
+	hash atomic.Uint64 // zero until stored
+}
+
+// Load returns the cached hash, if one was stored
+func (c *KeyCache) Load() (uint64, bool) {
+	h := c.hash.Load()
+	return h, h != 0
+}
+
+// Store caches hash. A zero hash can't be cached.
+func (c *KeyCache) Store(hash uint64) {
+	c.hash.Store(hash)
+}
+
+// CallCache is an inline cache for the evaluator: it remembers the result
+// of a call that gives the same result every time it runs, such as
+// len("abc"), along with the function it called, so the call in a loop is
+// worked out once. It is safe for concurrent use.
+type CallCache struct {
+	entry atomic.Pointer[cachedCall]
+}
+
+type cachedCall struct {
+	fn, result any
+}
+
+// Load returns the cached result, if one was stored for a call of fn
+func (c *CallCache) Load(fn any) (any, bool) {
+	if e := c.entry.Load(); e != nil && e.fn == fn {
+		return e.result, true
+	}
+	return nil, false
+}
+
+// Store caches the result of calling fn
+func (c *CallCache) Store(fn, result any) {
+	c.entry.Store(&cachedCall{fn: fn, result: result})
+}
+
+func (s *Span) setSpan(start, end int) {
+	s.Start, s.End = start, end
 }
 
 type Statement interface {
@@ -19,6 +80,7 @@ type Expression interface {
 
 // Program - root node
 type Program struct {
+	Span
 	Statements []Statement
 }
 
@@ -31,8 +93,10 @@ func (p *Program) TokenLiteral() string {
 
 // Identifier
 type Identifier struct {
+	Span
 	Token tokens.Token
 	Value string
+	Ident tokens.Ident // Value interned, which the evaluator keys scopes by
 }
 
 func (i *Identifier) expressionNode() {}
@@ -42,6 +106,7 @@ func (i *Identifier) TokenLiteral() string {
 
 // Literals
 type IntegerLiteral struct {
+	Span
 	Token tokens.Token
 	Value int64
 }
@@ -52,6 +117,7 @@ func (il *IntegerLiteral) TokenLiteral() string {
 }
 
 type FloatLiteral struct {
+	Span
 	Token tokens.Token
 	Value float64
 }
@@ -61,7 +127,33 @@ func (fl *FloatLiteral) TokenLiteral() string {
 	return fl.Token.Literal
 }
 
+// ImaginaryLiteral is a number followed by i, such as 4i
+type ImaginaryLiteral struct {
+	Span
+	Token tokens.Token
+	Value float64
+}
+
+func (il *ImaginaryLiteral) expressionNode() {}
+func (il *ImaginaryLiteral) TokenLiteral() string {
+	return il.Token.Literal
+}
+
+// DecimalLiteral is a number followed by d, such as 1.23d. Value holds
+// the digits so no precision is lost before evaluation.
+type DecimalLiteral struct {
+	Span
+	Token tokens.Token
+	Value string
+}
+
+func (dl *DecimalLiteral) expressionNode() {}
+func (dl *DecimalLiteral) TokenLiteral() string {
+	return dl.Token.Literal
+}
+
 type StringLiteral struct {
+	Span
 	Token tokens.Token
 	Value string
 }
@@ -72,6 +164,7 @@ func (sl *StringLiteral) TokenLiteral() string {
 }
 
 type BooleanLiteral struct {
+	Span
 	Token tokens.Token
 	Value bool
 }
@@ -82,6 +175,7 @@ func (bl *BooleanLiteral) TokenLiteral() string {
 }
 
 type NullLiteral struct {
+	Span
 	Token tokens.Token
 }
 
@@ -92,6 +186,7 @@ func (nl *NullLiteral) TokenLiteral() string {
 
 // Array Literal
 type ArrayLiteral struct {
+	Span
 	Token    tokens.Token
 	Elements []Expression
 }
@@ -101,10 +196,17 @@ func (al *ArrayLiteral) TokenLiteral() string {
 	return al.Token.Literal
 }
 
-// Object Literal
+// Object Literal, whose pairs are in source order
 type ObjectLiteral struct {
+	Span
 	Token tokens.Token
-	Pairs map[Expression]Expression
+	Pairs []ObjectPair
+}
+
+// ObjectPair is a key and its value in an object literal
+type ObjectPair struct {
+	Key   Expression
+	Value Expression
 }
 
 func (ol *ObjectLiteral) expressionNode() {}
@@ -114,6 +216,7 @@ func (ol *ObjectLiteral) TokenLiteral() string {
 
 // Variable Declarations
 type LetStatement struct {
+	Span
 	Token tokens.Token
 	Name  *Identifier
 	Value Expression
@@ -125,6 +228,7 @@ func (ls *LetStatement) TokenLiteral() string {
 }
 
 type ConstStatement struct {
+	Span
 	Token tokens.Token
 	Name  *Identifier
 	Value Expression
@@ -136,6 +240,7 @@ func (cs *ConstStatement) TokenLiteral() string {
 }
 
 type VarStatement struct {
+	Span
 	Token tokens.Token
 	Name  *Identifier
 	Value Expression
@@ -148,6 +253,7 @@ func (vs *VarStatement) TokenLiteral() string {
 
 // Return Statement
 type ReturnStatement struct {
+	Span
 	Token       tokens.Token
 	ReturnValue Expression
 }
@@ -159,6 +265,7 @@ func (rs *ReturnStatement) TokenLiteral() string {
 
 // Expression Statement
 type ExpressionStatement struct {
+	Span
 	Token      tokens.Token
 	Expression Expression
 }
@@ -170,6 +277,7 @@ func (es *ExpressionStatement) TokenLiteral() string {
 
 // Block Statement
 type BlockStatement struct {
+	Span
 	Token      tokens.Token
 	Statements []Statement
 }
@@ -181,9 +289,25 @@ func (bs *BlockStatement) TokenLiteral() string {
 
 // Function Literal
 type FunctionLiteral struct {
+	Span
 	Token      tokens.Token
-	Parameters []*Identifier
+	Parameters []*Identifier // nil where the parameter is a pattern
 	Body       *BlockStatement
+	Source     string // the literal as written
+	Name       string // the variable the literal was bound to, if any
+	Doc        string // the // comment above its declaration, if any
+
+	// Patterns holds, for each parameter, the literal its argument must
+	// equal, as in function fib(0) {}, or nil for a name. It is nil when
+	// no parameter is a pattern.
+	Patterns []Expression
+
+	// Clauses are the declarations of the same function that follow this
+	// one, as in function fib(0) {} function fib(n) {}. A call runs the
+	// first clause, this one included, that its arguments match. Each is
+	// a scope of its own, so Walk visits them from the declaration rather
+	// than from this literal.
+	Clauses []*FunctionLiteral
 }
 
 func (fl *FunctionLiteral) expressionNode() {}
@@ -191,11 +315,29 @@ func (fl *FunctionLiteral) TokenLiteral() string {
 	return fl.Token.Literal
 }
 
+// RecordLiteral is the record type a record declaration makes, as in
+// record Point {x, y}. Its fields are names, not variables, so Walk
+// doesn't visit them.
+type RecordLiteral struct {
+	Span
+	Token  tokens.Token
+	Name   string // the variable the record type is bound to
+	Fields []*Identifier
+	Doc    string // the // comment above its declaration, if any
+}
+
+func (rl *RecordLiteral) expressionNode() {}
+func (rl *RecordLiteral) TokenLiteral() string {
+	return rl.Token.Literal
+}
+
 // Call Expression
 type CallExpression struct {
+	Span
 	Token     tokens.Token
 	Function  Expression
 	Arguments []Expression
+	Cache     CallCache // for calls of pure builtins with constant arguments
 }
 
 func (ce *CallExpression) expressionNode() {}
@@ -205,6 +347,7 @@ func (ce *CallExpression) TokenLiteral() string {
 
 // Prefix Expression
 type PrefixExpression struct {
+	Span
 	Token    tokens.Token
 	Operator string
 	Right    Expression
@@ -217,6 +360,7 @@ func (pe *PrefixExpression) TokenLiteral() string {
 
 // Infix Expression
 type InfixExpression struct {
+	Span
 	Token    tokens.Token
 	Left     Expression
 	Operator string
@@ -230,6 +374,7 @@ func (ie *InfixExpression) TokenLiteral() string {
 
 // If Expression
 type IfExpression struct {
+	Span
 	Token       tokens.Token
 	Condition   Expression
 	Consequence *BlockStatement
@@ -243,6 +388,7 @@ func (ie *IfExpression) TokenLiteral() string {
 
 // While Statement
 type WhileStatement struct {
+	Span
 	Token     tokens.Token
 	Condition Expression
 	Body      *BlockStatement
@@ -255,6 +401,7 @@ func (ws *WhileStatement) TokenLiteral() string {
 
 // For Statement
 type ForStatement struct {
+	Span
 	Token       tokens.Token
 	Initializer Statement
 	Condition   Expression
@@ -267,8 +414,24 @@ func (fs *ForStatement) TokenLiteral() string {
 	return fs.Token.Literal
 }
 
+// For-of Statement, for (name of iterable) { body }, which runs the body
+// for each element of an array or each character of a string
+type ForOfStatement struct {
+	Span
+	Token    tokens.Token
+	Name     *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForOfStatement) statementNode() {}
+func (fs *ForOfStatement) TokenLiteral() string {
+	return fs.Token.Literal
+}
+
 // Break Statement
 type BreakStatement struct {
+	Span
 	Token tokens.Token
 }
 
@@ -279,6 +442,7 @@ func (bs *BreakStatement) TokenLiteral() string {
 
 // Continue Statement
 type ContinueStatement struct {
+	Span
 	Token tokens.Token
 }
 
@@ -287,12 +451,15 @@ func (cs *ContinueStatement) TokenLiteral() string {
 	return cs.Token.Literal
 }
 
-// Switch Statement
+// Switch Statement. A type switch, written `switch type (x)`, matches
+// the type of its value against the type names of each case.
 type SwitchStatement struct {
-	Token   tokens.Token
-	Value   Expression
-	Cases   []*CaseStatement
-	Default *DefaultStatement
+	Span
+	Token      tokens.Token
+	Value      Expression
+	Cases      []*CaseStatement
+	Default    *DefaultStatement
+	TypeSwitch bool
 }
 
 func (ss *SwitchStatement) statementNode() {}
@@ -302,8 +469,10 @@ func (ss *SwitchStatement) TokenLiteral() string {
 
 // Case Statement
 type CaseStatement struct {
+	Span
 	Token tokens.Token
 	Value Expression
+	Types []*Identifier // type names, in a type switch
 	Body  *BlockStatement
 }
 
@@ -314,6 +483,7 @@ func (cs *CaseStatement) TokenLiteral() string {
 
 // Default Statement
 type DefaultStatement struct {
+	Span
 	Token tokens.Token
 	Body  *BlockStatement
 }
@@ -325,6 +495,7 @@ func (ds *DefaultStatement) TokenLiteral() string {
 
 // Try Statement
 type TryStatement struct {
+	Span
 	Token   tokens.Token
 	Body    *BlockStatement
 	Catch   *CatchStatement
@@ -338,6 +509,7 @@ func (ts *TryStatement) TokenLiteral() string {
 
 // Catch Statement
 type CatchStatement struct {
+	Span
 	Token     tokens.Token
 	Parameter *Identifier
 	Body      *BlockStatement
@@ -350,6 +522,7 @@ func (cs *CatchStatement) TokenLiteral() string {
 
 // Finally Statement
 type FinallyStatement struct {
+	Span
 	Token tokens.Token
 	Body  *BlockStatement
 }
@@ -361,6 +534,7 @@ func (fs *FinallyStatement) TokenLiteral() string {
 
 // Throw Statement
 type ThrowStatement struct {
+	Span
 	Token tokens.Token
 	Value Expression
 }
@@ -372,6 +546,7 @@ func (ts *ThrowStatement) TokenLiteral() string {
 
 // Import Statement
 type ImportStatement struct {
+	Span
 	Token tokens.Token
 	Path  *StringLiteral
 	Alias *Identifier
@@ -384,6 +559,7 @@ func (is *ImportStatement) TokenLiteral() string {
 
 // Export Statement
 type ExportStatement struct {
+	Span
 	Token tokens.Token
 	Value Statement
 }
@@ -393,10 +569,38 @@ func (es *ExportStatement) TokenLiteral() string {
 	return es.Token.Literal
 }
 
+// Global Statement
+type GlobalStatement struct {
+	Span
+	Token tokens.Token
+	Names []*Identifier
+}
+
+func (gs *GlobalStatement) statementNode() {}
+func (gs *GlobalStatement) TokenLiteral() string {
+	return gs.Token.Literal
+}
+
+// Pragma Statement, a file-level option such as #strict, written on a
+// line of its own before the first statement
+type PragmaStatement struct {
+	Span
+	Token tokens.Token
+	Name  string // without the #, such as "no-semicolons"
+	Value string // what follows the name, such as "es" in #dialect es
+}
+
+func (ps *PragmaStatement) statementNode() {}
+func (ps *PragmaStatement) TokenLiteral() string {
+	return ps.Token.Literal
+}
+
 // Assignment Expression
 type AssignmentExpression struct {
+	Span
 	Token    tokens.Token
 	Name     *Identifier
+	Target   Expression // an index or property expression, when Name is nil
 	Operator string
 	Value    Expression
 }
@@ -406,11 +610,25 @@ func (ae *AssignmentExpression) TokenLiteral() string {
 	return ae.Token.Literal
 }
 
+// Symbol Literal, such as :ok. Value is the name without the colon.
+type SymbolLiteral struct {
+	Span
+	Token tokens.Token
+	Value string
+}
+
+func (sl *SymbolLiteral) expressionNode() {}
+func (sl *SymbolLiteral) TokenLiteral() string {
+	return sl.Token.Literal
+}
+
 // Index Expression
 type IndexExpression struct {
+	Span
 	Token tokens.Token
 	Left  Expression
 	Index Expression
+	Cache KeyCache // for indexes that are string literals
 }
 
 func (ie *IndexExpression) expressionNode() {}
@@ -420,9 +638,11 @@ func (ie *IndexExpression) TokenLiteral() string {
 
 // Dot Expression (for object property access)
 type DotExpression struct {
+	Span
 	Token    tokens.Token
 	Left     Expression
 	Property *Identifier
+	Cache    KeyCache
 }
 
 func (de *DotExpression) expressionNode() {}
@@ -432,6 +652,7 @@ func (de *DotExpression) TokenLiteral() string {
 
 // Ternary Expression
 type TernaryExpression struct {
+	Span
 	Token       tokens.Token
 	Condition   Expression
 	Consequence Expression
@@ -442,3 +663,46 @@ func (te *TernaryExpression) expressionNode() {}
 func (te *TernaryExpression) TokenLiteral() string {
 	return te.Token.Literal
 }
+
+// StatementToken returns the token a statement starts with
+func StatementToken(stmt Statement) tokens.Token {
+	switch stmt := stmt.(type) {
+	case *LetStatement:
+		return stmt.Token
+	case *ConstStatement:
+		return stmt.Token
+	case *VarStatement:
+		return stmt.Token
+	case *ReturnStatement:
+		return stmt.Token
+	case *ExpressionStatement:
+		return stmt.Token
+	case *BlockStatement:
+		return stmt.Token
+	case *WhileStatement:
+		return stmt.Token
+	case *ForStatement:
+		return stmt.Token
+	case *ForOfStatement:
+		return stmt.Token
+	case *BreakStatement:
+		return stmt.Token
+	case *ContinueStatement:
+		return stmt.Token
+	case *SwitchStatement:
+		return stmt.Token
+	case *TryStatement:
+		return stmt.Token
+	case *ThrowStatement:
+		return stmt.Token
+	case *ImportStatement:
+		return stmt.Token
+	case *ExportStatement:
+		return stmt.Token
+	case *GlobalStatement:
+		return stmt.Token
+	case *PragmaStatement:
+		return stmt.Token
+	}
+	return tokens.Token{Offset: -1}
+}
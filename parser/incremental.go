@@ -0,0 +1,200 @@
+package parser
+
+import (
+	"gokid/diagnostics"
+	"gokid/lexer"
+	"gokid/tokens"
+	"reflect"
+	"sort"
+)
+
+// Edit replaces the bytes [Start, End) of a document's source with Text
+type Edit struct {
+	Start int
+	End   int
+	Text  string
+}
+
+// Document is a parsed source that is kept up to date by edits. An edit
+// only re-parses the top-level statements it touches, so editors can
+// re-check large files on every keystroke.
+type Document struct {
+	Source  string
+	Program *Program
+
+	statements []documentStatement
+	warnings   []diagnostics.Diagnostic
+}
+
+// documentStatement is a top-level statement with the source span it was
+// parsed from, including the trivia after it, and its parse errors
+type documentStatement struct {
+	node        Statement
+	start, end  int
+	diagnostics []diagnostics.Diagnostic
+}
+
+// NewDocument parses source
+func NewDocument(source string) *Document {
+	d := &Document{Source: source}
+	d.statements, _ = parseStatements(source, 0, nil, func(int) bool { return false })
+	d.update()
+	return d
+}
+
+// Apply applies an edit and re-parses the statements around it
+func (d *Document) Apply(edit Edit) {
+	if edit.Start < 0 || edit.End > len(d.Source) || edit.Start > edit.End {
+		return
+	}
+	source := d.Source[:edit.Start] + edit.Text + d.Source[edit.End:]
+	delta := len(edit.Text) - (edit.End - edit.Start)
+
+	// Pragmas change how everything after them is parsed
+	if edit.Start <= d.pragmasEnd() {
+		d.Source = source
+		d.statements, _ = parseStatements(source, 0, nil, func(int) bool { return false })
+		d.update()
+		return
+	}
+
+	// The statement before the edit is re-parsed too, since how it ends can
+	// depend on the tokens that follow it
+	first := sort.Search(len(d.statements), func(i int) bool { return d.statements[i].end >= edit.Start })
+	if first > 0 {
+		first--
+	}
+	from := 0
+	if first > 0 {
+		from = d.statements[first].start
+	}
+
+	// Old statements that start after the edit, moved to their new offsets
+	var rest []documentStatement
+	for _, stmt := range d.statements[first:] {
+		if stmt.start > edit.End {
+			rest = append(rest, stmt)
+		}
+	}
+	starts := map[int]int{}
+	for i, stmt := range rest {
+		starts[stmt.start+delta] = i
+	}
+
+	reparsed, stoppedAt := parseStatements(source, from, d.statements[:first], func(offset int) bool {
+		_, ok := starts[offset]
+		return ok && offset > edit.Start+len(edit.Text)
+	})
+
+	statements := append(d.statements[:first:first], reparsed...)
+	if i, ok := starts[stoppedAt]; ok {
+		for _, stmt := range rest[i:] {
+			stmt.shift(delta)
+			statements = append(statements, stmt)
+		}
+	}
+
+	d.Source = source
+	d.statements = statements
+	d.update()
+}
+
+// pragmasEnd returns where the pragmas at the start of the document end,
+// which is where its first statement starts
+func (d *Document) pragmasEnd() int {
+	for _, stmt := range d.statements {
+		if _, ok := stmt.node.(*PragmaStatement); !ok {
+			return stmt.start
+		}
+	}
+	return len(d.Source)
+}
+
+// Diagnostics returns the parse errors of the whole document
+func (d *Document) Diagnostics() []diagnostics.Diagnostic {
+	var all []diagnostics.Diagnostic
+	for _, stmt := range d.statements {
+		all = append(all, stmt.diagnostics...)
+	}
+	return all
+}
+
+// Warnings returns the warnings of the whole document, or none while it
+// has parse errors
+func (d *Document) Warnings() []diagnostics.Diagnostic {
+	return d.warnings
+}
+
+func (d *Document) update() {
+	d.Program = &Program{Statements: make([]Statement, 0, len(d.statements))}
+	for _, stmt := range d.statements {
+		if stmt.node != nil {
+			d.Program.Statements = append(d.Program.Statements, stmt.node)
+		}
+	}
+
+	d.warnings = nil
+	if len(d.Diagnostics()) == 0 {
+		var list diagnostics.List
+		analyze(d.Program, d.Source, &list)
+		d.warnings = list.Items()
+	}
+}
+
+// parseStatements parses top-level statements from offset from, which
+// follow the statements before, until EOF or until stop accepts the
+// offset the next statement would start at, which it returns
+func parseStatements(source string, from int, before []documentStatement, stop func(offset int) bool) ([]documentStatement, int) {
+	p := New(lexer.NewLexerAt(source, from))
+	for _, stmt := range before {
+		if stmt.node != nil {
+			p.resume(stmt.node)
+		}
+	}
+
+	var statements []documentStatement
+	for !p.curTokenIs(tokens.EOF) {
+		start := p.curToken.Offset
+		if len(statements) == 0 {
+			start = from
+		} else if stop(start) {
+			return statements, start
+		}
+
+		seen := len(p.diagnostics.Items())
+		node := p.parseStatement()
+		p.nextTopLevel()
+		p.ensureProgress(start)
+
+		statements = append(statements, documentStatement{
+			node:        node,
+			start:       start,
+			end:         p.curToken.Offset,
+			diagnostics: append([]diagnostics.Diagnostic(nil), p.diagnostics.Items()[seen:]...),
+		})
+	}
+	return statements, len(source)
+}
+
+// shift moves a statement that follows an edit by delta bytes
+func (s *documentStatement) shift(delta int) {
+	s.start += delta
+	s.end += delta
+	for i := range s.diagnostics {
+		s.diagnostics[i] = s.diagnostics[i].Shift(delta)
+	}
+
+	Walk(s.node, func(node Node) bool {
+		v := reflect.ValueOf(node).Elem()
+		if field := v.FieldByName("Token"); field.IsValid() {
+			tok := field.Addr().Interface().(*tokens.Token)
+			tok.Offset += delta
+			tok.End += delta
+		}
+		if n, ok := node.(interface{ setSpan(start, end int) }); ok {
+			span := node.Range()
+			n.setSpan(span.Start+delta, span.End+delta)
+		}
+		return true
+	})
+}
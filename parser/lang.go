@@ -0,0 +1,110 @@
+package parser
+
+import (
+	"fmt"
+	"gokid/messages"
+	"gokid/tokens"
+	"strconv"
+	"strings"
+)
+
+// LanguageVersion is a version of the GoKid grammar, such as 0.2. A file
+// names the version it is written for with #lang gokid 0.2, and the syntax
+// added after that version is an error in it, so a script keeps parsing as
+// it did when the grammar gains words and forms it may already use.
+type LanguageVersion struct {
+	Major, Minor int
+}
+
+// LatestLanguage is the grammar this parser reads: that of the language
+// version evaluator.Version, without its patch number
+var LatestLanguage = LanguageVersion{1, 0}
+
+// DefaultLanguage is the grammar of files without a #lang pragma
+var DefaultLanguage = LatestLanguage
+
+// ParseLanguageVersion reads a version written as major.minor, as in
+// #lang gokid 0.2. A patch number, as in 1.0.0, does not change the
+// grammar and is ignored.
+func ParseLanguageVersion(s string) (LanguageVersion, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return LanguageVersion{}, fmt.Errorf("%s is not a GoKid version; write it as major.minor, such as %s", s, LatestLanguage)
+	}
+	var numbers [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || part != strconv.Itoa(n) {
+			return LanguageVersion{}, fmt.Errorf("%s is not a GoKid version; write it as major.minor, such as %s", s, LatestLanguage)
+		}
+		numbers[i] = n
+	}
+	v := LanguageVersion{numbers[0], numbers[1]}
+	if LatestLanguage.Before(v) {
+		return LanguageVersion{}, fmt.Errorf("GoKid %s is newer than this interpreter, which reads GoKid %s; upgrade gokid to run it", v, LatestLanguage)
+	}
+	return v, nil
+}
+
+func (v LanguageVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// Before reports whether v is an older version than w
+func (v LanguageVersion) Before(w LanguageVersion) bool {
+	return v.Major < w.Major || v.Major == w.Major && v.Minor < w.Minor
+}
+
+// Feature is syntax added to the grammar after its first version
+type Feature int
+
+const (
+	SymbolLiterals Feature = iota
+	DecimalLiterals
+	ImaginaryLiterals
+	RadixIntegers
+	FunctionDeclarations
+	Decorators
+	RangeLoops
+	ObjectShorthand
+	TrailingCommas
+	Records
+	FunctionClauses
+)
+
+// features describes each Feature and the version that added it. Syntax
+// added later goes here too, with the version it arrives in.
+var features = map[Feature]struct {
+	what  string
+	since LanguageVersion
+}{
+	SymbolLiterals:       {"symbol literals such as :name", LanguageVersion{1, 0}},
+	DecimalLiterals:      {"decimal literals such as 1.25d", LanguageVersion{1, 0}},
+	ImaginaryLiterals:    {"imaginary literals such as 2i", LanguageVersion{1, 0}},
+	RadixIntegers:        {"0x, 0o and 0b integers", LanguageVersion{1, 0}},
+	FunctionDeclarations: {"function declarations such as function name() {}", LanguageVersion{1, 0}},
+	Decorators:           {"decorators", LanguageVersion{1, 0}},
+	RangeLoops:           {"for i in start..end loops", LanguageVersion{1, 0}},
+	ObjectShorthand:      {"shorthand properties, methods and computed keys in objects", LanguageVersion{1, 0}},
+	TrailingCommas:       {"trailing commas", LanguageVersion{1, 0}},
+	Records:              {"record declarations", LanguageVersion{1, 0}},
+	FunctionClauses:      {"function clauses and patterns such as function fib(0) {}", LanguageVersion{1, 0}},
+}
+
+// Language returns the version of the grammar the parser reads the file
+// in: its #lang pragma's, or the default
+func (p *Parser) Language() LanguageVersion {
+	if p.lang != (LanguageVersion{}) {
+		return p.lang
+	}
+	return DefaultLanguage
+}
+
+// require records an error at tok unless the file's grammar has feature.
+// The syntax is parsed either way, so the error is the only one it causes.
+func (p *Parser) require(feature Feature, tok tokens.Token) {
+	f := features[feature]
+	if lang := p.Language(); lang.Before(f.since) {
+		p.errorAt(tok, messages.Sprintf("%s need GoKid %s, but this file is GoKid %s; raise its #lang gokid version to use them", f.what, f.since, lang))
+	}
+}
@@ -1,10 +1,17 @@
 package parser
 
 import (
-	"fmt"
+	"errors"
+	"gokid/diagnostics"
 	"gokid/lexer"
+	"gokid/logging"
+	"gokid/messages"
 	"gokid/tokens"
+	"math"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Precedence levels
@@ -68,7 +75,32 @@ type Parser struct {
 	prefixParseFns map[tokens.TokenType]prefixParseFn
 	infixParseFns  map[tokens.TokenType]infixParseFn
 
-	errors []string
+	errors      []string
+	diagnostics diagnostics.List
+	warnings    diagnostics.List
+
+	// strict makes semicolons after statements mandatory and stops
+	// newlines from ending statements
+	strict bool
+
+	// started is set once the parser reaches a statement, after which
+	// pragmas are errors
+	started bool
+
+	// brackets holds the unclosed brackets before curToken: true for ( and
+	// [, false for {. Newlines inside ( and [ do not end statements.
+	brackets []bool
+
+	// arena supplies the common nodes; nil allocates them one by one
+	arena *Arena
+
+	// halted is set when a loop stopped consuming tokens, after which
+	// every token is EOF so the parse ends
+	halted bool
+
+	// lang is the language version set by the file's #lang pragma, whose
+	// grammar the parser reads; the zero version when there is none
+	lang LanguageVersion
 }
 
 // New creates a new parser
@@ -86,23 +118,22 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(tokens.IDENT, p.parseIdentifier)
 	p.registerPrefix(tokens.INT, p.parseIntegerLiteral)
 	p.registerPrefix(tokens.FLOAT, p.parseFloatLiteral)
+	p.registerPrefix(tokens.IMAG, p.parseImaginaryLiteral)
+	p.registerPrefix(tokens.DECIMAL, p.parseDecimalLiteral)
 	p.registerPrefix(tokens.STRING, p.parseStringLiteral)
+	p.registerPrefix(tokens.SYMBOL, p.parseSymbolLiteral)
 	p.registerPrefix(tokens.TRUE, p.parseBooleanLiteral)
 	p.registerPrefix(tokens.FALSE, p.parseBooleanLiteral)
 	p.registerPrefix(tokens.NULL, p.parseNullLiteral)
 	p.registerPrefix(tokens.NOT, p.parsePrefixExpression)
 	p.registerPrefix(tokens.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(tokens.PLUS, p.parsePrefixExpression)
 	p.registerPrefix(tokens.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(tokens.IF, p.parseIfExpression)
 	p.registerPrefix(tokens.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(tokens.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(tokens.LBRACE, p.parseObjectLiteral)
 
-	// Register built-in functions as identifiers (they'll be handled by parseIdentifier)
-	p.registerPrefix(tokens.PRINT, p.parseIdentifier)
-	p.registerPrefix(tokens.LEN, p.parseIdentifier)
-	p.registerPrefix(tokens.TYPE, p.parseIdentifier)
-
 	// Register infix parse functions
 	p.registerInfix(tokens.PLUS, p.parseInfixExpression)
 	p.registerInfix(tokens.MINUS, p.parseInfixExpression)
@@ -144,9 +175,108 @@ func (p *Parser) registerInfix(tokenType tokens.TokenType, fn infixParseFn) {
 	p.infixParseFns[tokenType] = fn
 }
 
+// SetStrictSemicolons makes the parser require a semicolon after every
+// statement that does not end with }, instead of letting newlines end
+// statements
+func (p *Parser) SetStrictSemicolons(strict bool) {
+	p.strict = strict
+}
+
 func (p *Parser) nextToken() {
+	if p.halted {
+		return
+	}
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+
+	switch p.curToken.Type {
+	case tokens.LPAREN, tokens.LBRACKET:
+		p.brackets = append(p.brackets, true)
+	case tokens.LBRACE:
+		p.brackets = append(p.brackets, false)
+	case tokens.RPAREN, tokens.RBRACKET, tokens.RBRACE:
+		if len(p.brackets) > 0 {
+			p.brackets = p.brackets[:len(p.brackets)-1]
+		}
+	}
+}
+
+// ensureProgress stops the parse with an error if the parser hasn't moved
+// past offset, where an iteration of a loop over tokens began. Such a loop
+// would otherwise run forever on the same token.
+func (p *Parser) ensureProgress(offset int) {
+	if p.curToken.Offset > offset || p.curTokenIs(tokens.EOF) {
+		return
+	}
+	p.errorAt(p.curToken, messages.Sprintf("the parser is stuck at %s; the rest of the input was not parsed", p.curToken.Type))
+	end := len(p.l.Input())
+	eof := tokens.Token{Type: tokens.EOF, Offset: end, End: end}
+	p.curToken, p.peekToken = eof, eof
+	p.halted = true
+}
+
+// nextTopLevel moves to the start of the next top-level statement, which
+// is outside any brackets left unclosed by errors
+func (p *Parser) nextTopLevel() {
+	p.brackets = p.brackets[:0]
+	p.nextToken()
+}
+
+// peekOnNewLine reports whether a line break separates curToken and
+// peekToken
+func (p *Parser) peekOnNewLine() bool {
+	return strings.Contains(p.l.Slice(p.curToken.End, p.peekToken.Offset), "\n")
+}
+
+// newlineEndsStatement reports whether the statement being parsed ends
+// before peekToken. A token that could either continue the expression or
+// start a new statement, such as ( or -, starts a new one when it begins
+// a line outside parentheses and brackets, so a forgotten semicolon does
+// not join two lines.
+func (p *Parser) newlineEndsStatement() bool {
+	if p.strict || !p.peekOnNewLine() {
+		return false
+	}
+	if n := len(p.brackets); n > 0 && p.brackets[n-1] {
+		return false
+	}
+	switch p.peekToken.Type {
+	case tokens.LPAREN, tokens.LBRACKET, tokens.MINUS, tokens.PLUS:
+		return true
+	}
+	return false
+}
+
+// endStatement consumes the semicolon after a statement. It may be left
+// out unless the parser is strict, the statement does not end with } and
+// it is not the last statement of a block.
+func (p *Parser) endStatement() {
+	if p.peekTokenIs(tokens.SEMICOLON) {
+		p.nextToken()
+	} else if p.strict && !p.curTokenIs(tokens.RBRACE) && !p.peekTokenIs(tokens.RBRACE) {
+		end := p.curToken.End
+		p.fixableErrorAt(tokens.Token{Offset: end, End: end}, messages.Translate("expected ; at end of statement"),
+			&diagnostics.Fix{Message: "add ;", Edits: []diagnostics.Edit{{Offset: end, Text: ";"}}})
+	}
+}
+
+// finish records the span of node, from start to the end of the current
+// token
+func (p *Parser) finish(node Node, start int) {
+	if n, ok := node.(interface{ setSpan(start, end int) }); ok && !IsNil(node) {
+		n.setSpan(start, p.curToken.End)
+	}
+}
+
+// curIdentifier returns the current token as an identifier
+func (p *Parser) curIdentifier() *Identifier {
+	ident := p.arena.identifier()
+	*ident = Identifier{Token: p.curToken, Value: p.curToken.Literal, Ident: p.curToken.Ident}
+	if ident.Ident == 0 {
+		ident.Ident = tokens.Intern(ident.Value)
+	}
+	p.finish(ident, p.curToken.Offset)
+	return ident
 }
 
 func (p *Parser) curTokenIs(t tokens.TokenType) bool {
@@ -186,33 +316,104 @@ func (p *Parser) Errors() []string {
 	return p.errors
 }
 
+// Diagnostics returns the parse errors with their source locations
+func (p *Parser) Diagnostics() []diagnostics.Diagnostic {
+	return p.diagnostics.Items()
+}
+
+// Warnings returns problems in code that parsed but is probably a mistake
+func (p *Parser) Warnings() []diagnostics.Diagnostic {
+	return p.warnings.Items()
+}
+
+// errorAt records a parse error located at tok
+func (p *Parser) errorAt(tok tokens.Token, msg string) {
+	p.fixableErrorAt(tok, msg, nil)
+}
+
+// fixableErrorAt records an error at tok that fix, if not nil, resolves
+func (p *Parser) fixableErrorAt(tok tokens.Token, msg string, fix *diagnostics.Fix) {
+	p.errors = append(p.errors, msg)
+
+	length := len(tok.Literal)
+	if tok.Type == tokens.STRING {
+		length += 2
+	}
+	p.diagnostics.Add(diagnostics.Diagnostic{Severity: diagnostics.Error, Message: msg, Offset: tok.Offset, Length: length, Fix: fix})
+}
+
 func (p *Parser) peekError(t tokens.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
+	msg := messages.Sprintf("expected next token to be %s, got %s instead",
 		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.errorAt(p.peekToken, msg+p.keywordHint(p.peekToken))
 }
 
 func (p *Parser) noPrefixParseFnError(t tokens.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	msg := messages.Sprintf("no prefix parse function for %s found", t)
+	p.errorAt(p.curToken, msg)
+}
+
+// keywordHint suggests the keyword a name that broke the parse may be a
+// typo of, such as "retrun" for "return"
+func (p *Parser) keywordHint(tok tokens.Token) string {
+	if tok.Type != tokens.IDENT {
+		return ""
+	}
+	if keyword := diagnostics.Suggest(tok.Literal, p.l.Dialect().Words()); keyword != "" {
+		return messages.Sprintf("; did you mean '%s'?", keyword)
+	}
+	return ""
 }
 
 // Main parsing method
 func (p *Parser) ParseProgram() *Program {
+	var start time.Time
+	if logging.Debugging() {
+		start = time.Now()
+	}
 	program := &Program{}
 	program.Statements = []Statement{}
 
 	for !p.curTokenIs(tokens.EOF) {
-		stmt := p.parseStatement()
-		program.Statements = append(program.Statements, stmt)
-		p.nextToken()
+		start := p.curToken.Offset
+		if stmt := p.parseStatement(); stmt != nil {
+			program.Statements = append(program.Statements, stmt)
+		}
+		p.nextTopLevel()
+		p.ensureProgress(start)
+	}
+
+	program.End = p.curToken.End
+
+	if len(p.errors) == 0 {
+		analyze(program, p.l.Input(), &p.warnings)
 	}
 
+	if !start.IsZero() {
+		logging.Debug("parsed program", "bytes", program.End, "statements", len(program.Statements),
+			"errors", len(p.errors), "duration", time.Since(start))
+	}
 	return program
 }
 
 // Statement parsing
+
+// parseStatement returns nil, never a typed nil pointer, when a statement
+// fails to parse
 func (p *Parser) parseStatement() Statement {
+	start := p.curToken.Offset
+	if !p.curTokenIs(tokens.HASH) {
+		p.started = true
+	}
+	stmt := p.parseStatementNode()
+	if IsNil(stmt) {
+		return nil
+	}
+	p.finish(stmt, start)
+	return stmt
+}
+
+func (p *Parser) parseStatementNode() Statement {
 	switch p.curToken.Type {
 	case tokens.LET:
 		return p.parseLetStatement()
@@ -223,7 +424,12 @@ func (p *Parser) parseStatement() Statement {
 	case tokens.RETURN:
 		return p.parseReturnStatement()
 	case tokens.FUNCTION:
+		if p.peekTokenIs(tokens.IDENT) {
+			return p.parseFunctionDeclaration()
+		}
 		return p.parseFunctionStatement()
+	case tokens.AT:
+		return p.parseDecoratedStatement()
 	case tokens.WHILE:
 		return p.parseWhileStatement()
 	case tokens.FOR:
@@ -242,19 +448,31 @@ func (p *Parser) parseStatement() Statement {
 		return p.parseImportStatement()
 	case tokens.EXPORT:
 		return p.parseExportStatement()
+	case tokens.GLOBAL:
+		return p.parseGlobalStatement()
+	case tokens.HASH:
+		return p.parsePragmaStatement()
+	case tokens.IDENT:
+		// record is a keyword only before a name, so it can still name
+		// variables, as it did before records were added
+		if p.curToken.Literal == "record" && p.peekTokenIs(tokens.IDENT) {
+			return p.parseRecordDeclaration()
+		}
+		return p.parseExpressionStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
 func (p *Parser) parseLetStatement() *LetStatement {
-	stmt := &LetStatement{Token: p.curToken}
+	stmt := p.arena.let()
+	stmt.Token = p.curToken
 
 	if !p.expectPeek(tokens.IDENT) {
 		return nil
 	}
 
-	stmt.Name = &Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	stmt.Name = p.curIdentifier()
 
 	if !p.expectPeek(tokens.ASSIGN) {
 		return nil
@@ -263,10 +481,10 @@ func (p *Parser) parseLetStatement() *LetStatement {
 	p.nextToken()
 
 	stmt.Value = p.parseExpression(LOWEST)
+	nameFunction(stmt.Value, stmt.Name)
+	p.document(stmt.Value, stmt.Token.Offset)
 
-	if p.peekTokenIs(tokens.SEMICOLON) {
-		p.nextToken()
-	}
+	p.endStatement()
 
 	return stmt
 }
@@ -278,7 +496,7 @@ func (p *Parser) parseConstStatement() *ConstStatement {
 		return nil
 	}
 
-	stmt.Name = &Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	stmt.Name = p.curIdentifier()
 
 	if !p.expectPeek(tokens.ASSIGN) {
 		return nil
@@ -287,10 +505,10 @@ func (p *Parser) parseConstStatement() *ConstStatement {
 	p.nextToken()
 
 	stmt.Value = p.parseExpression(LOWEST)
+	nameFunction(stmt.Value, stmt.Name)
+	p.document(stmt.Value, stmt.Token.Offset)
 
-	if p.peekTokenIs(tokens.SEMICOLON) {
-		p.nextToken()
-	}
+	p.endStatement()
 
 	return stmt
 }
@@ -302,59 +520,73 @@ func (p *Parser) parseVarStatement() *VarStatement {
 		return nil
 	}
 
-	stmt.Name = &Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	stmt.Name = p.curIdentifier()
 
 	if p.peekTokenIs(tokens.ASSIGN) {
 		p.nextToken()
 		p.nextToken()
 		stmt.Value = p.parseExpression(LOWEST)
+		nameFunction(stmt.Value, stmt.Name)
+		p.document(stmt.Value, stmt.Token.Offset)
 	}
 
-	if p.peekTokenIs(tokens.SEMICOLON) {
-		p.nextToken()
-	}
+	p.endStatement()
 
 	return stmt
 }
 
 func (p *Parser) parseReturnStatement() *ReturnStatement {
-	stmt := &ReturnStatement{Token: p.curToken}
+	stmt := p.arena.ret()
+	stmt.Token = p.curToken
+
+	// A return on its own returns null
+	if p.peekTokenIs(tokens.SEMICOLON) || p.peekTokenIs(tokens.RBRACE) || p.peekTokenIs(tokens.EOF) ||
+		(!p.strict && p.peekOnNewLine()) {
+		p.endStatement()
+		return stmt
+	}
 
 	p.nextToken()
 
 	stmt.ReturnValue = p.parseExpression(LOWEST)
 
-	if p.peekTokenIs(tokens.SEMICOLON) {
-		p.nextToken()
-	}
+	p.endStatement()
 
 	return stmt
 }
 
 func (p *Parser) parseExpressionStatement() *ExpressionStatement {
-	stmt := &ExpressionStatement{Token: p.curToken}
+	stmt := p.arena.expression()
+	stmt.Token = p.curToken
 
 	stmt.Expression = p.parseExpression(LOWEST)
 
-	if p.peekTokenIs(tokens.SEMICOLON) {
-		p.nextToken()
-	}
+	p.endStatement()
 
 	return stmt
 }
 
 func (p *Parser) parseBlockStatement() *BlockStatement {
-	block := &BlockStatement{Token: p.curToken}
+	block := p.arena.block()
+	block.Token = p.curToken
 	block.Statements = []Statement{}
 
 	p.nextToken()
 
 	for !p.curTokenIs(tokens.RBRACE) && !p.curTokenIs(tokens.EOF) {
-		stmt := p.parseStatement()
-		block.Statements = append(block.Statements, stmt)
+		start := p.curToken.Offset
+		if stmt := p.parseStatement(); stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+		}
 		p.nextToken()
+		p.ensureProgress(start)
+	}
+
+	if p.curTokenIs(tokens.EOF) {
+		p.errorAt(p.curToken, messages.Translate("expected next token to be }, got EOF instead"))
 	}
 
+	p.finish(block, block.Token.Offset)
 	return block
 }
 
@@ -382,21 +614,27 @@ func (p *Parser) parseWhileStatement() *WhileStatement {
 	return stmt
 }
 
-func (p *Parser) parseForStatement() *ForStatement {
+func (p *Parser) parseForStatement() Statement {
 	stmt := &ForStatement{Token: p.curToken}
 
+	if p.peekTokenIs(tokens.IDENT) {
+		return p.parseForRange(stmt)
+	}
 	if !p.expectPeek(tokens.LPAREN) {
 		return nil
 	}
 
-	// Initializer
+	// Initializer, which as a statement may already have taken the
+	// semicolon after it
 	p.nextToken()
+	if p.curTokenIs(tokens.IDENT) && p.peekTokenIs(tokens.IDENT) && p.peekToken.Literal == "of" {
+		return p.parseForOf(stmt.Token)
+	}
 	if !p.curTokenIs(tokens.SEMICOLON) {
 		stmt.Initializer = p.parseStatement()
-	}
-
-	if !p.expectPeek(tokens.SEMICOLON) {
-		return nil
+		if !p.curTokenIs(tokens.SEMICOLON) && !p.expectPeek(tokens.SEMICOLON) {
+			return nil
+		}
 	}
 
 	// Condition
@@ -428,12 +666,68 @@ func (p *Parser) parseForStatement() *ForStatement {
 	return stmt
 }
 
+// parseForOf parses the rest of "for (name of iterable) { body }" from
+// the name
+func (p *Parser) parseForOf(token tokens.Token) *ForOfStatement {
+	stmt := &ForOfStatement{Token: token, Name: p.curIdentifier()}
+	p.nextToken()
+
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(tokens.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(tokens.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseBlockStatement()
+
+	return stmt
+}
+
+// parseForRange parses "for i in start..end { body }", which counts i up
+// from start to just before end. It is short for
+// for (let i = start; i < end; i += 1) { body }.
+func (p *Parser) parseForRange(stmt *ForStatement) *ForStatement {
+	p.require(RangeLoops, stmt.Token)
+	p.nextToken()
+	name := p.curIdentifier()
+
+	if !p.peekTokenIs(tokens.IDENT) || p.peekToken.Literal != "in" {
+		p.errorAt(p.peekToken, messages.Sprintf("expected in after for %s, got %s instead", name.Value, p.peekToken.Literal))
+		return nil
+	}
+	p.nextToken()
+	in := p.curToken
+
+	p.nextToken()
+	start := p.parseExpression(LOWEST)
+	if !p.expectPeek(tokens.RANGE) {
+		return nil
+	}
+	dots := p.curToken
+	p.nextToken()
+	end := p.parseExpression(LOWEST)
+
+	if !p.expectPeek(tokens.LBRACE) {
+		return nil
+	}
+
+	one := p.arena.integer()
+	*one = IntegerLiteral{Token: tokens.Token{Type: tokens.INT, Literal: "1", Offset: dots.Offset, End: dots.End}, Value: 1}
+	stmt.Initializer = &LetStatement{Token: in, Name: name, Value: start}
+	stmt.Condition = &InfixExpression{Token: dots, Left: name, Operator: "<", Right: end}
+	stmt.Increment = &AssignmentExpression{Token: dots, Name: name, Operator: "+=", Value: one}
+	stmt.Body = p.parseBlockStatement()
+
+	return stmt
+}
+
 func (p *Parser) parseBreakStatement() *BreakStatement {
 	stmt := &BreakStatement{Token: p.curToken}
 
-	if p.peekTokenIs(tokens.SEMICOLON) {
-		p.nextToken()
-	}
+	p.endStatement()
 
 	return stmt
 }
@@ -441,9 +735,7 @@ func (p *Parser) parseBreakStatement() *BreakStatement {
 func (p *Parser) parseContinueStatement() *ContinueStatement {
 	stmt := &ContinueStatement{Token: p.curToken}
 
-	if p.peekTokenIs(tokens.SEMICOLON) {
-		p.nextToken()
-	}
+	p.endStatement()
 
 	return stmt
 }
@@ -452,19 +744,173 @@ func (p *Parser) parseContinueStatement() *ContinueStatement {
 func (p *Parser) parseFunctionStatement() *ExpressionStatement {
 	// Function declarations are actually function literals assigned to the global scope
 	// We'll parse them as expression statements for now
-	stmt := &ExpressionStatement{Token: p.curToken}
+	stmt := p.arena.expression()
+	stmt.Token = p.curToken
 	stmt.Expression = p.parseFunctionLiteral()
+	p.finish(stmt.Expression, stmt.Token.Offset)
 
-	if p.peekTokenIs(tokens.SEMICOLON) {
+	p.endStatement()
+
+	return stmt
+}
+
+// parseFunctionDeclaration parses "function name(params) { body }", which
+// is short for let name = function(params) { body }
+func (p *Parser) parseFunctionDeclaration() *LetStatement {
+	stmt := p.arena.let()
+	stmt.Token = p.curToken
+	p.require(FunctionDeclarations, stmt.Token)
+
+	p.nextToken()
+	stmt.Name = p.curIdentifier()
+
+	lit := &FunctionLiteral{Token: stmt.Token, Name: stmt.Name.Value}
+	if !p.parseFunction(lit) {
+		return nil
+	}
+	// Record the source as the function literal it stands for
+	lit.Source = "function" + p.l.Slice(stmt.Name.Token.End, p.curToken.End)
+	p.finish(lit, lit.Token.Offset)
+	stmt.Value = lit
+	p.document(lit, stmt.Token.Offset)
+
+	p.endStatement()
+
+	// Declarations of the same name that follow are further clauses of
+	// the function
+	for p.peekTokenIs(tokens.FUNCTION) {
+		if next := p.l.PeekToken(); next.Type != tokens.IDENT || next.Literal != stmt.Name.Value {
+			break
+		}
+		p.nextToken()
+		clause := &FunctionLiteral{Token: p.curToken, Name: stmt.Name.Value}
+		p.require(FunctionClauses, clause.Token)
+		p.nextToken()
+		name := p.curToken
+		if !p.parseFunction(clause) {
+			return nil
+		}
+		clause.Source = "function" + p.l.Slice(name.End, p.curToken.End)
+		p.finish(clause, clause.Token.Offset)
+		lit.Clauses = append(lit.Clauses, clause)
+
+		p.endStatement()
+	}
+
+	return stmt
+}
+
+// parseRecordDeclaration parses record Point {x, y}, which binds Point to
+// a function that makes records with those fields: Point(1, 2)
+func (p *Parser) parseRecordDeclaration() *LetStatement {
+	stmt := p.arena.let()
+	stmt.Token = p.curToken
+	p.require(Records, stmt.Token)
+
+	p.nextToken()
+	stmt.Name = p.curIdentifier()
+	lit := &RecordLiteral{Token: stmt.Token, Name: stmt.Name.Value}
+
+	if !p.expectPeek(tokens.LBRACE) {
+		return nil
+	}
+	declared := map[string]bool{}
+	for !p.peekTokenIs(tokens.RBRACE) {
+		// Fields are read as properties, so keywords may name them
+		p.nextToken()
+		if !isWord(p.curToken.Literal) {
+			p.errorAt(p.curToken, messages.Sprintf("expected a field name, got %s instead", p.curToken.Type))
+			return nil
+		}
+		field := p.curIdentifier()
+		if declared[field.Value] {
+			p.errorAt(field.Token, messages.Sprintf("field %s is declared twice in record %s", field.Value, lit.Name))
+		}
+		declared[field.Value] = true
+		lit.Fields = append(lit.Fields, field)
+		if !p.peekTokenIs(tokens.COMMA) {
+			break
+		}
+		p.nextToken()
+		if p.peekTokenIs(tokens.RBRACE) {
+			p.require(TrailingCommas, p.curToken)
+		}
+	}
+	if !p.expectPeek(tokens.RBRACE) {
+		return nil
+	}
+	p.finish(lit, lit.Token.Offset)
+	stmt.Value = lit
+	p.document(lit, stmt.Token.Offset)
+
+	p.endStatement()
+
+	return stmt
+}
+
+// parseDecoratedStatement parses a declaration with decorators before it:
+//
+//	@memoize
+//	@timed("slow")
+//	function slow(x) { ... }
+//
+// Each decorator is an expression for a function that is called with the
+// declared value when the declaration runs, the nearest first, and the
+// name is bound to what the outermost returns:
+// let slow = memoize(timed("slow")(function(x) { ... })).
+func (p *Parser) parseDecoratedStatement() Statement {
+	p.require(Decorators, p.curToken)
+	var decorators []*CallExpression
+	for p.curTokenIs(tokens.AT) {
+		call := p.arena.call()
+		*call = CallExpression{Token: p.curToken}
+		p.nextToken()
+		call.Function = p.parseExpression(LOWEST)
+		if IsNil(call.Function) {
+			return nil
+		}
+		decorators = append(decorators, call)
 		p.nextToken()
 	}
 
+	start := p.curToken
+	var value *Expression
+	stmt := p.parseStatement()
+	switch s := stmt.(type) {
+	case *LetStatement:
+		value = &s.Value
+	case *ConstStatement:
+		value = &s.Value
+	case *VarStatement:
+		value = &s.Value
+	case nil:
+		return nil
+	}
+	if value == nil || IsNil(*value) {
+		p.errorAt(start, messages.Translate("a decorator must come before a function declaration or a let, const or var with a value"))
+		return nil
+	}
+
+	// The comment above a decorated declaration is above its decorators
+	p.document(*value, decorators[0].Token.Offset)
+	for i := len(decorators) - 1; i >= 0; i-- {
+		decorators[i].Arguments = []Expression{*value}
+		p.finish(decorators[i], decorators[i].Token.Offset)
+		*value = decorators[i]
+	}
 	return stmt
 }
 
 func (p *Parser) parseSwitchStatement() *SwitchStatement {
 	stmt := &SwitchStatement{Token: p.curToken}
 
+	// switch type (value) is a type switch; a plain switch has its value
+	// in parentheses right away
+	if p.peekTokenIs(tokens.IDENT) && p.peekToken.Literal == "type" {
+		p.nextToken()
+		stmt.TypeSwitch = true
+	}
+
 	if !p.expectPeek(tokens.LPAREN) {
 		return nil
 	}
@@ -483,8 +929,9 @@ func (p *Parser) parseSwitchStatement() *SwitchStatement {
 	p.nextToken()
 
 	for !p.curTokenIs(tokens.RBRACE) && !p.curTokenIs(tokens.EOF) {
+		start := p.curToken.Offset
 		if p.curTokenIs(tokens.CASE) {
-			caseStmt := p.parseCaseStatement()
+			caseStmt := p.parseCaseStatement(stmt.TypeSwitch)
 			if caseStmt != nil {
 				stmt.Cases = append(stmt.Cases, caseStmt)
 			}
@@ -492,16 +939,32 @@ func (p *Parser) parseSwitchStatement() *SwitchStatement {
 			stmt.Default = p.parseDefaultStatement()
 		}
 		p.nextToken()
+		p.ensureProgress(start)
 	}
 
 	return stmt
 }
 
-func (p *Parser) parseCaseStatement() *CaseStatement {
+func (p *Parser) parseCaseStatement(typeSwitch bool) *CaseStatement {
 	stmt := &CaseStatement{Token: p.curToken}
 
-	p.nextToken()
-	stmt.Value = p.parseExpression(LOWEST)
+	if typeSwitch {
+		for {
+			p.nextToken()
+			if !isWord(p.curToken.Literal) {
+				p.errorAt(p.curToken, messages.Sprintf("expected a type name, got %s instead", p.curToken.Type))
+				return nil
+			}
+			stmt.Types = append(stmt.Types, p.curIdentifier())
+			if !p.peekTokenIs(tokens.COMMA) {
+				break
+			}
+			p.nextToken()
+		}
+	} else {
+		p.nextToken()
+		stmt.Value = p.parseExpression(LOWEST)
+	}
 
 	if !p.expectPeek(tokens.COLON) {
 		return nil
@@ -513,9 +976,24 @@ func (p *Parser) parseCaseStatement() *CaseStatement {
 
 	stmt.Body = p.parseBlockStatement()
 
+	p.finish(stmt, stmt.Token.Offset)
 	return stmt
 }
 
+// isWord reports whether literal is spelled like an identifier, as type
+// names are whether or not they are keywords
+func isWord(literal string) bool {
+	if literal == "" {
+		return false
+	}
+	for _, ch := range literal {
+		if !('a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_') {
+			return false
+		}
+	}
+	return true
+}
+
 func (p *Parser) parseDefaultStatement() *DefaultStatement {
 	stmt := &DefaultStatement{Token: p.curToken}
 
@@ -529,6 +1007,7 @@ func (p *Parser) parseDefaultStatement() *DefaultStatement {
 
 	stmt.Body = p.parseBlockStatement()
 
+	p.finish(stmt, stmt.Token.Offset)
 	return stmt
 }
 
@@ -566,7 +1045,7 @@ func (p *Parser) parseCatchStatement() *CatchStatement {
 		return nil
 	}
 
-	stmt.Parameter = &Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	stmt.Parameter = p.curIdentifier()
 
 	if !p.expectPeek(tokens.RPAREN) {
 		return nil
@@ -578,6 +1057,7 @@ func (p *Parser) parseCatchStatement() *CatchStatement {
 
 	stmt.Body = p.parseBlockStatement()
 
+	p.finish(stmt, stmt.Token.Offset)
 	return stmt
 }
 
@@ -590,6 +1070,7 @@ func (p *Parser) parseFinallyStatement() *FinallyStatement {
 
 	stmt.Body = p.parseBlockStatement()
 
+	p.finish(stmt, stmt.Token.Offset)
 	return stmt
 }
 
@@ -600,9 +1081,7 @@ func (p *Parser) parseThrowStatement() *ThrowStatement {
 
 	stmt.Value = p.parseExpression(LOWEST)
 
-	if p.peekTokenIs(tokens.SEMICOLON) {
-		p.nextToken()
-	}
+	p.endStatement()
 
 	return stmt
 }
@@ -616,19 +1095,39 @@ func (p *Parser) parseImportStatement() *ImportStatement {
 	}
 
 	stmt.Path = &StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+	p.finish(stmt.Path, p.curToken.Offset)
 
 	if p.peekTokenIs(tokens.AS) {
 		p.nextToken()
 		if !p.expectPeek(tokens.IDENT) {
 			return nil
 		}
-		stmt.Alias = &Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		stmt.Alias = p.curIdentifier()
 	}
 
-	if p.peekTokenIs(tokens.SEMICOLON) {
+	p.endStatement()
+
+	return stmt
+}
+
+func (p *Parser) parseGlobalStatement() *GlobalStatement {
+	stmt := &GlobalStatement{Token: p.curToken}
+
+	if !p.expectPeek(tokens.IDENT) {
+		return nil
+	}
+	stmt.Names = append(stmt.Names, p.curIdentifier())
+
+	for p.peekTokenIs(tokens.COMMA) {
 		p.nextToken()
+		if !p.expectPeek(tokens.IDENT) {
+			return nil
+		}
+		stmt.Names = append(stmt.Names, p.curIdentifier())
 	}
 
+	p.endStatement()
+
 	return stmt
 }
 
@@ -641,6 +1140,111 @@ func (p *Parser) parseExportStatement() *ExportStatement {
 	return stmt
 }
 
+// pragmas are the options a file may set with #name lines before its
+// first statement:
+//
+//	#strict          require semicolons, as with --strict
+//	#no-semicolons   let newlines end statements, even with --strict
+//	#deterministic   make the interpreter's clock fixed
+//	#dialect es      write keywords in a dialect, such as si and sino
+//	#lang gokid 0.2  read the file with the grammar of a language version
+var pragmas = []string{"strict", "no-semicolons", "deterministic", "dialect", "lang"}
+
+func (p *Parser) parsePragmaStatement() *PragmaStatement {
+	stmt := &PragmaStatement{Token: p.curToken}
+
+	// The name runs up to the first space, so #no-semicolons is one name
+	// though it is lexed as no, - and semicolons
+	for p.peekToken.Offset == p.curToken.End && (p.peekTokenIs(tokens.IDENT) || p.peekTokenIs(tokens.MINUS)) {
+		p.nextToken()
+	}
+	stmt.Name = p.l.Slice(stmt.Token.End, p.curToken.End)
+	name := tokens.Token{Literal: "#" + stmt.Name, Offset: stmt.Token.Offset, End: p.curToken.End}
+
+	switch {
+	case stmt.Name == "":
+		p.errorAt(stmt.Token, messages.Translate("expected a pragma name after #"))
+		return nil
+	case !slices.Contains(pragmas, stmt.Name):
+		msg := messages.Sprintf("unknown pragma %s", name.Literal)
+		if suggestion := diagnostics.Suggest(stmt.Name, pragmas); suggestion != "" {
+			msg += messages.Sprintf("; did you mean '#%s'?", suggestion)
+		}
+		p.errorAt(name, msg)
+		return nil
+	case p.started:
+		p.errorAt(name, messages.Sprintf("pragma %s must come before the first statement", name.Literal))
+		return nil
+	case stmt.Name == "dialect" && (p.peekOnNewLine() || !isWord(p.peekToken.Literal)):
+		p.errorAt(name, messages.Translate("#dialect needs the name of a dialect, such as #dialect es"))
+		return nil
+	case stmt.Name == "dialect":
+		p.nextToken()
+		stmt.Value = p.curToken.Literal
+		if _, ok := tokens.LookupDialect(stmt.Value); !ok {
+			p.errorAt(p.curToken, messages.Sprintf("unknown dialect %s; the dialects are %s", stmt.Value, strings.Join(tokens.Dialects(), ", ")))
+			return nil
+		}
+	case stmt.Name == "lang":
+		if !p.parseLanguage(stmt, name) {
+			return nil
+		}
+	}
+	if !p.peekTokenIs(tokens.EOF) && !p.peekOnNewLine() {
+		p.errorAt(p.peekToken, messages.Sprintf("pragma %s must be on a line of its own", name.Literal))
+		return nil
+	}
+	p.resume(stmt)
+
+	return stmt
+}
+
+// resume applies what stmt changes about parsing the rest of the file: a
+// pragma's option, or the end of the pragmas. Parsing part of a file
+// resumes after each statement before the part.
+func (p *Parser) resume(stmt Statement) {
+	pragma, ok := stmt.(*PragmaStatement)
+	if !ok {
+		p.started = true
+		return
+	}
+	switch pragma.Name {
+	case "strict":
+		p.strict = true
+	case "no-semicolons":
+		p.strict = false
+	case "lang":
+		p.lang, _ = ParseLanguageVersion(strings.TrimPrefix(pragma.Value, "gokid "))
+	}
+}
+
+// parseLanguage parses the rest of #lang gokid 0.2, whose version runs up
+// to the first space as the pragma's name does
+func (p *Parser) parseLanguage(stmt *PragmaStatement, name tokens.Token) bool {
+	if p.peekOnNewLine() || p.peekToken.Literal != "gokid" {
+		p.errorAt(name, messages.Sprintf("#lang needs the language and its version, such as #lang gokid %s", LatestLanguage))
+		return false
+	}
+	p.nextToken()
+	start := p.curToken
+	if p.peekOnNewLine() || !p.peekTokenIs(tokens.INT) && !p.peekTokenIs(tokens.FLOAT) {
+		p.errorAt(name, messages.Sprintf("#lang needs the language and its version, such as #lang gokid %s", LatestLanguage))
+		return false
+	}
+	p.nextToken()
+	version := p.curToken
+	for p.peekToken.Offset == p.curToken.End && (p.peekTokenIs(tokens.INT) || p.peekTokenIs(tokens.FLOAT) || p.peekTokenIs(tokens.DOT)) {
+		p.nextToken()
+	}
+	version.Literal = p.l.Slice(version.Offset, p.curToken.End)
+	if _, err := ParseLanguageVersion(version.Literal); err != nil {
+		p.errorAt(version, err.Error())
+		return false
+	}
+	stmt.Value = p.l.Slice(start.Offset, p.curToken.End)
+	return true
+}
+
 // Expression parsing
 func (p *Parser) parseExpression(precedence int) Expression {
 	prefix := p.prefixParseFns[p.curToken.Type]
@@ -648,9 +1252,11 @@ func (p *Parser) parseExpression(precedence int) Expression {
 		p.noPrefixParseFnError(p.curToken.Type)
 		return nil
 	}
+	start := p.curToken.Offset
 	leftExp := prefix()
+	p.finish(leftExp, start)
 
-	for !p.peekTokenIs(tokens.SEMICOLON) && precedence < p.peekPrecedence() {
+	for !p.peekTokenIs(tokens.SEMICOLON) && precedence < p.peekPrecedence() && !p.newlineEndsStatement() {
 		infix := p.infixParseFns[p.peekToken.Type]
 		if infix == nil {
 			return leftExp
@@ -659,6 +1265,7 @@ func (p *Parser) parseExpression(precedence int) Expression {
 		p.nextToken()
 
 		leftExp = infix(leftExp)
+		p.finish(leftExp, start)
 	}
 
 	return leftExp
@@ -666,16 +1273,27 @@ func (p *Parser) parseExpression(precedence int) Expression {
 
 // Prefix expressions
 func (p *Parser) parseIdentifier() Expression {
-	return &Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	return p.curIdentifier()
 }
 
 func (p *Parser) parseIntegerLiteral() Expression {
-	lit := &IntegerLiteral{Token: p.curToken}
-
-	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	lit := p.arena.integer()
+	lit.Token = p.curToken
+
+	// Only a 0x, 0o or 0b prefix changes the base, so 010 is ten
+	literal, base := p.curToken.Literal, 10
+	if len(literal) > 1 && strings.ContainsAny(literal[1:2], "xXoObB") {
+		p.require(RadixIntegers, p.curToken)
+		base = 0
+	}
+	value, err := strconv.ParseInt(literal, base, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		p.errorAt(p.curToken, messages.Sprintf("integer %s is too large; the largest integer is %d", literal, int64(math.MaxInt64)))
+		return nil
+	}
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		msg := messages.Sprintf("could not parse %q as integer", literal)
+		p.errorAt(p.curToken, msg)
 		return nil
 	}
 
@@ -688,8 +1306,24 @@ func (p *Parser) parseFloatLiteral() Expression {
 
 	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as float", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		msg := messages.Sprintf("could not parse %q as float", p.curToken.Literal)
+		p.errorAt(p.curToken, msg)
+		return nil
+	}
+
+	lit.Value = value
+	return lit
+}
+
+func (p *Parser) parseImaginaryLiteral() Expression {
+	lit := &ImaginaryLiteral{Token: p.curToken}
+	p.require(ImaginaryLiterals, p.curToken)
+
+	literal := p.curToken.Literal
+	value, err := strconv.ParseFloat(literal[:len(literal)-1], 64)
+	if err != nil {
+		msg := messages.Sprintf("could not parse %q as imaginary number", p.curToken.Literal)
+		p.errorAt(p.curToken, msg)
 		return nil
 	}
 
@@ -697,8 +1331,21 @@ func (p *Parser) parseFloatLiteral() Expression {
 	return lit
 }
 
+func (p *Parser) parseDecimalLiteral() Expression {
+	p.require(DecimalLiterals, p.curToken)
+	literal := p.curToken.Literal
+	return &DecimalLiteral{Token: p.curToken, Value: literal[:len(literal)-1]}
+}
+
 func (p *Parser) parseStringLiteral() Expression {
-	return &StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+	lit := p.arena.stringLiteral()
+	*lit = StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+	return lit
+}
+
+func (p *Parser) parseSymbolLiteral() Expression {
+	p.require(SymbolLiterals, p.curToken)
+	return &SymbolLiteral{Token: p.curToken, Value: p.curToken.Literal[1:]}
 }
 
 func (p *Parser) parseBooleanLiteral() Expression {
@@ -710,7 +1357,8 @@ func (p *Parser) parseNullLiteral() Expression {
 }
 
 func (p *Parser) parsePrefixExpression() Expression {
-	expression := &PrefixExpression{
+	expression := p.arena.prefix()
+	*expression = PrefixExpression{
 		Token:    p.curToken,
 		Operator: p.curToken.Literal,
 	}
@@ -757,6 +1405,22 @@ func (p *Parser) parseIfExpression() Expression {
 	if p.peekTokenIs(tokens.ELSE) {
 		p.nextToken()
 
+		// else if is an else block holding only the next if
+		if p.peekTokenIs(tokens.IF) {
+			p.nextToken()
+			start := p.curToken.Offset
+			stmt := p.arena.expression()
+			stmt.Token = p.curToken
+			stmt.Expression = p.parseIfExpression()
+			p.finish(stmt, start)
+			block := p.arena.block()
+			block.Token = stmt.Token
+			block.Statements = []Statement{stmt}
+			p.finish(block, start)
+			expression.Alternative = block
+			return expression
+		}
+
 		if !p.expectPeek(tokens.LBRACE) {
 			return nil
 		}
@@ -769,23 +1433,60 @@ func (p *Parser) parseIfExpression() Expression {
 
 func (p *Parser) parseFunctionLiteral() Expression {
 	lit := &FunctionLiteral{Token: p.curToken}
+	if !p.parseFunction(lit) {
+		return nil
+	}
+	lit.Source = p.l.Slice(lit.Token.Offset, p.curToken.End)
 
-	if !p.expectPeek(tokens.LPAREN) {
+	return lit
+}
+
+// curKeywordIsName reports whether the current token is a keyword used as
+// a key in an object literal, as in {type: "circle"} or {default() {}}.
+// true, false and null stay values.
+func (p *Parser) curKeywordIsName() bool {
+	switch p.curToken.Type {
+	case tokens.TRUE, tokens.FALSE, tokens.NULL:
+		return false
+	}
+	return isWord(p.curToken.Literal) && (p.peekTokenIs(tokens.COLON) || p.peekTokenIs(tokens.LPAREN))
+}
+
+// parseMethod parses a method written as name(params) { body } in an
+// object literal, which is short for name: function(params) { body }
+func (p *Parser) parseMethod() *FunctionLiteral {
+	lit := &FunctionLiteral{Token: p.curToken, Name: p.curToken.Literal}
+	if !p.parseFunction(lit) {
 		return nil
 	}
+	// Record the source as the function literal it stands for
+	lit.Source = "function" + p.l.Slice(lit.Token.End, p.curToken.End)
+	p.finish(lit, lit.Token.Offset)
+
+	return lit
+}
+
+// parseFunction parses the parameters and body that follow the current
+// token into lit
+func (p *Parser) parseFunction(lit *FunctionLiteral) bool {
+	if !p.expectPeek(tokens.LPAREN) {
+		return false
+	}
 
-	lit.Parameters = p.parseFunctionParameters()
+	lit.Parameters = p.parseFunctionParameters(lit)
 
 	if !p.expectPeek(tokens.LBRACE) {
-		return nil
+		return false
 	}
 
 	lit.Body = p.parseBlockStatement()
-
-	return lit
+	return true
 }
 
-func (p *Parser) parseFunctionParameters() []*Identifier {
+// parseFunctionParameters parses the parameters of lit, recording those
+// that are patterns in lit.Patterns and leaving them nil in the list it
+// returns
+func (p *Parser) parseFunctionParameters(lit *FunctionLiteral) []*Identifier {
 	identifiers := []*Identifier{}
 
 	if p.peekTokenIs(tokens.RPAREN) {
@@ -795,15 +1496,22 @@ func (p *Parser) parseFunctionParameters() []*Identifier {
 
 	p.nextToken()
 
-	ident := &Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	ident := p.parseFunctionParameter(lit, len(identifiers))
 	identifiers = append(identifiers, ident)
 
 	for p.peekTokenIs(tokens.COMMA) {
 		p.nextToken()
+		if p.peekTokenIs(tokens.RPAREN) {
+			p.require(TrailingCommas, p.curToken)
+			break // trailing comma
+		}
 		p.nextToken()
-		ident := &Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		ident := p.parseFunctionParameter(lit, len(identifiers))
 		identifiers = append(identifiers, ident)
 	}
+	for lit.Patterns != nil && len(lit.Patterns) < len(identifiers) {
+		lit.Patterns = append(lit.Patterns, nil)
+	}
 
 	if !p.expectPeek(tokens.RPAREN) {
 		return nil
@@ -812,6 +1520,48 @@ func (p *Parser) parseFunctionParameters() []*Identifier {
 	return identifiers
 }
 
+// parseFunctionParameter parses parameter i of lit. A literal, as in
+// function fib(0), is a pattern the argument must equal: it goes in
+// lit.Patterns and the parameter has no name.
+func (p *Parser) parseFunctionParameter(lit *FunctionLiteral, i int) *Identifier {
+	switch p.curToken.Type {
+	case tokens.INT, tokens.FLOAT, tokens.STRING, tokens.SYMBOL, tokens.TRUE, tokens.FALSE, tokens.NULL, tokens.MINUS:
+	default:
+		return p.curIdentifier()
+	}
+
+	tok := p.curToken
+	p.require(FunctionClauses, tok)
+	pattern := p.parseExpression(PREFIX)
+	if IsNil(pattern) {
+		return nil
+	}
+	if !isPattern(pattern) {
+		p.errorAt(tok, messages.Translate("a parameter must be a name or a literal such as 0, \"add\" or null"))
+		return nil
+	}
+	for len(lit.Patterns) < i {
+		lit.Patterns = append(lit.Patterns, nil)
+	}
+	lit.Patterns = append(lit.Patterns, pattern)
+	return nil
+}
+
+// isPattern reports whether node can be a parameter pattern: a literal
+// number, string, symbol, boolean or null, or a negated number
+func isPattern(node Expression) bool {
+	switch node := node.(type) {
+	case *IntegerLiteral, *FloatLiteral, *StringLiteral, *SymbolLiteral, *BooleanLiteral, *NullLiteral:
+		return true
+	case *PrefixExpression:
+		switch node.Right.(type) {
+		case *IntegerLiteral, *FloatLiteral:
+			return node.Operator == "-"
+		}
+	}
+	return false
+}
+
 func (p *Parser) parseArrayLiteral() Expression {
 	array := &ArrayLiteral{Token: p.curToken}
 
@@ -822,26 +1572,56 @@ func (p *Parser) parseArrayLiteral() Expression {
 
 func (p *Parser) parseObjectLiteral() Expression {
 	obj := &ObjectLiteral{Token: p.curToken}
-	obj.Pairs = make(map[Expression]Expression)
 
 	for !p.peekTokenIs(tokens.RBRACE) && !p.peekTokenIs(tokens.EOF) {
+		start := p.curToken.Offset
 		p.nextToken()
 
-		key := p.parseExpression(LOWEST)
-
-		if !p.expectPeek(tokens.COLON) {
-			return nil
+		var key, value Expression
+		switch {
+		case p.curTokenIs(tokens.IDENT) || p.curKeywordIsName():
+			// A name is the key itself, as in {name: "Kid"}, and on its
+			// own it also gives the value: {name} is {name: name}
+			key = &StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+			p.finish(key, p.curToken.Offset)
+			if p.curTokenIs(tokens.IDENT) && (p.peekTokenIs(tokens.COMMA) || p.peekTokenIs(tokens.RBRACE)) {
+				p.require(ObjectShorthand, p.curToken)
+				value = p.curIdentifier()
+			} else if p.peekTokenIs(tokens.LPAREN) {
+				// A method: {greet() { ... }}
+				p.require(ObjectShorthand, p.curToken)
+				method := p.parseMethod()
+				if method == nil {
+					return nil
+				}
+				value = method
+			}
+		case p.curTokenIs(tokens.LBRACKET):
+			// A computed key, as in {[prefix + "id"]: 1}
+			p.require(ObjectShorthand, p.curToken)
+			p.nextToken()
+			key = p.parseExpression(LOWEST)
+			if !p.expectPeek(tokens.RBRACKET) {
+				return nil
+			}
+		default:
+			key = p.parseExpression(LOWEST)
 		}
 
-		p.nextToken()
-
-		value := p.parseExpression(LOWEST)
+		if value == nil {
+			if !p.expectPeek(tokens.COLON) {
+				return nil
+			}
+			p.nextToken()
+			value = p.parseExpression(LOWEST)
+		}
 
-		obj.Pairs[key] = value
+		obj.Pairs = append(obj.Pairs, ObjectPair{Key: key, Value: value})
 
 		if !p.peekTokenIs(tokens.RBRACE) && !p.expectPeek(tokens.COMMA) {
 			return nil
 		}
+		p.ensureProgress(start)
 	}
 
 	if !p.expectPeek(tokens.RBRACE) {
@@ -853,7 +1633,8 @@ func (p *Parser) parseObjectLiteral() Expression {
 
 // Infix expressions
 func (p *Parser) parseInfixExpression(left Expression) Expression {
-	expression := &InfixExpression{
+	expression := p.arena.infix()
+	*expression = InfixExpression{
 		Token:    p.curToken,
 		Left:     left,
 		Operator: p.curToken.Literal,
@@ -867,34 +1648,84 @@ func (p *Parser) parseInfixExpression(left Expression) Expression {
 }
 
 func (p *Parser) parseAssignmentExpression(left Expression) Expression {
-	ident, ok := left.(*Identifier)
-	if !ok {
-		msg := fmt.Sprintf("expected identifier, got %T", left)
-		p.errors = append(p.errors, msg)
-		return nil
-	}
-
-	expression := &AssignmentExpression{
+	expression := p.arena.assignment()
+	*expression = AssignmentExpression{
 		Token:    p.curToken,
-		Name:     ident,
 		Operator: p.curToken.Literal,
 	}
 
+	switch target := left.(type) {
+	case *Identifier:
+		expression.Name = target
+	case *IndexExpression, *DotExpression:
+		expression.Target = target
+	default:
+		msg := messages.Sprintf("expected identifier, index or property, got %T", left)
+		p.errorAt(p.curToken, msg)
+		return nil
+	}
+
 	precedence := p.curPrecedence()
 	p.nextToken()
 	expression.Value = p.parseExpression(precedence)
+	if expression.Operator == "=" && expression.Name != nil {
+		nameFunction(expression.Value, expression.Name)
+	}
 
 	return expression
 }
 
+// nameFunction records the variable a function literal is bound to, so
+// errors about the function can refer to it by name
+func nameFunction(value Expression, name *Identifier) {
+	if fn, ok := value.(*FunctionLiteral); ok && fn != nil {
+		fn.Name = name.Value
+	}
+}
+
+// document gives a function or record type declared at offset the comment
+// above it
+func (p *Parser) document(value Expression, offset int) {
+	if fn, ok := value.(*FunctionLiteral); ok && fn != nil {
+		fn.Doc = docComment(p.l.Slice(0, offset))
+	}
+	if record, ok := value.(*RecordLiteral); ok && record != nil {
+		record.Doc = docComment(p.l.Slice(0, offset))
+	}
+}
+
+// docComment returns the // comment lines that end source, directly above
+// what follows it, without their slashes
+func docComment(source string) string {
+	cut := strings.LastIndexByte(source, '\n')
+	if strings.TrimSpace(source[cut+1:]) != "" {
+		return ""
+	}
+	var doc []string
+	for cut >= 0 {
+		source = source[:cut]
+		cut = strings.LastIndexByte(source, '\n')
+		line := strings.TrimSpace(source[cut+1:])
+		if !strings.HasPrefix(line, "//") {
+			break
+		}
+		line = strings.TrimPrefix(line, "//")
+		doc = append(doc, strings.TrimPrefix(line, " "))
+	}
+	slices.Reverse(doc)
+	return strings.Join(doc, "\n")
+}
+
 func (p *Parser) parseCallExpression(fn Expression) Expression {
-	exp := &CallExpression{Token: p.curToken, Function: fn}
+	exp := p.arena.call()
+	*exp = CallExpression{Token: p.curToken, Function: fn}
 	exp.Arguments = p.parseExpressionList(tokens.RPAREN)
 	return exp
 }
 
 func (p *Parser) parseIndexExpression(left Expression) Expression {
-	exp := &IndexExpression{Token: p.curToken, Left: left}
+	exp := p.arena.index()
+	*exp = IndexExpression{Token: p.curToken, Left: left}
 
 	p.nextToken()
 	exp.Index = p.parseExpression(LOWEST)
@@ -907,13 +1738,17 @@ func (p *Parser) parseIndexExpression(left Expression) Expression {
 }
 
 func (p *Parser) parseDotExpression(left Expression) Expression {
-	exp := &DotExpression{Token: p.curToken, Left: left}
+	exp := p.arena.dot()
+	*exp = DotExpression{Token: p.curToken, Left: left}
 
-	if !p.expectPeek(tokens.IDENT) {
+	// Keywords are property names here too, as in value.type
+	if !p.peekTokenIs(tokens.IDENT) && !isWord(p.peekToken.Literal) {
+		p.peekError(tokens.IDENT)
 		return nil
 	}
+	p.nextToken()
 
-	exp.Property = &Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	exp.Property = p.curIdentifier()
 
 	return exp
 }
@@ -948,6 +1783,10 @@ func (p *Parser) parseExpressionList(end tokens.TokenType) []Expression {
 
 	for p.peekTokenIs(tokens.COMMA) {
 		p.nextToken()
+		if p.peekTokenIs(end) {
+			p.require(TrailingCommas, p.curToken)
+			break // trailing comma
+		}
 		p.nextToken()
 		args = append(args, p.parseExpression(LOWEST))
 	}
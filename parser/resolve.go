@@ -0,0 +1,252 @@
+package parser
+
+import (
+	"gokid/diagnostics"
+	"gokid/messages"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Unresolved reports the names a program reads that it never defines,
+// which would fail with "identifier not found" if the code ran. known
+// says whether a name is defined outside the program, such as a builtin.
+//
+// A name defined anywhere in the program counts as defined everywhere, so
+// that functions may call ones declared after them; only names defined
+// nowhere are reported.
+func Unresolved(program *Program, known func(name string) bool) []diagnostics.Diagnostic {
+	defined := map[string]bool{"this": true}
+	define := func(name *Identifier) {
+		if !IsNil(name) {
+			defined[name.Value] = true
+		}
+	}
+	Walk(program, func(node Node) bool {
+		switch n := node.(type) {
+		case *LetStatement:
+			define(n.Name)
+		case *ConstStatement:
+			define(n.Name)
+		case *VarStatement:
+			define(n.Name)
+		case *FunctionLiteral:
+			for _, param := range n.Parameters {
+				define(param)
+			}
+		case *CatchStatement:
+			define(n.Parameter)
+		case *ForOfStatement:
+			define(n.Name)
+		case *GlobalStatement:
+			for _, name := range n.Names {
+				define(name)
+			}
+		case *AssignmentExpression:
+			define(n.Name)
+		case *ImportStatement:
+			if !IsNil(n.Alias) {
+				define(n.Alias)
+			} else if !IsNil(n.Path) {
+				base := path.Base(n.Path.Value)
+				defined[strings.TrimSuffix(base, path.Ext(base))] = true
+			}
+		}
+		return true
+	})
+
+	var list diagnostics.List
+	var visit func(Node) bool
+	visit = func(node Node) bool {
+		switch n := node.(type) {
+		case *Identifier:
+			if !defined[n.Value] && !known(n.Value) {
+				list.Add(diagnostics.Diagnostic{
+					Severity: diagnostics.Error,
+					Message:  messages.Sprintf("identifier not found: %s", n.Value),
+					Offset:   n.Token.Offset,
+					Length:   len(n.Value),
+					Code:     "E_UNDEFINED_IDENT",
+				})
+			}
+		case *DotExpression:
+			// A property is looked up on the value, not in scope
+			Walk(n.Left, visit)
+			return false
+		case *CaseStatement:
+			// So are the type names of a type switch
+			Walk(n.Value, visit)
+			Walk(n.Body, visit)
+			return false
+		}
+		return true
+	}
+	Walk(program, visit)
+	list.Sort()
+	return list.Items()
+}
+
+// Binding is a variable a program declares, with every identifier that
+// refers to it
+type Binding struct {
+	Name  string
+	Scope Node          // the Program, FunctionLiteral, ForStatement, ForOfStatement or CatchStatement it is in
+	Decl  *Identifier   // where it is declared, or first assigned
+	Uses  []*Identifier // every identifier naming it, in source order, Decl included
+}
+
+// resolveScope is a scope of the program being resolved. Function scopes
+// and the program hold the variables assignment creates; the others hold
+// only what they declare.
+type resolveScope struct {
+	node     Node
+	outer    *resolveScope
+	function bool
+	declared map[string]*Binding
+	assigned map[string]*Identifier // first plain assignment of each name
+	globals  map[string]bool
+}
+
+// Resolve works out which variable each identifier in program refers to,
+// following the scopes the interpreter makes: the program, each function,
+// for and for-of loop, and catch block. Identifiers that name no variable
+// the program declares, such as builtins and property names, are left out.
+//
+// As when the program runs, a variable declared anywhere in a scope is
+// visible throughout it. Assigning with = to a name that isn't declared
+// makes a variable of the function it's in; when an outer scope declares
+// the name, the two are resolved as one, since which one a read sees
+// depends on whether the assignment has run yet.
+func Resolve(program *Program) map[*Identifier]*Binding {
+	scopes := map[Node]*resolveScope{}
+	root := &resolveScope{node: program, function: true, declared: map[string]*Binding{},
+		assigned: map[string]*Identifier{}, globals: map[string]bool{}}
+	scopes[program] = root
+
+	// First every scope's declarations, so that a use may come before them
+	current := root
+	declare := func(s *resolveScope, name *Identifier) {
+		if IsNil(name) {
+			return
+		}
+		if _, ok := s.declared[name.Value]; !ok {
+			s.declared[name.Value] = &Binding{Name: name.Value, Scope: s.node, Decl: name}
+		}
+	}
+	var collect func(Node) bool
+	collect = func(node Node) bool {
+		var scope *resolveScope
+		switch n := node.(type) {
+		case *LetStatement:
+			declare(current, n.Name)
+		case *ConstStatement:
+			declare(current, n.Name)
+		case *VarStatement:
+			declare(current, n.Name)
+		case *ImportStatement:
+			declare(current, n.Alias)
+		case *GlobalStatement:
+			for _, name := range n.Names {
+				current.globals[name.Value] = true
+			}
+		case *AssignmentExpression:
+			if n.Operator == "=" && !IsNil(n.Name) {
+				s := current
+				for !s.function {
+					s = s.outer
+				}
+				for o := current; o != nil; o = o.outer {
+					if o.globals[n.Name.Value] {
+						s = root
+					}
+				}
+				if _, ok := s.assigned[n.Name.Value]; !ok {
+					s.assigned[n.Name.Value] = n.Name
+				}
+			}
+		case *FunctionLiteral:
+			scope = &resolveScope{function: true, assigned: map[string]*Identifier{}}
+		case *ForStatement, *ForOfStatement, *CatchStatement:
+			scope = &resolveScope{}
+		}
+		if scope == nil {
+			return true
+		}
+		scope.node, scope.outer = node, current
+		scope.declared, scope.globals = map[string]*Binding{}, map[string]bool{}
+		scopes[node] = scope
+		current = scope
+		switch n := node.(type) {
+		case *FunctionLiteral:
+			for _, param := range n.Parameters {
+				declare(scope, param)
+			}
+		case *ForOfStatement:
+			declare(scope, n.Name)
+		case *CatchStatement:
+			declare(scope, n.Parameter)
+		}
+		Walk(node, func(child Node) bool { return child == node || collect(child) })
+		current = scope.outer
+		return false
+	}
+	Walk(program, collect)
+
+	// Then what each identifier refers to
+	resolved := map[*Identifier]*Binding{}
+	lookup := func(s *resolveScope, name string) *Binding {
+		for o := s; o != nil; o = o.outer {
+			if b, ok := o.declared[name]; ok {
+				return b
+			}
+		}
+		for o := s; o != nil; o = o.outer {
+			if o.globals[name] {
+				s = root
+				break
+			}
+		}
+		for o := s; o != nil; o = o.outer {
+			if first, ok := o.assigned[name]; ok {
+				o.declared[name] = &Binding{Name: name, Scope: o.node, Decl: first}
+				return o.declared[name]
+			}
+		}
+		return nil
+	}
+	current = root
+	var visit func(Node) bool
+	visit = func(node Node) bool {
+		switch n := node.(type) {
+		case *Identifier:
+			if b := lookup(current, n.Value); b != nil {
+				resolved[n] = b
+				b.Uses = append(b.Uses, n)
+			}
+		case *DotExpression:
+			Walk(n.Left, visit)
+			return false
+		case *CaseStatement:
+			Walk(n.Value, visit)
+			Walk(n.Body, visit)
+			return false
+		}
+		if scope, ok := scopes[node]; ok && node != program {
+			current = scope
+			Walk(node, func(child Node) bool { return child == node || visit(child) })
+			current = scope.outer
+			return false
+		}
+		return true
+	}
+	Walk(program, visit)
+
+	sorted := map[*Binding]bool{}
+	for _, b := range resolved {
+		if !sorted[b] {
+			sorted[b] = true
+			sort.Slice(b.Uses, func(i, j int) bool { return b.Uses[i].Token.Offset < b.Uses[j].Token.Offset })
+		}
+	}
+	return resolved
+}
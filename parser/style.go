@@ -0,0 +1,32 @@
+package parser
+
+import (
+	"gokid/diagnostics"
+	"gokid/messages"
+)
+
+// Suggestions reports style improvements to a program that change nothing
+// it does, each with a fix: var declarations, which are written as let.
+// gokid check reports them; the interpreter doesn't.
+func Suggestions(program *Program) []diagnostics.Diagnostic {
+	var list diagnostics.List
+	Walk(program, func(node Node) bool {
+		stmt, ok := node.(*VarStatement)
+		if !ok || IsNil(stmt.Name) {
+			return true
+		}
+		edits := []diagnostics.Edit{{Offset: stmt.Token.Offset, Length: len(stmt.Token.Literal), Text: "let"}}
+		if IsNil(stmt.Value) {
+			edits = append(edits, diagnostics.Edit{Offset: stmt.Name.Token.End, Text: " = null"})
+		}
+		list.Add(diagnostics.Diagnostic{
+			Severity: diagnostics.Warning,
+			Message:  messages.Translate("use let instead of var"),
+			Offset:   stmt.Token.Offset,
+			Length:   len(stmt.Token.Literal),
+			Fix:      &diagnostics.Fix{Message: "change var to let", Edits: edits},
+		})
+		return true
+	})
+	return list.Items()
+}
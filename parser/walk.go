@@ -0,0 +1,142 @@
+package parser
+
+import "reflect"
+
+// Walk calls fn for node and then, if fn returns true, for each of its
+// children in source order. Missing (nil) children are skipped.
+func Walk(node Node, fn func(Node) bool) {
+	if IsNil(node) || !fn(node) {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for _, stmt := range n.Statements {
+			Walk(stmt, fn)
+		}
+	case *ArrayLiteral:
+		for _, el := range n.Elements {
+			Walk(el, fn)
+		}
+	case *ObjectLiteral:
+		for _, pair := range n.Pairs {
+			Walk(pair.Key, fn)
+			Walk(pair.Value, fn)
+		}
+	case *LetStatement:
+		Walk(n.Name, fn)
+		Walk(n.Value, fn)
+		if lit, ok := n.Value.(*FunctionLiteral); ok && lit != nil {
+			for _, clause := range lit.Clauses {
+				Walk(clause, fn)
+			}
+		}
+	case *ConstStatement:
+		Walk(n.Name, fn)
+		Walk(n.Value, fn)
+	case *VarStatement:
+		Walk(n.Name, fn)
+		Walk(n.Value, fn)
+	case *ReturnStatement:
+		Walk(n.ReturnValue, fn)
+	case *ExpressionStatement:
+		Walk(n.Expression, fn)
+	case *BlockStatement:
+		for _, stmt := range n.Statements {
+			Walk(stmt, fn)
+		}
+	case *FunctionLiteral:
+		for i, param := range n.Parameters {
+			if param == nil && i < len(n.Patterns) {
+				Walk(n.Patterns[i], fn)
+				continue
+			}
+			Walk(param, fn)
+		}
+		Walk(n.Body, fn)
+	case *CallExpression:
+		Walk(n.Function, fn)
+		for _, arg := range n.Arguments {
+			Walk(arg, fn)
+		}
+	case *PrefixExpression:
+		Walk(n.Right, fn)
+	case *InfixExpression:
+		Walk(n.Left, fn)
+		Walk(n.Right, fn)
+	case *IfExpression:
+		Walk(n.Condition, fn)
+		Walk(n.Consequence, fn)
+		Walk(n.Alternative, fn)
+	case *WhileStatement:
+		Walk(n.Condition, fn)
+		Walk(n.Body, fn)
+	case *ForStatement:
+		Walk(n.Initializer, fn)
+		Walk(n.Condition, fn)
+		Walk(n.Increment, fn)
+		Walk(n.Body, fn)
+	case *ForOfStatement:
+		Walk(n.Name, fn)
+		Walk(n.Iterable, fn)
+		Walk(n.Body, fn)
+	case *SwitchStatement:
+		Walk(n.Value, fn)
+		for _, c := range n.Cases {
+			Walk(c, fn)
+		}
+		Walk(n.Default, fn)
+	case *CaseStatement:
+		Walk(n.Value, fn)
+		for _, t := range n.Types {
+			Walk(t, fn)
+		}
+		Walk(n.Body, fn)
+	case *DefaultStatement:
+		Walk(n.Body, fn)
+	case *TryStatement:
+		Walk(n.Body, fn)
+		Walk(n.Catch, fn)
+		Walk(n.Finally, fn)
+	case *CatchStatement:
+		Walk(n.Parameter, fn)
+		Walk(n.Body, fn)
+	case *FinallyStatement:
+		Walk(n.Body, fn)
+	case *ThrowStatement:
+		Walk(n.Value, fn)
+	case *ImportStatement:
+		Walk(n.Path, fn)
+		Walk(n.Alias, fn)
+	case *ExportStatement:
+		Walk(n.Value, fn)
+	case *GlobalStatement:
+		for _, name := range n.Names {
+			Walk(name, fn)
+		}
+	case *AssignmentExpression:
+		Walk(n.Name, fn)
+		Walk(n.Target, fn)
+		Walk(n.Value, fn)
+	case *IndexExpression:
+		Walk(n.Left, fn)
+		Walk(n.Index, fn)
+	case *DotExpression:
+		Walk(n.Left, fn)
+		Walk(n.Property, fn)
+	case *TernaryExpression:
+		Walk(n.Condition, fn)
+		Walk(n.Consequence, fn)
+		Walk(n.Alternative, fn)
+	}
+}
+
+// IsNil reports whether node is nil, including typed nil pointers left by
+// failed parses
+func IsNil(node Node) bool {
+	if node == nil {
+		return true
+	}
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
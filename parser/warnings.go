@@ -0,0 +1,231 @@
+package parser
+
+import (
+	"gokid/diagnostics"
+	"gokid/messages"
+	"strings"
+)
+
+// scope tracks the names declared in one function or for-loop scope
+type scope struct {
+	outer    *scope
+	declared map[string]*Identifier
+	order    []*Identifier
+	params   map[string]bool
+	used     map[string]bool
+
+	// statements holds the let, const or var statement declaring a name
+	statements map[*Identifier]Statement
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{
+		outer:      outer,
+		declared:   map[string]*Identifier{},
+		params:     map[string]bool{},
+		used:       map[string]bool{},
+		statements: map[*Identifier]Statement{},
+	}
+}
+
+func (s *scope) declaredOutside(name string) bool {
+	for o := s.outer; o != nil; o = o.outer {
+		if _, ok := o.declared[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// analyzer finds suspicious but valid code: variables declared inside a
+// function and never read, and names that shadow an outer variable
+type analyzer struct {
+	source   string
+	warnings *diagnostics.List
+	current  *scope
+}
+
+func analyze(program *Program, source string, warnings *diagnostics.List) {
+	a := &analyzer{source: source, warnings: warnings, current: newScope(nil)}
+	Walk(program, a.visit)
+	warnings.Sort()
+}
+
+func (a *analyzer) visit(node Node) bool {
+	switch n := node.(type) {
+	case *Identifier:
+		a.current.used[n.Value] = true
+	case *LetStatement:
+		Walk(n.Value, a.visit)
+		if lit, ok := n.Value.(*FunctionLiteral); ok && lit != nil {
+			a.clauses(lit)
+		}
+		a.declare(n.Name, false)
+		a.current.statements[n.Name] = n
+		return false
+	case *ConstStatement:
+		Walk(n.Value, a.visit)
+		a.declare(n.Name, false)
+		a.current.statements[n.Name] = n
+		return false
+	case *VarStatement:
+		Walk(n.Value, a.visit)
+		a.declare(n.Name, false)
+		a.current.statements[n.Name] = n
+		return false
+	case *ImportStatement:
+		if !IsNil(n.Alias) {
+			a.declare(n.Alias, false)
+		}
+		return false
+	case *GlobalStatement:
+		return false
+	case *AssignmentExpression:
+		// Plain assignment writes the variable, compound assignment also reads it
+		if n.Operator != "=" {
+			Walk(n.Name, a.visit)
+		}
+		Walk(n.Target, a.visit)
+		Walk(n.Value, a.visit)
+		return false
+	case *DotExpression:
+		Walk(n.Left, a.visit)
+		return false
+	case *FunctionLiteral:
+		a.enter()
+		for _, param := range n.Parameters {
+			if param != nil {
+				a.declare(param, true)
+			}
+		}
+		Walk(n.Body, a.visit)
+		a.leave()
+		return false
+	case *ForOfStatement:
+		Walk(n.Iterable, a.visit)
+		a.enter()
+		a.declare(n.Name, false)
+		Walk(n.Body, a.visit)
+		a.leave()
+		return false
+	case *ForStatement:
+		a.enter()
+		Walk(n.Initializer, a.visit)
+		Walk(n.Condition, a.visit)
+		Walk(n.Increment, a.visit)
+		Walk(n.Body, a.visit)
+		a.leave()
+		return false
+	}
+	return true
+}
+
+// clauses visits the clauses after lit, warning about those that never
+// run because an earlier clause with as many parameters has no patterns
+func (a *analyzer) clauses(lit *FunctionLiteral) {
+	takesAll := map[int]bool{len(lit.Parameters): lit.Patterns == nil}
+	for _, clause := range lit.Clauses {
+		Walk(clause, a.visit)
+		if takesAll[len(clause.Parameters)] {
+			a.warnings.Warnf(clause.Token.Offset, len(clause.Token.Literal),
+				"this clause of %s never runs: an earlier one takes every call with as many arguments", lit.Name)
+		}
+		if clause.Patterns == nil {
+			takesAll[len(clause.Parameters)] = true
+		}
+	}
+}
+
+func (a *analyzer) declare(name *Identifier, param bool) {
+	s := a.current
+	if s.declaredOutside(name.Value) {
+		a.warnings.Warnf(name.Token.Offset, len(name.Value), "%s shadows a variable from an outer scope", name.Value)
+	}
+	if _, ok := s.declared[name.Value]; !ok {
+		s.order = append(s.order, name)
+	}
+	s.declared[name.Value] = name
+	s.params[name.Value] = param
+}
+
+func (a *analyzer) enter() {
+	a.current = newScope(a.current)
+}
+
+// leave reports unused variables of the scope and passes references to
+// names it doesn't declare on to the enclosing scope
+func (a *analyzer) leave() {
+	s := a.current
+	for _, name := range s.order {
+		if !s.used[name.Value] && !s.params[name.Value] {
+			a.warnings.Add(diagnostics.Diagnostic{
+				Severity: diagnostics.Warning,
+				Message:  messages.Sprintf("%s is declared but never used", name.Value),
+				Offset:   name.Token.Offset,
+				Length:   len(name.Value),
+				Fix:      a.removeDeclaration(name, s.statements[name]),
+			})
+		}
+	}
+	for name := range s.used {
+		if _, ok := s.declared[name]; !ok {
+			s.outer.used[name] = true
+		}
+	}
+	a.current = s.outer
+}
+
+// removeDeclaration returns a fix deleting stmt, which declares the unused
+// name. A value that may do something, such as a call, is kept as a
+// statement of its own. Names declared otherwise, such as by for-of, have
+// no fix.
+func (a *analyzer) removeDeclaration(name *Identifier, stmt Statement) *diagnostics.Fix {
+	var value Expression
+	switch stmt := stmt.(type) {
+	case *LetStatement:
+		value = stmt.Value
+	case *ConstStatement:
+		value = stmt.Value
+	case *VarStatement:
+		value = stmt.Value
+	default:
+		return nil
+	}
+
+	span := stmt.Range()
+	if IsNil(value) || hasNoEffect(value) {
+		return &diagnostics.Fix{Message: "remove " + name.Value, Edits: []diagnostics.Edit{a.removal(span.Start, span.End)}}
+	}
+	start := value.Range().Start
+	return &diagnostics.Fix{
+		Message: "remove " + name.Value + ", keeping its value",
+		Edits:   []diagnostics.Edit{{Offset: span.Start, Length: start - span.Start}},
+	}
+}
+
+// removal returns an edit deleting source from start to end, along with
+// the whole line when nothing else is on it, or else the spaces after it
+func (a *analyzer) removal(start, end int) diagnostics.Edit {
+	lineStart := strings.LastIndexByte(a.source[:start], '\n') + 1
+	lineEnd := len(a.source)
+	if i := strings.IndexByte(a.source[end:], '\n'); i >= 0 {
+		lineEnd = end + i
+	}
+	if strings.TrimSpace(a.source[lineStart:start]) == "" && strings.TrimSpace(a.source[end:lineEnd]) == "" {
+		start, end = lineStart, min(lineEnd+1, len(a.source))
+	} else {
+		end = lineEnd - len(strings.TrimLeft(a.source[end:lineEnd], " \t"))
+	}
+	return diagnostics.Edit{Offset: start, Length: end - start}
+}
+
+// hasNoEffect reports whether evaluating value can do nothing but produce
+// it, so it may be deleted
+func hasNoEffect(value Expression) bool {
+	switch value.(type) {
+	case *IntegerLiteral, *FloatLiteral, *ImaginaryLiteral, *DecimalLiteral, *StringLiteral,
+		*BooleanLiteral, *NullLiteral, *FunctionLiteral:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+// Package perf measures how fast GoKid programs are lexed, parsed and
+// evaluated, so that a change which slows the interpreter down shows up
+// before it is released.
+package perf
+
+import (
+	"embed"
+	"fmt"
+	"gokid/evaluator"
+	"gokid/lexer"
+	"gokid/parser"
+	"gokid/tokens"
+	"io"
+	"path"
+	"time"
+)
+
+//go:embed corpus/*.gokid
+var corpus embed.FS
+
+// Program is a GoKid source file to measure
+type Program struct {
+	Name   string
+	Source string
+}
+
+// Corpus returns the bundled programs, which between them exercise
+// arithmetic, recursion, loops, collections, closures and strings
+func Corpus() []Program {
+	entries, _ := corpus.ReadDir("corpus")
+	programs := make([]Program, 0, len(entries))
+	for _, entry := range entries {
+		source, _ := corpus.ReadFile(path.Join("corpus", entry.Name()))
+		programs = append(programs, Program{Name: entry.Name(), Source: string(source)})
+	}
+	return programs
+}
+
+// Result holds what one pass over a program does and how long it took on
+// average
+type Result struct {
+	Name string
+
+	Tokens     int // tokens lexed
+	Statements int // statements parsed, nested ones included
+	Steps      int // statements evaluated
+
+	Lex   time.Duration
+	Parse time.Duration
+	Eval  time.Duration
+
+	// Error is the message of the runtime error the program stopped with,
+	// if any. The rates still hold for the part that ran.
+	Error string
+}
+
+// TokensPerSec returns how many tokens the lexer produces per second
+func (r Result) TokensPerSec() float64 {
+	return rate(r.Tokens, r.Lex)
+}
+
+// StatementsPerSec returns how many statements the parser builds per
+// second
+func (r Result) StatementsPerSec() float64 {
+	return rate(r.Statements, r.Parse)
+}
+
+// EvalsPerSec returns how many statements the evaluator runs per second
+func (r Result) EvalsPerSec() float64 {
+	return rate(r.Steps, r.Eval)
+}
+
+func rate(n int, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) / d.Seconds()
+}
+
+// Measure lexes, parses and evaluates p, repeating each for at least d,
+// and returns the averages. What the program prints is discarded.
+func Measure(p Program, d time.Duration) Result {
+	r := Result{Name: p.Name}
+
+	r.Lex = repeat(d, func() {
+		l := lexer.NewLexer(p.Source)
+		r.Tokens = 0
+		for l.NextToken().Type != tokens.EOF {
+			r.Tokens++
+		}
+	})
+
+	var program *parser.Program
+	r.Parse = repeat(d, func() {
+		program = parser.New(lexer.NewLexer(p.Source)).ParseProgram()
+	})
+	r.Statements = 0
+	for _, stmt := range program.Statements {
+		parser.Walk(stmt, func(n parser.Node) bool {
+			if _, ok := n.(parser.Statement); ok {
+				r.Statements++
+			}
+			return true
+		})
+	}
+
+	r.Eval = repeat(d, func() {
+		env := evaluator.NewEnvironment()
+		env.SetOutput(io.Discard, io.Discard)
+		result := evaluator.Eval(program, env)
+		r.Steps = env.Steps()
+		if err, ok := result.(*evaluator.Error); ok {
+			r.Error = err.Message
+		}
+	})
+	return r
+}
+
+// repeat calls fn until d has passed, at least once, and returns the
+// average time of a call
+func repeat(d time.Duration, fn func()) time.Duration {
+	start := time.Now()
+	runs := 0
+	for runs == 0 || time.Since(start) < d {
+		fn()
+		runs++
+	}
+	return time.Since(start) / time.Duration(runs)
+}
+
+// Budget is the slowest acceptable rate of each phase; a zero field is
+// not checked
+type Budget struct {
+	TokensPerSec     float64
+	StatementsPerSec float64
+	EvalsPerSec      float64
+}
+
+// Check returns a description of every rate of r that is below the
+// budget
+func (b Budget) Check(r Result) []string {
+	var failures []string
+	check := func(what string, got, want float64) {
+		if want > 0 && got < want {
+			failures = append(failures, fmt.Sprintf("%s: %s %.0f/s, below the budget of %.0f/s", r.Name, what, got, want))
+		}
+	}
+	check("lexing", r.TokensPerSec(), b.TokensPerSec)
+	check("parsing", r.StatementsPerSec(), b.StatementsPerSec)
+	check("evaluation", r.EvalsPerSec(), b.EvalsPerSec)
+	return failures
+}
@@ -0,0 +1,57 @@
+package project
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// client fetches dependencies given by URL
+var client = &http.Client{Timeout: 30 * time.Second}
+
+// Get fetches every dependency of m into the gokid_modules directory next
+// to the manifest, replacing the copies already there, and calls fetched
+// with each dependency and the file it was written to
+func Get(m *Manifest, fetched func(dep Dependency, path string)) error {
+	dir := filepath.Join(m.Dir, ModulesDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, dep := range m.Dependencies {
+		source, err := fetch(m.Dir, dep.Source)
+		if err != nil {
+			return fmt.Errorf("%s: %w", dep.Name, err)
+		}
+		path := filepath.Join(dir, dep.Name+".gokid")
+		if err := os.WriteFile(path, source, 0o644); err != nil {
+			return fmt.Errorf("%s: %w", dep.Name, err)
+		}
+		if fetched != nil {
+			fetched(dep, path)
+		}
+	}
+	return nil
+}
+
+// fetch reads a module from a URL, or from a path relative to dir
+func fetch(dir, source string) ([]byte, error) {
+	if !IsURL(source) {
+		if !filepath.IsAbs(source) {
+			source = filepath.Join(dir, source)
+		}
+		return os.ReadFile(source)
+	}
+
+	resp, err := client.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", source, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
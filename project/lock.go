@@ -0,0 +1,180 @@
+package project
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"gokid/logging"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// LockFile is the name of the file that pins the content of modules
+// imported by URL
+const LockFile = "gokid.lock"
+
+// Lock records the hash of every module a project imports by URL, so the
+// same code is run on every machine and a module that changes on its
+// server is caught instead of silently picked up. Each line of the file
+// is a URL and the SHA-256 of its content:
+//
+//	https://example.com/lib.gokid sha256:9f86d08…
+type Lock struct {
+	path   string
+	hashes map[string]string
+}
+
+// LockPath returns where the lock file for code in dir belongs: next to
+// the project's manifest, or in dir when there is none
+func LockPath(dir string) string {
+	if manifest := Find(dir); manifest != "" {
+		return filepath.Join(filepath.Dir(manifest), LockFile)
+	}
+	dir, _ = filepath.Abs(dir)
+	return filepath.Join(dir, LockFile)
+}
+
+// LoadLock reads the lock file at path. A missing file is an empty lock.
+func LoadLock(path string) (*Lock, error) {
+	l := &Lock{path: path, hashes: map[string]string{}}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 || !strings.HasPrefix(fields[1], "sha256:") {
+			return nil, fmt.Errorf("%s:%d: expected a URL and its sha256:hash", path, line)
+		}
+		l.hashes[fields[0]] = fields[1]
+	}
+	return l, scanner.Err()
+}
+
+// Hash returns the hash recorded for url
+func (l *Lock) Hash(url string) (string, bool) {
+	hash, ok := l.hashes[url]
+	return hash, ok
+}
+
+// Save writes the lock file, with its URLs in order
+func (l *Lock) Save() error {
+	urls := make([]string, 0, len(l.hashes))
+	for url := range l.hashes {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+
+	var b strings.Builder
+	b.WriteString("# Generated by gokid: the content hash of each module imported by URL\n")
+	for _, url := range urls {
+		fmt.Fprintf(&b, "%s %s\n", url, l.hashes[url])
+	}
+	return os.WriteFile(l.path, []byte(b.String()), 0o644)
+}
+
+// CacheDir returns the directory modules fetched by URL are kept in:
+// $GOKID_CACHE, or a gokid directory in the user's cache directory
+func CacheDir() string {
+	if dir := os.Getenv("GOKID_CACHE"); dir != "" {
+		return dir
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "gokid")
+	}
+	return filepath.Join(os.TempDir(), "gokid-cache")
+}
+
+// urlMu serializes FetchURL, which reads and writes shared files
+var urlMu sync.Mutex
+
+// FetchURL returns the path of a local copy of the module at url, checked
+// against the hash in the lock file at lockPath. A module the lock knows
+// and the cache holds with that hash is used without going to the network;
+// a cached copy that doesn't match, which someone else who can write the
+// cache may have changed, is fetched again. A module the lock doesn't know
+// yet is downloaded and its hash added to the lock; one whose content no
+// longer matches its hash is an error.
+func FetchURL(url, lockPath string) (string, error) {
+	urlMu.Lock()
+	defer urlMu.Unlock()
+
+	lock, err := LoadLock(lockPath)
+	if err != nil {
+		return "", err
+	}
+	name := path.Base(strings.SplitN(url, "?", 2)[0])
+	if path.Ext(name) == "" {
+		name += ".gokid"
+	}
+
+	pinned, locked := lock.Hash(url)
+	if locked {
+		cached := cachePath(pinned, name)
+		if source, err := os.ReadFile(cached); err == nil {
+			if contentHash(source) == pinned {
+				logging.Debug("url module cache hit", "url", url, "path", cached)
+				return cached, nil
+			}
+			logging.Warn("cached url module does not match its hash", "url", url, "path", cached)
+		}
+	}
+	logging.Debug("fetching url module", "url", url, "locked", locked)
+
+	source, err := fetch("", url)
+	if err != nil {
+		return "", err
+	}
+	hash := contentHash(source)
+	if locked && hash != pinned {
+		return "", fmt.Errorf("%s has changed since it was locked: %s has %s, got %s; remove its line from %s to accept the new content",
+			url, LockFile, pinned, hash, lockPath)
+	}
+
+	cached := cachePath(hash, name)
+	if err := os.MkdirAll(filepath.Dir(cached), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(cached, source, 0o644); err != nil {
+		return "", err
+	}
+	if !locked {
+		lock.hashes[url] = hash
+		if err := lock.Save(); err != nil {
+			return "", err
+		}
+	}
+	return cached, nil
+}
+
+// contentHash returns the hash the lock file records for source
+func contentHash(source []byte) string {
+	sum := sha256.Sum256(source)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// cachePath is where the module with the given hash and file name is
+// cached. The file keeps its name, which imports bind the module to.
+func cachePath(hash, name string) string {
+	return filepath.Join(CacheDir(), strings.TrimPrefix(hash, "sha256:"), name)
+}
+
+// IsURL reports whether an import path is a URL to fetch
+func IsURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
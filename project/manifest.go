@@ -0,0 +1,163 @@
+// Package project reads the gokid.toml manifest of a GoKid project and
+// fetches the modules it depends on into gokid_modules, where imports find
+// them.
+package project
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ManifestFile is the name of a project's manifest
+const ManifestFile = "gokid.toml"
+
+// ModulesDir is the directory, next to a project's manifest, that holds
+// the modules the project depends on
+const ModulesDir = "gokid_modules"
+
+// Manifest describes a project:
+//
+//	name = "shapes"
+//	version = "0.1.0"
+//
+//	[dependencies]
+//	geometry = "https://example.com/geometry.gokid"
+//	colors = "../colors/colors.gokid"
+//
+// Each dependency is a module name and where to get its file, a URL or a
+// path relative to the manifest.
+type Manifest struct {
+	Name         string
+	Version      string
+	Dependencies []Dependency
+
+	// Dir is the directory the manifest was read from
+	Dir string
+}
+
+// Dependency is a module a project imports
+type Dependency struct {
+	Name   string
+	Source string
+}
+
+// Find looks for a manifest in dir and the directories above it, and
+// returns the path of the first one, or "" when there is none
+func Find(dir string) string {
+	dir, _ = filepath.Abs(dir)
+	for {
+		path := filepath.Join(dir, ManifestFile)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// Load reads the manifest at path
+func Load(path string) (*Manifest, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", path, err)
+	}
+	m.Dir = filepath.Dir(path)
+	return m, nil
+}
+
+// Parse reads a manifest. Only the parts of TOML a manifest uses are
+// understood: comments, the top-level name and version, and a
+// [dependencies] table, all with string values.
+func Parse(text string) (*Manifest, error) {
+	m := &Manifest{}
+	table := ""
+	seen := map[string]bool{}
+	for i, line := range strings.Split(text, "\n") {
+		fail := func(format string, args ...interface{}) error {
+			return fmt.Errorf("%d: %s", i+1, fmt.Sprintf(format, args...))
+		}
+
+		line = strings.TrimSpace(stripComment(line))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fail("unterminated table header %s", line)
+			}
+			table = strings.TrimSpace(line[1 : len(line)-1])
+			if table != "dependencies" {
+				return nil, fail("unknown table [%s]", table)
+			}
+			continue
+		}
+
+		key, raw, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fail("expected key = \"value\", got %s", line)
+		}
+		key = strings.TrimSpace(key)
+		value, err := strconv.Unquote(strings.TrimSpace(raw))
+		if err != nil || !strings.HasPrefix(strings.TrimSpace(raw), `"`) {
+			return nil, fail("value of %s must be a quoted string", key)
+		}
+		if seen[table+"."+key] {
+			return nil, fail("%s is set twice", key)
+		}
+		seen[table+"."+key] = true
+
+		switch {
+		case table == "dependencies" && !isName(key):
+			return nil, fail("dependency %s must be a name of letters and underscores, as imports bind it", key)
+		case table == "dependencies":
+			m.Dependencies = append(m.Dependencies, Dependency{Name: key, Source: value})
+		case key == "name":
+			m.Name = value
+		case key == "version":
+			m.Version = value
+		default:
+			return nil, fail("unknown key %s", key)
+		}
+	}
+	return m, nil
+}
+
+// stripComment removes a # comment that isn't inside a string
+func stripComment(line string) string {
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case '#':
+			if !quoted {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
+
+func isName(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_') {
+			return false
+		}
+	}
+	return s != ""
+}
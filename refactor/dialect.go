@@ -0,0 +1,71 @@
+package refactor
+
+import (
+	"fmt"
+	"gokid/diagnostics"
+	"gokid/lexer"
+	"gokid/parser"
+	"gokid/tokenizer"
+	"gokid/tokens"
+	"strings"
+)
+
+// Dialect returns the edits that write source's keywords in the dialect
+// called name, such as "es" for si and sino, and make its #dialect pragma
+// name it. Writing the result back in the first dialect gives source
+// again. A file in English needs no pragma, so writing one in English
+// removes it.
+func Dialect(source, name string) ([]diagnostics.Edit, error) {
+	target, ok := tokens.LookupDialect(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown dialect %s; the dialects are %s", name, strings.Join(tokens.Dialects(), ", "))
+	}
+	program, err := parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	src := diagnostics.NewSource("", source)
+	var edits []diagnostics.Edit
+	for _, piece := range tokenizer.NewTokenizer(source).GetPieces() {
+		tok := piece.Token
+		switch {
+		case tok.Ident == 0:
+			continue
+		case tok.Type == tokens.IDENT:
+			if target.Lookup(tok.Literal) != tokens.IDENT {
+				line, column := src.Position(tok.Offset)
+				return nil, fmt.Errorf("%s is a keyword in dialect %s; rename the variable at line %d, column %d first", tok.Literal, name, line, column)
+			}
+		case target.Lookup(tok.Literal) != tok.Type:
+			word, ok := target.Word(tok.Type)
+			if !ok {
+				return nil, fmt.Errorf("dialect %s has no keyword for %s", name, tok.Literal)
+			}
+			edits = append(edits, diagnostics.Edit{Offset: tok.Offset, Length: len(tok.Literal), Text: word})
+		}
+	}
+
+	// The pragma goes first, where the lexer looks for it
+	english := name == "en" && lexer.DefaultDialect == nil
+	for _, stmt := range program.Statements {
+		pragma, ok := stmt.(*parser.PragmaStatement)
+		if !ok || pragma.Name != "dialect" {
+			continue
+		}
+		span := pragma.Range()
+		if english {
+			start := strings.LastIndexByte(source[:span.Start], '\n') + 1
+			end := len(source)
+			if i := strings.IndexByte(source[span.End:], '\n'); i >= 0 {
+				end = span.End + i + 1
+			}
+			return append(edits, diagnostics.Edit{Offset: start, Length: end - start}), nil
+		}
+		return append(edits, diagnostics.Edit{Offset: span.End - len(pragma.Value), Length: len(pragma.Value), Text: name}), nil
+	}
+	if !english {
+		edits = append([]diagnostics.Edit{{Offset: 0, Text: "#dialect " + name + "\n"}}, edits...)
+	}
+	return edits, nil
+}
@@ -0,0 +1,280 @@
+package refactor
+
+import (
+	"fmt"
+	"gokid/diagnostics"
+	"gokid/parser"
+	"strings"
+)
+
+// Extract returns the edits that move the statements on lines first to
+// last of source, which must be whole statements of one block, into a new
+// function called name, and call it where they were. The function is
+// declared at the top level, before the statement holding them.
+//
+// Variables of enclosing functions the statements use become parameters.
+// A variable they set that the code after them reads is returned, so
+// they may set at most one; top-level variables they set are declared
+// global in the function.
+func Extract(source string, first, last int, name string, known func(string) bool) ([]diagnostics.Edit, error) {
+	program, err := parse(source)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkName(name, known); err != nil {
+		return nil, err
+	}
+	resolved := parser.Resolve(program)
+	for _, b := range resolved {
+		if b.Name == name {
+			return nil, fmt.Errorf("the program already has a variable named %s", name)
+		}
+	}
+
+	src := diagnostics.NewSource("", source)
+	lineOf := func(offset int) int {
+		line, _ := src.Position(offset)
+		return line
+	}
+	selected, top := selectStatements(program, first, last, lineOf)
+	if selected == nil {
+		return nil, fmt.Errorf("lines %d to %d are not whole statements of one block", first, last)
+	}
+	start, end := selected[0].Range().Start, selected[len(selected)-1].Range().End
+	lineStart := strings.LastIndexByte(source[:start], '\n') + 1
+	lineEnd := len(source)
+	if i := strings.IndexByte(source[end:], '\n'); i >= 0 {
+		lineEnd = end + i
+	}
+	if strings.TrimSpace(source[lineStart:start]) != "" || strings.TrimSpace(source[end:lineEnd]) != "" {
+		return nil, fmt.Errorf("lines %d to %d hold code besides the statements", first, last)
+	}
+	if err := checkJumps(selected); err != nil {
+		return nil, err
+	}
+
+	// What the statements read and set of the code around them
+	inFunction, declaredGlobal := enclosingFunctions(top, start)
+	var params, globals []string
+	var result *parser.Binding
+	seen := map[*parser.Binding]bool{}
+	for _, stmt := range selected {
+		var err error
+		parser.Walk(stmt, func(node parser.Node) bool {
+			if err != nil {
+				return false
+			}
+			var ident *parser.Identifier
+			set := false
+			switch n := node.(type) {
+			case *parser.Identifier:
+				ident = n
+			case *parser.AssignmentExpression:
+				ident, set = n.Name, true
+			}
+			if parser.IsNil(ident) {
+				return true
+			}
+			if ident.Value == "this" {
+				err = fmt.Errorf("the statements use this, which a function of their own would not see")
+				return false
+			}
+			b := resolved[ident]
+			if b == nil {
+				return true
+			}
+			declaredInside := start <= b.Decl.Token.Offset && b.Decl.Token.Offset < end
+			usedAfter := false
+			for _, use := range b.Uses {
+				usedAfter = usedAfter || use.Token.Offset >= end
+			}
+			switch {
+			case declaredInside:
+				set = usedAfter
+			case b.Scope == program && (!inFunction || declaredGlobal[b.Name] || !set):
+				if set && !seen[b] {
+					globals = append(globals, b.Name)
+				}
+				set = false
+			default:
+				// Setting a top-level variable from a function without
+				// global makes a variable of the function, so it is passed
+				// in and handed back like the function's own
+				if !seen[b] {
+					params = append(params, b.Name)
+				}
+				set = set && usedAfter
+			}
+			seen[b] = true
+			if set && result != b {
+				if result != nil {
+					err = fmt.Errorf("the statements set %s and %s, but a function can return only one value", result.Name, b.Name)
+					return false
+				}
+				result = b
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The new function, indented as a top-level declaration
+	lines := strings.Split(source[lineStart:lineEnd], "\n")
+	indent := commonIndent(lines)
+	var fn strings.Builder
+	fmt.Fprintf(&fn, "let %s = function(%s) {\n", name, strings.Join(params, ", "))
+	if len(globals) > 0 {
+		fmt.Fprintf(&fn, "    global %s;\n", strings.Join(globals, ", "))
+	}
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			fn.WriteString("\n")
+			continue
+		}
+		fn.WriteString("    " + strings.TrimPrefix(line, indent) + "\n")
+	}
+	if result != nil {
+		fmt.Fprintf(&fn, "    return %s;\n", result.Name)
+	}
+	fn.WriteString("};\n\n")
+
+	call := fmt.Sprintf("%s(%s);", name, strings.Join(params, ", "))
+	if result != nil {
+		if start <= result.Decl.Token.Offset && result.Decl.Token.Offset < end {
+			call = "let " + result.Name + " = " + call
+		} else {
+			call = result.Name + " = " + call
+		}
+	}
+	call = indent + call
+
+	topStart := strings.LastIndexByte(source[:top.Range().Start], '\n') + 1
+	if topStart == lineStart {
+		return []diagnostics.Edit{{Offset: lineStart, Length: lineEnd - lineStart, Text: fn.String() + call}}, nil
+	}
+	return []diagnostics.Edit{
+		{Offset: topStart, Text: fn.String()},
+		{Offset: lineStart, Length: lineEnd - lineStart, Text: call},
+	}, nil
+}
+
+// selectStatements finds the block whose statements lie within lines
+// first to last and returns them, along with the top-level statement
+// holding them. It returns nil if the lines cut through a statement.
+func selectStatements(program *parser.Program, first, last int, lineOf func(int) int) ([]parser.Statement, parser.Statement) {
+	var selected []parser.Statement
+	var top parser.Statement
+	var try func(stmts []parser.Statement) bool
+	try = func(stmts []parser.Statement) bool {
+		var inside []parser.Statement
+		for _, stmt := range stmts {
+			span := stmt.Range()
+			from, to := lineOf(span.Start), lineOf(span.End)
+			switch {
+			case first <= from && to <= last:
+				inside = append(inside, stmt)
+			case to < first || last < from:
+			case from <= first && last <= to && len(inside) == 0:
+				// The lines are inside this statement: look in its blocks
+				found := false
+				parser.Walk(stmt, func(node parser.Node) bool {
+					if block, ok := node.(*parser.BlockStatement); ok && !found && node != stmt {
+						found = try(block.Statements)
+						return false
+					}
+					return !found
+				})
+				return found
+			default:
+				return false
+			}
+		}
+		if len(inside) > 0 {
+			selected = inside
+			return true
+		}
+		return false
+	}
+	for _, stmt := range program.Statements {
+		top = stmt
+		if try([]parser.Statement{stmt}) {
+			return selected, top
+		}
+	}
+	return nil, nil
+}
+
+// enclosingFunctions reports whether the statement at offset in top is
+// inside a function, and which names the functions around it declare
+// global
+func enclosingFunctions(top parser.Statement, offset int) (bool, map[string]bool) {
+	inFunction := false
+	globals := map[string]bool{}
+	parser.Walk(top, func(node parser.Node) bool {
+		span := node.Range()
+		if span.Start > offset || offset >= span.End {
+			return false
+		}
+		if fn, ok := node.(*parser.FunctionLiteral); ok {
+			inFunction = true
+			parser.Walk(fn.Body, func(node parser.Node) bool {
+				if stmt, ok := node.(*parser.GlobalStatement); ok {
+					for _, name := range stmt.Names {
+						globals[name.Value] = true
+					}
+				}
+				_, nested := node.(*parser.FunctionLiteral)
+				return !nested
+			})
+		}
+		return true
+	})
+	return inFunction, globals
+}
+
+// checkJumps reports a return, break or continue that would leave the
+// statements, which a function of their own couldn't do
+func checkJumps(stmts []parser.Statement) error {
+	var err error
+	var visit func(node parser.Node, inLoop bool) bool
+	visit = func(node parser.Node, inLoop bool) bool {
+		switch node.(type) {
+		case *parser.FunctionLiteral:
+			return false
+		case *parser.ReturnStatement:
+			err = fmt.Errorf("the statements return from the function they are in")
+		case *parser.BreakStatement, *parser.ContinueStatement:
+			if !inLoop {
+				err = fmt.Errorf("the statements break or continue a loop around them")
+			}
+		case *parser.WhileStatement, *parser.ForStatement, *parser.ForOfStatement, *parser.SwitchStatement:
+			parser.Walk(node, func(child parser.Node) bool { return child == node || visit(child, true) })
+			return false
+		}
+		return err == nil
+	}
+	for _, stmt := range stmts {
+		parser.Walk(stmt, func(node parser.Node) bool { return visit(node, false) })
+	}
+	return err
+}
+
+// commonIndent returns the white space all non-blank lines start with
+func commonIndent(lines []string) string {
+	indent, first := "", true
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lead := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if first {
+			indent, first = lead, false
+		}
+		for !strings.HasPrefix(lead, indent) {
+			indent = indent[:len(indent)-1]
+		}
+	}
+	return indent
+}
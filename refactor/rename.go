@@ -0,0 +1,149 @@
+// Package refactor changes GoKid source without changing what it does:
+// renaming a variable and extracting statements into a function. Each
+// refactoring returns the edits that make it, for gokid refactor to apply
+// or an editor to offer as a code action.
+package refactor
+
+import (
+	"fmt"
+	"gokid/diagnostics"
+	"gokid/lexer"
+	"gokid/parser"
+	"gokid/tokens"
+	"strings"
+)
+
+// parse parses source, which must be free of syntax errors
+func parse(source string) (*parser.Program, error) {
+	p := parser.New(lexer.NewLexer(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, fmt.Errorf("the file has syntax errors: %s", p.Errors()[0])
+	}
+	return program, nil
+}
+
+// Rename returns the edits that rename the variable old to name. With at
+// -1 the variable is the one named old at the top level of the program,
+// or the only one with that name; otherwise it is the variable named by
+// the identifier at offset at. known says whether a name is defined
+// outside the program, such as a builtin, which the new name must not
+// hide.
+func Rename(source, old, name string, at int, known func(string) bool) ([]diagnostics.Edit, error) {
+	program, err := parse(source)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkName(name, known); err != nil {
+		return nil, err
+	}
+	resolved := parser.Resolve(program)
+	b, err := findBinding(source, program, resolved, old, at)
+	if err != nil {
+		return nil, err
+	}
+	if clash := clashing(program, resolved, b, name); clash != nil {
+		line, _ := diagnostics.NewSource("", source).Position(clash.Token.Offset)
+		return nil, fmt.Errorf("cannot rename %s to %s: a variable named %s is already in scope (line %d)", old, name, name, line)
+	}
+
+	// In {x} the identifier is also the key, which must stay "x"
+	shorthand := map[*parser.Identifier]bool{}
+	parser.Walk(program, func(node parser.Node) bool {
+		if object, ok := node.(*parser.ObjectLiteral); ok {
+			for _, pair := range object.Pairs {
+				k, isString := pair.Key.(*parser.StringLiteral)
+				v, isIdent := pair.Value.(*parser.Identifier)
+				if isString && isIdent && k.Token.Offset == v.Token.Offset {
+					shorthand[v] = true
+				}
+			}
+		}
+		return true
+	})
+
+	edits := make([]diagnostics.Edit, 0, len(b.Uses))
+	for _, use := range b.Uses {
+		text := name
+		if shorthand[use] {
+			text = old + ": " + name
+		}
+		edits = append(edits, diagnostics.Edit{Offset: use.Token.Offset, Length: len(old), Text: text})
+	}
+	return edits, nil
+}
+
+// checkName reports whether name can name a new variable
+func checkName(name string, known func(string) bool) error {
+	if name == "" || strings.TrimFunc(name, func(r rune) bool { return r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' }) != "" {
+		return fmt.Errorf("%q is not a name: names are letters and _", name)
+	}
+	if tokens.Reserved(name) {
+		return fmt.Errorf("%s is a keyword", name)
+	}
+	if known != nil && known(name) {
+		return fmt.Errorf("%s would hide the builtin %s", name, name)
+	}
+	return nil
+}
+
+// findBinding returns the variable old that at picks out
+func findBinding(source string, program *parser.Program, resolved map[*parser.Identifier]*parser.Binding, old string, at int) (*parser.Binding, error) {
+	if at >= 0 {
+		for ident, b := range resolved {
+			if ident.Token.Offset <= at && at < ident.Token.End {
+				if b.Name != old {
+					return nil, fmt.Errorf("the name there is %s, not %s", b.Name, old)
+				}
+				return b, nil
+			}
+		}
+		return nil, fmt.Errorf("there is no variable %s there", old)
+	}
+
+	var found []*parser.Binding
+	seen := map[*parser.Binding]bool{}
+	for _, b := range resolved {
+		if b.Name == old && !seen[b] {
+			seen[b] = true
+			found = append(found, b)
+		}
+	}
+	for _, b := range found {
+		if b.Scope == program {
+			return b, nil
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("the program declares no variable %s", old)
+	case 1:
+		return found[0], nil
+	}
+	src := diagnostics.NewSource("", source)
+	lines := make([]string, len(found))
+	for i, b := range found {
+		line, _ := src.Position(b.Decl.Token.Offset)
+		lines[i] = fmt.Sprint(line)
+	}
+	return nil, fmt.Errorf("%s is declared in %d scopes, on lines %s; say which with --at line:column", old, len(found), strings.Join(lines, ", "))
+}
+
+// clashing returns an identifier naming a variable called name that
+// renaming b to name could confuse with b: one declared in b's scope, a
+// scope around it or a scope inside it
+func clashing(program *parser.Program, resolved map[*parser.Identifier]*parser.Binding, b *parser.Binding, name string) *parser.Identifier {
+	inside := b.Scope.Range()
+	for ident, other := range resolved {
+		if other.Name != name {
+			continue
+		}
+		scope := other.Scope.Range()
+		encloses := scope.Start <= inside.Start && inside.End <= scope.End
+		enclosed := inside.Start <= scope.Start && scope.End <= inside.End
+		if other.Scope == program || b.Scope == program || encloses || enclosed {
+			return ident
+		}
+	}
+	return nil
+}
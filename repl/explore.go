@@ -0,0 +1,381 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"gokid/diagnostics"
+	"gokid/evaluator"
+	"gokid/lexer"
+	"gokid/parser"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// treeNode is a value shown by :explore, with the entries of a collection
+// listed below it once it is opened
+type treeNode struct {
+	label    string // the index or key of the value in its parent
+	path     string // an expression for the value, such as users[2].name
+	value    evaluator.Object
+	depth    int
+	open     bool
+	children []*treeNode // made when the node is first opened
+	parent   *treeNode
+}
+
+// explorer is the state of an :explore view
+type explorer struct {
+	root   *treeNode
+	rows   []*treeNode // the nodes shown, in order
+	cursor int         // index in rows of the selected node
+	top    int         // index in rows of the first node on screen
+	height int         // rows shown at once
+	plain  bool
+}
+
+// terminals holds the terminal Run reads each environment's input from,
+// so :explore can read single keys from it. It is only used on the
+// interpreter goroutine.
+var terminals = map[*evaluator.Environment]*os.File{}
+
+// readingKeys makes Run's input split into keys instead of lines, while
+// :explore has the terminal reading keys as they are pressed
+var readingKeys atomic.Bool
+
+// splitInput splits the REPL's input into lines, or into keys while
+// readingKeys is set. An arrow key is a single escape sequence.
+func splitInput(data []byte, atEOF bool) (int, []byte, error) {
+	if !readingKeys.Load() || len(data) == 0 {
+		return bufio.ScanLines(data, atEOF)
+	}
+	if data[0] == 0x1b {
+		if len(data) < 3 && !atEOF {
+			return 0, nil, nil
+		}
+		if len(data) >= 3 && (data[1] == '[' || data[1] == 'O') {
+			return 3, data[:3], nil
+		}
+		return 1, data[:1], nil
+	}
+	if !utf8.FullRune(data) && !atEOF {
+		return 0, nil, nil
+	}
+	_, size := utf8.DecodeRune(data)
+	return size, data[:size], nil
+}
+
+// explore evaluates source and shows the result as a tree whose
+// collections can be opened and closed. Keys are read with next: single
+// key presses when the session is in a terminal, or one key per line.
+func explore(source string, out io.Writer, env *evaluator.Environment, next func() (string, bool)) {
+	if source == "" {
+		fmt.Fprintln(out, "usage: :explore <expression>")
+		return
+	}
+	value, ok := evalExpression(source, out, env)
+	if !ok {
+		return
+	}
+	s := settingsFor(env, out)
+	if _, _, isCollection := evaluator.Entries(value); !isCollection || next == nil {
+		showResult(out, env, value, next)
+		return
+	}
+
+	x := &explorer{
+		root:   &treeNode{label: source, path: source, value: value, open: true},
+		height: s.height - 2,
+		plain:  diagnostics.Plain,
+	}
+	if x.height < 3 {
+		x.height = 3
+	}
+	x.root.expand()
+	x.layout()
+
+	// Redraw in place when keys can be read as they are pressed; otherwise
+	// each view follows the line typed, which screen readers read in order
+	redraw := false
+	if f := terminals[env]; f != nil && isTerminal(out) && !diagnostics.Plain {
+		if restore, err := keyMode(f); err == nil {
+			defer restore()
+			redraw = true
+		}
+	}
+
+	drawn := 0
+	for {
+		view := x.view(s.pretty.Width)
+		if redraw && drawn > 0 {
+			fmt.Fprintf(out, "\x1b[%dA\x1b[J", drawn)
+		}
+		io.WriteString(out, view)
+		drawn = strings.Count(view, "\n")
+
+		key, ok := next()
+		if !ok || !x.press(key) {
+			return
+		}
+	}
+}
+
+// evalExpression evaluates source in env as a REPL line does, showing any
+// error it has
+func evalExpression(source string, out io.Writer, env *evaluator.Environment) (evaluator.Object, bool) {
+	p := parser.New(lexer.NewLexer(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(out, p.Errors())
+		return nil, false
+	}
+
+	color := settingsFor(env, out).color
+	src := diagnostics.NewSource("<repl>", source)
+	value := evaluator.Eval(program, env)
+	env.Flush()
+	for _, w := range env.TakeWarnings() {
+		diagnostics.Render(out, src, []diagnostics.Diagnostic{w.Diagnostic()}, color)
+	}
+	if noteExit(value, env) {
+		return nil, false
+	}
+	if err, ok := value.(*evaluator.Error); ok {
+		if err.Located && err.Path == "" {
+			diagnostics.Render(out, src, []diagnostics.Diagnostic{err.Diagnostic()}, color)
+		} else {
+			showResult(out, env, err, nil)
+		}
+		return nil, false
+	}
+	return value, value != nil
+}
+
+// keyMode makes terminal f send keys as they are pressed, without echoing
+// them, and returns a function that restores it
+func keyMode(f *os.File) (func(), error) {
+	saved, err := stty(f, "-g")
+	if err != nil {
+		return nil, err
+	}
+	readingKeys.Store(true)
+	if _, err := stty(f, "-icanon", "-echo", "min", "1"); err != nil {
+		readingKeys.Store(false)
+		return nil, err
+	}
+	return func() {
+		stty(f, strings.TrimSpace(saved))
+		readingKeys.Store(false)
+	}, nil
+}
+
+func stty(f *os.File, args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = f
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	err := cmd.Run()
+	return output.String(), err
+}
+
+// press acts on a key, reporting false when it ends the view. Arrow keys,
+// or h, j, k and l, move and open; enter or space opens and closes.
+func (x *explorer) press(key string) bool {
+	node := x.rows[x.cursor]
+	switch strings.TrimRight(key, "\r\n") {
+	case "q", "\x1b":
+		return false
+	case "\x1b[A", "\x1bOA", "k", "up":
+		if x.cursor > 0 {
+			x.cursor--
+		}
+	case "\x1b[B", "\x1bOB", "j", "down":
+		if x.cursor < len(x.rows)-1 {
+			x.cursor++
+		}
+	case "\x1b[C", "\x1bOC", "l", "right":
+		if !node.open && node.expand() {
+			node.open = true
+		} else if node.open && len(node.children) > 0 {
+			x.cursor++
+		}
+	case "\x1b[D", "\x1bOD", "h", "left":
+		if node.open && node.parent != nil {
+			node.open = false
+		} else if node.parent != nil {
+			x.moveTo(node.parent)
+		}
+	case "", " ":
+		if node.open && node.parent != nil {
+			node.open = false
+		} else if !node.open && node.expand() {
+			node.open = true
+		}
+	}
+	x.layout()
+	return true
+}
+
+// expand makes the children of a collection node, reporting whether it
+// is one
+func (n *treeNode) expand() bool {
+	keys, values, ok := evaluator.Entries(n.value)
+	if !ok || n.children != nil {
+		return ok
+	}
+	n.children = make([]*treeNode, len(values))
+	for i, value := range values {
+		child := &treeNode{value: value, depth: n.depth + 1, parent: n}
+		switch key := keys[i].(type) {
+		case nil:
+			child.label = fmt.Sprint(i)
+			child.path = fmt.Sprintf("%s[%d]", n.path, i)
+		case *evaluator.String:
+			child.label = key.Value
+			if isName(key.Value) {
+				child.path = n.path + "." + key.Value
+			} else {
+				child.path = fmt.Sprintf("%s[\"%s\"]", n.path, key.Value)
+			}
+		default:
+			child.label = evaluator.Pretty(key, evaluator.PrettyOptions{})
+			child.path = fmt.Sprintf("%s[%s]", n.path, child.label)
+		}
+		n.children[i] = child
+	}
+	return true
+}
+
+// isName reports whether s can follow a dot in a property access
+func isName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// layout lists the nodes shown, keeping the selected one on screen
+func (x *explorer) layout() {
+	selected := x.rows
+	var node *treeNode
+	if x.cursor < len(selected) {
+		node = selected[x.cursor]
+	}
+	x.rows = x.rows[:0]
+	var walk func(n *treeNode)
+	walk = func(n *treeNode) {
+		x.rows = append(x.rows, n)
+		if n.open {
+			for _, child := range n.children {
+				walk(child)
+			}
+		}
+	}
+	walk(x.root)
+	if node != nil {
+		x.moveTo(node)
+	}
+}
+
+// moveTo moves the cursor to node, or to its closest ancestor shown
+func (x *explorer) moveTo(node *treeNode) {
+	for ; node != nil; node = node.parent {
+		for i, row := range x.rows {
+			if row == node {
+				x.cursor = i
+				x.scroll()
+				return
+			}
+		}
+	}
+	x.cursor = 0
+	x.scroll()
+}
+
+func (x *explorer) scroll() {
+	if x.cursor < x.top {
+		x.top = x.cursor
+	}
+	if x.cursor >= x.top+x.height {
+		x.top = x.cursor - x.height + 1
+	}
+}
+
+// view draws the rows on screen under the path of the selected node, with
+// a line on the keys below them
+func (x *explorer) view(width int) string {
+	if width < 20 {
+		width = 80
+	}
+	var b strings.Builder
+	b.WriteString(x.rows[x.cursor].path)
+	b.WriteString("\n")
+	end := x.top + x.height
+	if end > len(x.rows) {
+		end = len(x.rows)
+	}
+	for i := x.top; i < end; i++ {
+		pointer := "  "
+		if i == x.cursor {
+			pointer = "> "
+		}
+		b.WriteString(x.truncate(pointer+x.row(x.rows[i]), width))
+		b.WriteString("\n")
+	}
+	if x.plain {
+		fmt.Fprintf(&b, "Row %d of %d. Up and down or j and k move, right or l opens, left or h closes, q stops.\n", x.cursor+1, len(x.rows))
+	} else {
+		fmt.Fprintf(&b, "-- %d/%d  ↑↓ move  → open  ← close  q quit --\n", x.cursor+1, len(x.rows))
+	}
+	return b.String()
+}
+
+// row describes a node: a leaf's value, an open collection's size, or the
+// start of a closed one
+func (x *explorer) row(n *treeNode) string {
+	marker := " "
+	_, values, isCollection := evaluator.Entries(n.value)
+	if isCollection {
+		switch {
+		case n.open && x.plain:
+			marker = "-"
+		case n.open:
+			marker = "▾"
+		case x.plain:
+			marker = "+"
+		default:
+			marker = "▸"
+		}
+	}
+	text := ""
+	if n.open {
+		text = fmt.Sprintf("%s, %d entries", n.value.Type(), len(values))
+	} else {
+		text = evaluator.Pretty(n.value, evaluator.PrettyOptions{MaxItems: 5, MaxDepth: 1, Plain: x.plain})
+	}
+	text = strings.ReplaceAll(text, "\n", " ")
+	if n.parent == nil {
+		return fmt.Sprintf("%s %s", marker, text)
+	}
+	return fmt.Sprintf("%s%s %s: %s", strings.Repeat("  ", n.depth-1), marker, n.label, text)
+}
+
+// truncate shortens s to width characters
+func (x *explorer) truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	if x.plain {
+		return string([]rune(s)[:width-3]) + "..."
+	}
+	return string([]rune(s)[:width-1]) + "…"
+}
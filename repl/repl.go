@@ -2,53 +2,597 @@ package repl
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"gokid/crash"
+	"gokid/diagnostics"
 	"gokid/evaluator"
 	"gokid/lexer"
 	"gokid/parser"
 	"io"
+	"net"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
 )
 
 const PROMPT = ">> "
 
+// Prompt is shown before each line is read. It starts as PROMPT; gokid
+// repl --prompt changes it.
+var Prompt = PROMPT
+
+// Output names the formatter results are shown with. It starts as
+// "pretty"; gokid --output changes it, and :set output changes it for one
+// session.
+var Output = "pretty"
+
 const GOKID_FACE = `
     ____       _  ___     _ 
    / ___| ___ | |/ (_) __| |
   | |  _ / _ \| ' /| |/ _` + "`" + ` |
   | |_| | (_) | . \| | (_| |
    \____|\___/|_|\_\_|\__,_|
+` + WELCOME
 
+// WELCOME ends the banner, and is all of it in plain mode
+const WELCOME = `
 Welcome to the GoKid Programming Language!
 Feel free to type in commands.
 `
 
+// Banner returns what is shown when a session starts: GOKID_FACE, or
+// without the drawing when diagnostics.Plain is set
+func Banner() string {
+	if diagnostics.Plain {
+		return WELCOME
+	}
+	return GOKID_FACE
+}
+
+// The loop guard of sessions begun with Start, so that a runaway loop
+// fails with an error instead of freezing the session
+const (
+	DefaultMaxIterations = 10_000_000
+	DefaultLoopTimeout   = 10 * time.Second
+)
+
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+	fmt.Fprint(out, Banner())
 	env := evaluator.NewEnvironment()
+	env.SetLoopGuard(DefaultMaxIterations, DefaultLoopTimeout)
+	Run(in, out, env)
+}
 
-	fmt.Fprint(out, GOKID_FACE)
+// Run reads and evaluates lines in env until input ends or "exit" is
+// entered. Host tasks, such as lines from remote sessions, are run while
+// waiting for input. When a line calls os.exit, Run returns an
+// *evaluator.ExitError with its status.
+func Run(in io.Reader, out io.Writer, env *evaluator.Environment) error {
+	defer endTranscript(env)
+	if f, ok := in.(*os.File); ok && isTerminal(f) {
+		terminals[env] = f
+		defer delete(terminals, env)
+	}
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(in)
+		scanner.Split(splitInput)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
 
 	for {
-		fmt.Fprint(out, PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		fmt.Fprint(out, Prompt)
+
+	wait:
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok || strings.TrimSpace(line) == "exit" {
+					return nil
+				}
+				evalLine(line, out, env, func() (string, bool) {
+					line, ok := <-lines
+					return line, ok
+				})
+				if exit := takeExit(env); exit != nil {
+					return exit
+				}
+				break wait
+			case task := <-evaluator.HostTasks():
+				task()
+			}
+		}
+	}
+}
+
+// Listen accepts remote REPL sessions on addr. Every session shares env,
+// and its input is evaluated on the interpreter through host tasks.
+// Whoever connects can run any code as the user running the program, so
+// an address with no host, such as ":7777", listens on 127.0.0.1 only.
+func Listen(addr string, env *evaluator.Environment) (net.Listener, error) {
+	if host, port, err := net.SplitHostPort(addr); err == nil && host == "" {
+		addr = net.JoinHostPort("127.0.0.1", port)
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSession(conn, env)
+		}
+	}()
+
+	return listener, nil
+}
+
+func serveSession(conn net.Conn, env *evaluator.Environment) {
+	defer conn.Close()
+
+	fmt.Fprintf(conn, "Attached to GoKid interpreter at %s\n", conn.LocalAddr())
+	scanner := bufio.NewScanner(conn)
+	for {
+		fmt.Fprint(conn, Prompt)
+		if !scanner.Scan() {
 			return
 		}
 
 		line := scanner.Text()
-		l := lexer.NewLexer(line)
-		p := parser.New(l)
-		program := p.ParseProgram()
+		if strings.TrimSpace(line) == "exit" {
+			return
+		}
+		exited := false
+		evaluator.RunOnInterpreter(func() {
+			evalLine(line, conn, env, func() (string, bool) {
+				return scanner.Text(), scanner.Scan()
+			})
+			exited = takeExit(env) != nil
+		})
+		// os.exit ends the remote session, not the program it is attached to
+		if exited {
+			return
+		}
+	}
+}
+
+// Attach connects to a remote REPL session and relays the terminal to it
+func Attach(addr string, in io.Reader, out io.Writer) error {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	go func() {
+		io.Copy(conn, in)
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		}
+	}()
+
+	_, err = io.Copy(out, conn)
+	return err
+}
+
+// lastChanges holds, for each environment, the variables changed by the
+// last line evaluated in it. It is only used on the interpreter goroutine.
+var lastChanges = map[*evaluator.Environment][]evaluator.Change{}
+
+// loadedFiles holds, for each environment, the file :load last ran in it,
+// for :reload. It is only used on the interpreter goroutine.
+var loadedFiles = map[*evaluator.Environment]string{}
+
+// exits holds, for each environment, the os.exit a line or a loaded file
+// ended with, until the session sees it. It is only used on the
+// interpreter goroutine.
+var exits = map[*evaluator.Environment]*evaluator.ExitError{}
+
+// noteExit records evaluated if it is an os.exit, reporting whether it was
+func noteExit(evaluated evaluator.Object, env *evaluator.Environment) bool {
+	if err, ok := evaluated.(*evaluator.Error); ok && err.Code == evaluator.E_EXIT {
+		exits[env] = &evaluator.ExitError{Status: err.Status}
+		return true
+	}
+	return false
+}
+
+// takeExit returns and forgets the os.exit recorded for env, if any
+func takeExit(env *evaluator.Environment) *evaluator.ExitError {
+	exit := exits[env]
+	delete(exits, env)
+	return exit
+}
+
+// evalLine runs one line of input, recording it if the session is being
+// transcribed. next reads a further line, for paging long results.
+func evalLine(line string, out io.Writer, env *evaluator.Environment, next func() (string, bool)) {
+	recordLine(line, out, env, func(out io.Writer) { runLine(line, out, env, next) })
+}
+
+// runLine runs one line of input, writing its result to out
+func runLine(line string, out io.Writer, env *evaluator.Environment, next func() (string, bool)) {
+	trimmed := strings.TrimSpace(line)
+	if fields := strings.Fields(trimmed); len(fields) > 0 && fields[0] == ":explore" {
+		explore(strings.TrimSpace(strings.TrimPrefix(trimmed, ":explore")), out, env, next)
+		return
+	}
+	if strings.HasPrefix(trimmed, ":") {
+		runCommand(strings.Fields(line), out, env)
+		return
+	}
+
+	crash.Watch("<repl>", line, nil)
+	l := lexer.NewLexer(line)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		printParserErrors(out, p.Errors())
+		return
+	}
+	crash.Watch("<repl>", line, env)
+
+	color := settingsFor(env, out).color
+	src := diagnostics.NewSource("<repl>", line)
+	diagnostics.Render(out, src, p.Warnings(), color)
 
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
-			continue
+	before := env.Snapshot()
+	restore := interruptible(env)
+	evaluated := evaluator.Eval(program, env)
+	restore()
+	env.Flush()
+	lastChanges[env] = before.Diff(env)
+	for _, w := range env.TakeWarnings() {
+		diagnostics.Render(out, src, []diagnostics.Diagnostic{w.Diagnostic()}, color)
+	}
+	if noteExit(evaluated, env) {
+		return
+	}
+	if err, ok := evaluated.(*evaluator.Error); ok && err.Located && err.Path == "" {
+		diagnostics.Render(out, src, []diagnostics.Diagnostic{err.Diagnostic()}, color)
+		return
+	}
+	if evaluated != nil {
+		showResult(out, env, evaluated, next)
+	}
+}
+
+// errInterrupted is why a line stopped by Ctrl+C stopped
+var errInterrupted = errors.New("interrupted")
+
+// interruptible makes Ctrl+C stop the line running in env, rather than
+// end the REPL, when the REPL reads from a terminal and the program
+// doesn't handle the signal itself. The function it returns restores the
+// default once the line has run.
+func interruptible(env *evaluator.Environment) func() {
+	if terminals[env] == nil || evaluator.HandlesSignal(os.Interrupt) {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancelCause(context.Background())
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		select {
+		case <-interrupts:
+			cancel(errInterrupted)
+		case <-ctx.Done():
+		}
+	}()
+	env.SetContext(ctx)
+	return func() {
+		signal.Stop(interrupts)
+		cancel(nil)
+		env.SetContext(nil)
+	}
+}
+
+// runCommand handles REPL commands, which start with a colon
+func runCommand(fields []string, out io.Writer, env *evaluator.Environment) {
+	switch fields[0] {
+	case ":save-session":
+		if len(fields) != 2 {
+			fmt.Fprintln(out, "usage: :save-session <file>")
+			return
+		}
+		saveSession(fields[1], out, env)
+	case ":load-session":
+		if len(fields) != 2 {
+			fmt.Fprintln(out, "usage: :load-session <file>")
+			return
+		}
+		loadSession(fields[1], out, env)
+	case ":load":
+		if len(fields) != 2 {
+			fmt.Fprintln(out, "usage: :load <file>")
+			return
 		}
+		loadFile(fields[1], out, env)
+	case ":reload":
+		filename, ok := loadedFiles[env]
+		if !ok {
+			fmt.Fprintln(out, "nothing to reload; use :load <file> first")
+			return
+		}
+		loadFile(filename, out, env)
+	case ":builtins":
+		printBuiltins(out, env)
+	case ":doc":
+		if len(fields) != 2 {
+			fmt.Fprintln(out, "usage: :doc <name>")
+			return
+		}
+		printDoc(fields[1], out, env)
+	case ":env":
+		printEnv(out, env)
+	case ":diff":
+		printDiff(out, env)
+	case ":guard":
+		setGuard(fields[1:], out, env)
+	case ":set":
+		setOption(fields[1:], out, env)
+	case ":transcript":
+		setTranscript(fields[1:], out, env)
+	default:
+		fmt.Fprintf(out, "unknown command %s\n", fields[0])
+	}
+}
+
+func saveSession(filename string, out io.Writer, env *evaluator.Environment) {
+	file, err := os.Create(filename)
+	if err != nil {
+		fmt.Fprintf(out, "cannot save session: %v\n", err)
+		return
+	}
+	defer file.Close()
+
+	skipped, err := evaluator.SaveSession(env, file)
+	if err != nil {
+		fmt.Fprintf(out, "cannot save session: %v\n", err)
+		return
+	}
+	fmt.Fprintf(out, "session saved to %s\n", filename)
+	if len(skipped) > 0 {
+		fmt.Fprintf(out, "not saved: %s\n", strings.Join(skipped, ", "))
+	}
+}
+
+func loadSession(filename string, out io.Writer, env *evaluator.Environment) {
+	file, err := os.Open(filename)
+	if err != nil {
+		fmt.Fprintf(out, "cannot load session: %v\n", err)
+		return
+	}
+	defer file.Close()
+
+	names, err := evaluator.LoadSession(env, file)
+	if err != nil {
+		fmt.Fprintf(out, "cannot load session: %v\n", err)
+		return
+	}
+	fmt.Fprintf(out, "restored %s\n", strings.Join(names, ", "))
+}
+
+// loadFile runs a file in the session, as if its lines had been typed in,
+// and remembers it for :reload. Running it again redefines what it
+// defines, so the file can be edited and reloaded while the rest of the
+// session is kept.
+func loadFile(filename string, out io.Writer, env *evaluator.Environment) {
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintf(out, "cannot load file: %v\n", err)
+		return
+	}
+	loadedFiles[env] = filename
+
+	if runSource(filename, string(source), out, env) {
+		fmt.Fprintf(out, "loaded %s\n", filename)
+	}
+}
+
+// RunStartup runs a startup file, such as ~/.gokidrc.gk, in env before
+// the first prompt, so the helpers it defines and the modules it imports
+// are there from the start. A missing file is skipped, and errors in it
+// are shown without stopping the session. When the file calls os.exit,
+// RunStartup returns an *evaluator.ExitError with its status.
+func RunStartup(filename string, out io.Writer, env *evaluator.Environment) error {
+	source, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		fmt.Fprintf(out, "cannot run startup file: %v\n", err)
+		return nil
+	}
+	runSource(filename, string(source), out, env)
+	if exit := takeExit(env); exit != nil {
+		return exit
+	}
+	return nil
+}
+
+// runSource runs the source of a file in the session, reporting its
+// diagnostics and errors. It returns whether the file ran to the end.
+func runSource(filename, source string, out io.Writer, env *evaluator.Environment) bool {
+	color := settingsFor(env, out).color
+	src := diagnostics.NewSource(filename, source)
+	p := parser.New(lexer.NewLexer(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		diagnostics.Render(out, src, p.Diagnostics(), color)
+		return false
+	}
+	diagnostics.Render(out, src, p.Warnings(), color)
+
+	before := env.Snapshot()
+	evaluated := evaluator.Eval(program, env)
+	env.Flush()
+	lastChanges[env] = before.Diff(env)
+	for _, w := range env.TakeWarnings() {
+		diagnostics.Render(out, src, []diagnostics.Diagnostic{w.Diagnostic()}, color)
+	}
+	if noteExit(evaluated, env) {
+		return false
+	}
+	if err, ok := evaluated.(*evaluator.Error); ok {
+		if err.Located && err.Path == "" {
+			diagnostics.Render(out, src, []diagnostics.Diagnostic{err.Diagnostic()}, color)
+		} else {
+			fmt.Fprintf(out, "error: %s\n", err.Message)
+		}
+		return false
+	}
+	return true
+}
+
+// printBuiltins lists every builtin function with its signature and doc
+func printBuiltins(out io.Writer, env *evaluator.Environment) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, b := range env.Builtins() {
+		fmt.Fprintf(w, "%s\t%s\n", b.Signature(), b.Doc)
+	}
+	w.Flush()
+}
+
+// printDoc shows how to call the function a name refers to and what it
+// does: the doc string of a builtin, or the comment above a function's
+// declaration. The name of a module lists its members.
+func printDoc(name string, out io.Writer, env *evaluator.Environment) {
+	value, defined := env.Get(name)
+	if fn, ok := value.(*evaluator.Function); defined && ok {
+		fmt.Fprintln(out, fn.Signature())
+		if location := fn.Location(); location != "" {
+			fmt.Fprintf(out, "  defined at %s\n", location)
+		}
+		for _, line := range strings.Split(fn.Doc, "\n") {
+			if line != "" {
+				fmt.Fprintf(out, "  %s\n", line)
+			}
+		}
+		return
+	}
+	switch value := value.(type) {
+	case nil, *evaluator.Module:
+	case *evaluator.Builtin:
+		if value.Name == "" {
+			fmt.Fprintf(out, "no documentation for %s\n", name)
+			return
+		}
+		// The value itself, since the program may have made it, as a
+		// record declaration makes its constructor
+		fmt.Fprintln(out, value.Signature())
+		for _, line := range strings.Split(value.Doc, "\n") {
+			if line != "" {
+				fmt.Fprintf(out, "  %s\n", line)
+			}
+		}
+		return
+	default:
+		fmt.Fprintf(out, "%s is %s, not a function\n", name, value.Type())
+		return
+	}
+
+	if b, ok := env.LookupBuiltin(name); ok {
+		fmt.Fprintf(out, "%s\n  %s\n", b.Signature(), b.Doc)
+		return
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	members := 0
+	for _, b := range env.Builtins() {
+		if strings.HasPrefix(b.Name, name+".") {
+			fmt.Fprintf(w, "%s\t%s\n", b.Signature(), b.Doc)
+			members++
+		}
+	}
+	w.Flush()
+	if members == 0 {
+		fmt.Fprintf(out, "no documentation for %s\n", name)
+	}
+}
+
+// printEnv lists the session's variables, sorted by name
+func printEnv(out io.Writer, env *evaluator.Environment) {
+	bindings := env.Bindings()
+	names := make([]string, 0, len(bindings))
+	for name := range bindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(out, "%s = %s\n", name, evaluator.Pretty(bindings[name], settingsFor(env, out).pretty))
+	}
+}
+
+// setGuard shows or changes the loop guard: ":guard off", or ":guard"
+// followed by a maximum number of iterations and optionally a timeout
+func setGuard(args []string, out io.Writer, env *evaluator.Environment) {
+	switch {
+	case len(args) == 1 && args[0] == "off":
+		env.SetLoopGuard(0, 0)
+	case len(args) == 1 || len(args) == 2:
+		iterations, err := strconv.Atoi(strings.ReplaceAll(args[0], "_", ""))
+		if err != nil || iterations < 0 {
+			fmt.Fprintln(out, "usage: :guard [off | <iterations> [timeout]]")
+			return
+		}
+		_, timeout := env.LoopGuard()
+		if len(args) == 2 {
+			if timeout, err = time.ParseDuration(args[1]); err != nil || timeout < 0 {
+				fmt.Fprintln(out, "usage: :guard [off | <iterations> [timeout]]")
+				return
+			}
+		}
+		env.SetLoopGuard(iterations, timeout)
+	case len(args) != 0:
+		fmt.Fprintln(out, "usage: :guard [off | <iterations> [timeout]]")
+		return
+	}
+
+	iterations, timeout := env.LoopGuard()
+	if iterations == 0 && timeout == 0 {
+		fmt.Fprintln(out, "loop guard off")
+		return
+	}
+	limits := []string{}
+	if iterations > 0 {
+		limits = append(limits, fmt.Sprintf("%d iterations", iterations))
+	}
+	if timeout > 0 {
+		limits = append(limits, timeout.String())
+	}
+	fmt.Fprintf(out, "loops stop after %s\n", strings.Join(limits, " or "))
+}
+
+// printDiff lists the variables added, changed or removed by the last line
+func printDiff(out io.Writer, env *evaluator.Environment) {
+	changes := lastChanges[env]
+	if len(changes) == 0 {
+		fmt.Fprintln(out, "no changes")
+		return
+	}
 
-		evaluated := evaluator.Eval(program, env)
-		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
-			io.WriteString(out, "\n")
+	for _, c := range changes {
+		switch c.Kind {
+		case "added":
+			fmt.Fprintf(out, "+ %s = %s\n", c.Name, c.New)
+		case "removed":
+			fmt.Fprintf(out, "- %s = %s\n", c.Name, c.Old)
+		default:
+			fmt.Fprintf(out, "~ %s = %s (was %s)\n", c.Name, c.New, c.Old)
 		}
 	}
 }
@@ -0,0 +1,165 @@
+package repl
+
+import (
+	"fmt"
+	"gokid/diagnostics"
+	"gokid/evaluator"
+	"gokid/highlight"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// settings are the REPL options changed with :set
+type settings struct {
+	pretty evaluator.PrettyOptions
+	color  bool   // color diagnostics and results
+	page   bool   // show results longer than the terminal a screen at a time
+	height int    // lines in a screen
+	output string // the formatter of results, as evaluator.LookupFormatter names it
+}
+
+// sessionSettings holds the settings of each environment. It is only used
+// on the interpreter goroutine.
+var sessionSettings = map[*evaluator.Environment]*settings{}
+
+// settingsFor returns env's settings, starting from defaults that color and
+// page only when out is a terminal, and never color in plain mode
+func settingsFor(env *evaluator.Environment, out io.Writer) *settings {
+	if s, ok := sessionSettings[env]; ok {
+		return s
+	}
+	s := &settings{
+		pretty: evaluator.DefaultPrettyOptions,
+		color:  isTerminal(out) && !diagnostics.Plain,
+		page:   isTerminal(out),
+		height: 24,
+		output: Output,
+	}
+	s.pretty.Plain = diagnostics.Plain
+	if lines, err := strconv.Atoi(os.Getenv("LINES")); err == nil && lines > 1 {
+		s.height = lines
+	}
+	sessionSettings[env] = s
+	return s
+}
+
+// setOption shows the settings, or changes one: ":set maxDepth 3"
+func setOption(args []string, out io.Writer, env *evaluator.Environment) {
+	s := settingsFor(env, out)
+	if len(args) == 0 {
+		fmt.Fprintf(out, "maxDepth %d\nmaxItems %d\nwidth %d\nindent %d\ncolor %s\npage %s\nheight %d\noutput %s\n",
+			s.pretty.MaxDepth, s.pretty.MaxItems, s.pretty.Width, s.pretty.Indent, onOff(s.color), onOff(s.page), s.height, s.output)
+		return
+	}
+	if len(args) != 2 {
+		fmt.Fprintln(out, "usage: :set [<option> <value>]")
+		return
+	}
+
+	name, value := args[0], args[1]
+	switch name {
+	case "maxDepth", "maxItems", "width", "indent", "height":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			fmt.Fprintf(out, "%s must be a number of at least 0\n", name)
+			return
+		}
+		switch name {
+		case "maxDepth":
+			s.pretty.MaxDepth = n
+		case "maxItems":
+			s.pretty.MaxItems = n
+		case "width":
+			s.pretty.Width = n
+		case "indent":
+			s.pretty.Indent = n
+		case "height":
+			s.height = n
+		}
+	case "color", "page":
+		if value != "on" && value != "off" {
+			fmt.Fprintf(out, "%s must be on or off\n", name)
+			return
+		}
+		if name == "color" {
+			s.color = value == "on"
+		} else {
+			s.page = value == "on"
+		}
+	case "output":
+		if _, err := evaluator.LookupFormatter(value); err != nil {
+			fmt.Fprintln(out, err)
+			return
+		}
+		s.output = value
+	default:
+		fmt.Fprintf(out, "unknown option %s; options are maxDepth, maxItems, width, indent, color, page, height and output\n", name)
+	}
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// showResult writes a result as the settings say, a screen at a time when
+// it is longer than one. next reads the line typed at the "more" prompt; q
+// stops the output. Formatters other than pretty write the result as it
+// is, to be copied into other tools; errors are still shown as text.
+func showResult(out io.Writer, env *evaluator.Environment, value evaluator.Object, next func() (string, bool)) {
+	s := settingsFor(env, out)
+	if _, failed := value.(*evaluator.Error); s.output != "pretty" && !failed {
+		if format, err := evaluator.LookupFormatter(s.output); err == nil {
+			text, err := format(value)
+			if err != nil {
+				fmt.Fprintf(out, "cannot show the result as %s: %v\n", s.output, err)
+				return
+			}
+			io.WriteString(out, text)
+			io.WriteString(out, "\n")
+			return
+		}
+	}
+
+	text := evaluator.Pretty(value, s.pretty)
+	if s.color {
+		text = highlight.ANSI(text)
+	}
+
+	lines := strings.SplitAfter(text, "\n")
+	screen := s.height - 1
+	if !s.page || next == nil || screen < 1 || len(lines) <= screen {
+		io.WriteString(out, text)
+		io.WriteString(out, "\n")
+		return
+	}
+	for len(lines) > screen {
+		io.WriteString(out, strings.Join(lines[:screen], ""))
+		lines = lines[screen:]
+		if diagnostics.Plain {
+			fmt.Fprintf(out, "%d more lines. Press enter for the next screen, or q to stop.", len(lines))
+		} else {
+			fmt.Fprintf(out, "-- %d more lines; enter for the next screen, q to stop --", len(lines))
+		}
+		answer, ok := next()
+		if !ok || strings.TrimSpace(answer) == "q" {
+			io.WriteString(out, "\n")
+			return
+		}
+	}
+	io.WriteString(out, strings.Join(lines, ""))
+	io.WriteString(out, "\n")
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
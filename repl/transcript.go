@@ -0,0 +1,126 @@
+package repl
+
+import (
+	"bytes"
+	"fmt"
+	"gokid/evaluator"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// transcript records a session's lines and what they printed as Markdown
+type transcript struct {
+	filename       string
+	file           *os.File
+	output         bytes.Buffer // what the current line has printed
+	inputs         []string     // lines typed since the last that printed anything
+	stdout, stderr io.Writer    // the session's output before recording began
+}
+
+// transcripts holds the transcript each environment is recording, if any.
+// It is only used on the interpreter goroutine.
+var transcripts = map[*evaluator.Environment]*transcript{}
+
+// ansiCodes matches the color codes of highlighted output and the cursor
+// movements of :explore
+var ansiCodes = regexp.MustCompile("\x1b\\[[0-9;]*[A-Za-z]")
+
+// setTranscript starts recording the session to a Markdown file, stops
+// with ":transcript off", or tells where it is recording
+func setTranscript(args []string, out io.Writer, env *evaluator.Environment) {
+	t := transcripts[env]
+	switch {
+	case len(args) == 0 && t == nil:
+		fmt.Fprintln(out, "not recording; use :transcript <file.md> to start")
+	case len(args) == 0:
+		fmt.Fprintf(out, "recording to %s\n", t.filename)
+	case len(args) == 1 && args[0] == "off":
+		if t == nil {
+			fmt.Fprintln(out, "not recording")
+			return
+		}
+		if err := endTranscript(env); err != nil {
+			fmt.Fprintf(out, "cannot save transcript: %v\n", err)
+			return
+		}
+		fmt.Fprintf(out, "transcript saved to %s\n", t.filename)
+	case len(args) == 1:
+		if t != nil {
+			fmt.Fprintf(out, "already recording to %s; use :transcript off first\n", t.filename)
+			return
+		}
+		file, err := os.Create(args[0])
+		if err != nil {
+			fmt.Fprintf(out, "cannot start transcript: %v\n", err)
+			return
+		}
+		t = &transcript{filename: args[0], file: file}
+		t.stdout, t.stderr = env.Output()
+		env.Flush()
+		env.SetOutput(io.MultiWriter(t.stdout, &t.output), io.MultiWriter(t.stderr, &t.output))
+		transcripts[env] = t
+		fmt.Fprintf(file, "# GoKid session, %s\n", time.Now().Format("2006-01-02 15:04"))
+		fmt.Fprintf(out, "recording to %s\n", args[0])
+	default:
+		fmt.Fprintln(out, "usage: :transcript [<file.md> | off]")
+	}
+}
+
+// recordLine evaluates a line with eval, adding it and what it printed to
+// env's transcript if one is being recorded
+func recordLine(line string, out io.Writer, env *evaluator.Environment, eval func(out io.Writer)) {
+	t := transcripts[env]
+	if t == nil || strings.HasPrefix(strings.TrimSpace(line), ":transcript") {
+		eval(out)
+		return
+	}
+	// Settings made now see whether out is a terminal
+	settingsFor(env, out)
+	t.output.Reset()
+	eval(io.MultiWriter(out, &t.output))
+	env.Flush()
+	if transcripts[env] != t {
+		return
+	}
+
+	t.inputs = append(t.inputs, line)
+	printed := strings.TrimRight(ansiCodes.ReplaceAllString(t.output.String(), ""), "\n")
+	if printed != "" {
+		t.writeInputs()
+		writeBlock(t.file, "", printed)
+	}
+}
+
+// writeInputs writes the lines typed since the last output as a block
+func (t *transcript) writeInputs() {
+	if len(t.inputs) > 0 {
+		writeBlock(t.file, "javascript", strings.Join(t.inputs, "\n"))
+		t.inputs = nil
+	}
+}
+
+// endTranscript stops recording env's session, writing what is left
+func endTranscript(env *evaluator.Environment) error {
+	t := transcripts[env]
+	if t == nil {
+		return nil
+	}
+	delete(transcripts, env)
+	env.Flush()
+	env.SetOutput(t.stdout, t.stderr)
+	t.writeInputs()
+	return t.file.Close()
+}
+
+// writeBlock writes text as a fenced code block, with a fence longer than
+// any run of backquotes in it
+func writeBlock(w io.Writer, language, text string) {
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	fmt.Fprintf(w, "\n%s%s\n%s\n%s\n", fence, language, text, fence)
+}
@@ -0,0 +1,200 @@
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"gokid/lexer"
+	"gokid/tokens"
+	"io"
+)
+
+// StreamMagic starts a token stream, the compact binary form of a
+// program's tokens written by WriteStream
+const StreamMagic = "GOKIDTOK\x01"
+
+// StreamExt is the extension of files holding a token stream
+const StreamExt = ".gkt"
+
+// How a token's literal is kept: as the text it spans, as that text
+// without its first and last bytes (the quotes of a string), or written
+// out. A token with an Ident also has literalIdent set.
+const (
+	literalText = iota
+	literalQuoted
+	literalWritten
+	literalIdent = 4
+)
+
+var errCorrupt = errors.New("corrupt token stream")
+
+// IsStream reports whether data is a token stream
+func IsStream(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(StreamMagic))
+}
+
+// WriteStream writes source and its tokens as a token stream. A stream
+// holds the source too, since the parser takes the text of functions and
+// doc comments from it and errors show it.
+//
+// After the magic come the source, the table of token types used, and
+// each token as its type's index in the table, its distance from the end
+// of the token before, its length and how its literal is kept, all as
+// uvarints.
+func WriteStream(w io.Writer, source string) error {
+	l := lexer.NewLexer(source)
+	var toks []tokens.Token
+	for {
+		tok := l.NextToken()
+		toks = append(toks, tok)
+		if tok.Type == tokens.EOF {
+			break
+		}
+	}
+
+	b := bufio.NewWriter(w)
+	b.WriteString(StreamMagic)
+	writeString(b, source)
+
+	types := map[tokens.TokenType]uint64{}
+	var table []tokens.TokenType
+	for _, tok := range toks {
+		if _, ok := types[tok.Type]; !ok {
+			types[tok.Type] = uint64(len(table))
+			table = append(table, tok.Type)
+		}
+	}
+	writeUvarint(b, uint64(len(table)))
+	for _, t := range table {
+		writeString(b, string(t))
+	}
+
+	writeUvarint(b, uint64(len(toks)))
+	end := 0
+	for _, tok := range toks {
+		writeUvarint(b, types[tok.Type])
+		writeUvarint(b, uint64(tok.Offset-end))
+		writeUvarint(b, uint64(tok.End-tok.Offset))
+		text := source[tok.Offset:tok.End]
+		kind := literalWritten
+		switch {
+		case tok.Literal == text:
+			kind = literalText
+		case len(text) >= 2 && tok.Literal == text[1:len(text)-1]:
+			kind = literalQuoted
+		}
+		if tok.Ident != 0 {
+			kind |= literalIdent
+		}
+		writeUvarint(b, uint64(kind))
+		if kind&^literalIdent == literalWritten {
+			writeString(b, tok.Literal)
+		}
+		end = tok.End
+	}
+	return b.Flush()
+}
+
+// ReadStream reads a token stream, returning the source it was made from
+// and its tokens, the last of them EOF. lexer.Replay makes a lexer the
+// parser can read them from.
+func ReadStream(data []byte) (string, []tokens.Token, error) {
+	if !IsStream(data) {
+		return "", nil, errors.New("not a token stream")
+	}
+	r := bytes.NewReader(data[len(StreamMagic):])
+	source, err := readString(r)
+	if err != nil {
+		return "", nil, err
+	}
+
+	n, err := readCount(r)
+	if err != nil {
+		return "", nil, err
+	}
+	table := make([]tokens.TokenType, n)
+	for i := range table {
+		t, err := readString(r)
+		if err != nil {
+			return "", nil, err
+		}
+		table[i] = tokens.TokenType(t)
+	}
+
+	n, err = readCount(r)
+	if err != nil {
+		return "", nil, err
+	}
+	toks := make([]tokens.Token, 0, n)
+	end := 0
+	for i := 0; i < n; i++ {
+		var fields [4]uint64
+		for j := range fields {
+			if fields[j], err = binary.ReadUvarint(r); err != nil {
+				return "", nil, errCorrupt
+			}
+		}
+		typeIndex, gap, length, kind := fields[0], fields[1], fields[2], fields[3]
+		if typeIndex >= uint64(len(table)) || gap > uint64(len(source)-end) || length > uint64(len(source)-end)-gap {
+			return "", nil, errCorrupt
+		}
+
+		tok := tokens.Token{Type: table[typeIndex], Offset: end + int(gap)}
+		tok.End = tok.Offset + int(length)
+		text := source[tok.Offset:tok.End]
+		switch kind &^ literalIdent {
+		case literalText:
+			tok.Literal = text
+		case literalQuoted:
+			if len(text) < 2 {
+				return "", nil, errCorrupt
+			}
+			tok.Literal = text[1 : len(text)-1]
+		case literalWritten:
+			if tok.Literal, err = readString(r); err != nil {
+				return "", nil, err
+			}
+		default:
+			return "", nil, errCorrupt
+		}
+		if kind&literalIdent != 0 {
+			_, tok.Ident = tokens.LookupWord(tok.Literal)
+		}
+		toks = append(toks, tok)
+		end = tok.End
+	}
+	if len(toks) == 0 || toks[len(toks)-1].Type != tokens.EOF {
+		return "", nil, errCorrupt
+	}
+	return source, toks, nil
+}
+
+func writeUvarint(w *bufio.Writer, n uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	w.Write(buf[:binary.PutUvarint(buf[:], n)])
+}
+
+func writeString(w *bufio.Writer, s string) {
+	writeUvarint(w, uint64(len(s)))
+	w.WriteString(s)
+}
+
+// readCount reads a length, which can't be more than the bytes left
+func readCount(r *bytes.Reader) (int, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n > uint64(r.Len()) {
+		return 0, errCorrupt
+	}
+	return int(n), nil
+}
+
+func readString(r *bytes.Reader) (string, error) {
+	n, err := readCount(r)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, n)
+	io.ReadFull(r, buf)
+	return string(buf), nil
+}
@@ -6,11 +6,13 @@ import (
 )
 
 type Tokenizer struct {
+	input string
 	lexer *lexer.Lexer
 }
 
 func NewTokenizer(input string) *Tokenizer {
 	return &Tokenizer{
+		input: input,
 		lexer: lexer.NewLexer(input),
 	}
 }
@@ -22,3 +24,51 @@ func (t *Tokenizer) GetTokens() []tokens.Token {
 	}
 	return allTokens
 }
+
+// Piece is a token along with the whitespace and comments before it.
+// Concatenating Trivia and Text of every piece reproduces the input.
+type Piece struct {
+	Trivia string // whitespace and comments preceding the token
+	Text   string // the token as written, including string quotes
+	Token  tokens.Token
+}
+
+// GetPieces returns every token of the input with its surrounding trivia.
+// The last piece is the EOF token holding any trailing trivia, and as its
+// text any data section from the __data__ line on.
+func (t *Tokenizer) GetPieces() []Piece {
+	var pieces []Piece
+	pos := 0
+	for {
+		tok := t.lexer.NextToken()
+		start := tok.Offset
+		if start > len(t.input) {
+			start = len(t.input)
+		}
+
+		end := start + len(tok.Literal)
+		switch tok.Type {
+		case tokens.STRING:
+			end += 2
+		case tokens.ILLEGAL:
+			// Illegal tokens are single bytes of the input
+			end = start + 1
+		case tokens.EOF:
+			end = len(t.input)
+		}
+		if end > len(t.input) {
+			end = len(t.input)
+		}
+
+		pieces = append(pieces, Piece{
+			Trivia: t.input[pos:start],
+			Text:   t.input[start:end],
+			Token:  tok,
+		})
+		pos = end
+
+		if tok.Type == tokens.EOF {
+			return pieces
+		}
+	}
+}
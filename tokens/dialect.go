@@ -0,0 +1,151 @@
+package tokens
+
+import (
+	"sort"
+	"sync"
+)
+
+// A Dialect is a set of keywords: the words a program is written with,
+// mapped to the token types they stand for. A file picks its dialect with
+// a #dialect pragma, so beginners can write keywords in their language.
+// Words are letters and _, as names are. A dialect's words are its only
+// keywords; the English ones are names in it.
+type Dialect map[string]TokenType
+
+// English is the dialect programs are written in unless they say
+// otherwise. It must not be changed; With makes a dialect from it.
+var English = Dialect(keywords)
+
+var (
+	dialectsMu sync.RWMutex
+	dialects   = map[string]Dialect{"en": English}
+)
+
+// RegisterDialect adds a dialect, or replaces the one with its name
+func RegisterDialect(name string, d Dialect) {
+	dialectsMu.Lock()
+	defer dialectsMu.Unlock()
+	dialects[name] = d
+}
+
+// LookupDialect returns the dialect called name
+func LookupDialect(name string) (Dialect, bool) {
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+	d, ok := dialects[name]
+	return d, ok
+}
+
+// Dialects returns the names of the dialects, in order
+func Dialects() []string {
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+	names := make([]string, 0, len(dialects))
+	for name := range dialects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// With returns a copy of d with words added, for a dialect that differs
+// from another in a few words
+func (d Dialect) With(words Dialect) Dialect {
+	merged := make(Dialect, len(d)+len(words))
+	for word, t := range d {
+		merged[word] = t
+	}
+	for word, t := range words {
+		merged[word] = t
+	}
+	return merged
+}
+
+// Lookup returns the token type of a word in d: a keyword's, or IDENT
+func (d Dialect) Lookup(word string) TokenType {
+	if t, ok := d[word]; ok {
+		return t
+	}
+	return IDENT
+}
+
+// Word returns the word d writes a keyword's token type with, the longest
+// when there are several, such as function rather than fn
+func (d Dialect) Word(t TokenType) (string, bool) {
+	best := ""
+	for word, wt := range d {
+		if wt == t && (len(word) > len(best) || len(word) == len(best) && word < best) {
+			best = word
+		}
+	}
+	return best, best != ""
+}
+
+// Words returns d's keywords, in alphabetical order
+func (d Dialect) Words() []string {
+	words := make([]string, 0, len(d))
+	for word := range d {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
+}
+
+// Reserved reports whether name is a keyword of any dialect, so a name
+// made up by a tool is safe whatever dialect its file is in
+func Reserved(name string) bool {
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+	for _, d := range dialects {
+		if _, ok := d[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// The Spanish dialect, for #dialect es
+func init() {
+	RegisterDialect("es", Dialect{
+		"sea":       LET,
+		"constante": CONST,
+		"var":       VAR,
+		"fn":        FUNCTION,
+		"funcion":   FUNCTION,
+		"retornar":  RETURN,
+
+		"si":        IF,
+		"sino":      ELSE,
+		"mientras":  WHILE,
+		"para":      FOR,
+		"romper":    BREAK,
+		"continuar": CONTINUE,
+		"segun":     SWITCH,
+		"caso":      CASE,
+		"otro":      DEFAULT,
+
+		"verdadero": TRUE,
+		"falso":     FALSE,
+		"nulo":      NULL,
+
+		"texto":  STRING_TYPE,
+		"entero": INT_TYPE,
+		"real":   FLOAT_TYPE,
+		"logico": BOOL_TYPE,
+		"lista":  ARRAY_TYPE,
+		"objeto": OBJECT_TYPE,
+
+		"intentar":   TRY,
+		"capturar":   CATCH,
+		"lanzar":     THROW,
+		"finalmente": FINALLY,
+
+		"importar": IMPORT,
+		"exportar": EXPORT,
+		"desde":    FROM,
+		"como":     AS,
+
+		"global": GLOBAL,
+		"local":  LOCAL,
+	})
+}
@@ -0,0 +1,78 @@
+package tokens
+
+import (
+	"strings"
+	"sync"
+)
+
+// Ident is an interned identifier. The lexer interns every name it reads
+// into one table shared by all programs, so the parser and evaluator can
+// compare and hash names as small integers rather than strings. The zero
+// Ident stands for no name.
+//
+// Interned names are never removed, which is fine for the names written
+// in programs but means code generating names without end, such as eval
+// of ever-new variables, grows the table.
+type Ident uint32
+
+// identTable holds every interned name. Keywords are interned from the
+// start, so the lexer learns a word's token type and Ident in one lookup.
+var identTable = struct {
+	sync.RWMutex
+	ids   map[string]Ident
+	names []string
+	types []TokenType
+}{ids: map[string]Ident{"": 0}, names: []string{""}, types: []TokenType{ILLEGAL}}
+
+func init() {
+	for name := range keywords {
+		Intern(name)
+	}
+}
+
+// Intern returns the Ident of name, adding name to the table on first use
+func Intern(name string) Ident {
+	_, id := LookupWord(name)
+	return id
+}
+
+// LookupWord returns the token type of a word the lexer read, a keyword's
+// or IDENT, and its Ident
+func LookupWord(name string) (TokenType, Ident) {
+	identTable.RLock()
+	id, ok := identTable.ids[name]
+	var t TokenType
+	if ok {
+		t = identTable.types[id]
+	}
+	identTable.RUnlock()
+	if ok {
+		return t, id
+	}
+
+	identTable.Lock()
+	defer identTable.Unlock()
+	if id, ok := identTable.ids[name]; ok {
+		return identTable.types[id], id
+	}
+	// The name may be a slice of a large source, which the table would
+	// otherwise keep alive
+	name = strings.Clone(name)
+	id = Ident(len(identTable.names))
+	identTable.ids[name] = id
+	identTable.names = append(identTable.names, name)
+	identTable.types = append(identTable.types, LookupIdent(name))
+	return identTable.types[id], id
+}
+
+// Name returns the identifier's name, "" for the zero Ident
+func (id Ident) Name() string {
+	identTable.RLock()
+	defer identTable.RUnlock()
+	if int(id) >= len(identTable.names) {
+		return ""
+	}
+	return identTable.names[id]
+}
+
+func (id Ident) String() string { return id.Name() }
@@ -1,5 +1,7 @@
 package tokens
 
+import "sort"
+
 type TokenType string
 
 const (
@@ -8,10 +10,13 @@ const (
 	EOF     = "EOF"
 
 	// Identifiers and literals
-	IDENT  = "IDENT"
-	INT    = "INT"
-	FLOAT  = "FLOAT"
-	STRING = "STRING"
+	IDENT   = "IDENT"
+	INT     = "INT"
+	FLOAT   = "FLOAT"
+	IMAG    = "IMAG"    // imaginary number, such as 4i
+	DECIMAL = "DECIMAL" // decimal number, such as 1.23d
+	STRING  = "STRING"
+	SYMBOL  = "SYMBOL" // :name
 
 	// Operators
 	ASSIGN   = "="
@@ -46,6 +51,7 @@ const (
 	COLON     = ":"
 	COMMA     = ","
 	DOT       = "."
+	RANGE     = ".."
 	QUESTION  = "?"
 
 	// Brackets and Braces
@@ -106,16 +112,14 @@ const (
 	// Keywords - Scope
 	GLOBAL = "GLOBAL"
 	LOCAL  = "LOCAL"
-
-	// Built-in Functions
-	PRINT = "PRINT"
-	LEN   = "LEN"
-	TYPE  = "TYPE"
 )
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Offset  int   // byte offset of the token in the source
+	End     int   // byte offset just past the token
+	Ident   Ident // the interned name, for identifiers and keywords
 }
 
 var keywords = map[string]TokenType{
@@ -166,11 +170,16 @@ var keywords = map[string]TokenType{
 	// Scope
 	"global": GLOBAL,
 	"local":  LOCAL,
+}
 
-	// Built-in Functions
-	"print": PRINT,
-	"len":   LEN,
-	"type":  TYPE,
+// Keywords returns the reserved words, in alphabetical order
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
 }
 
 func LookupIdent(ident string) TokenType {